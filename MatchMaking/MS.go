@@ -3,6 +3,11 @@ package main
 // This file implements a matchmaking server.
 
 import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net"
@@ -10,8 +15,11 @@ import (
 	"os"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 /////////// Debugging Helper
@@ -30,7 +38,8 @@ func DebugPrint(level int, str string) {
 	}
 }
 
-// The program should exit if this gives error
+// The program should exit if this gives error. Only call this from main;
+// request handling should return its errors instead.
 func FatalError(e error) {
 	if e != nil {
 		fmt.Println(e)
@@ -49,32 +58,123 @@ func CheckError(err error, n int) {
 
 // Object to be sent back to the client
 type Node struct {
-	Id string // [p1 to p6]
-	Ip string // ip to send to each player
+	Id     string // [p1 to p6]
+	Ip     string // ip to send to each player
+	Name   string // display name, "" if the player didn't give one
+	Colour string // hex colour the player is drawn in, e.g. "#ff0000"
 }
 
 // Object received from the clients at the start
 type NodeJoin struct {
-	RpcIp string // The one MS has to dial at start Game
-	Ip    string // ip to send to each player
-	Log   []byte
+	RpcIp    string // The one MS has to dial at start Game
+	Ip       string // ip to send to each player
+	Player   string // name the player is rated under; "" to play unrated
+	Name     string // display name shown to other players
+	Token    string // for ReJoinQueue, the token Join gave the client
+	Practice bool   // whether to play alone if nobody else turns up
+	Log      []byte
+}
+
+// Overrides where a player starts and which way it faces
+type StartOverride struct {
+	X         int
+	Y         int
+	Direction string // "" to keep the default direction
 }
 
 type GameArgs struct {
-	NodeList []*Node // List of peer a node should talk to
+	NodeList        []*Node                  // List of peer a node should talk to
+	MaxGameDuration time.Duration            // Wall-clock cap on the game's length
+	AllowDiagonal   bool                     // Whether players may also move diagonally
+	SpawnProtection int                      // Number of ticks at the start where collisions are survived
+	Lives           int                      // Number of crashes each player survives, at least 1
+	Secret          []byte                   // Shared by the game's players to authenticate packets
+	StartOverrides  map[string]StartOverride // Player id : where it starts instead of its spawn
+	CleanStart      int                      // Players leave no trail this close to their spawn
+	BounceWalls     bool                     // Whether walls turn players rather than kill them
+	ResultAddr      string                   // Where the leader reports the result with ReportResult
+	ShrinkInterval  int                      // Ticks between the board closing in a ring; 0 never does
+	TrailStride     int                      // Players only leave a trail every this many ticks
+	AfkTicks        int                      // Ticks without turning before a player is eliminated; 0 never
+	TrailLength     int                      // Most trail cells a player has at once; 0 for no limit
+	MineInterval    int                      // Ticks between the leader placing a mine; 0 never does
+	AreaTiebreak    bool                     // Whether running out of time is won by covering the most area
+	TurnCooldown    int                      // Ticks after turning before a player can turn again; 0 for none
+	RollbackTicks   int                      // Ticks the leader can roll back to apply a late turn; 0 for none
+	Reversal        string                   // What turning back the way a player came does, "ignore" or "lethal"
+	MoveOrder       string                   // Order players move in each tick, "fixed", "rotate" or "random"
+	Assist          bool                     // Whether players about to crash dodge to a free cell next to them
+	FogRadius       int                      // Cells from their head players can see; 0 sees the whole board
+	KickAfter       int                      // Packets the leader rejects from a peer within KickWindow before kicking it; 0 never
+	KickWindow      time.Duration            // How long a rejected packet counts towards a kick
+	StartDelays     map[string]int           // Player id : ticks it stays put before it starts moving
+	PracticeTicks   int                      // Ticks the only player must survive to win a practice game; 0 if not one
+	BestOf          int                      // Games in the series this game is part of; 0 if not part of one
+	SeriesWins      map[string]int           // Player id : games of the series won so far
+	Token           string                   // The token Join gave the client, so it knows the call is from us
+	Log             []byte
+}
+
+// How a player finished a game
+type PlayerResult struct {
+	Id      string
+	Ip      string
+	Name    string
+	IsAlive bool
+	Lives   int // lives left
+	Area    int // distinct cells the player covered
+}
+
+// Outcome of a game, reported by its leader once it's over
+type GameResult struct {
+	Winner   string // id of the winner, "" for a draw
+	Reason   string // why the game ended if nobody won
+	Players  []PlayerResult
+	Duration time.Duration
+	Ticks    int
+	Secret   []byte // the game's secret, proving the result is from its players
 	Log      []byte
 }
 
 // Reply from client
 type ValReply struct {
-	Val string // value; depends on the call
-	Log []byte
+	Val   string // value; depends on the call
+	Ip    string // for Join, the ip peers will be given for the client
+	Token string // for Join, proves who the client is to ReJoinQueue
+	Log   []byte
+}
+
+// Reply to RecentMatches
+type MatchesReply struct {
+	Matches []MatchRecord // oldest first
+}
+
+// Reply to Status
+type StatusReply struct {
+	Waiting      int                    // players waiting for the next game
+	Rooms        map[int]int            // skill bucket : players waiting in its room
+	Queued       map[int][]QueuedPlayer // skill bucket : players waiting in its room
+	StartsIn     map[int]time.Duration  // skill bucket : time until its room may start
+	Playing      int                    // games being played
+	GamesStarted int                    // games started since the server started
+	Ratings      map[string]float64     // player name : rating
+}
+
+// A player waiting in a room, as reported by Status
+type QueuedPlayer struct {
+	RpcIp  string // where the server reaches the player's node
+	Player string // name the player is rated under, if any
 }
 
 // MS node
 type MsNode struct {
-	Node *Node
-	Id   int // the order of node
+	Node     *Node
+	Id       int       // the order of node
+	Player   string    // name the player is rated under
+	Token    string    // lets the client take its place back with ReJoinQueue
+	practice bool      // whether the client would rather play alone than wait
+	lostAt   time.Time // when the client stopped answering; zero while it does
+	lastChat time.Time // when the client last sent a chat line
 }
 
 type MsNodeList []*MsNode
@@ -84,20 +184,179 @@ func (ml MsNodeList) Swap(i, j int)      { ml[i], ml[j] = ml[j], ml[i] }
 func (ml MsNodeList) Len() int           { return len(ml) }
 func (ml MsNodeList) Less(i, j int) bool { return ml[i].Id < ml[j].Id }
 
+// Players waiting together for a game
+type Room struct {
+	bucket      int                    // skill bucket the room was opened for
+	connections map[string]*rpc.Client // Client's IPaddr : connection
+	nodeList    map[string]*MsNode     // map rpcIP to a node object
+	gameRoom    []*Node                // players of the game being started, in order
+	clientNum   int                    // the order of incoming clients
+	opened      time.Time              // when the first player joined
+	starting    bool                   // whether the room is being notified of a game start
+	secret      []byte                 // secret for the game being started
+	series      *Series                // series the players are playing; nil for a single game
+}
+
+func newRoom(bucket int) *Room {
+	return &Room{
+		bucket:      bucket,
+		connections: make(map[string]*rpc.Client),
+		nodeList:    make(map[string]*MsNode),
+		gameRoom:    make([]*Node, 0),
+		opened:      time.Now(),
+	}
+}
+
+// How many skill buckets away the room takes players from. It starts at its
+// own bucket and widens by one every delay it waits, so players who can't
+// find a match eventually play someone further from their rating.
+func (this *Room) reach(now time.Time, delay time.Duration) int {
+	return int(now.Sub(this.opened) / delay)
+}
+
 // main context
 type Context struct {
 	NodeLock sync.RWMutex
 
-	connections map[string]*rpc.Client // Client's IPaddr : connection
-	nodeList    map[string]*MsNode     // map rpcIP to a node object
-	gameRoom    []*Node                // the only one game room contains all existing players
-	clientNum   int                    // the order of incoming clients
+	rooms       map[int]*Room // skill bucket : room waiting for players
 	roomLimit   int
-	gameTimer   *time.Timer // timer until game start
+	bucketWidth float64 // rating points per skill bucket; 0 puts everyone in one
+
+	sessionDelay   time.Duration // how long a room waits for players before starting
+	maxGames       int           // most games played at once; 0 for no limit
+	reconnectGrace time.Duration // how long a waiting client may stop answering before it's dropped
+	chatLength     int           // longest chat line in characters; 0 turns chat off
+	chatInterval   time.Duration // least time between a client's chat lines
+
+	maxGameDuration time.Duration // passed to clients; the leader ends the game after it
+	allowDiagonal   bool          // passed to clients; enables diagonal movement
+	spawnProtection int           // passed to clients; ticks of collision immunity at start
+	lives           int           // passed to clients; crashes each player can take
+
+	startOverrides map[string]StartOverride // passed to clients; designed starting positions
+	cleanStart     int                      // passed to clients; trail-free cells around spawns
+	bounceWalls    bool                     // passed to clients; walls turn players instead
+	shrinkInterval int                      // passed to clients; ticks between the board closing in
+	trailStride    int                      // passed to clients; ticks between trail cells
+	afkTicks       int                      // passed to clients; ticks without input before elimination
+	trailLength    int                      // passed to clients; longest a trail gets
+	mineInterval   int                      // passed to clients; ticks between mines being placed
+	areaTiebreak   bool                     // passed to clients; time's up is won by area
+	turnCooldown   int                      // passed to clients; ticks between a player's turns
+	rollbackTicks  int                      // passed to clients; how late a turn the leader replays
+	reversal       string                   // passed to clients; whether reversing is ignored or lethal
+	moveOrder      string                   // passed to clients; whether players take turns moving first
+	assist         bool                     // passed to clients; last-chance dodges for players about to crash
+	fogRadius      int                      // passed to clients; how far players see, 0 for the whole board
+	kickAfter      int                      // passed to clients; rejected packets before a peer is kicked
+	kickWindow     time.Duration            // passed to clients; how long a rejected packet counts
+	startDelays    map[string]int           // passed to clients; staggered starts, as a handicap
+	practiceTicks  int                      // passed to clients; ticks to survive a practice game
+	bestOf         int                      // passed to clients; games in a series, 0 or 1 for single games
+
+	rpcAddr        string                       // passed to clients; where to report results
+	pendingResults map[string]map[string]string // game secret : player id : name, until the result is in
+	seriesRooms    map[string]*Room             // game secret : room playing it as part of a series, until the result is in
+	seriesBreaks   int                          // series between games, which keep their game's slot
+	startedArgs    map[string]*GameArgs         // client token : args its game was started with, until the result is in
+	gamesStarted   int                          // games started since the server started
+	metrics        *GameMetrics                 // how games ended and how long they took
+	ratings        *Ratings
+	matches        MatchStore // every game whose result is in
+}
+
+// Most players a room holds. Players past the last spawn would have nowhere to
+// start, whatever the room limit.
+func (this *Context) capacity() int {
+	if this.roomLimit < spawnCount {
+		return this.roomLimit
+	}
+	return spawnCount
+}
+
+// Whether as many games are being played as the server allows, so no more
+// can start until one reports its result. A series between games still counts,
+// as its next game is coming. NodeLock must be held.
+func (this *Context) busy() bool {
+	return this.maxGames > 0 && len(this.pendingResults)+this.seriesBreaks >= this.maxGames
+}
+
+// Skill bucket of a player, by their rating.
+func (this *Context) bucketOf(player string) int {
+	if this.bucketWidth <= 0 {
+		return 0
+	}
+	return int(this.ratings.rating(player) / this.bucketWidth)
+}
+
+// Find the room a player in bucket should wait in: the closest one in reach,
+// or a new one for their bucket. Returns nil if their bucket's room is full,
+// or if it would need a new room while the server is busy. NodeLock must be
+// held.
+func (this *Context) findRoom(bucket int) *Room {
+	now := time.Now()
+	var best *Room
+	bestDistance := 0
+	for _, room := range this.rooms {
+		distance := intAbs(room.bucket - bucket)
+		if room.starting || len(room.nodeList) >= this.capacity() ||
+			distance > room.reach(now, this.sessionDelay) {
+			continue
+		}
+		if best == nil || distance < bestDistance {
+			best = room
+			bestDistance = distance
+		}
+	}
+	if best != nil {
+		return best
+	}
+	if _, exists := this.rooms[bucket]; exists || this.busy() {
+		return nil
+	}
+	room := newRoom(bucket)
+	this.rooms[bucket] = room
+	return room
+}
+
+// Number of clients in the room that are answering.
+func (this *Room) present() int {
+	count := 0
+	for _, msNode := range this.nodeList {
+		if msNode.lostAt.IsZero() {
+			count++
+		}
+	}
+	return count
+}
+
+// Whether the room should start a practice game: its only client that's
+// answering asked to play alone if nobody else turned up.
+func (this *Room) practiceAlone() bool {
+	if this.present() != 1 {
+		return false
+	}
+	for _, msNode := range this.nodeList {
+		if msNode.lostAt.IsZero() {
+			return msNode.practice
+		}
+	}
+	return false
+}
+
+// Drop the clients that aren't answering, so a game doesn't start with them.
+func (this *Room) dropLost() {
+	for rpcIp, msNode := range this.nodeList {
+		if !msNode.lostAt.IsZero() {
+			localLog("Dropping", rpcIp, "which didn't reconnect before the game")
+			delete(this.nodeList, rpcIp)
+			delete(this.connections, rpcIp)
+		}
+	}
 }
 
 // Construct a game room from nodeList
-func (this *Context) makeGameRoom() {
+func (this *Room) makeGameRoom() {
 	fmt.Println("Making a Game room")
 
 	// Sort the MsNodeList based on id
@@ -116,192 +375,982 @@ func (this *Context) makeGameRoom() {
 	}
 }
 
-// Assign id to each client
-func (this *Context) assignID() {
+// Assign id and colour to each client
+func (this *Room) assignID() {
 	fmt.Println("Assigning IDs")
 	for index, client := range this.gameRoom {
 		client.Id = "p" + strconv.Itoa(index+1)
+		client.Colour = playerColours[index]
 	}
 }
 
-// Notify all cients in current session about other players in the same room
-func (this *Context) startGame() {
-	fmt.Println("Connection Number:", len(this.connections))
-	for key, msNodeVal := range this.nodeList {
-		var reply *ValReply = &ValReply{Val: ""}
-		log := logSend("Rpc Call " + RPC_START_GAME + " to " + msNodeVal.Node.Ip)
-		e := this.connections[key].Call(RPC_START_GAME,
-			&GameArgs{NodeList: this.gameRoom, Log: log}, reply)
-		if e != nil {
-			fmt.Println("Failed to start", key)
+// Lock the room and start a game with everyone in it. Players joining after
+// this wait in a new room. The game counts towards the server's limit until
+// its result is reported, or until it's clearly never coming. NodeLock must be
+// held.
+func (this *Context) beginGame(room *Room) {
+	room.starting = true
+	room.dropLost()
+	room.makeGameRoom()
+	room.assignID()
+	if this.rooms[room.bucket] == room {
+		delete(this.rooms, room.bucket)
+	}
+	if this.bestOf > 1 && len(room.gameRoom) > 1 {
+		room.series = &Series{wins: make(map[string]int)}
+	}
+	this.launchGame(room)
+}
+
+// Start a game with the players in room's gameRoom. NodeLock must be held.
+func (this *Context) launchGame(room *Room) {
+	room.secret = newGameSecret()
+	if e := validateGameArgs(this.gameArgs(room)); e != nil {
+		// A bug of ours, which clients would only choke on.
+		localLog("ERROR: not starting a game with bad args:", e)
+		for _, connection := range room.connections {
+			connection.Close()
 		}
+		return
+	}
+	players := make(map[string]string)
+	for _, msNode := range room.nodeList {
+		players[msNode.Node.Id] = msNode.Player
 	}
+	key := string(room.secret)
+	this.pendingResults[key] = players
+	if room.series != nil {
+		this.seriesRooms[key] = room
+	}
+	this.keepGameArgs(room)
+	this.gamesStarted++
+	time.AfterFunc(this.maxGameDuration+RESULT_GRACE, func() {
+		// Every player crashed or quit, so nobody is left to report.
+		this.NodeLock.Lock()
+		defer this.NodeLock.Unlock()
+		if _, ok := this.pendingResults[key]; ok {
+			localLog("Gave up waiting for a game's result")
+			delete(this.pendingResults, key)
+			delete(this.seriesRooms, key)
+			this.forgetGameArgs(key)
+			this.metrics.recordAbandoned()
+		}
+	})
+	go this.startGame(room)
+}
 
-	// Clear the game room, nodelist, and connections
-	this.gameRoom = make([]*Node, 0)
-	this.nodeList = make(map[string]*MsNode)
-	this.connections = make(map[string]*rpc.Client)
-	this.clientNum = 0
+// Generate a random token for a client to take its place back with.
+func newToken() string {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		// The client just can't reconnect.
+		localLog("Failed to generate token:", err)
+		return ""
+	}
+	return hex.EncodeToString(token)
+}
 
-	// Reset the timer
-	this.gameTimer.Reset(SESSION_DELAY)
+// Generate a random secret for a game's players to authenticate packets with.
+func newGameSecret() []byte {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		// Better to play unauthenticated than not at all.
+		localLog("Failed to generate game secret:", err)
+		return nil
+	}
+	return secret
+}
+
+// The args to start the game in room's gameRoom with, minus the Log of the
+// call. NodeLock must be held.
+func (this *Context) gameArgs(room *Room) *GameArgs {
+	args := &GameArgs{
+		NodeList:        room.gameRoom,
+		MaxGameDuration: this.maxGameDuration,
+		AllowDiagonal:   this.allowDiagonal,
+		SpawnProtection: this.spawnProtection,
+		Lives:           this.lives,
+		Secret:          room.secret,
+		StartOverrides:  this.startOverrides,
+		CleanStart:      this.cleanStart,
+		BounceWalls:     this.bounceWalls,
+		ResultAddr:      this.rpcAddr,
+		ShrinkInterval:  this.shrinkInterval,
+		TrailStride:     this.trailStride,
+		AfkTicks:        this.afkTicks,
+		TrailLength:     this.trailLength,
+		MineInterval:    this.mineInterval,
+		AreaTiebreak:    this.areaTiebreak,
+		TurnCooldown:    this.turnCooldown,
+		RollbackTicks:   this.rollbackTicks,
+		Reversal:        this.reversal,
+		MoveOrder:       this.moveOrder,
+		Assist:          this.assist,
+		FogRadius:       this.fogRadius,
+		KickAfter:       this.kickAfter,
+		KickWindow:      this.kickWindow,
+		StartDelays:     this.startDelays,
+	}
+	if len(room.gameRoom) == 1 {
+		args.PracticeTicks = this.practiceTicks
+	}
+	if room.series != nil {
+		args.BestOf = this.bestOf
+		// A copy, as the series goes on after the game.
+		args.SeriesWins = make(map[string]int, len(room.series.wins))
+		for id, wins := range room.series.wins {
+			args.SeriesWins[id] = wins
+		}
+	}
+	return args
 }
 
-// Update NodeList and Connection based on disconnected clients
-func (this *Context) checkConn() {
+// Notify all cients in the room about the other players in it. The calls are
+// made at once and without NodeLock, each giving up after RPC_START_TIMEOUT,
+// so a client that never answers holds up neither the server nor the rest of
+// the room.
+func (this *Context) startGame(room *Room) {
 	this.NodeLock.Lock()
+	fmt.Println("Connection Number:", len(room.connections))
+	game := this.gameArgs(room)
+	nodeIps := make(map[string]string, len(room.nodeList)) // rpcIp : node Ip
+	tokens := make(map[string]string, len(room.nodeList))  // rpcIp : its token
+	for key, msNodeVal := range room.nodeList {
+		nodeIps[key] = msNodeVal.Node.Ip
+		tokens[key] = msNodeVal.Token
+	}
+	connections := make(map[string]*rpc.Client, len(room.connections))
+	for key, connection := range room.connections {
+		connections[key] = connection
+	}
+	this.NodeLock.Unlock()
+
+	var redialedLock sync.Mutex
+	redialed := make(map[string]*rpc.Client)
+	var calls sync.WaitGroup
+	for key, nodeIp := range nodeIps {
+		calls.Add(1)
+		go func(key string, connection *rpc.Client, nodeIp string) {
+			defer calls.Done()
+			var reply *ValReply = &ValReply{Val: ""}
+			args := *game
+			args.Token = tokens[key]
+			args.Log = logSend("Rpc Call " + RPC_START_GAME + " to " + nodeIp)
+			e := errors.New("no connection")
+			if connection != nil {
+				e = callWithTimeout(connection, RPC_START_GAME, &args, reply)
+			}
+			if e != nil {
+				// The connection may have gone stale since the client joined,
+				// so give it a fresh one before giving up on it.
+				localLog("Redialing", key, "to start the game:", e)
+				if connection, de := dialNode(key); de == nil {
+					redialedLock.Lock()
+					redialed[key] = connection
+					redialedLock.Unlock()
+					e = callWithTimeout(connection, RPC_START_GAME, &args, reply)
+				}
+			}
+			if e != nil {
+				// It can still get the game with GetGameArgs.
+				fmt.Println("Failed to start", key)
+			}
+		}(key, connections[key], nodeIp)
+	}
+	calls.Wait()
+
+	this.NodeLock.Lock()
+	for key, connection := range redialed {
+		room.connections[key] = connection
+		connections[key] = connection
+	}
+	this.NodeLock.Unlock()
+	for _, connection := range connections {
+		connection.Close()
+	}
+}
+
+// Call serviceMethod on a client's connection, giving up after
+// RPC_START_TIMEOUT. The connection is closed if the client doesn't answer in
+// time, as the call would otherwise stay pending on it.
+func callWithTimeout(connection *rpc.Client, serviceMethod string, args interface{}, reply interface{}) error {
+	timer := time.NewTimer(RPC_START_TIMEOUT)
+	defer timer.Stop()
+	call := connection.Go(serviceMethod, args, reply, make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+		return call.Error
+	case <-timer.C:
+		connection.Close()
+		return fmt.Errorf("%s timed out after %v", serviceMethod, RPC_START_TIMEOUT)
+	}
+}
+
+// Update NodeList and Connection of a room based on disconnected clients.
+// Clients that don't answer are dropped once they've been gone the reconnect
+// grace. Empty rooms are closed.
+func (this *Context) checkConn(room *Room) {
+	this.NodeLock.Lock()
+	now := time.Now()
 
 	// client in the connections -> no need to dial, just call
 	// client NOT in the connections -> dial first and call
-	for ClientIp, _ := range this.nodeList {
-		_, exist := this.connections[ClientIp]
+	for ClientIp, msNode := range room.nodeList {
+		_, exist := room.connections[ClientIp]
 		if exist {
 			var reply *ValReply = &ValReply{Val: ""}
 			log := logSend("Rpc Call " + RpcMessage)
-			e := this.connections[ClientIp].Call(RpcMessage, &GameArgs{NodeList: this.gameRoom, Log: log}, reply)
+			e := room.connections[ClientIp].Call(RpcMessage, &GameArgs{NodeList: room.gameRoom, Log: log}, reply)
 			if e != nil {
 				fmt.Println(e)
-				fmt.Println("Deleting disconnected node ", ClientIp)
-				delete(this.nodeList, ClientIp)
-				delete(this.connections, ClientIp)
+				this.loseClient(room, ClientIp, now)
 				continue
 			} else {
 				// Update connection for each client
 				fmt.Println("client: ", ClientIp, " is good.")
+				msNode.lostAt = time.Time{}
 			}
 		} else {
-			c, e := rpc.Dial("tcp", ClientIp)
+			c, e := dialNode(ClientIp)
 			if e != nil {
 				fmt.Println(e)
-				fmt.Println("Deleting disconnected node ", ClientIp)
-				delete(this.nodeList, ClientIp)
+				this.loseClient(room, ClientIp, now)
 				continue
 			} else {
 				// Update connection for each client
 				fmt.Println("client: ", ClientIp, " is good.")
-				this.connections[ClientIp] = c
+				room.connections[ClientIp] = c
+				msNode.lostAt = time.Time{}
 			}
 		}
 	}
+	if len(room.nodeList) == 0 && !room.starting && this.rooms[room.bucket] == room {
+		delete(this.rooms, room.bucket)
+	}
 	this.NodeLock.Unlock()
 }
 
-// RPC join called by a client
+// Note that a client in room didn't answer at now, dropping it if it has been
+// gone the reconnect grace. NodeLock must be held.
+func (this *Context) loseClient(room *Room, rpcIp string, now time.Time) {
+	if connection, ok := room.connections[rpcIp]; ok {
+		connection.Close()
+		delete(room.connections, rpcIp)
+	}
+	msNode := room.nodeList[rpcIp]
+	if msNode.lostAt.IsZero() {
+		msNode.lostAt = now
+	}
+	if now.Sub(msNode.lostAt) < this.reconnectGrace {
+		localLog("Waiting for", rpcIp, "to reconnect")
+		return
+	}
+	fmt.Println("Deleting disconnected node ", rpcIp)
+	delete(room.nodeList, rpcIp)
+}
+
+// Dial a client's rpc server, retrying a few times in case it's only just
+// starting to listen. Each attempt gives up after RPC_DIAL_TIMEOUT.
+func dialNode(addr string) (*rpc.Client, error) {
+	var e error
+	for attempt := 1; attempt <= RPC_DIAL_ATTEMPTS; attempt++ {
+		var connection net.Conn
+		connection, e = net.DialTimeout("tcp", addr, RPC_DIAL_TIMEOUT)
+		if e == nil {
+			return rpc.NewClient(connection), nil
+		}
+		localLog("Dial attempt", attempt, "to", addr, "failed:", e)
+		if attempt < RPC_DIAL_ATTEMPTS {
+			time.Sleep(RPC_DIAL_BACKOFF)
+		}
+	}
+	return nil, e
+}
+
+// RPC join called by a client. reply.Val is set to one of the JOIN_* statuses
+// so the client knows whether it was queued.
 func (this *Context) Join(nodeJoin *NodeJoin, reply *ValReply) error {
 	logReceive("AD: new node: IP: "+nodeJoin.Ip+" Log: ", nodeJoin.Log)
-	AddNode(this, nodeJoin)
-	localLog("New node: ", nodeJoin.Ip)
-	this.checkConn() // Update NodeList and Connections
-
-	localLog("Join:", len(this.nodeList), "players")
+	if !validName(nodeJoin.Name) || !validName(nodeJoin.Player) {
+		localLog("Rejected node: ", nodeJoin.Ip, JOIN_REJECTED_NAME)
+		reply.Val = JOIN_REJECTED_NAME
+		return nil
+	}
+	var room *Room
+	nodeJoin.Token = newToken()
+	reply.Val, room = AddNode(this, nodeJoin)
+	if reply.Val != JOIN_QUEUED {
+		localLog("Rejected node: ", nodeJoin.Ip, reply.Val)
+		return nil
+	}
+	localLog("New node: ", nodeJoin.Ip, "in room", room.bucket)
+	reply.Token = nodeJoin.Token
+	this.checkConn(room) // Update NodeList and Connections
 
 	// Check if the room is full
-	if len(this.nodeList) >= this.roomLimit {
-		this.NodeLock.Lock()
+	this.NodeLock.Lock()
+	localLog("Join:", len(room.nodeList), "players")
+	if len(room.nodeList) >= this.capacity() && !room.starting && !this.busy() {
 		localLog("Join: Starting Game")
-		this.makeGameRoom()
-		this.assignID()
-		go this.startGame()
+		this.beginGame(room)
 		this.NodeLock.Unlock()
 	} else {
-		localLog("Join:", len(this.nodeList), "players waiting")
+		this.NodeLock.Unlock()
+		localLog("Join:", len(room.nodeList), "players waiting")
+	}
+	return nil
+}
+
+// RPC called by a client that lost its connection while waiting, to take its
+// place in its room back with the token Join gave it. reply.Val is JOIN_QUEUED
+// if it did, JOIN_REJECTED_IN_PROGRESS if its game started without it, so it
+// should ask for it with GetGameArgs, or JOIN_UNKNOWN_TOKEN if its place is
+// gone and it should Join again.
+func (this *Context) ReJoinQueue(nodeJoin *NodeJoin, reply *ValReply) error {
+	logReceive("RJ: node rejoining: IP: "+nodeJoin.Ip+" Log: ", nodeJoin.Log)
+	this.NodeLock.Lock()
+	defer this.NodeLock.Unlock()
+	reply.Val = JOIN_UNKNOWN_TOKEN
+	if _, ok := this.startedArgs[nodeJoin.Token]; ok && nodeJoin.Token != "" {
+		reply.Val = JOIN_REJECTED_IN_PROGRESS
+	}
+	room, rpcIp, msNode := this.queuedByToken(nodeJoin.Token)
+	if room == nil {
+		localLog("Rejected rejoin: ", nodeJoin.Ip, reply.Val)
+		return nil
 	}
+	// Its addresses may have changed, and its old connection is dead.
+	if connection, ok := room.connections[rpcIp]; ok {
+		connection.Close()
+		delete(room.connections, rpcIp)
+	}
+	delete(room.nodeList, rpcIp)
+	msNode.Node.Ip = nodeJoin.Ip
+	msNode.lostAt = time.Time{}
+	room.nodeList[nodeJoin.RpcIp] = msNode
+	localLog("Rejoined node: ", nodeJoin.Ip, "in room", room.bucket)
+	reply.Val = JOIN_QUEUED
+	reply.Ip = nodeJoin.Ip
+	reply.Token = msNode.Token
 	return nil
 }
 
-// Perform certain operation every SESSION_DELAY
+// Find the client Join gave token to among those waiting in rooms. Returns its
+// room, the address to dial it at and its node, or a nil room if no waiting
+// client has the token. NodeLock must be held.
+func (this *Context) queuedByToken(token string) (*Room, string, *MsNode) {
+	if token == "" {
+		return nil, "", nil
+	}
+	for _, room := range this.rooms {
+		for rpcIp, msNode := range room.nodeList {
+			if msNode.Token == token {
+				return room, rpcIp, msNode
+			}
+		}
+	}
+	return nil, "", nil
+}
+
+// Every ROOM_CHECK_INTERVAL, start games in rooms that have waited at least
+// the session delay, and merge rooms that are still too empty with ones in
+// reach. With a reconnect grace, the clients in other rooms are checked on
+// too, so ones that drop out have the countdown to come back.
 func endSession(this *Context) {
 	defer waitGroup.Done()
-	for _ = range this.gameTimer.C {
-		this.checkConn() // Update NodeList and Connections
+	for _ = range time.Tick(ROOM_CHECK_INTERVAL) {
+		now := time.Now()
+		this.NodeLock.RLock()
+		due := make([]*Room, 0)
+		waiting := make([]*Room, 0)
+		for _, room := range this.rooms {
+			if room.starting {
+				continue
+			} else if now.Sub(room.opened) >= this.sessionDelay {
+				due = append(due, room)
+			} else if this.reconnectGrace > 0 {
+				waiting = append(waiting, room)
+			}
+		}
+		this.NodeLock.RUnlock()
+
+		for _, room := range waiting {
+			this.checkConn(room)
+		}
+
+		for _, room := range due {
+			this.checkConn(room) // Update NodeList and Connections
 
-		// At are at least 2 players in the room
-		if len(this.nodeList) >= leastPlayers {
+			// At are at least 2 players in the room
 			this.NodeLock.Lock()
-			localLog("ES: Starting Game")
-			this.makeGameRoom()
-			this.assignID()
-			go this.startGame()
-			log.Println("ES: Done Start Game")
-			this.NodeLock.Unlock()
-		} else {
-			this.gameTimer.Reset(SESSION_DELAY)
-			localLog("ES:", len(this.nodeList), "players waiting")
+			if room.starting || this.rooms[room.bucket] != room {
+				// Already started, merged, or closed.
+				this.NodeLock.Unlock()
+			} else if this.busy() {
+				// Keep waiting; the room starts once a game finishes.
+				this.NodeLock.Unlock()
+			} else if room.present() >= leastPlayers {
+				localLog("ES: Starting Game")
+				this.beginGame(room)
+				log.Println("ES: Done Start Game")
+				this.NodeLock.Unlock()
+			} else if !this.mergeRoom(room, now) && room.practiceAlone() {
+				// Nobody in reach to play with, so practice.
+				localLog("ES: Starting practice game")
+				this.beginGame(room)
+				this.NodeLock.Unlock()
+			} else {
+				this.NodeLock.Unlock()
+				localLog("ES:", len(room.nodeList), "players waiting")
+			}
 		}
 	}
 }
 
+// Move the players of a room into the closest other room in its reach, if
+// they fit. Returns whether it did. NodeLock must be held.
+func (this *Context) mergeRoom(room *Room, now time.Time) bool {
+	var best *Room
+	bestDistance := 0
+	for _, other := range this.rooms {
+		distance := intAbs(other.bucket - room.bucket)
+		if other == room || other.starting ||
+			distance > room.reach(now, this.sessionDelay) ||
+			len(other.nodeList)+len(room.nodeList) > this.capacity() {
+			continue
+		}
+		if best == nil || distance < bestDistance {
+			best = other
+			bestDistance = distance
+		}
+	}
+	if best == nil {
+		return false
+	}
+
+	localLog("ES: Merging room", room.bucket, "into room", best.bucket)
+	for rpcIp, msNode := range room.nodeList {
+		msNode.Id = best.clientNum
+		best.clientNum++
+		best.nodeList[rpcIp] = msNode
+		if connection, ok := room.connections[rpcIp]; ok {
+			best.connections[rpcIp] = connection
+		}
+	}
+	// The merged room has waited as long as either did.
+	if room.opened.Before(best.opened) {
+		best.opened = room.opened
+	}
+	delete(this.rooms, room.bucket)
+	return true
+}
+
+func intAbs(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
 /////////// Helper methods
 
-// this is called when a node joins, it handles adding the node to lists
-func AddNode(ctx *Context, nodeJoin *NodeJoin) {
+// Parse start overrides written like "p1:1,1:R;p2:8,1", i.e. a player id, its
+// starting x,y and optionally its direction, separated by semicolons.
+func parseStartOverrides(str string) (map[string]StartOverride, error) {
+	overrides := make(map[string]StartOverride)
+	if str == "" {
+		return overrides, nil
+	}
+	for _, entry := range strings.Split(str, ";") {
+		parts := strings.Split(entry, ":")
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("bad start override %q", entry)
+		}
+		coords := strings.Split(parts[1], ",")
+		if len(coords) != 2 {
+			return nil, fmt.Errorf("bad start position in %q", entry)
+		}
+		x, e := strconv.Atoi(coords[0])
+		if e != nil {
+			return nil, fmt.Errorf("bad start x in %q: %v", entry, e)
+		}
+		y, e := strconv.Atoi(coords[1])
+		if e != nil {
+			return nil, fmt.Errorf("bad start y in %q: %v", entry, e)
+		}
+		override := StartOverride{X: x, Y: y}
+		if len(parts) == 3 {
+			override.Direction = parts[2]
+		}
+		overrides[parts[0]] = override
+	}
+	return overrides, nil
+}
+
+// Parse start delays of the form "p1:3;p2:1", i.e. players p1 and p2 stay
+// put for the first 3 and 1 ticks respectively.
+func parseStartDelays(str string) (map[string]int, error) {
+	delays := make(map[string]int)
+	if str == "" {
+		return delays, nil
+	}
+	for _, entry := range strings.Split(str, ";") {
+		parts := strings.Split(entry, ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("bad start delay %q", entry)
+		}
+		ticks, e := strconv.Atoi(parts[1])
+		if e != nil || ticks < 0 {
+			return nil, fmt.Errorf("bad ticks in start delay %q", entry)
+		}
+		delays[parts[0]] = ticks
+	}
+	return delays, nil
+}
+
+// RPC called by a game's leader once the game is over.
+func (this *Context) ReportResult(result *GameResult, reply *ValReply) error {
+	logReceive("Game result: winner "+result.Winner, result.Log)
+	this.NodeLock.Lock()
+	defer this.NodeLock.Unlock()
+
+	// Only take one result per game, and only from its players.
+	key := string(result.Secret)
+	players, ok := this.pendingResults[key]
+	if !ok {
+		localLog("Rejected result for unknown game, winner:", result.Winner)
+		return errors.New("no game is waiting for this result")
+	}
+	delete(this.pendingResults, key)
+	this.forgetGameArgs(key)
+
+	localLog("Game over after", result.Duration, "and", result.Ticks, "ticks, winner:",
+		result.Winner, "reason:", result.Reason)
+	this.metrics.recordResult(result)
+	for _, player := range result.Players {
+		localLog("Result:", player.Id, player.Name, player.Ip, "alive:", player.IsAlive,
+			"lives:", player.Lives, "area:", player.Area)
+	}
+
+	names := make([]string, 0, len(players))
+	for _, name := range players {
+		names = append(names, name)
+	}
+	if e := this.ratings.update(names, players[result.Winner]); e != nil {
+		// The result still counts, it just won't survive a restart.
+		localLog("Failed to save ratings:", e)
+	}
+
+	record := &MatchRecord{
+		Time:       time.Now(),
+		Winner:     result.Winner,
+		WinnerName: players[result.Winner],
+		Reason:     result.Reason,
+		Duration:   result.Duration,
+		Ticks:      result.Ticks,
+		Players:    result.Players,
+		Ratings:    make(map[string]float64),
+	}
+	for _, name := range names {
+		if name != "" {
+			record.Ratings[name] = this.ratings.rating(name)
+		}
+	}
+	if e := this.matches.add(record); e != nil {
+		// Like the ratings, the result still counts.
+		localLog("Failed to save game to the history:", e)
+	}
+	if room, ok := this.seriesRooms[key]; ok {
+		delete(this.seriesRooms, key)
+		this.continueSeries(room, result.Winner, players)
+	}
+	reply.Val = "ok"
+	return nil
+}
+
+// RPC returning the last *n games whose result is in, oldest first, or every
+// game if *n is negative.
+func (this *Context) RecentMatches(n *int, reply *MatchesReply) error {
+	matches, e := this.matches.recent(*n)
+	if e != nil {
+		return e
+	}
+	reply.Matches = matches
+	return nil
+}
+
+// RPC reporting who is waiting in which room, how long until each room may
+// start, how many games there have been and everyone's rating.
+func (this *Context) Status(args *int, reply *StatusReply) error {
+	now := time.Now()
+	this.NodeLock.RLock()
+	reply.Rooms = make(map[int]int)
+	reply.Queued = make(map[int][]QueuedPlayer)
+	reply.StartsIn = make(map[int]time.Duration)
+	for bucket, room := range this.rooms {
+		reply.Rooms[bucket] = len(room.nodeList)
+		reply.Waiting += len(room.nodeList)
+		queued := make([]QueuedPlayer, 0, len(room.nodeList))
+		for rpcIp, msNode := range room.nodeList {
+			queued = append(queued, QueuedPlayer{RpcIp: rpcIp, Player: msNode.Player})
+		}
+		sort.Slice(queued, func(i, j int) bool { return queued[i].RpcIp < queued[j].RpcIp })
+		reply.Queued[bucket] = queued
+		startsIn := this.sessionDelay - now.Sub(room.opened)
+		if startsIn < 0 {
+			// Due, but waiting for players or for a game to finish.
+			startsIn = 0
+		}
+		reply.StartsIn[bucket] = startsIn
+	}
+	reply.Playing = len(this.pendingResults)
+	reply.GamesStarted = this.gamesStarted
+	this.NodeLock.RUnlock()
+	reply.Ratings = this.ratings.snapshot()
+	return nil
+}
+
+// The context as seen by a single client connection, so RPCs know where the
+// client is connecting from.
+type ClientConn struct {
+	*Context
+	remoteAddr net.Addr // where the client's rpc connection comes from
+}
+
+// Join the client, filling in the host of any address it left blank (e.g.
+// ":9999") with the host its connection comes from. Behind NAT, that's the one
+// peers can actually reach.
+func (this *ClientConn) Join(nodeJoin *NodeJoin, reply *ValReply) error {
+	nodeJoin.Ip = withObservedHost(nodeJoin.Ip, this.remoteAddr)
+	nodeJoin.RpcIp = withObservedHost(nodeJoin.RpcIp, this.remoteAddr)
+	reply.Ip = nodeJoin.Ip
+	return this.Context.Join(nodeJoin, reply)
+}
+
+// Rejoin the client, filling in its addresses like Join does.
+func (this *ClientConn) ReJoinQueue(nodeJoin *NodeJoin, reply *ValReply) error {
+	nodeJoin.Ip = withObservedHost(nodeJoin.Ip, this.remoteAddr)
+	nodeJoin.RpcIp = withObservedHost(nodeJoin.RpcIp, this.remoteAddr)
+	return this.Context.ReJoinQueue(nodeJoin, reply)
+}
+
+// Replace a missing or unspecified host in addr with the host of observed.
+// addr is returned as is if it already names a host.
+func withObservedHost(addr string, observed net.Addr) string {
+	host, port, e := net.SplitHostPort(addr)
+	if e != nil {
+		return addr
+	}
+	if ip := net.ParseIP(host); host != "" && (ip == nil || !ip.IsUnspecified()) {
+		return addr
+	}
+	observedHost, _, e := net.SplitHostPort(observed.String())
+	if e != nil {
+		return addr
+	}
+	return net.JoinHostPort(observedHost, port)
+}
+
+// Whether name is fit to show other players: at most MAX_NAME_LENGTH
+// characters, all of them printable. "" is fine, it means no name was given.
+func validName(name string) bool {
+	if utf8.RuneCountInString(name) > MAX_NAME_LENGTH {
+		return false
+	}
+	for _, r := range name {
+		if !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// this is called when a node joins, it handles adding the node to the room for
+// its skill bucket if there's space. Returns one of the JOIN_* statuses, and
+// the room if it was queued.
+func AddNode(ctx *Context, nodeJoin *NodeJoin) (string, *Room) {
+	bucket := ctx.bucketOf(nodeJoin.Player)
 	ctx.NodeLock.Lock()
+	defer ctx.NodeLock.Unlock()
+	room := ctx.findRoom(bucket)
+	if room == nil && ctx.busy() {
+		return JOIN_SERVER_BUSY, nil
+	} else if room == nil {
+		return JOIN_REJECTED_FULL, nil
+	}
+
 	fmt.Println("AD: new node:", nodeJoin)
 	// Add this client to the gameRoom & NodeList
-	node := &Node{Ip: nodeJoin.Ip}
-	msn := &MsNode{Node: node, Id: ctx.clientNum}
-	ctx.clientNum++
-	ctx.nodeList[nodeJoin.RpcIp] = msn
+	node := &Node{Ip: nodeJoin.Ip, Name: nodeJoin.Name}
+	msn := &MsNode{Node: node, Id: room.clientNum, Player: nodeJoin.Player,
+		Token: nodeJoin.Token, practice: nodeJoin.Practice}
+	room.clientNum++
+	room.nodeList[nodeJoin.RpcIp] = msn
 
-	log.Println("AD: NodeList:", ctx.nodeList, ". Numb:", len(ctx.nodeList), "players.")
-	ctx.NodeLock.Unlock()
+	log.Println("AD: NodeList:", room.nodeList, ". Numb:", len(room.nodeList), "players.")
+	return JOIN_QUEUED, room
 }
 
-// Listen and serve request from client
-func listenToClient(ctx *Context, rpcAddr string) {
-	defer waitGroup.Done()
+// Listen and serve request from client, over TLS unless tlsConfig is nil.
+// Only errors that prevent the server from serving clients at all are
+// returned; a bad connection is logged and skipped.
+func listenToClient(ctx *Context, rpcAddr string, tlsConfig *tls.Config) error {
+	// Whether the service registers depends only on ClientConn's methods, so
+	// if it can't be, no connection could be served. Find out before
+	// accepting any.
+	e := rpc.NewServer().RegisterName("Context", &ClientConn{Context: ctx})
+	if e != nil {
+		return e
+	}
+
+	listener, e := net.Listen("tcp", rpcAddr)
+	if e != nil {
+		return e
+	}
+	if tlsConfig != nil {
+		// Clients that don't speak TLS fail the handshake on their first call.
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+	fmt.Println("LISTENING")
+
 	for {
-		rpc.Register(ctx)
-		listener, e := net.Listen("tcp", rpcAddr)
-		FatalError(e)
-		fmt.Println("LISTENING")
-
-		for {
-			connection, e := listener.Accept()
-			FatalError(e)
-			defer connection.Close()
-
-			// Handle one connection at a time
-			go rpc.ServeConn(connection)
+		connection, e := listener.Accept()
+		if e != nil {
+			localLog("Failed to accept connection:", e)
+			time.Sleep(time.Millisecond * 100)
+			continue
+		}
+
+		// Each connection gets its own server so its RPCs can see who's calling.
+		server := rpc.NewServer()
+		e = server.RegisterName("Context", &ClientConn{Context: ctx,
+			remoteAddr: connection.RemoteAddr()})
+		if e != nil {
+			localLog("Failed to serve connection:", e)
+			connection.Close()
+			continue
 		}
-		time.Sleep(time.Millisecond * 100)
+		go server.ServeConn(connection)
 	}
 }
 
 // Global variables
 var waitGroup sync.WaitGroup // Wait group
 const SESSION_DELAY time.Duration = 30 * time.Second
+const ROOM_CHECK_INTERVAL time.Duration = time.Second
+const RESULT_GRACE time.Duration = time.Minute // How long past the max game duration a result can take
 const RPC_START_GAME string = "NodeService.StartGame"
+const RPC_DIAL_ATTEMPTS int = 3
+const RPC_DIAL_TIMEOUT time.Duration = time.Second
+const RPC_DIAL_BACKOFF time.Duration = 250 * time.Millisecond
+const RPC_START_TIMEOUT time.Duration = 5 * time.Second // How long a client has to answer StartGame
 const RpcMessage string = "NodeService.Message"
 const leastPlayers int = 2
+const spawnCount int = 6 // Spawns clients have (p1 to p6), so the most players a game can have
+const boardSize int = 10 // Cells along each side of clients' boards
+
+// Colours players are drawn in, p1 to p6. The UI and replay exporter fall back
+// to these too.
+var playerColours = [spawnCount]string{
+	"#ff0000", // red
+	"#008000", // green
+	"#0000ff", // blue
+	"#ffa500", // orange
+	"#a52a2a", // brown
+	"#000000", // black
+}
+
+// Join statuses returned to clients.
+const JOIN_QUEUED string = "queued"
+const JOIN_REJECTED_FULL string = "rejected_full"
+const JOIN_SERVER_BUSY string = "server_busy"
+const JOIN_UNKNOWN_TOKEN string = "unknown_token"               // for ReJoinQueue
+const JOIN_REJECTED_IN_PROGRESS string = "rejected_in_progress" // for ReJoinQueue, the client's game started without it
+const JOIN_REJECTED_NAME string = "rejected_name"               // the display or rated name is too long or unprintable
+
+const MAX_NAME_LENGTH int = 20 // Characters allowed in a display or rated name.
 
 func main() {
-	// go run MS.go :4421
-	if len(os.Args) != 2 {
+	// go run MS.go [flags] :4421
+	maxGameDuration := flag.Duration("max-game-duration", 10*time.Minute,
+		"wall-clock time after which a game is ended as a draw")
+	allowDiagonal := flag.Bool("allow-diagonal", false,
+		"allow players to move diagonally")
+	spawnProtection := flag.Int("spawn-protection", 0,
+		"number of ticks at the start of a game where collisions are survived")
+	lives := flag.Int("lives", 1,
+		"number of crashes a player can take before being eliminated")
+	startOverrides := flag.String("start-overrides", "",
+		"where players start instead of their spawns, e.g. \"p1:1,1:R;p2:8,1:L\"")
+	cleanStart := flag.Int("clean-start", 0,
+		"number of cells from their spawn players travel before leaving a trail")
+	bounceWalls := flag.Bool("bounce-walls", false,
+		"turn players away from walls instead of killing them; trails stay lethal")
+	shrinkInterval := flag.Int("shrink-interval", 0,
+		"sudden death: ticks between the board's outer ring turning into walls; 0 to disable")
+	trailStride := flag.Int("trail-stride", 1,
+		"players only leave a trail every this many ticks, leaving gaps; 1 for solid trails")
+	afkTicks := flag.Int("afk-ticks", 0,
+		"eliminate players who don't turn for this many ticks; 0 to disable")
+	trailLength := flag.Int("trail-length", 0,
+		"snake mode: the tail of a trail clears once it's this many cells long; 0 for endless trails")
+	mineInterval := flag.Int("mine-interval", 0,
+		"ticks between a mine being placed at a random empty cell; 0 to disable")
+	areaTiebreak := flag.Bool("area-tiebreak", false,
+		"when a game runs out of time, the player left alive who covered the most cells wins instead of a draw")
+	turnCooldown := flag.Int("turn-cooldown", 0,
+		"ticks after turning before a player can turn again; turns meanwhile wait; 0 for none")
+	rollbackTicks := flag.Int("rollback-ticks", 0,
+		"ticks the leader keeps snapshots of, to replay turns that arrive up to that late; 0 applies them late")
+	reversal := flag.String("reversal", "ignore",
+		"what turning back the way a player came does: \"ignore\" discards the turn, \"lethal\" kills them")
+	moveOrder := flag.String("move-order", "fixed",
+		"order players move in each tick: fixed, rotate to start one player later each tick, or random")
+	assist := flag.Bool("assist", false,
+		"turn players about to crash onto a free cell next to them, if there is one")
+	fogRadius := flag.Int("fog-radius", 0,
+		"fog of war: players only see cells this many cells from their head until they die; 0 to see everything")
+	kickAfter := flag.Int("kick-after", 0,
+		"packets the leader rejects from a peer within -kick-window before kicking it from the game; 0 never kicks")
+	kickWindow := flag.Duration("kick-window", 10*time.Second,
+		"how long a rejected packet counts towards -kick-after")
+	startDelays := flag.String("start-delays", "",
+		"ticks players stay put at the start, e.g. \"p1:3;p2:1\"; everyone starts at once if unset")
+	practiceTicks := flag.Int("practice-ticks", 60,
+		"ticks a player practicing alone must survive to win")
+	bestOf := flag.Int("best-of", 0,
+		"games in a series the same players play, won by whoever wins most of them; 0 or 1 for single games")
+	ratingsPath := flag.String("ratings", "",
+		"file player ratings are kept in across restarts; in memory only if unset")
+	historyPath := flag.String("history", "",
+		"file of JSON lines the results of games are appended to; in memory only if unset")
+	bucketWidth := flag.Float64("bucket-width", 0,
+		"rating points per skill bucket players are matched within; 0 to match everyone")
+	sessionDelay := flag.Duration("session-delay", SESSION_DELAY,
+		"how long a room waits for more players before starting its game")
+	maxGames := flag.Int("max-concurrent-games", 0,
+		"most games played at once; players wait or are turned away past it, 0 for no limit")
+	reconnectGrace := flag.Duration("reconnect-grace", 0,
+		"how long a waiting client may stop answering and still rejoin its room; 0 drops it at once")
+	tlsCert := flag.String("tls-cert", "",
+		"PEM certificate to serve clients over TLS with; plaintext if unset")
+	tlsKey := flag.String("tls-key", "",
+		"PEM private key for -tls-cert")
+	tlsCA := flag.String("tls-ca", "",
+		"PEM CA certificates client certificates must be signed by; clients needn't present one if unset")
+	chatLength := flag.Int("chat-length", 200,
+		"longest line players waiting in a room may chat, in characters; 0 turns chat off")
+	chatInterval := flag.Duration("chat-interval", time.Second,
+		"least time between a player's chat lines")
+	adminAddr := flag.String("admin", "",
+		"ip:port to serve an admin page showing rooms and games at; none if unset")
+	flag.Parse()
+	if flag.NArg() != 1 {
 		fmt.Println("Not enough arguments")
 		os.Exit(-1)
 	}
 
+	if *reversal != "ignore" && *reversal != "lethal" {
+		fmt.Println("-reversal must be ignore or lethal")
+		os.Exit(-1)
+	}
+	if *moveOrder != "fixed" && *moveOrder != "rotate" && *moveOrder != "random" {
+		fmt.Println("-move-order must be fixed, rotate or random")
+		os.Exit(-1)
+	}
+	if *fogRadius < 0 {
+		fmt.Println("-fog-radius can't be negative")
+		os.Exit(-1)
+	}
+	if *kickAfter < 0 || *kickWindow <= 0 {
+		fmt.Println("-kick-after can't be negative and -kick-window must be positive")
+		os.Exit(-1)
+	}
+	if *practiceTicks < 1 {
+		fmt.Println("-practice-ticks must be at least 1")
+		os.Exit(-1)
+	}
+	if *bestOf < 0 {
+		fmt.Println("-best-of can't be negative")
+		os.Exit(-1)
+	}
+	if *chatLength < 0 {
+		fmt.Println("-chat-length can't be negative")
+		os.Exit(-1)
+	}
+
+	overrides, e := parseStartOverrides(*startOverrides)
+	FatalError(e)
+	delays, e := parseStartDelays(*startDelays)
+	FatalError(e)
+	ratings, e := loadRatings(*ratingsPath)
+	FatalError(e)
+	tlsConfig, e := serverTLSConfig(*tlsCert, *tlsKey, *tlsCA)
+	FatalError(e)
+
 	// setup the kv service
 	context := &Context{
-		connections: make(map[string]*rpc.Client),
-		nodeList:    make(map[string]*MsNode),
-		clientNum:   0,
-		roomLimit:   6,
-		gameRoom:    make([]*Node, 0),
-		gameTimer:   time.NewTimer(SESSION_DELAY),
+		rooms:           make(map[int]*Room),
+		roomLimit:       6,
+		bucketWidth:     *bucketWidth,
+		sessionDelay:    *sessionDelay,
+		maxGames:        *maxGames,
+		reconnectGrace:  *reconnectGrace,
+		chatLength:      *chatLength,
+		chatInterval:    *chatInterval,
+		maxGameDuration: *maxGameDuration,
+		allowDiagonal:   *allowDiagonal,
+		spawnProtection: *spawnProtection,
+		lives:           *lives,
+		startOverrides:  overrides,
+		cleanStart:      *cleanStart,
+		bounceWalls:     *bounceWalls,
+		shrinkInterval:  *shrinkInterval,
+		trailStride:     *trailStride,
+		afkTicks:        *afkTicks,
+		trailLength:     *trailLength,
+		mineInterval:    *mineInterval,
+		areaTiebreak:    *areaTiebreak,
+		turnCooldown:    *turnCooldown,
+		rollbackTicks:   *rollbackTicks,
+		reversal:        *reversal,
+		moveOrder:       *moveOrder,
+		assist:          *assist,
+		fogRadius:       *fogRadius,
+		kickAfter:       *kickAfter,
+		kickWindow:      *kickWindow,
+		startDelays:     delays,
+		practiceTicks:   *practiceTicks,
+		bestOf:          *bestOf,
+		pendingResults:  make(map[string]map[string]string),
+		seriesRooms:     make(map[string]*Room),
+		startedArgs:     make(map[string]*GameArgs),
+		metrics:         newGameMetrics(),
+		ratings:         ratings,
+		matches:         openMatchStore(*historyPath),
 	}
 
 	// get arguments
-	rpcAddr, e := net.ResolveTCPAddr("tcp", os.Args[1])
+	rpcAddr, e := net.ResolveTCPAddr("tcp", flag.Arg(0))
 	FatalError(e)
+	context.rpcAddr = rpcAddr.String()
 	DebugPrint(1, "Starting MS server")
 	initLogging(rpcAddr.String())
 
 	waitGroup.Add(2)
 
 	go endSession(context) // Timer
-	go listenToClient(context, rpcAddr.String())
+	if *adminAddr != "" {
+		go func() {
+			// Asked for explicitly, so give up rather than run without it.
+			FatalError(serveAdmin(context, *adminAddr))
+		}()
+	}
+	go func() {
+		defer waitGroup.Done()
+		// The server is useless if it can't listen, so give up.
+		FatalError(listenToClient(context, rpcAddr.String(), tlsConfig))
+	}()
 
 	// Wait until processes are done.
 	waitGroup.Wait()
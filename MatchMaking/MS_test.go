@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/rpc"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestContext(roomLimit int) *Context {
+	fileLogger = log.New(ioutil.Discard, "", 0)
+	log.SetOutput(ioutil.Discard)
+	ratings, _ := loadRatings("")
+	return &Context{
+		rooms:           make(map[int]*Room),
+		roomLimit:       roomLimit,
+		sessionDelay:    time.Minute,
+		maxGameDuration: time.Minute,
+		pendingResults:  make(map[string]map[string]string),
+		seriesRooms:     make(map[string]*Room),
+		startedArgs:     make(map[string]*GameArgs),
+		metrics:         newGameMetrics(),
+		ratings:         ratings,
+	}
+}
+
+// A client's rpc server, passing on the games it's started in.
+type fakeNodeService struct {
+	started chan *GameArgs
+}
+
+func (this *fakeNodeService) StartGame(args *GameArgs, reply *ValReply) error {
+	this.started <- args
+	return nil
+}
+
+func (this *fakeNodeService) Message(args *GameArgs, reply *ValReply) error {
+	return nil
+}
+
+// Serve a fake client's rpc server on listener until it's closed. Returns the
+// games the client is started in.
+func serveFakeNode(t *testing.T, listener net.Listener) chan *GameArgs {
+	service := &fakeNodeService{started: make(chan *GameArgs, 4)}
+	server := rpc.NewServer()
+	if e := server.RegisterName("NodeService", service); e != nil {
+		t.Fatal(e)
+	}
+	go server.Accept(listener)
+	return service.started
+}
+
+func joinTestNode(ctx *Context, i int) (string, *Room) {
+	port := strconv.Itoa(9999 - 3*i)
+	return AddNode(ctx, &NodeJoin{Ip: "localhost:" + port, RpcIp: "localhost:" + port + "1"})
+}
+
+// Join a fake client to ctx, returning its reply and the games it's started in.
+func joinFakeNode(t *testing.T, ctx *Context, i int) (*ValReply, chan *GameArgs) {
+	listener, e := net.Listen("tcp", "127.0.0.1:0")
+	if e != nil {
+		t.Fatal(e)
+	}
+	t.Cleanup(func() { listener.Close() })
+	started := serveFakeNode(t, listener)
+	reply := &ValReply{}
+	e = ctx.Join(&NodeJoin{Ip: "localhost:" + strconv.Itoa(9999-3*i),
+		RpcIp: listener.Addr().String()}, reply)
+	if e != nil {
+		t.Fatal(e)
+	}
+	return reply, started
+}
+
+func TestJoinAfterRoomStarts(t *testing.T) {
+	ctx := newTestContext(2)
+	var joined []*ValReply
+	var started []chan *GameArgs
+	for i := 0; i < 2; i++ {
+		reply, games := joinFakeNode(t, ctx, i)
+		if reply.Val != JOIN_QUEUED {
+			t.Fatalf("join %d: %s, want %s", i, reply.Val, JOIN_QUEUED)
+		}
+		joined = append(joined, reply)
+		started = append(started, games)
+	}
+	first := joined[0]
+	// The second filled the room, starting it. Each client is sent its own
+	// token, so it can tell the call is from us.
+	for i, games := range started {
+		select {
+		case args := <-games:
+			if args.Token != joined[i].Token {
+				t.Errorf("client %d started with token %q, want %q", i, args.Token, joined[i].Token)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("client %d wasn't started once the room was full", i)
+		}
+	}
+
+	// The next player waits for another game.
+	reply, _ := joinFakeNode(t, ctx, 2)
+	ctx.NodeLock.RLock()
+	if len(ctx.rooms) != 1 || len(ctx.pendingResults) != 1 {
+		t.Errorf("%d rooms waiting and %d games playing, want one of each",
+			len(ctx.rooms), len(ctx.pendingResults))
+	}
+	ctx.NodeLock.RUnlock()
+	if reply.Val != JOIN_QUEUED {
+		t.Errorf("join after start: %s, want %s into a new room", reply.Val, JOIN_QUEUED)
+	}
+
+	// A player coming back to the started game can't queue for it, but can
+	// get its args.
+	rejoin := &ValReply{}
+	ctx.ReJoinQueue(&NodeJoin{Ip: "localhost:9999", RpcIp: "localhost:99991",
+		Token: first.Token}, rejoin)
+	if rejoin.Val != JOIN_REJECTED_IN_PROGRESS {
+		t.Errorf("rejoin after start: %s, want %s", rejoin.Val, JOIN_REJECTED_IN_PROGRESS)
+	}
+	missed := &GameArgsReply{}
+	ctx.GetGameArgs(&NodeJoin{Ip: "localhost:9999", Token: first.Token}, missed)
+	if missed.Val != GAME_ARGS_STARTED || missed.Args.Token != first.Token {
+		t.Errorf("game args: %s with token %q, want %s with %q",
+			missed.Val, missed.Args.Token, GAME_ARGS_STARTED, first.Token)
+	}
+}
+
+func TestJoinRejectsBadNames(t *testing.T) {
+	ctx := newTestContext(2)
+	for _, join := range []NodeJoin{
+		{Name: strings.Repeat("a", MAX_NAME_LENGTH+1)},
+		{Name: "bob\n"},
+		{Player: "alice\x00"},
+	} {
+		join.Ip, join.RpcIp = "localhost:9999", "localhost:99991"
+		reply := &ValReply{}
+		if e := ctx.Join(&join, reply); e != nil {
+			t.Fatal(e)
+		}
+		if reply.Val != JOIN_REJECTED_NAME {
+			t.Errorf("join as %q/%q: %s, want %s", join.Name, join.Player, reply.Val, JOIN_REJECTED_NAME)
+		}
+	}
+	for _, room := range ctx.rooms {
+		if len(room.nodeList) != 0 {
+			t.Errorf("rejected nodes queued: %v", room.nodeList)
+		}
+	}
+}
+
+func TestJoinWhileBusy(t *testing.T) {
+	ctx := newTestContext(2)
+	ctx.maxGames = 1
+	ctx.pendingResults["secret"] = map[string]string{}
+	if status, _ := joinTestNode(ctx, 0); status != JOIN_SERVER_BUSY {
+		t.Errorf("join while busy: %s, want %s", status, JOIN_SERVER_BUSY)
+	}
+}
+
+func TestJoinBeyondSpawns(t *testing.T) {
+	ctx := newTestContext(spawnCount + 2)
+	for i := 0; i < spawnCount; i++ {
+		if status, _ := joinTestNode(ctx, i); status != JOIN_QUEUED {
+			t.Fatalf("join %d: %s, want %s", i, status, JOIN_QUEUED)
+		}
+	}
+	// The room limit has space, but there's no spawn left.
+	if status, room := joinTestNode(ctx, spawnCount); status != JOIN_REJECTED_FULL || room != nil {
+		t.Errorf("join past the last spawn: %s, want %s", status, JOIN_REJECTED_FULL)
+	}
+}
+
+func TestJoinBySkillBucket(t *testing.T) {
+	ctx := newTestContext(4)
+	ctx.bucketWidth = 100
+	ctx.ratings.scores = map[string]float64{
+		"low1": 1510, "low2": 1590, "high": 1910, "mid1": 1600, "mid2": 1620}
+	join := func(i int, player string) *Room {
+		port := strconv.Itoa(9999 - 3*i)
+		status, room := AddNode(ctx, &NodeJoin{Ip: "localhost:" + port,
+			RpcIp: "localhost:" + port + "1", Player: player})
+		if status != JOIN_QUEUED {
+			t.Fatalf("%s joined: %s, want %s", player, status, JOIN_QUEUED)
+		}
+		return room
+	}
+
+	low := join(0, "low1")
+	if room := join(1, "low2"); room != low {
+		t.Errorf("low2 is in another room to low1, in the same band")
+	}
+	high := join(2, "high")
+	if high == low {
+		t.Fatalf("high is in the same room as the low band")
+	}
+
+	// Fresh, the high room only takes its own band.
+	mid := join(3, "mid1")
+	if mid == high || mid == low {
+		t.Errorf("mid1 joined an existing room, want one of its own")
+	}
+	delete(ctx.rooms, mid.bucket)
+
+	// Left waiting, it widens until the mid band is in reach.
+	high.opened = time.Now().Add(-3 * ctx.sessionDelay)
+	if room := join(4, "mid2"); room != high {
+		t.Errorf("mid2 didn't join the high room once it widened")
+	}
+	if len(high.nodeList) != 2 {
+		t.Errorf("high room has %d players, want 2", len(high.nodeList))
+	}
+}
+
+func TestJoinedNameInGameArgs(t *testing.T) {
+	ctx := newTestContext(3)
+	names := []string{"alice", "", "bob"}
+	var room *Room
+	for i, name := range names {
+		port := strconv.Itoa(9999 - 3*i)
+		var status string
+		status, room = AddNode(ctx, &NodeJoin{Ip: "localhost:" + port,
+			RpcIp: "localhost:" + port + "1", Name: name})
+		if status != JOIN_QUEUED {
+			t.Fatalf("%q joined: %s, want %s", name, status, JOIN_QUEUED)
+		}
+	}
+	room.makeGameRoom()
+	room.assignID()
+
+	// Sent to clients with gob, as RPC does.
+	var buf bytes.Buffer
+	if e := gob.NewEncoder(&buf).Encode(ctx.gameArgs(room)); e != nil {
+		t.Fatal(e)
+	}
+	var args GameArgs
+	if e := gob.NewDecoder(&buf).Decode(&args); e != nil {
+		t.Fatal(e)
+	}
+	for i, name := range names {
+		node := args.NodeList[i]
+		if id := "p" + strconv.Itoa(i+1); node.Id != id || node.Name != name {
+			t.Errorf("player %d is %s named %q, want %s named %q", i, node.Id, node.Name, id, name)
+		}
+	}
+}
+
+func TestEachPlayerGetsOwnColour(t *testing.T) {
+	ctx := newTestContext(spawnCount)
+	var room *Room
+	for i := 0; i < spawnCount; i++ {
+		_, room = joinTestNode(ctx, i)
+	}
+	room.makeGameRoom()
+	room.assignID()
+
+	var buf bytes.Buffer
+	if e := gob.NewEncoder(&buf).Encode(ctx.gameArgs(room)); e != nil {
+		t.Fatal(e)
+	}
+	var args GameArgs
+	if e := gob.NewDecoder(&buf).Decode(&args); e != nil {
+		t.Fatal(e)
+	}
+	if len(args.NodeList) != spawnCount {
+		t.Fatalf("%d players in the game, want %d", len(args.NodeList), spawnCount)
+	}
+	owners := make(map[string]string) // Colour : id of the player drawn in it
+	for _, node := range args.NodeList {
+		if node.Colour == "" {
+			t.Errorf("%s has no colour", node.Id)
+		} else if owner, ok := owners[node.Colour]; ok {
+			t.Errorf("%s and %s are both %s", owner, node.Id, node.Colour)
+		}
+		owners[node.Colour] = node.Id
+	}
+}
+
+func TestStartGameNotHeldUpByUnresponsiveClient(t *testing.T) {
+	ctx := newTestContext(2)
+	answering, e := net.Listen("tcp", "127.0.0.1:0")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer answering.Close()
+	started := serveFakeNode(t, answering)
+
+	// Takes the connection, but never answers on it.
+	silent, e := net.Listen("tcp", "127.0.0.1:0")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer silent.Close()
+	held := make(chan net.Conn, 1)
+	go func() {
+		if connection, e := silent.Accept(); e == nil {
+			held <- connection
+		}
+	}()
+	defer func() {
+		select {
+		case connection := <-held:
+			connection.Close()
+		default:
+		}
+	}()
+
+	var room *Room
+	for i, listener := range []net.Listener{answering, silent} {
+		rpcIp := listener.Addr().String()
+		var status string
+		status, room = AddNode(ctx, &NodeJoin{Ip: "localhost:" + strconv.Itoa(9999-3*i), RpcIp: rpcIp})
+		if status != JOIN_QUEUED {
+			t.Fatalf("join %d: %s, want %s", i, status, JOIN_QUEUED)
+		}
+		connection, e := dialNode(rpcIp)
+		if e != nil {
+			t.Fatal(e)
+		}
+		room.connections[rpcIp] = connection
+	}
+	ctx.NodeLock.Lock()
+	ctx.beginGame(room)
+	ctx.NodeLock.Unlock()
+
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatalf("the answering client wasn't started while the other didn't answer")
+	}
+	// Nor is the server held up meanwhile.
+	answered := make(chan struct{})
+	go func() {
+		ctx.Status(new(int), &StatusReply{})
+		close(answered)
+	}()
+	select {
+	case <-answered:
+	case <-time.After(time.Second):
+		t.Errorf("Status waited on the unanswered StartGame")
+	}
+}
+
+func TestStartGameReachesLateListener(t *testing.T) {
+	ctx := newTestContext(2)
+	// Find a free port for the client, which only listens on it a while later.
+	reserved, e := net.Listen("tcp", "127.0.0.1:0")
+	if e != nil {
+		t.Fatal(e)
+	}
+	rpcIp := reserved.Addr().String()
+	reserved.Close()
+
+	status, room := AddNode(ctx, &NodeJoin{Ip: "localhost:9999", RpcIp: rpcIp})
+	if status != JOIN_QUEUED {
+		t.Fatalf("join: %s, want %s", status, JOIN_QUEUED)
+	}
+	room.makeGameRoom()
+	room.assignID()
+
+	service := &fakeNodeService{started: make(chan *GameArgs, 1)}
+	server := rpc.NewServer()
+	if e := server.RegisterName("NodeService", service); e != nil {
+		t.Fatal(e)
+	}
+	// Past the first dial attempt, but within the retry budget.
+	listening := make(chan net.Listener, 1)
+	go func() {
+		defer close(listening)
+		time.Sleep(RPC_DIAL_BACKOFF + RPC_DIAL_BACKOFF/2)
+		listener, e := net.Listen("tcp", rpcIp)
+		if e != nil {
+			t.Error(e)
+			return
+		}
+		listening <- listener
+		server.Accept(listener)
+	}()
+
+	ctx.startGame(room)
+	if listener, ok := <-listening; ok {
+		defer listener.Close()
+	}
+	select {
+	case args := <-service.started:
+		if len(args.NodeList) != 1 || args.NodeList[0].Id != "p1" {
+			t.Errorf("started with players %v, want just p1", args.NodeList)
+		}
+	default:
+		t.Errorf("the client wasn't started once it was listening")
+	}
+}
+
+func TestSeriesKeepsSlotBetweenGames(t *testing.T) {
+	ctx := newTestContext(2)
+	ctx.maxGames = 1
+	ctx.bestOf = 3
+	room := newRoom(0)
+	room.series = &Series{wins: make(map[string]int)}
+
+	// The first game's result is in, and the next is a break away.
+	ctx.NodeLock.Lock()
+	ctx.continueSeries(room, "p1", map[string]string{})
+	ctx.NodeLock.Unlock()
+	if status, _ := joinTestNode(ctx, 0); status != JOIN_SERVER_BUSY {
+		t.Errorf("join between a series' games: %s, want %s", status, JOIN_SERVER_BUSY)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+// This file implements a small admin page for operators, showing the rooms,
+// who is waiting in them, when they may start, how many games there have been
+// and how the last ones went. The page polls /status and /matches, which serve
+// the Status and RecentMatches RPCs' replies as JSON. /metrics serves the
+// game metrics in metrics.go.
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// Games /matches returns unless asked for another number with ?n=
+const defaultRecentMatches int = 20
+
+// Serve the admin page and /status at addr. Only returns on error.
+func serveAdmin(this *Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		var reply StatusReply
+		if e := this.Status(nil, &reply); e != nil {
+			http.Error(w, e.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if e := json.NewEncoder(w).Encode(&reply); e != nil {
+			localLog("Failed to write admin status:", e)
+		}
+	})
+	mux.HandleFunc("/matches", func(w http.ResponseWriter, r *http.Request) {
+		n := defaultRecentMatches
+		if arg := r.URL.Query().Get("n"); arg != "" {
+			var e error
+			if n, e = strconv.Atoi(arg); e != nil {
+				http.Error(w, "n must be a number", http.StatusBadRequest)
+				return
+			}
+		}
+		var reply MatchesReply
+		if e := this.RecentMatches(&n, &reply); e != nil {
+			http.Error(w, e.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if e := json.NewEncoder(w).Encode(&reply); e != nil {
+			localLog("Failed to write recent matches:", e)
+		}
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		this.NodeLock.RLock()
+		this.metrics.write(w)
+		this.NodeLock.RUnlock()
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(adminPage))
+	})
+	localLog("Serving the admin page at", addr)
+	return http.ListenAndServe(addr, mux)
+}
+
+// The admin page, refreshing every second. StartsIn and Duration are in
+// nanoseconds, as time.Duration encodes.
+const adminPage string = `<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>GoTron matchmaking</title>
+  <style>
+    body { font-family: sans-serif; }
+    table { border-collapse: collapse; }
+    td, th { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+  </style>
+</head>
+<body>
+  <h1>GoTron matchmaking</h1>
+  <p id="summary">Loading...</p>
+  <table>
+    <thead><tr><th>Bucket</th><th>Players</th><th>Starts in</th></tr></thead>
+    <tbody id="rooms"></tbody>
+  </table>
+  <h2>Recent games</h2>
+  <table>
+    <thead><tr><th>Finished</th><th>Players</th><th>Winner</th><th>Duration</th></tr></thead>
+    <tbody id="matches"></tbody>
+  </table>
+  <script>
+    "use strict";
+
+    function cell(row, text) {
+      let td = document.createElement("td");
+      td.textContent = text;
+      row.appendChild(td);
+    }
+
+    function render(status) {
+      document.getElementById("summary").textContent =
+        status.Waiting + " waiting, " + status.Playing + " playing, " +
+        status.GamesStarted + " games started";
+      let rooms = document.getElementById("rooms");
+      rooms.innerHTML = "";
+      for (let bucket of Object.keys(status.Rooms).sort((a, b) => a - b)) {
+        let players = (status.Queued[bucket] || []).map(
+          (p) => p.Player ? p.Player + " (" + p.RpcIp + ")" : p.RpcIp);
+        let row = document.createElement("tr");
+        cell(row, bucket);
+        cell(row, players.join(", "));
+        cell(row, (status.StartsIn[bucket] / 1e9).toFixed(1) + "s");
+        rooms.appendChild(row);
+      }
+    }
+
+    function renderMatches(reply) {
+      let matches = document.getElementById("matches");
+      matches.innerHTML = "";
+      for (let match of (reply.Matches || []).reverse()) {
+        let players = match.Players.map(
+          (p) => p.Name ? p.Name + " (" + p.Id + ")" : p.Id);
+        let row = document.createElement("tr");
+        cell(row, new Date(match.Time).toLocaleString());
+        cell(row, players.join(", "));
+        cell(row, match.Winner ? match.WinnerName || match.Winner :
+          "draw, " + match.Reason);
+        cell(row, (match.Duration / 1e9).toFixed(1) + "s");
+        matches.appendChild(row);
+      }
+    }
+
+    function refresh() {
+      fetch("/status")
+        .then((response) => response.json())
+        .then(render)
+        .catch((e) => {
+          document.getElementById("summary").textContent = "Error: " + e;
+        });
+      fetch("/matches")
+        .then((response) => response.json())
+        .then(renderMatches)
+        .catch((e) => {
+          document.getElementById("summary").textContent = "Error: " + e;
+        });
+    }
+
+    refresh();
+    setInterval(refresh, 1000);
+  </script>
+</body>
+</html>
+`
@@ -0,0 +1,106 @@
+package main
+
+// This file implements chat between the players waiting in a room. A client
+// sends a line with SendChat, and the server passes it on to everyone else in
+// its room with their ReceiveChat RPC. Lines are limited to -chat-length
+// characters and each client to one line every -chat-interval, so nobody can
+// flood the room.
+
+import (
+	"net/rpc"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const RPC_RECEIVE_CHAT string = "NodeService.ReceiveChat"
+
+// Chat statuses SendChat replies with in reply.Val
+const CHAT_SENT = "sent"
+const CHAT_DISABLED = "disabled"     // the server was started with -chat-length=0
+const CHAT_NOT_QUEUED = "not_queued" // the token isn't of a client waiting in a room
+const CHAT_BAD_LENGTH = "bad_length" // the line is empty or longer than -chat-length
+const CHAT_TOO_FAST = "too_fast"     // the client's last line was under -chat-interval ago
+
+// Object received from a client sending a chat line
+type ChatArgs struct {
+	Token string // the token Join gave the client
+	Text  string
+	Log   []byte
+}
+
+// Object sent to the other clients in the sender's room
+type ChatMessage struct {
+	From string // the sender's display name, or the name they're rated under
+	Text string
+	Log  []byte
+}
+
+// RPC called by a client waiting in a room to chat to the others in it.
+// reply.Val is CHAT_SENT if the line was passed on, or one of the other
+// CHAT_* statuses if not.
+func (this *Context) SendChat(args *ChatArgs, reply *ValReply) error {
+	logReceive("CH: chat line, Log: ", args.Log)
+	text := strings.TrimSpace(args.Text)
+	if this.chatLength == 0 {
+		reply.Val = CHAT_DISABLED
+		return nil
+	}
+	if text == "" || utf8.RuneCountInString(text) > this.chatLength {
+		reply.Val = CHAT_BAD_LENGTH
+		return nil
+	}
+
+	this.NodeLock.Lock()
+	room, sender, msNode := this.queuedByToken(args.Token)
+	if room == nil {
+		this.NodeLock.Unlock()
+		localLog("Rejected chat from a client that isn't waiting in a room")
+		reply.Val = CHAT_NOT_QUEUED
+		return nil
+	}
+	now := time.Now()
+	if now.Sub(msNode.lastChat) < this.chatInterval {
+		this.NodeLock.Unlock()
+		reply.Val = CHAT_TOO_FAST
+		return nil
+	}
+	msNode.lastChat = now
+	// Clients without a connection are being checked on by checkConn, and
+	// miss the line.
+	recipients := make(map[string]*rpc.Client)
+	for rpcIp, connection := range room.connections {
+		if rpcIp != sender && room.nodeList[rpcIp] != nil {
+			recipients[rpcIp] = connection
+		}
+	}
+	from := chatName(msNode)
+	this.NodeLock.Unlock()
+
+	localLog("Chat from", from, "in room", room.bucket, "to", len(recipients), "clients:", text)
+	for rpcIp, connection := range recipients {
+		go deliverChat(rpcIp, connection, from, text)
+	}
+	reply.Val = CHAT_SENT
+	return nil
+}
+
+// Name a client's chat lines are shown under.
+func chatName(msNode *MsNode) string {
+	if msNode.Node.Name != "" {
+		return msNode.Node.Name
+	}
+	if msNode.Player != "" {
+		return msNode.Player
+	}
+	return "a player"
+}
+
+// Pass a chat line on to the client at rpcIp.
+func deliverChat(rpcIp string, connection *rpc.Client, from string, text string) {
+	log := logSend("Rpc Call " + RPC_RECEIVE_CHAT + " to " + rpcIp)
+	message := &ChatMessage{From: from, Text: text, Log: log}
+	if e := connection.Call(RPC_RECEIVE_CHAT, message, &ValReply{}); e != nil {
+		localLog("Failed to pass chat on to", rpcIp, ":", e)
+	}
+}
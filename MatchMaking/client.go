@@ -1,7 +1,11 @@
+//go:build ignore
+// +build ignore
+
 package main
 
 // This file was used for testing the Matchmaking server implementation. It may
-// or may not work with the current implementation.
+// or may not work with the current implementation. It's its own program, so
+// it's left out of the server's build and tests.
 
 import (
 	"fmt"
@@ -73,7 +77,9 @@ func main() {
 	//Exporting methods to be used by MS server
 	go func() {
 		nodeService := new(NodeService)
-		rpc.Register(nodeService)
+		if e := rpc.Register(nodeService); e != nil {
+			log.Fatal("register error:", e)
+		}
 		nodeListener, e := net.Listen("tcp", localAddr.String())
 		if e != nil {
 			log.Fatal("listen error:", e)
@@ -0,0 +1,109 @@
+package main
+
+// This file implements GetGameArgs, a fallback for clients that miss the
+// StartGame call starting their game, e.g. to a network blip, and would
+// otherwise sit waiting while the others play without them. Until a game's
+// result is in, the server keeps the args it started the game with, and gives
+// them to any of its players asking with the token Join gave them.
+//
+// It also implements checking the args of a game before it starts, so a bug in
+// building them stops the game on the server rather than shipping a broken
+// game to every client.
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// Statuses GetGameArgs replies with in reply.Val
+const GAME_ARGS_STARTED = "started" // reply.Args is the game the client was started in
+const GAME_ARGS_WAITING = "waiting" // the client is still waiting in a room
+const GAME_ARGS_UNKNOWN = "unknown" // the token isn't of a client waiting or playing
+
+// Reply to GetGameArgs
+type GameArgsReply struct {
+	Val  string   // one of the GAME_ARGS_* statuses
+	Args GameArgs // if Val is GAME_ARGS_STARTED
+	Log  []byte
+}
+
+// RPC called by a client waiting for a game, in case its game started without
+// it hearing. Only nodeJoin.Token, Ip and Log are used.
+func (this *Context) GetGameArgs(nodeJoin *NodeJoin, reply *GameArgsReply) error {
+	logReceive("GA: game args asked for, Log: ", nodeJoin.Log)
+	this.NodeLock.RLock()
+	defer this.NodeLock.RUnlock()
+	if args, ok := this.startedArgs[nodeJoin.Token]; ok {
+		localLog("Sending game args to", nodeJoin.Ip, "which hasn't heard its game started")
+		reply.Val = GAME_ARGS_STARTED
+		reply.Args = *args
+		reply.Args.Token = nodeJoin.Token
+		reply.Args.Log = logSend("Game args for " + nodeJoin.Ip)
+		return nil
+	}
+	if room, _, _ := this.queuedByToken(nodeJoin.Token); room != nil {
+		reply.Val = GAME_ARGS_WAITING
+		return nil
+	}
+	reply.Val = GAME_ARGS_UNKNOWN
+	return nil
+}
+
+// Keep the args of the game being started in room for its players to ask for.
+// NodeLock must be held.
+func (this *Context) keepGameArgs(room *Room) {
+	args := this.gameArgs(room)
+	for _, msNode := range room.nodeList {
+		if msNode.Token != "" {
+			this.startedArgs[msNode.Token] = args
+		}
+	}
+}
+
+// Check that args describe a game clients can play: one with players, each
+// with an id and address of its own, starting on the board.
+func validateGameArgs(args *GameArgs) error {
+	if len(args.NodeList) == 0 {
+		return errors.New("no players")
+	}
+	if len(args.NodeList) > spawnCount {
+		return fmt.Errorf("%d players, but at most %d fit", len(args.NodeList), spawnCount)
+	}
+	ids := make(map[string]bool)
+	addrs := make(map[string]string) // Address : id of the player at it
+	for _, node := range args.NodeList {
+		if node.Id == "" {
+			return fmt.Errorf("player at %q has no id", node.Ip)
+		}
+		if ids[node.Id] {
+			return fmt.Errorf("more than one player is %s", node.Id)
+		}
+		ids[node.Id] = true
+		if node.Ip == "" {
+			return fmt.Errorf("player %s has no address", node.Id)
+		}
+		if other, ok := addrs[node.Ip]; ok {
+			return fmt.Errorf("players %s and %s are both at %s", other, node.Id, node.Ip)
+		}
+		addrs[node.Ip] = node.Id
+	}
+	for id, override := range args.StartOverrides {
+		if ids[id] && (override.X < 0 || override.Y < 0 ||
+			override.X >= boardSize || override.Y >= boardSize) {
+			return fmt.Errorf("%s starts at %d,%d, off the %dx%d board",
+				id, override.X, override.Y, boardSize, boardSize)
+		}
+	}
+	return nil
+}
+
+// Forget the args of the game with the given secret, as it's over. NodeLock
+// must be held.
+func (this *Context) forgetGameArgs(secret string) {
+	for token, args := range this.startedArgs {
+		if bytes.Equal(args.Secret, []byte(secret)) {
+			delete(this.startedArgs, token)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+// This file keeps a history of finished games, as their leaders report them.
+// Where the history is kept is up to a MatchStore: in memory, or appended to a
+// file of JSON lines, one game per line, so it survives restarts.
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// A finished game, as kept in the history
+type MatchRecord struct {
+	Time       time.Time          // when the result was reported
+	Winner     string             // id of the winner, "" for a draw
+	WinnerName string             // name the winner is rated under, if any
+	Reason     string             // why the game ended if nobody won
+	Duration   time.Duration      // how long the game took
+	Ticks      int                // ticks the game took
+	Players    []PlayerResult     // how each player finished, including their area
+	Ratings    map[string]float64 // player name : rating after the game
+}
+
+// Somewhere to keep the history of games
+type MatchStore interface {
+	// Add a game to the end of the history.
+	add(record *MatchRecord) error
+	// The last n games, oldest first.
+	recent(n int) ([]MatchRecord, error)
+}
+
+// Open the history kept at path, or one kept in memory if path is "".
+func openMatchStore(path string) MatchStore {
+	if path == "" {
+		return &memoryMatchStore{}
+	}
+	return &fileMatchStore{path: path}
+}
+
+// The last n of records, or all of them if there are fewer.
+func lastMatches(records []MatchRecord, n int) []MatchRecord {
+	if n >= 0 && len(records) > n {
+		records = records[len(records)-n:]
+	}
+	return records
+}
+
+// A history lost when the server stops
+type memoryMatchStore struct {
+	lock    sync.Mutex
+	records []MatchRecord
+}
+
+func (this *memoryMatchStore) add(record *MatchRecord) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.records = append(this.records, *record)
+	return nil
+}
+
+func (this *memoryMatchStore) recent(n int) ([]MatchRecord, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return append([]MatchRecord(nil), lastMatches(this.records, n)...), nil
+}
+
+// A history appended to a file of JSON lines
+type fileMatchStore struct {
+	lock sync.Mutex
+	path string
+}
+
+func (this *fileMatchStore) add(record *MatchRecord) error {
+	line, e := json.Marshal(record)
+	if e != nil {
+		return e
+	}
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	file, e := os.OpenFile(this.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if e != nil {
+		return e
+	}
+	// One write per line, so a crash can at worst cut off the last game.
+	if _, e := file.Write(append(line, '\n')); e != nil {
+		file.Close()
+		return e
+	}
+	return file.Close()
+}
+
+func (this *fileMatchStore) recent(n int) ([]MatchRecord, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	file, e := os.Open(this.path)
+	if os.IsNotExist(e) {
+		return nil, nil
+	} else if e != nil {
+		return nil, e
+	}
+	defer file.Close()
+
+	var records []MatchRecord
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record MatchRecord
+		if e := json.Unmarshal(scanner.Bytes(), &record); e != nil {
+			// Most likely the last line, cut off by a crash.
+			localLog("Skipping unreadable game in", this.path, ":", e)
+			continue
+		}
+		records = append(records, record)
+	}
+	if e := scanner.Err(); e != nil {
+		return nil, e
+	}
+	return lastMatches(records, n), nil
+}
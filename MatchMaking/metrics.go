@@ -0,0 +1,77 @@
+package main
+
+// This file implements metrics of how games end and how long they take, for
+// tuning tick rates and board sizes. They're gathered from the results games'
+// leaders report, and served in plain text at the admin server's /metrics,
+// e.g.
+//
+//	games_total{outcome="win"} 3
+//	game_duration_seconds_bucket{le="60"} 2
+//
+// Games that never report a result are counted as abandoned.
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Upper bounds of the game duration histogram's buckets, in seconds. Games
+// longer than the last go in the +Inf bucket only.
+var gameDurationBuckets = []float64{15, 30, 60, 120, 300, 600}
+
+// How games ended
+const OUTCOME_WIN = "win"
+const OUTCOME_DRAW = "draw"
+const OUTCOME_ABANDONED = "abandoned" // nobody reported a result
+
+// How the games played since the server started ended and how long they took
+type GameMetrics struct {
+	outcomes      map[string]int // outcome : games that ended that way
+	durationCount []int          // games at most each of gameDurationBuckets long
+	durations     int            // games whose duration is known
+	durationSum   time.Duration  // of the games whose duration is known
+}
+
+func newGameMetrics() *GameMetrics {
+	return &GameMetrics{
+		outcomes:      make(map[string]int),
+		durationCount: make([]int, len(gameDurationBuckets)),
+	}
+}
+
+// Count a game whose result is in. NodeLock must be held.
+func (this *GameMetrics) recordResult(result *GameResult) {
+	if result.Winner != "" {
+		this.outcomes[OUTCOME_WIN]++
+	} else {
+		this.outcomes[OUTCOME_DRAW]++
+	}
+	for i, bound := range gameDurationBuckets {
+		if result.Duration.Seconds() <= bound {
+			this.durationCount[i]++
+		}
+	}
+	this.durations++
+	this.durationSum += result.Duration
+}
+
+// Count a game nobody reported a result for. NodeLock must be held.
+func (this *GameMetrics) recordAbandoned() {
+	this.outcomes[OUTCOME_ABANDONED]++
+}
+
+// Write the metrics to w. NodeLock must be held.
+func (this *GameMetrics) write(w io.Writer) {
+	for _, outcome := range []string{OUTCOME_WIN, OUTCOME_DRAW, OUTCOME_ABANDONED} {
+		fmt.Fprintf(w, "games_total{outcome=%q} %d\n", outcome, this.outcomes[outcome])
+	}
+	for i, bound := range gameDurationBuckets {
+		fmt.Fprintf(w, "game_duration_seconds_bucket{le=%q} %d\n",
+			strconv.FormatFloat(bound, 'f', -1, 64), this.durationCount[i])
+	}
+	fmt.Fprintf(w, "game_duration_seconds_bucket{le=\"+Inf\"} %d\n", this.durations)
+	fmt.Fprintln(w, "game_duration_seconds_sum", this.durationSum.Seconds())
+	fmt.Fprintln(w, "game_duration_seconds_count", this.durations)
+}
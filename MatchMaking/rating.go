@@ -0,0 +1,134 @@
+package main
+
+// This file keeps Elo ratings of players across games, keyed by the player
+// name clients give when joining.
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"sync"
+)
+
+const INITIAL_RATING float64 = 1500 // Rating of a player's first game
+const RATING_K float64 = 32         // Most a rating moves in one game
+
+type Ratings struct {
+	lock   sync.Mutex
+	path   string             // file ratings are saved to; "" keeps them in memory
+	scores map[string]float64 // player name : rating
+}
+
+// Load ratings saved at path, starting fresh if there's no file yet.
+func loadRatings(path string) (*Ratings, error) {
+	r := &Ratings{path: path, scores: make(map[string]float64)}
+	if path == "" {
+		return r, nil
+	}
+	data, e := ioutil.ReadFile(path)
+	if os.IsNotExist(e) {
+		return r, nil
+	} else if e != nil {
+		return nil, e
+	}
+	if e := json.Unmarshal(data, &r.scores); e != nil {
+		return nil, e
+	}
+	return r, nil
+}
+
+// Rating of a player, or INITIAL_RATING if they haven't played. lock must be
+// held.
+func (this *Ratings) get(player string) float64 {
+	if score, ok := this.scores[player]; ok {
+		return score
+	}
+	return INITIAL_RATING
+}
+
+// Rating of a player, taking the lock.
+func (this *Ratings) rating(player string) float64 {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.get(player)
+}
+
+// Copy of every rating.
+func (this *Ratings) snapshot() map[string]float64 {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	scores := make(map[string]float64, len(this.scores))
+	for player, score := range this.scores {
+		scores[player] = score
+	}
+	return scores
+}
+
+// Update ratings with the result of a game between players, each pair of whom
+// is scored as a match: the winner beats everyone, and with no winner, every
+// pair draws. Players without a name aren't rated.
+func (this *Ratings) update(players []string, winner string) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	rated := make([]string, 0, len(players))
+	for _, player := range players {
+		if player != "" {
+			rated = append(rated, player)
+		}
+	}
+	if len(rated) < 2 {
+		return nil
+	}
+
+	// Everyone's change is worked out from the ratings before the game, and
+	// spread over their matches so bigger games don't swing ratings more.
+	k := RATING_K / float64(len(rated)-1)
+	changes := make(map[string]float64)
+	for i, a := range rated {
+		for _, b := range rated[i+1:] {
+			var score float64
+			switch winner {
+			case a:
+				score = 1
+			case b:
+				score = 0
+			case "":
+				score = 0.5
+			default:
+				// Both lost to someone else.
+				continue
+			}
+			change := k * (score - expectedScore(this.get(a), this.get(b)))
+			changes[a] += change
+			changes[b] -= change
+		}
+	}
+	for player, change := range changes {
+		this.scores[player] = this.get(player) + change
+	}
+	return this.save()
+}
+
+// Chance a player rated a beats one rated b.
+func expectedScore(a float64, b float64) float64 {
+	return 1 / (1 + math.Pow(10, (b-a)/400))
+}
+
+// Write the ratings to their file, if any. lock must be held.
+func (this *Ratings) save() error {
+	if this.path == "" {
+		return nil
+	}
+	data, e := json.Marshal(this.scores)
+	if e != nil {
+		return e
+	}
+	// Write then rename so a crash can't leave half a file.
+	tmpPath := this.path + ".tmp"
+	if e := ioutil.WriteFile(tmpPath, data, 0644); e != nil {
+		return e
+	}
+	return os.Rename(tmpPath, this.path)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func assertRating(t *testing.T, ratings *Ratings, player string, want float64) {
+	t.Helper()
+	if got := ratings.rating(player); math.Abs(got-want) > 0.01 {
+		t.Errorf("%s is rated %.2f, want %.2f", player, got, want)
+	}
+}
+
+func TestExpectedScore(t *testing.T) {
+	tests := []struct {
+		a, b float64
+		want float64
+	}{
+		{1500, 1500, 0.5},
+		{1900, 1500, 0.909},
+		{1500, 1900, 0.091},
+		{1600, 1500, 0.640},
+	}
+	for _, test := range tests {
+		if got := expectedScore(test.a, test.b); math.Abs(got-test.want) > 0.001 {
+			t.Errorf("expectedScore(%v, %v) = %.3f, want %.3f",
+				test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestRatingUpdates(t *testing.T) {
+	ratings, e := loadRatings("")
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	// Evenly rated, so the winner takes half of RATING_K from the loser.
+	ratings.update([]string{"ann", "bob"}, "ann")
+	assertRating(t, ratings, "ann", 1516)
+	assertRating(t, ratings, "bob", 1484)
+
+	// A draw moves the higher rated player towards the lower.
+	ratings.update([]string{"ann", "bob"}, "")
+	assertRating(t, ratings, "ann", 1514.53)
+	assertRating(t, ratings, "bob", 1485.47)
+
+	// K is spread over each player's two matches, and the two losers don't
+	// play each other. Players without a name aren't rated.
+	ratings.update([]string{"cat", "dan", "eve", ""}, "cat")
+	assertRating(t, ratings, "cat", 1516)
+	assertRating(t, ratings, "dan", 1492)
+	assertRating(t, ratings, "eve", 1492)
+	if _, ok := ratings.snapshot()[""]; ok {
+		t.Errorf("rated a player without a name")
+	}
+
+	// Alone, or with only unnamed players, nobody is rated.
+	ratings.update([]string{"fay", ""}, "fay")
+	assertRating(t, ratings, "fay", INITIAL_RATING)
+}
+
+func TestRatingsPersistAcrossRestart(t *testing.T) {
+	dir, e := ioutil.TempDir("", "ratings")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "ratings.json")
+
+	ratings, e := loadRatings(path)
+	if e != nil {
+		t.Fatalf("loading without a file: %v", e)
+	}
+	if e := ratings.update([]string{"ann", "bob"}, "bob"); e != nil {
+		t.Fatalf("saving: %v", e)
+	}
+
+	reloaded, e := loadRatings(path)
+	if e != nil {
+		t.Fatalf("reloading: %v", e)
+	}
+	assertRating(t, reloaded, "ann", 1484)
+	assertRating(t, reloaded, "bob", 1516)
+	if _, e := os.Stat(path + ".tmp"); !os.IsNotExist(e) {
+		t.Errorf("left the temporary file behind")
+	}
+}
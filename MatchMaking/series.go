@@ -0,0 +1,91 @@
+package main
+
+// This file implements best-of-N series. With -best-of=3, a room's players play
+// up to 3 games together rather than just one: once a game's result is in, the
+// server starts another with the same players, at the addresses it reached
+// them at for the first, until one of them has won 2 and is the series'
+// champion. Each game is rated and kept in the history like any other.
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// How long the server waits between the games of a series, so every player
+// hears the last one is over and sees its result first.
+const SERIES_BREAK = 5 * time.Second
+
+// Games of a series the players of a room have played so far
+type Series struct {
+	played int            // games whose result is in
+	wins   map[string]int // player id : games won
+}
+
+// Wins it takes to win a series of bestOf games.
+func winsNeeded(bestOf int) int {
+	return bestOf/2 + 1
+}
+
+// Count a game of room's series won by winner, "" for a draw, then start the
+// next game unless the series is over. players maps the game's player ids to
+// their names. NodeLock must be held.
+func (this *Context) continueSeries(room *Room, winner string, players map[string]string) {
+	series := room.series
+	series.played++
+	if winner != "" {
+		series.wins[winner]++
+	}
+	localLog("Series score after game", series.played, "of", this.bestOf, ":",
+		series.score(room))
+
+	if series.wins[winner] < winsNeeded(this.bestOf) && series.played < this.bestOf {
+		localLog("Starting game", series.played+1, "of the series in", SERIES_BREAK)
+		// Keep the game's slot meanwhile, so the next can't push the server
+		// past its limit.
+		this.seriesBreaks++
+		time.AfterFunc(SERIES_BREAK, func() {
+			this.NodeLock.Lock()
+			defer this.NodeLock.Unlock()
+			this.seriesBreaks--
+			this.launchGame(room)
+		})
+		return
+	}
+
+	champion := series.champion()
+	if champion == "" {
+		localLog("Series over after", series.played, "games, nobody won the most")
+		return
+	}
+	localLog("Series over after", series.played, "games, champion:", champion,
+		players[champion], "with", series.wins[champion], "wins")
+}
+
+// Id of the player who won the most games, or "" if that's tied.
+func (this *Series) champion() string {
+	champion := ""
+	tied := false
+	for id, wins := range this.wins {
+		if champion == "" || wins > this.wins[champion] {
+			champion = id
+			tied = false
+		} else if wins == this.wins[champion] {
+			tied = true
+		}
+	}
+	if tied {
+		return ""
+	}
+	return champion
+}
+
+// Games each of room's players has won, in the order they play in, e.g.
+// "p1 2, p2 0".
+func (this *Series) score(room *Room) string {
+	scores := make([]string, 0, len(room.gameRoom))
+	for _, node := range room.gameRoom {
+		scores = append(scores, fmt.Sprintf("%s %d", node.Id, this.wins[node.Id]))
+	}
+	return strings.Join(scores, ", ")
+}
@@ -0,0 +1,50 @@
+package main
+
+// This file implements serving clients over TLS, for deployments where the
+// network between players and the server can't be trusted.
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+)
+
+// Build the TLS config for serving clients with the certificate and key in
+// the given files. If caFile is set, clients must present a certificate signed
+// by one of the CAs in it. Returns nil if certFile is unset, for plaintext.
+func serverTLSConfig(certFile string, keyFile string, caFile string) (*tls.Config, error) {
+	if certFile == "" {
+		if keyFile != "" || caFile != "" {
+			return nil, errors.New("-tls-key and -tls-ca need -tls-cert")
+		}
+		return nil, nil
+	}
+	cert, e := tls.LoadX509KeyPair(certFile, keyFile)
+	if e != nil {
+		return nil, e
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if caFile != "" {
+		pool, e := loadCertPool(caFile)
+		if e != nil {
+			return nil, e
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// Read the PEM encoded certificates in path into a pool.
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, e := ioutil.ReadFile(path)
+	if e != nil {
+		return nil, e
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("no certificates found in " + path)
+	}
+	return pool, nil
+}
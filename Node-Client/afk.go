@@ -0,0 +1,41 @@
+package main
+
+// This file implements eliminating players who've stopped playing but whose
+// node is still up, e.g. someone who walked away. Every node notes the tick
+// each player last turned on, and once a player goes afkTicks without turning
+// the leader declares them dead like any other crash.
+
+var afkTicks int                 // Ticks without turning before a node is eliminated, 0 for never.
+var lastInputTick map[string]int // Id : tick the node last turned on.
+
+// Note that the node with the given id turned. mutex must be held.
+func recordInput(id string) {
+	lastInputTick[id] = tickCount
+}
+
+// Whether the node with the given id has gone afkTicks without turning.
+// mutex must be held.
+func isAFK(id string) bool {
+	return afkTicks > 0 && tickCount-lastInputTick[id] >= afkTicks
+}
+
+// LEADER: Eliminate every live node that has gone AFK, telling peers about it.
+// Returns how many nodes died. mutex must be held.
+func eliminateAFKNodes() int {
+	deaths := 0
+	for _, node := range nodes {
+		if !node.IsAlive || !isAFK(node.Id) {
+			continue
+		}
+		localLog("NODE "+node.Id+" IS AFK, no input for", afkTicks, "ticks")
+		node.IsAlive = false
+		aliveNodes = aliveNodes - 1
+		deaths++
+		setCell(&board, *node.CurrLoc, getPlayerState(node.Id))
+		if node.Id == nodeId {
+			notifyPlayerDeathToJS()
+		}
+		reportASorrowfulDeathToPeers(node, causedDeath(node, CAUSE_AFK))
+	}
+	return deaths
+}
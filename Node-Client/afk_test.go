@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestAFKNodeEliminated(t *testing.T) {
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 1, Y: 1}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 1, Y: 5}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 1, Y: 8}, Direction: DIRECTION_RIGHT},
+	)
+	afkTicks = 4
+	defer func() { afkTicks = 0 }()
+	p1, p2, p3 := nodes[0], nodes[1], nodes[2]
+
+	// p1 and p2 turn on tick 2, p3 never does.
+	stepGame()
+	stepGame()
+	recordInput("p1")
+	recordInput("p2")
+	stepGame()
+	if !p3.IsAlive {
+		t.Fatalf("p3 eliminated after 3 ticks without turning, under the %d allowed", afkTicks)
+	}
+	stepGame()
+	if p3.IsAlive {
+		t.Errorf("p3 still alive after %d ticks without turning", afkTicks)
+	}
+	if !p1.IsAlive || !p2.IsAlive {
+		t.Errorf("p1 alive %v, p2 alive %v, want both as they turned", p1.IsAlive, p2.IsAlive)
+	}
+	if aliveNodes != 2 || !isPlaying() {
+		t.Errorf("%d alive, playing %v after p3 was eliminated", aliveNodes, isPlaying())
+	}
+	if cell := cellAt(&board, *p3.CurrLoc); cell != "d3" {
+		t.Errorf("p3's cell is %q, want d3", cell)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+// This file implements scoring players by the area they've covered, the
+// number of distinct cells they've been on. It's reported with the game's
+// result, and with areaTiebreak set, a game that runs out of time is won by
+// the player left alive who covered the most area rather than being a draw.
+
+var areaTiebreak bool             // Whether time running out is settled by area.
+var visitedCells map[string][]Pos // Id : every cell the node has moved off, in order.
+
+// Number of distinct cells in history, counting revisited cells once.
+func coveredArea(history []Pos) int {
+	seen := make(map[Pos]bool)
+	for _, pos := range history {
+		seen[pos] = true
+	}
+	return len(seen)
+}
+
+// Area the node has covered, including where it is now. mutex must be held.
+func areaOf(node *Node) int {
+	history := visitedCells[node.Id]
+	if node.CurrLoc != nil {
+		history = append(history[:len(history):len(history)], *node.CurrLoc)
+	}
+	return coveredArea(history)
+}
+
+// The id of the node among candidates that covered the most area, or "" if
+// there are none or the most is tied. mutex must be held.
+func mostArea(candidates []*Node) string {
+	best := ""
+	bestArea := -1
+	for _, node := range candidates {
+		area := areaOf(node)
+		if area > bestArea {
+			best = node.Id
+			bestArea = area
+		} else if area == bestArea {
+			best = ""
+		}
+	}
+	return best
+}
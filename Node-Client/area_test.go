@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestAreaOf(t *testing.T) {
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 1, Y: 1}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 1, Y: 5}, Direction: DIRECTION_RIGHT},
+	)
+	p1 := nodes[0]
+	for i := 0; i < 3; i++ {
+		stepGame()
+	}
+	// Three cells moved off, and the one it's on.
+	if area := areaOf(p1); area != 4 {
+		t.Errorf("p1 covered %d cells, want 4", area)
+	}
+	// Going back over a cell doesn't cover it again.
+	visitedCells["p1"] = append(visitedCells["p1"], Pos{X: 2, Y: 1})
+	if area := areaOf(p1); area != 4 {
+		t.Errorf("p1 covered %d cells after revisiting one, want 4 still", area)
+	}
+}
+
+func TestTimeUpWinnerByArea(t *testing.T) {
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 1, Y: 1}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 1, Y: 5}, Direction: DIRECTION_RIGHT},
+	)
+	defer func() { areaTiebreak = false }()
+	startDelays["p2"] = 2
+	for i := 0; i < 3; i++ {
+		stepGame()
+	}
+
+	areaTiebreak = false
+	if winner := timeUpWinner(); winner != "" {
+		t.Errorf("%s won when time ran out without the area tiebreak", winner)
+	}
+	areaTiebreak = true
+	if winner := timeUpWinner(); winner != "p1" {
+		t.Errorf("%q won when time ran out, want p1 with the most area", winner)
+	}
+
+	// Once p2 has caught up, it's a draw.
+	visitedCells["p2"] = append(visitedCells["p2"], Pos{X: 0, Y: 5}, Pos{X: 0, Y: 6})
+	if winner := timeUpWinner(); winner != "" {
+		t.Errorf("%s won when time ran out with the area tied", winner)
+	}
+}
@@ -7,33 +7,43 @@ const Direction = {
   DOWN: "D",
   LEFT: "L",
   RIGHT: "R",
+  UP_LEFT: "UL",
+  UP_RIGHT: "UR",
+  DOWN_LEFT: "DL",
+  DOWN_RIGHT: "DR",
 };
 
 const W = 87;
 const A = 65;
 const S = 83;
 const D = 68;
+// Diagonal keys, only used when the game allows diagonal movement.
+const Q = 81;
+const E = 69;
+const Z = 90;
+const C = 67;
 
-// Maps player codes constants such as "p1" and "t1" to a colour.
+// Maps player ids such as "p1" to a colour, for players without an assigned
+// one.
 const PLAYER_CODE_TO_COLOUR = {
-  "d1": "red",
   "p1": "red",
-  "t1": "red",
-  "d2": "green",
   "p2": "green",
-  "t2": "green",
-  "d3": "blue",
   "p3": "blue",
-  "t3": "blue",
-  "d4": "orange",
   "p4": "orange",
-  "t4": "orange",
-  "d5": "brown",
   "p5": "brown",
-  "t5": "brown",
-  "d6": "black",
   "p6": "black",
-  "t6": "black",
+};
+
+// Maps types of cell that don't belong to a player to a colour.
+const CELL_TYPE_TO_COLOUR = {
+  // Walls closing in during sudden death.
+  "wall": "gray",
+  // Mines the leader places.
+  "mine": "purple",
+  // Border drawn around the board when the node is run with -board-border.
+  "border": "dimgray",
+  // Too far from our head to see, when the game is played with fog of war.
+  "fog": "lightgray",
 };
 
 const gSocket = io();
@@ -45,30 +55,69 @@ const gCanvas = new fabric.StaticCanvas("mainCanvas");
 // we won.
 var gGameEnded = false;
 
+// The last game state rendered, which changed cells are applied to. Rows of
+// cells as sent by the node, with null for empty ones.
+var gBoard = null;
+
 // Keep track of current direction so we don't send redundant emits.
 var curDirection = 0;
 
+// Whether the game allows diagonal movement.
+var gAllowDiagonal = false;
+
+// Whether turning back the way we came is allowed, if fatal.
+var gReversalLethal = false;
+
+// Whether players start with more than one life, so lives should be shown.
+var gShowLives = false;
+
+// Maps player ids such as "p1" to the colour the matchmaking server gave them.
+var gPlayerColours = {};
+
+// Every player still in the game, with where its head is, which way it's
+// heading and whether it's alive, as of the last whole board.
+var gPlayers = [];
+
+// Id of the player a spectator is following, or null if none.
+var gFollowId = null;
+
+// Maps diagonal keys to their direction and the key of the opposite direction.
+const DIAGONAL_KEYS = {
+  [Q]: {direction: Direction.UP_LEFT, opposite: C},
+  [E]: {direction: Direction.UP_RIGHT, opposite: Z},
+  [Z]: {direction: Direction.DOWN_LEFT, opposite: E},
+  [C]: {direction: Direction.DOWN_RIGHT, opposite: Q},
+};
+
 function handleKeyPress(event) {
   if (event.keyCode === curDirection) return;
 
+  if (gAllowDiagonal && event.keyCode in DIAGONAL_KEYS) {
+    let diagonal = DIAGONAL_KEYS[event.keyCode];
+    if (!gReversalLethal && curDirection === diagonal.opposite) return;
+    curDirection = event.keyCode;
+    gSocket.emit("playerMove", {"direction": diagonal.direction});
+    return;
+  }
+
   switch (event.keyCode) {
     case W:
-      if (curDirection === S) break;
+      if (!gReversalLethal && curDirection === S) break;
       curDirection = W;
       gSocket.emit("playerMove", {"direction": Direction.UP});
       break;
     case A:
-      if (curDirection === D) break;
+      if (!gReversalLethal && curDirection === D) break;
       curDirection = A;
       gSocket.emit("playerMove", {"direction": Direction.LEFT});
       break;
     case S:
-      if (curDirection === W) break;
+      if (!gReversalLethal && curDirection === W) break;
       curDirection = S;
       gSocket.emit("playerMove", {"direction": Direction.DOWN});
       break;
     case D:
-      if (curDirection === A) break;
+      if (!gReversalLethal && curDirection === A) break;
       curDirection = D;
       gSocket.emit("playerMove", {"direction": Direction.RIGHT});
       break;
@@ -106,6 +155,27 @@ function objContainsProps(obj, expectedProps) {
   return true;
 }
 
+/**
+ * Returns the colour to draw a player such as "p1" in, preferring the colour
+ * the player was assigned.
+ */
+function colourOf(id) {
+  if (id in gPlayerColours) {
+    return gPlayerColours[id];
+  }
+  return PLAYER_CODE_TO_COLOUR[id];
+}
+
+/**
+ * Returns the colour to draw a cell in.
+ */
+function colourOfCell(cell) {
+  if (cell.player) {
+    return colourOf(cell.player);
+  }
+  return CELL_TYPE_TO_COLOUR[cell.type];
+}
+
 function hideIntroScreen() {
   let introElem = document.getElementById("intro");
   if (!introElem) {
@@ -115,37 +185,71 @@ function hideIntroScreen() {
   introElem.style.display = "none";
 }
 
+/**
+ * Applies changed cells to the last game state and renders it. Changes
+ * arriving before a whole game state are dropped, since there's nothing to
+ * apply them to; a whole one follows soon.
+ *
+ * @param {Object[]} changes
+ *        Cells that changed, each like {x: 1, y: 2, type: "trail",
+ *        player: "p1"}, or with type "empty" if it was cleared.
+ */
+function handleGameStateDelta(changes) {
+  console.log('onGameStateDelta')
+  if (!gBoard) {
+    return;
+  }
+  for (let change of changes) {
+    gBoard[change.y][change.x] = change.type === "empty" ? null : change;
+  }
+  renderBoard();
+}
+
 /**
  * Renders to the canvas a representation of the given game state.
  *
- * @param {String[][]} state
- *        A "board" object as defined in node.go.
+ * @param {Object} state
+ *        A board like {size: 10, cells: [...]}, listing the cells that aren't
+ *        empty, as defined in boarddto.go.
  */
 function handleGameStateUpdate(state) {
   console.log('onGameStateUpdate')
-  if (!(state instanceof Array)) {
-    throw new Error("Passed game state that isn't an array");
+  if (!objContainsProps(state, ["size", "cells"])) {
+    throw new Error("Passed game state that isn't a board");
+  }
+  gBoard = [];
+  for (let y = 0; y < state.size; y++) {
+    gBoard.push(new Array(state.size).fill(null));
+  }
+  for (let cell of state.cells) {
+    gBoard[cell.y][cell.x] = cell;
   }
+  gPlayers = state.players || [];
+  renderBoard();
+}
 
+/**
+ * Renders gBoard to the canvas.
+ */
+function renderBoard() {
   // For now, we want to throw away the existing canvas and repaint everything
   // whenever we get an update. All of this is pretty inefficient, but probably
   // serves the requirements of this project well enough.
   gCanvas.dispose();
+  // The board is a bit bigger with a border around it.
+  gCanvas.setWidth(gBoard.length * PLAYER_RECT_WIDTH);
+  gCanvas.setHeight(gBoard.length * PLAYER_RECT_HEIGHT);
 
-  for (let y = 0; y < state.length; y ++) {
-    let row = state[y];
-    if (!(row instanceof Array)) {
-      throw new Error("Passed row that isn't an array");
-    }
-
-    for (let x = 0; x < row.length; x++) {
-      let playerCode = state[y][x];
-      if (playerCode.length != 2) {
+  for (let y = 0; y < gBoard.length; y ++) {
+    for (let x = 0; x < gBoard[y].length; x++) {
+      let cell = gBoard[y][x];
+      if (!cell) {
         continue;
       }
 
-      if (!(playerCode in PLAYER_CODE_TO_COLOUR)) {
-        throw new Error("State contains unknown player code: " + playerCode);
+      let colour = colourOfCell(cell);
+      if (!colour) {
+        throw new Error("State contains unknown cell: " + JSON.stringify(cell));
       }
 
       let canvasProps = {
@@ -153,15 +257,15 @@ function handleGameStateUpdate(state) {
         top: y * PLAYER_RECT_HEIGHT,
         width: PLAYER_RECT_WIDTH,
         height: PLAYER_RECT_HEIGHT,
-        fill: PLAYER_CODE_TO_COLOUR[playerCode],
+        fill: colour,
       };
       // If this is a trail, lower the opacity to make it visually obvious.
-      if (playerCode.charAt(0) == "t") {
+      if (cell.type === "trail") {
         canvasProps.opacity = 0.5;
       }
       gCanvas.add(new fabric.Rect(canvasProps));
       // If the player is dead, we want to overlay a indicator on top.
-      if (playerCode.charAt(0) == "d") {
+      if (cell.type === "dead") {
         gCanvas.add(new fabric.Line([
           canvasProps.left,
           canvasProps.top,
@@ -175,16 +279,124 @@ function handleGameStateUpdate(state) {
       }
     }
   }
+  renderFollowed();
+}
+
+/**
+ * Outlines the head of the player being followed and says where they are.
+ */
+function renderFollowed() {
+  let followElem = document.getElementById("followMsg");
+  let player = gPlayers.find(p => p.id === gFollowId);
+  if (!player) {
+    followElem.innerHTML = "";
+    return;
+  }
+  gCanvas.add(new fabric.Rect({
+    left: player.x * PLAYER_RECT_WIDTH,
+    top: player.y * PLAYER_RECT_HEIGHT,
+    width: PLAYER_RECT_WIDTH,
+    height: PLAYER_RECT_HEIGHT,
+    fill: "transparent",
+    stroke: "yellow",
+    strokeWidth: 4,
+  }));
+  followElem.innerHTML = "Following " + player.id + " at (" + player.x + ", " +
+      player.y + "), heading " + player.direction +
+      (player.alive ? "" : ", dead");
+}
+
+/**
+ * Follows the player with the given id, or stops following them if we were.
+ */
+function follow(id) {
+  gFollowId = gFollowId === id ? null : id;
+  if (gBoard) {
+    renderBoard();
+  }
 }
 
 /**
  * Starts the game when we are paired with enough players.
  */
-function startGame(id, addr, direction) {
+function startGame(id, addr, direction, allowDiagonal, lives, name, colours,
+                   reversalLethal, players) {
+  gPlayerColours = colours || {};
+  gPlayers = players || [];
+  gAllowDiagonal = !!allowDiagonal;
+  gReversalLethal = !!reversalLethal;
   curDirection = getDirectionCode(direction);
   window.onkeydown = handleKeyPress;
   hideIntroScreen();
-  document.getElementById('stats').innerHTML = '<h3 style="color:' + PLAYER_CODE_TO_COLOUR[id]  + '">Player : ' + id + ' ' + addr  + '</h3>';
+  // Clear what's left of the last game of a series.
+  gGameEnded = false;
+  for (let msg of ["deadMsg", "winMsg", "gameOverMsg"]) {
+    document.getElementById(msg).style.display = "none";
+  }
+  document.getElementById("killFeed").innerHTML = "";
+  // Names come from other players, so they're set as text, never as markup.
+  let stats = document.getElementById('stats');
+  stats.innerHTML = '<h3></h3><h4 id="livesMsg"></h4><h4 id="seriesMsg"></h4>';
+  let title = stats.querySelector('h3');
+  title.style.color = colourOf(id);
+  title.textContent = 'Player : ' + name + ' ' + addr;
+  gShowLives = lives > 1;
+  updateLives(lives);
+}
+
+/**
+ * Shows how many lives the player has left, if the game has lives at all.
+ */
+function updateLives(lives) {
+  if (!gShowLives) {
+    return;
+  }
+  document.getElementById("livesMsg").innerHTML = "Lives: " + lives;
+}
+
+/**
+ * Starts watching a game from the leader's spectator hub, without a player to
+ * control.
+ *
+ * @param {Object} names
+ *        Maps each player's id to their display name.
+ * @param {Object} colours
+ *        Maps each player's id to the colour they're drawn in.
+ */
+function spectateGame(names, colours, players) {
+  console.log('spectateGame', names)
+  gPlayerColours = colours || {};
+  gPlayers = players || [];
+  hideIntroScreen();
+  // Clicking a player's name follows them.
+  let stats = document.getElementById('stats');
+  stats.innerHTML = '<h3>Spectating</h3><h4></h4>';
+  let legend = stats.querySelector('h4');
+  for (let id in names) {
+    let span = document.createElement("span");
+    span.style.color = colourOf(id);
+    span.style.cursor = "pointer";
+    span.onclick = () => follow(id);
+    span.textContent = names[id];
+    legend.appendChild(span);
+    legend.appendChild(document.createTextNode(" "));
+  }
+}
+
+/**
+ * The game is part of a series, and score is how many of its games each player
+ * has won so far, e.g. "Best of 3: alice 1, bob 0".
+ */
+function onSeriesScore(score) {
+  document.getElementById("seriesMsg").textContent = score;
+}
+
+/**
+ * Player crashed but had a life to spare.
+ */
+function onPlayerRespawn(livesLeft) {
+  console.log('onPlayerRespawn', livesLeft)
+  updateLives(livesLeft);
 }
 
 /**
@@ -195,6 +407,10 @@ function getDirectionCode(direction) {
      if (direction === Direction.DOWN) return S;
      if (direction === Direction.RIGHT) return D;
      if (direction === Direction.LEFT) return A;
+     if (direction === Direction.UP_LEFT) return Q;
+     if (direction === Direction.UP_RIGHT) return E;
+     if (direction === Direction.DOWN_LEFT) return Z;
+     if (direction === Direction.DOWN_RIGHT) return C;
 }
 
 /**
@@ -211,6 +427,27 @@ function onPlayerDeath() {
   document.getElementById("deadMsg").style.display = "inline";
 }
 
+/**
+ * Someone died. Adds a line saying what killed them to the kill feed.
+ */
+function onKill(event) {
+  console.log('onKill', event)
+  let line = event.Victim;
+  if (event.Cause === "reversal") {
+    line += " reversed into their own neck";
+  } else if (event.Killer && event.Killer !== event.Victim) {
+    line += " hit " + event.Killer + "'s " + event.Cause;
+  } else if (event.Killer) {
+    line += " hit their own " + event.Cause;
+  } else {
+    line += " died: " + event.Cause;
+  }
+  let entry = document.createElement("div");
+  entry.style.color = colourOf(event.Victim);
+  entry.textContent = line;
+  document.getElementById("killFeed").appendChild(entry);
+}
+
 /**
  * Player won the game.
  */
@@ -224,13 +461,80 @@ function onPlayerVictory() {
   document.getElementById("winMsg").style.display = "inline";
 }
 
+/**
+ * The game ended without a winner. This is shown even if we already died, since
+ * everyone who was left died with us.
+ */
+function onGameOver(reason) {
+  console.log('onGameOver', reason)
+  gGameEnded = true;
+  window.onkeydown = null;
+  document.getElementById("deadMsg").style.display = "none";
+  let gameOverElem = document.getElementById("gameOverMsg");
+  gameOverElem.textContent = "Game over, " + reason + "!";
+  gameOverElem.style.display = "inline";
+}
+
+/**
+ * The matchmaking server wouldn't put us in a game.
+ */
+function onJoinRejected(status) {
+  console.log('onJoinRejected', status)
+  let reason = "the game room is full";
+  if (status === "server_busy") {
+    reason = "the server is busy with other games";
+  } else if (status === "rejected_name") {
+    reason = "the name is too long or has unprintable characters";
+  } else if (status === "unreachable") {
+    reason = "the matchmaking server couldn't be reached";
+  }
+  document.getElementById("lookingMsg").innerHTML =
+      "Couldn't join because " + reason + ". Refresh to try again.";
+  document.querySelector("#intro .loader").style.display = "none";
+}
+
+/**
+ * Another player waiting in our room said something. Their text is added as
+ * text rather than HTML, so they can't inject markup.
+ */
+function onChat(from, text) {
+  console.log('onChat', from, text)
+  let line = document.createElement("div");
+  line.textContent = from + ": " + text;
+  document.getElementById("chatLog").appendChild(line);
+}
+
+/**
+ * Sends what's in the chat box to the players waiting with us. It's shown in
+ * the chat log once the matchmaking server takes it.
+ */
+function sendChat(event) {
+  event.preventDefault();
+  let input = document.getElementById("chatInput");
+  let text = input.value.trim();
+  if (!text) {
+    return;
+  }
+  gSocket.emit("sendChat", text);
+  input.value = "";
+}
+
 function main() {
   console.log('main')
   // Register handlers.
   gSocket.on("startGame", startGame);
+  gSocket.on("spectateGame", spectateGame);
   gSocket.on("gameStateUpdate", handleGameStateUpdate);
+  gSocket.on("gameStateDelta", handleGameStateDelta);
   gSocket.on("playerDead", onPlayerDeath);
+  gSocket.on("kill", onKill);
   gSocket.on("playerVictory", onPlayerVictory);
+  gSocket.on("playerRespawn", onPlayerRespawn);
+  gSocket.on("gameOver", onGameOver);
+  gSocket.on("seriesScore", onSeriesScore);
+  gSocket.on("joinRejected", onJoinRejected);
+  gSocket.on("chat", onChat);
+  document.querySelector("#intro .login-form").onsubmit = sendChat;
 }
 
 main();
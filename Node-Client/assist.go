@@ -0,0 +1,66 @@
+package main
+
+// This file implements steering assist, a last-chance dodge for players whose
+// input stalls while they're boxed in. With it on, a player about to run into
+// a wall, a trail or another player turns to a free cell next to them instead,
+// if there is one. Every node works the dodge out the same way from the same
+// board, so it needs no messages. Reversals are left alone, since the player
+// chose to make them.
+
+var steeringAssist bool // Whether players about to crash dodge to a free cell.
+
+// The direction a node at x, y heading in direction can dodge to: the turn
+// onto a free cell with the most room beyond it, preferring the order
+// bounceDirection tries them in on ties. Returns "" if every turn collides.
+// mutex must be held.
+func dodgeDirection(x int, y int, direction string) string {
+	best := ""
+	bestRoom := 0
+	for _, d := range []string{DIRECTION_UP, DIRECTION_RIGHT, DIRECTION_DOWN,
+		DIRECTION_LEFT, DIRECTION_UP_LEFT, DIRECTION_UP_RIGHT,
+		DIRECTION_DOWN_RIGHT, DIRECTION_DOWN_LEFT} {
+		if d == direction || d == opposite(direction) || !isValidDirection(d) {
+			continue
+		}
+		newX, newY := nextPosition(x, y, d)
+		if nodeHasCollided(x, y, newX, newY) != COLLISION_NONE {
+			continue
+		}
+		room := roomAhead(newX, newY, d)
+		if best == "" || room > bestRoom {
+			best = d
+			bestRoom = room
+		}
+	}
+	return best
+}
+
+// Free cells in a straight line from x, y heading in direction, up to the
+// first collision. mutex must be held.
+func roomAhead(x int, y int, direction string) int {
+	room := 0
+	for {
+		newX, newY := nextPosition(x, y, direction)
+		if nodeHasCollided(x, y, newX, newY) != COLLISION_NONE {
+			return room
+		}
+		x, y = newX, newY
+		room++
+	}
+}
+
+// Turn node, at x, y and about to collide, to dodge if steering assist is on
+// and there's a free cell to dodge to. Returns whether it turned. mutex must
+// be held.
+func dodgeCollision(node *Node, x int, y int) bool {
+	if !steeringAssist {
+		return false
+	}
+	dodged := dodgeDirection(x, y, node.Direction)
+	if dodged == "" {
+		return false
+	}
+	localLog("NODE " + node.Id + " DODGED " + node.Direction + " TO " + dodged)
+	node.Direction = dodged
+	return true
+}
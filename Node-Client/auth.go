@@ -0,0 +1,42 @@
+package main
+
+// This file implements authenticating packets between peers with a secret
+// shared by everyone in the game, so other hosts can't forge messages.
+//
+// An authenticated packet is the HMAC-SHA256 of the payload followed by the
+// payload itself.
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+)
+
+var roomSecret []byte // Secret for the current game from the ms server.
+
+// Prefix data with its HMAC, if the game has a secret.
+func signPacket(data []byte) []byte {
+	if len(roomSecret) == 0 {
+		return data
+	}
+	mac := hmac.New(sha256.New, roomSecret)
+	mac.Write(data)
+	return append(mac.Sum(nil), data...)
+}
+
+// Check the HMAC of a packet made by signPacket, returning its payload.
+func verifyPacket(packet []byte) ([]byte, error) {
+	if len(roomSecret) == 0 {
+		return packet, nil
+	}
+	if len(packet) < sha256.Size {
+		return nil, errors.New("packet is too short to be authenticated")
+	}
+	packetMac, data := packet[:sha256.Size], packet[sha256.Size:]
+	mac := hmac.New(sha256.New, roomSecret)
+	mac.Write(data)
+	if !hmac.Equal(packetMac, mac.Sum(nil)) {
+		return nil, errors.New("packet has a bad HMAC")
+	}
+	return data, nil
+}
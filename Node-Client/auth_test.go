@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestVerifyPacket(t *testing.T) {
+	roomSecret = []byte("room secret")
+	defer func() { roomSecret = nil }()
+	data := []byte(`{"IsLeader":true}`)
+
+	signed := signPacket(data)
+	if payload, err := verifyPacket(signed); err != nil || string(payload) != string(data) {
+		t.Errorf("signed packet verified as %q, %v, want %q", payload, err, data)
+	}
+
+	forged := append([]byte(nil), signed...)
+	forged[0] ^= 1
+	if _, err := verifyPacket(forged); err == nil {
+		t.Errorf("packet with a wrong HMAC verified")
+	}
+
+	roomSecret = []byte("another room's secret")
+	if _, err := verifyPacket(signed); err == nil {
+		t.Errorf("packet signed with another secret verified")
+	}
+
+	for _, unsigned := range [][]byte{data, append(make([]byte, 32), data...)} {
+		if _, err := verifyPacket(unsigned); err == nil {
+			t.Errorf("packet without an HMAC verified: %q", unsigned)
+		}
+	}
+}
+
+func TestProcessPacketAuthenticates(t *testing.T) {
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 1, Y: 1}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 1, Y: 5}, Direction: DIRECTION_RIGHT},
+	)
+	// We lead, and p2's turns reach us.
+	p2 := nodes[1]
+	roomSecret = []byte("room secret")
+	defer func() { roomSecret = nil }()
+	turn := *p2
+	turn.Direction = DIRECTION_DOWN
+	data, err := json.Marshal(&Message{IsDirectionChange: true, Node: turn})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed := signPacket(data)
+	forged := append([]byte(nil), signed...)
+	forged[len(forged)-1] = ' '
+	for _, packet := range [][]byte{data, forged} {
+		deliverPacketFrom(t, p2, packet)
+		if p2.Direction != DIRECTION_RIGHT {
+			t.Fatalf("unauthenticated turn %q took p2 %s", packet, p2.Direction)
+		}
+	}
+
+	deliverPacketFrom(t, p2, signed)
+	if p2.Direction != DIRECTION_DOWN {
+		t.Errorf("signed turn left p2 heading %s, want %s", p2.Direction, DIRECTION_DOWN)
+	}
+}
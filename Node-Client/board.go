@@ -0,0 +1,166 @@
+package main
+
+// This file implements reading and writing cells of the board, and a compact,
+// canonical encoding of it and of changes to it, for sending it to peers and
+// saving it.
+//
+// The board is indexed row first, so the cell at a position is b[Y][X]. Code
+// reading or writing a single cell goes through cellAt and setCell rather
+// than indexing the board itself, so the axes can't get swapped.
+//
+// The board is read row by row as runs of identical cells. Each run is written
+// as its length in decimal followed by the two character cell ("p1", "t1", "d1",
+// ...), with ".." standing in for empty cells. Since cells never start with a
+// digit, no separators are needed, e.g. "11..1p188.." for a board with one
+// player on it.
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const emptyCellCode string = ".." // Stands in for an empty cell when encoding.
+
+// The cell at pos on b.
+func cellAt(b *[BOARD_SIZE][BOARD_SIZE]string, pos Pos) string {
+	return b[pos.Y][pos.X]
+}
+
+// Set the cell at pos on b to v.
+func setCell(b *[BOARD_SIZE][BOARD_SIZE]string, pos Pos, v string) {
+	b[pos.Y][pos.X] = v
+}
+
+// Whether x, y is on the board.
+func isOnBoard(x int, y int) bool {
+	return x >= 0 && y >= 0 && x < BOARD_SIZE && y < BOARD_SIZE
+}
+
+// Encodes and decodes boards.
+type BoardCodec struct{}
+
+// Encode a board as runs of cells.
+func (BoardCodec) Marshal(b *[BOARD_SIZE][BOARD_SIZE]string) []byte {
+	var sb strings.Builder
+	run := 0
+	prev := ""
+	for i := 0; i < BOARD_SIZE*BOARD_SIZE; i++ {
+		cell := b[i/BOARD_SIZE][i%BOARD_SIZE]
+		if i > 0 && cell != prev {
+			writeRun(&sb, run, prev)
+			run = 0
+		}
+		prev = cell
+		run++
+	}
+	writeRun(&sb, run, prev)
+	return []byte(sb.String())
+}
+
+func writeRun(sb *strings.Builder, run int, cell string) {
+	sb.WriteString(strconv.Itoa(run))
+	if cell == "" {
+		sb.WriteString(emptyCellCode)
+	} else {
+		sb.WriteString(cell)
+	}
+}
+
+// Decode a board encoded by Marshal.
+func (BoardCodec) Unmarshal(data []byte) (*[BOARD_SIZE][BOARD_SIZE]string, error) {
+	var b [BOARD_SIZE][BOARD_SIZE]string
+	i := 0
+	for pos := 0; pos < len(data); {
+		start := pos
+		for pos < len(data) && data[pos] >= '0' && data[pos] <= '9' {
+			pos++
+		}
+		run, err := strconv.Atoi(string(data[start:pos]))
+		if err != nil || run <= 0 {
+			return nil, fmt.Errorf("bad run length at %d", start)
+		}
+		if pos+2 > len(data) {
+			return nil, fmt.Errorf("missing cell at %d", pos)
+		}
+		cell := string(data[pos : pos+2])
+		pos += 2
+		if cell == emptyCellCode {
+			cell = ""
+		}
+		if i+run > BOARD_SIZE*BOARD_SIZE {
+			return nil, fmt.Errorf("encoded board has over %d cells", BOARD_SIZE*BOARD_SIZE)
+		}
+		for ; run > 0; run-- {
+			b[i/BOARD_SIZE][i%BOARD_SIZE] = cell
+			i++
+		}
+	}
+	if i != BOARD_SIZE*BOARD_SIZE {
+		return nil, fmt.Errorf("encoded board has %d cells, expected %d",
+			i, BOARD_SIZE*BOARD_SIZE)
+	}
+	return &b, nil
+}
+
+// Encode the cells of to that differ from from, each as its index on the board
+// (counting row by row) in decimal followed by its two character cell, e.g.
+// "12p113t1" for a player that moved from cell 13 to 12.
+func (BoardCodec) MarshalDelta(from, to *[BOARD_SIZE][BOARD_SIZE]string) []byte {
+	var sb strings.Builder
+	for i := 0; i < BOARD_SIZE*BOARD_SIZE; i++ {
+		cell := to[i/BOARD_SIZE][i%BOARD_SIZE]
+		if cell != from[i/BOARD_SIZE][i%BOARD_SIZE] {
+			writeRun(&sb, i, cell)
+		}
+	}
+	return []byte(sb.String())
+}
+
+// Apply a delta encoded by MarshalDelta to b, returning the positions it
+// changed. b is left untouched if the delta is malformed.
+func (BoardCodec) ApplyDelta(b *[BOARD_SIZE][BOARD_SIZE]string, data []byte) ([]Pos, error) {
+	changes := make(map[Pos]string)
+	changed := make([]Pos, 0)
+	for pos := 0; pos < len(data); {
+		start := pos
+		for pos < len(data) && data[pos] >= '0' && data[pos] <= '9' {
+			pos++
+		}
+		i, err := strconv.Atoi(string(data[start:pos]))
+		if err != nil || i >= BOARD_SIZE*BOARD_SIZE {
+			return nil, fmt.Errorf("bad cell index at %d", start)
+		}
+		if pos+2 > len(data) {
+			return nil, fmt.Errorf("missing cell at %d", pos)
+		}
+		cell := string(data[pos : pos+2])
+		pos += 2
+		if cell == emptyCellCode {
+			cell = ""
+		}
+		p := Pos{X: i % BOARD_SIZE, Y: i / BOARD_SIZE}
+		changes[p] = cell
+		changed = append(changed, p)
+	}
+	for p, cell := range changes {
+		setCell(b, p, cell)
+	}
+	return changed, nil
+}
+
+// Stable form of a board with two characters per cell, row by row, e.g. for
+// hashing. Equal boards always have the same form.
+func (BoardCodec) String(b *[BOARD_SIZE][BOARD_SIZE]string) string {
+	var sb strings.Builder
+	for y := 0; y < BOARD_SIZE; y++ {
+		for x := 0; x < BOARD_SIZE; x++ {
+			if b[y][x] == "" {
+				sb.WriteString(emptyCellCode)
+			} else {
+				sb.WriteString(b[y][x])
+			}
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// A board with each cell filled with probability density from the cells a
+// game can have.
+func randomBoard(r *rand.Rand, density float64) *[BOARD_SIZE][BOARD_SIZE]string {
+	cells := []string{"p1", "p2", "p3", "t1", "t2", "t3", "d1", "d2"}
+	var b [BOARD_SIZE][BOARD_SIZE]string
+	for y := 0; y < BOARD_SIZE; y++ {
+		for x := 0; x < BOARD_SIZE; x++ {
+			if r.Float64() < density {
+				b[y][x] = cells[r.Intn(len(cells))]
+			}
+		}
+	}
+	return &b
+}
+
+func TestBoardCodecRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		b := randomBoard(r, r.Float64())
+		data := BoardCodec{}.Marshal(b)
+		got, err := BoardCodec{}.Unmarshal(data)
+		if err != nil {
+			t.Fatalf("unmarshaling %q: %v", data, err)
+		}
+		if *got != *b {
+			t.Fatalf("%q came back as %q", BoardCodec{}.String(b), BoardCodec{}.String(got))
+		}
+	}
+}
+
+func TestBoardCodecDeltaRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	for i := 0; i < 200; i++ {
+		from, to := randomBoard(r, 0.3), randomBoard(r, 0.3)
+		b := *from
+		if _, err := (BoardCodec{}).ApplyDelta(&b, BoardCodec{}.MarshalDelta(from, to)); err != nil {
+			t.Fatal(err)
+		}
+		if b != *to {
+			t.Fatalf("delta applied to %q gave %q, want %q", BoardCodec{}.String(from),
+				BoardCodec{}.String(&b), BoardCodec{}.String(to))
+		}
+	}
+}
+
+func TestBoardCodecSmallerThanJSON(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	for i := 0; i < 50; i++ {
+		b := randomBoard(r, 0.1)
+		naive, err := json.Marshal(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if encoded := (BoardCodec{}).Marshal(b); len(encoded) >= len(naive) {
+			t.Errorf("sparse board encoded in %d bytes, JSON takes %d", len(encoded), len(naive))
+		}
+	}
+}
+
+func TestBoardCodecRejectsMalformed(t *testing.T) {
+	for _, data := range []string{"", "1p1", "0..", "p1", "5..", "999..", "3p"} {
+		if _, err := (BoardCodec{}).Unmarshal([]byte(data)); err == nil {
+			t.Errorf("unmarshaled %q without an error", data)
+		}
+	}
+}
+
+func TestCellAtSetCell(t *testing.T) {
+	var b [BOARD_SIZE][BOARD_SIZE]string
+	pos := Pos{X: 2, Y: 7}
+	setCell(&b, pos, "t3")
+	if got := cellAt(&b, pos); got != "t3" {
+		t.Errorf("cell at %v is %q after setting it to t3", pos, got)
+	}
+	// X is the column and Y the row.
+	if b[7][2] != "t3" || b[2][7] != "" {
+		t.Errorf("setting %v set the wrong cell:\n%s", pos, BoardCodec{}.String(&b))
+	}
+}
+
+func TestPrintBoard(t *testing.T) {
+	var b [BOARD_SIZE][BOARD_SIZE]string
+	b[1][0], b[1][1] = "t1", "p1"
+	var out bytes.Buffer
+	printBoard(&out, &b)
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != BOARD_SIZE+1 {
+		t.Fatalf("printed %d lines, want a header and %d rows:\n%s", len(lines), BOARD_SIZE, out.String())
+	}
+	if want := "    0  1  2  3  4  5  6  7  8  9"; lines[0] != want {
+		t.Errorf("header printed as %q, want %q", lines[0], want)
+	}
+	if want := " 1 t1 p1 __ __ __ __ __ __ __ __ "; lines[2] != want {
+		t.Errorf("row 1 printed as %q, want %q", lines[2], want)
+	}
+}
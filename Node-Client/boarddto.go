@@ -0,0 +1,83 @@
+package main
+
+// This file implements the board as sent to the UI and spectators. Rather than
+// the codes the board is kept in, e.g. "t1" or "##", they get the type of each
+// cell and the player it belongs to, so how the board is kept can change
+// without breaking them. Whole boards list only the cells that aren't empty;
+// changes list every cell that changed, with CELL_EMPTY for cleared ones.
+
+// Types of cell sent to the UI.
+const (
+	CELL_EMPTY  string = "empty"
+	CELL_HEAD   string = "head"   // A live player.
+	CELL_DEAD   string = "dead"   // A player who died there.
+	CELL_TRAIL  string = "trail"  // A player's trail.
+	CELL_WALL   string = "wall"   // Closed in by the board shrinking.
+	CELL_MINE   string = "mine"   // A mine the leader placed.
+	CELL_BORDER string = "border" // Drawn around the board with -board-border.
+	CELL_FOG    string = "fog"    // Too far from the player's head to see, see fog.go.
+)
+
+// A cell of the board as sent to the UI.
+type cellDTO struct {
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	Type   string `json:"type"`             // One of the CELL_* constants.
+	Player string `json:"player,omitempty"` // Id of the player a head, dead player or trail is.
+}
+
+// A whole board as sent to the UI.
+type boardDTO struct {
+	Size    int         `json:"size"`    // Cells along each side, including any border.
+	Cells   []cellDTO   `json:"cells"`   // Every cell that isn't empty.
+	Players []playerDTO `json:"players"` // Every player still in the game, see follow.go.
+}
+
+// The cell at x, y holding code, as sent to the UI.
+func cellToDTO(x int, y int, code string) cellDTO {
+	cell := cellDTO{X: x, Y: y, Type: CELL_EMPTY}
+	switch code {
+	case "":
+		return cell
+	case WALL_CELL:
+		cell.Type = CELL_WALL
+		return cell
+	case MINE_CELL:
+		cell.Type = CELL_MINE
+		return cell
+	case BORDER_CELL:
+		cell.Type = CELL_BORDER
+		return cell
+	case FOG_CELL:
+		cell.Type = CELL_FOG
+		return cell
+	}
+	switch code[0] {
+	case 'p':
+		cell.Type = CELL_HEAD
+	case 'd':
+		cell.Type = CELL_DEAD
+	case 't':
+		cell.Type = CELL_TRAIL
+	default:
+		localLog("ERROR: can't send unknown cell", code, "at", x, y, "to the UI")
+		return cell
+	}
+	cell.Player = "p" + code[1:]
+	return cell
+}
+
+// The board b as sent to the UI, with a border if boardBorder is set, and the
+// players on it. mutex must be held.
+func toDTO(b *[BOARD_SIZE][BOARD_SIZE]string) boardDTO {
+	rows, _ := renderedRows(b)
+	dto := boardDTO{Size: len(rows), Cells: make([]cellDTO, 0), Players: playersToDTO()}
+	for y, row := range rows {
+		for x, code := range row {
+			if cell := cellToDTO(x, y, code); cell.Type != CELL_EMPTY {
+				dto.Cells = append(dto.Cells, cell)
+			}
+		}
+	}
+	return dto
+}
@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestToDTOClassifiesCells(t *testing.T) {
+	startStepTest(startingPosition{Pos: &Pos{X: 1, Y: 1}, Direction: DIRECTION_RIGHT})
+	var b [BOARD_SIZE][BOARD_SIZE]string
+	b[1][0], b[1][1] = "t1", "p1"
+	b[3][2] = "d12"
+	b[4][4], b[5][5], b[6][6] = WALL_CELL, MINE_CELL, FOG_CELL
+
+	mutex.Lock()
+	dto := toDTO(&b)
+	mutex.Unlock()
+	want := []cellDTO{
+		{X: 0, Y: 1, Type: CELL_TRAIL, Player: "p1"},
+		{X: 1, Y: 1, Type: CELL_HEAD, Player: "p1"},
+		{X: 2, Y: 3, Type: CELL_DEAD, Player: "p12"},
+		{X: 4, Y: 4, Type: CELL_WALL},
+		{X: 5, Y: 5, Type: CELL_MINE},
+		{X: 6, Y: 6, Type: CELL_FOG},
+	}
+	if dto.Size != BOARD_SIZE || len(dto.Cells) != len(want) {
+		t.Fatalf("board of size %d sent as %+v, want size %d with %+v", dto.Size, dto.Cells, BOARD_SIZE, want)
+	}
+	for i, cell := range want {
+		if dto.Cells[i] != cell {
+			t.Errorf("cell %d sent as %+v, want %+v", i, dto.Cells[i], cell)
+		}
+	}
+	if len(dto.Players) != 1 || dto.Players[0].Id != "p1" {
+		t.Errorf("players sent as %+v, want just p1", dto.Players)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+// This file implements drawing a border around the board when rendering it,
+// so the edge of the board stands out from the empty cells next to it. The
+// border is only added to what's logged and pushed to the UI; the board
+// itself, and so collisions, are unchanged.
+
+// Marker of a border cell in a rendered board.
+const BORDER_CELL string = "=="
+
+var boardBorder bool // Whether rendered boards have a border around them.
+
+// The board b with a ring of BORDER_CELL around it, so cell (x, y) of b is at
+// (x+1, y+1).
+func borderedBoard(b *[BOARD_SIZE][BOARD_SIZE]string) [][]string {
+	size := BOARD_SIZE + 2
+	bordered := make([][]string, size)
+	for y := range bordered {
+		bordered[y] = make([]string, size)
+		for x := range bordered[y] {
+			if x == 0 || y == 0 || x == size-1 || y == size-1 {
+				bordered[y][x] = BORDER_CELL
+			} else {
+				bordered[y][x] = b[y-1][x-1]
+			}
+		}
+	}
+	return bordered
+}
+
+// The rows of b as rendered, with a border if boardBorder is set, and the
+// board coordinate of the first row and column.
+func renderedRows(b *[BOARD_SIZE][BOARD_SIZE]string) ([][]string, int) {
+	if boardBorder {
+		return borderedBoard(b), -1
+	}
+	rows := make([][]string, BOARD_SIZE)
+	for y := range rows {
+		rows[y] = b[y][:]
+	}
+	return rows, 0
+}
+
+// How far cells of the board are shifted along each axis in a rendered board.
+func renderedOffset() int {
+	if boardBorder {
+		return 1
+	}
+	return 0
+}
+
+// Shift changed cells to where they are in a rendered board.
+func borderChanges(changes []cellDTO) []cellDTO {
+	for i := range changes {
+		changes[i].X += renderedOffset()
+		changes[i].Y += renderedOffset()
+	}
+	return changes
+}
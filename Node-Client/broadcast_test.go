@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestLeaderBroadcastRate(t *testing.T) {
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 1, Y: 1}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 1, Y: 5}, Direction: DIRECTION_RIGHT},
+	)
+	givePeerAddr(nodes[1])
+	gameHistory = make(map[string][]*Pos)
+	capturing := capturingTransport{sent: make(chan []byte, 64)}
+	setTransport(capturing)
+	leaderBroadcastRate = intervalUpdateRate / 50
+	defer func() { leaderBroadcastRate = enforceGameStateRate }()
+
+	done := make(chan struct{})
+	go func() {
+		enforceGameState()
+		close(done)
+	}()
+	// A fifth of the time between heartbeats.
+	time.Sleep(intervalUpdateRate / 5)
+	mutex.Lock()
+	gameNumber++
+	mutex.Unlock()
+	<-done
+
+	broadcasts := 0
+	for len(capturing.sent) > 0 {
+		var message Message
+		if err := json.Unmarshal(<-capturing.sent, &message); err != nil {
+			t.Fatal(err)
+		}
+		if !message.IsLeader || message.GameHistory == nil {
+			t.Errorf("broadcast %+v without the game state", message)
+		}
+		broadcasts++
+	}
+	if broadcasts < 5 {
+		t.Errorf("leader broadcast %d times in a fifth of a heartbeat, want about 10", broadcasts)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+// This file implements catching up a follower that went quiet, e.g. while its
+// network dropped out or its process was stalled, and came back before the
+// leader gave up on it. It missed the leader's broadcasts meanwhile, so its
+// board is stale and it can't apply the next board delta. Rather than have it
+// wait for a keyframe that still wouldn't repaint what it missed, or send
+// everyone a keyframe, the leader sends just that follower its whole board as
+// soon as it hears from it again, which the follower adopts outright.
+
+import "time"
+
+// Silence after which the leader catches up a follower it hears from again.
+// Well under the silence after which it's dropped as failed.
+const catchUpAfter time.Duration = 3 * intervalUpdateRate
+
+// LEADER: Catch up the node with the given id if we haven't heard from it in
+// catchUpAfter, given we just did at receivedAt. mutex must be held.
+func catchUpIfReturning(id string, receivedAt time.Time) {
+	last, ok := lastCheckin[id]
+	if !ok || !isLeader() || id == nodeId || receivedAt.Sub(last) < catchUpAfter {
+		return
+	}
+	peer := getNode(id)
+	if peer == nil {
+		return
+	}
+	localLog("Heard from", id, "again after", receivedAt.Sub(last), "catching it up")
+	sendCatchUp(peer)
+}
+
+// LEADER: Send peer our whole board and history to adopt, without changing
+// what our broadcasts are deltas of. mutex must be held.
+func sendCatchUp(peer *Node) {
+	// The board our next delta applies to, so the follower can apply it. It's
+	// at most one broadcast old, and the history brings heads up to date.
+	caughtUp := &sentBoard
+	if broadcastCount == 0 {
+		// Our first broadcast is a keyframe anyways.
+		caughtUp = &board
+	}
+	if fogRadius > 0 {
+		// Our broadcasts are whole boards, fogged for each follower.
+		caughtUp = fogBoard(&board, peer)
+	}
+	history := make(map[string][]*Pos, len(gameHistory))
+	for id, positions := range gameHistory {
+		history[id] = positions
+	}
+	message := &Message{IsLeader: true, IsCatchUp: true, GameHistory: history,
+		Node: *myNode, IsGameOver: !isPlaying(), Winner: winnerId, Tick: tickCount,
+		ShrunkRings: shrunkRings, Mines: mines, Board: string(BoardCodec{}.Marshal(caughtUp))}
+	sendPacketToPeer(peer, message, "catching up "+peer.Id)
+}
+
+// Replace our board with the one the leader sent in message to catch us up,
+// and move nodes' heads to where the leader has them. Call after
+// applyLeaderBoard. mutex must be held.
+func adoptLeaderBoard(message *Message) {
+	if !haveLeaderBoard {
+		// Its board couldn't be decoded, so the next keyframe will have to do.
+		return
+	}
+	if fogRadius > 0 {
+		adoptVisibleCells()
+	} else {
+		board = leaderBoard
+	}
+	paintLeaderChanges(nil)
+	localLog("Caught up with the leader's board at tick", message.Tick)
+}
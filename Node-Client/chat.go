@@ -0,0 +1,50 @@
+package main
+
+// This file implements chatting with the other players waiting in our room.
+// Lines we send go to the matchmaking server, which passes them on to the
+// others with their ReceiveChat RPC. Lines from others are shown in the UI's
+// lobby. The server limits how long lines are and how often we may send one.
+
+import "errors"
+
+// Chat status the matchmaking server replies with when it passed our line on.
+// Anything else says why it didn't.
+const CHAT_SENT string = "sent"
+
+type ChatArgs struct {
+	Token string // The token from our Join.
+	Text  string
+	Log   []byte
+}
+
+type ChatMessage struct {
+	From string // The sender's display name, or the name they're rated under.
+	Text string
+	Log  []byte
+}
+
+// This RPC function is triggered when another player in our room chats.
+func (nc *NodeService) ReceiveChat(args *ChatMessage, response *ValReply) error {
+	logReceive("Rpc Called ReceiveChat", args.Log)
+	localLog("Chat from", args.From+":", args.Text)
+	notifyChatToJS(args.From, args.Text)
+	return nil
+}
+
+// Send a chat line to the other players in our room.
+func sendChat(text string) error {
+	if msService == nil || msToken == "" {
+		return errors.New("not waiting for a game")
+	}
+	var reply ValReply
+	log := logSend("Rpc Call Context.SendChat to " + msServerAddr)
+	err := msService.Call("Context.SendChat", &ChatArgs{Token: msToken, Text: text, Log: log}, &reply)
+	if err != nil {
+		return err
+	}
+	if reply.Val != CHAT_SENT {
+		return errors.New("chat rejected: " + reply.Val)
+	}
+	localLog("Sent chat:", text)
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+// This file estimates the offset between this node's clock and the leader's,
+// NTP style, from timestamps piggybacked on regular messages.
+//
+// Each message carries the time it was sent and, for the peer it's addressed
+// to, the send time of the last message received from that peer along with
+// when it was received. A node receiving such a message from the leader has
+// all four timestamps of a round trip:
+//
+//	t0: we sent a message          t1: the leader received it
+//	t2: the leader sent its reply  t3: we received the reply
+//
+// and can estimate offset = ((t1 - t0) + (t2 - t3)) / 2.
+//
+// The offset is applied to timestamps the leader sends, so that followers
+// agree with it on e.g. when the game started, and so when it runs out of
+// time, even if their clocks don't.
+
+import (
+	"sync"
+	"time"
+)
+
+// When the last message from a peer was sent (by its clock) and received (by
+// ours), in UnixNano.
+type peerTimestamp struct {
+	sentAt     int64
+	receivedAt int64
+}
+
+var clockLock sync.Mutex
+var peerTimestamps = make(map[string]peerTimestamp) // Id of peer : last message timestamps.
+var leaderClockOffset time.Duration                 // Leader's clock minus ours.
+var leaderClockId string                            // Id of the leader the offset is for.
+
+// Fill in the clock fields and sequence number of a message about to be sent
+// to peerId.
+func stampMessage(message *Message, peerId string) {
+	clockLock.Lock()
+	defer clockLock.Unlock()
+	ts := peerTimestamps[peerId]
+	message.EchoSentAt = ts.sentAt
+	message.EchoReceivedAt = ts.receivedAt
+	message.SentAt = time.Now().UnixNano()
+	message.SeqEpoch, message.Seq = nextSeq()
+}
+
+// Record the clock fields of a message from the peer with id fromId that was
+// received at receivedAt, updating the leader offset if it's from the leader.
+func recordMessageTimes(message *Message, fromId string, receivedAt time.Time) {
+	clockLock.Lock()
+	defer clockLock.Unlock()
+	peerTimestamps[fromId] = peerTimestamp{
+		sentAt:     message.SentAt,
+		receivedAt: receivedAt.UnixNano(),
+	}
+
+	if !message.IsLeader || message.EchoSentAt == 0 {
+		return
+	}
+	sample := estimateClockOffset(message.EchoSentAt, message.EchoReceivedAt,
+		message.SentAt, receivedAt.UnixNano())
+	if leaderClockId == fromId {
+		// Smooth out jitter from individual packets.
+		leaderClockOffset = (7*leaderClockOffset + sample) / 8
+	} else {
+		// First estimate, or the leader changed.
+		leaderClockOffset = sample
+		leaderClockId = fromId
+	}
+}
+
+// Estimate the remote clock minus the local one from a round trip, where t0
+// and t3 are local times and t1 and t2 remote ones.
+func estimateClockOffset(t0, t1, t2, t3 int64) time.Duration {
+	return time.Duration(((t1 - t0) + (t2 - t3)) / 2)
+}
+
+// Convert a timestamp taken by the clock of the leader with the given id to
+// our clock. Returns false if we don't know the offset to its clock yet.
+func leaderToLocalTime(t time.Time, leaderId string) (time.Time, bool) {
+	clockLock.Lock()
+	defer clockLock.Unlock()
+	if leaderClockId != leaderId {
+		return t, false
+	}
+	return t.Add(-leaderClockOffset), true
+}
+
+// Take the leader's game start time from a message from it, on our clock, so
+// the game runs out of time when it does for the leader. mutex must be held.
+func adoptLeaderStartTime(message *Message) {
+	if message.StartedAt == 0 || len(nodes) == 0 {
+		return
+	}
+	started, ok := leaderToLocalTime(time.Unix(0, message.StartedAt), nodes[0].Id)
+	if !ok {
+		return
+	}
+	if drift := started.Sub(gameStartTime); drift > time.Second || drift < -time.Second {
+		localLog("Moving our game start by", drift, "to the leader's")
+	}
+	gameStartTime = started
+}
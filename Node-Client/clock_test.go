@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+const testSkew = 3 * time.Second        // Leader's clock minus ours.
+const testDelay = 20 * time.Millisecond // One way, each way.
+
+// Simulate a round trip with a leader whose clock is testSkew ahead of ours,
+// returning t0 to t3 as in clock.go.
+func skewedExchange(base time.Time) (t0, t1, t2, t3 time.Time) {
+	t0 = base
+	t1 = t0.Add(testDelay + testSkew)
+	t2 = t1.Add(5 * time.Millisecond)
+	t3 = t2.Add(testDelay - testSkew)
+	return
+}
+
+func resetClock() {
+	peerTimestamps = make(map[string]peerTimestamp)
+	leaderClockOffset = 0
+	leaderClockId = ""
+}
+
+func TestEstimateClockOffset(t *testing.T) {
+	t0, t1, t2, t3 := skewedExchange(time.Now())
+	offset := estimateClockOffset(t0.UnixNano(), t1.UnixNano(), t2.UnixNano(), t3.UnixNano())
+	if offset != testSkew {
+		t.Errorf("offset = %v, want %v", offset, testSkew)
+	}
+}
+
+func TestRecordMessageTimesFromLeader(t *testing.T) {
+	resetClock()
+	t0, t1, t2, t3 := skewedExchange(time.Now())
+	message := &Message{IsLeader: true, EchoSentAt: t0.UnixNano(),
+		EchoReceivedAt: t1.UnixNano(), SentAt: t2.UnixNano()}
+	recordMessageTimes(message, "leader", t3)
+
+	if _, ok := leaderToLocalTime(t2, "other"); ok {
+		t.Errorf("converted a time from a node we have no offset for")
+	}
+	local, ok := leaderToLocalTime(t2, "leader")
+	if !ok {
+		t.Fatalf("no offset for the leader after a round trip")
+	}
+	if want := t2.Add(-testSkew); !local.Equal(want) {
+		t.Errorf("leader's %v is our %v, want %v", t2, local, want)
+	}
+
+	// Our next message to the leader echoes its timestamps back.
+	reply := &Message{}
+	stampMessage(reply, "leader")
+	if reply.EchoSentAt != t2.UnixNano() || reply.EchoReceivedAt != t3.UnixNano() {
+		t.Errorf("echoed %d, %d, want %d, %d", reply.EchoSentAt,
+			reply.EchoReceivedAt, t2.UnixNano(), t3.UnixNano())
+	}
+}
+
+func TestRecordMessageTimesFromFollower(t *testing.T) {
+	resetClock()
+	t0, t1, t2, t3 := skewedExchange(time.Now())
+	message := &Message{EchoSentAt: t0.UnixNano(),
+		EchoReceivedAt: t1.UnixNano(), SentAt: t2.UnixNano()}
+	recordMessageTimes(message, "follower", t3)
+	if _, ok := leaderToLocalTime(t2, "follower"); ok {
+		t.Errorf("took a clock offset from a follower")
+	}
+}
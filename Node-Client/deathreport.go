@@ -0,0 +1,126 @@
+package main
+
+// This file implements making sure every peer hears about a death. The leader
+// sends death reports over UDP, so some may be lost, and a peer that misses
+// one keeps the dead node alive and can't tell when the game is won. Rather
+// than answering each report with a packet of its own, a peer lists the
+// sequence numbers of the last death reports it got in its interval updates,
+// which it sends anyways. The leader repeats each report to the peers that
+// haven't listed it until they do, they leave the game or maxDeathResends
+// passes. Handling a death report is idempotent, so repeats are harmless.
+
+import "time"
+
+const (
+	// Long enough for an interval update to carry the ack back first.
+	deathResendRate time.Duration = 2 * intervalUpdateRate
+	maxDeathResends int           = 10 // Peers still missing by then are left to node failure detection.
+	maxAcks         int           = 16 // Sequence numbers listed in each interval update.
+)
+
+// A death report that some peers haven't acknowledged yet.
+type pendingDeath struct {
+	dead    Node                // The dead node, as reported.
+	event   *CollisionEvent     // What killed it.
+	waiting map[string][]uint64 // Id : sequence numbers of the reports the peer hasn't acknowledged.
+	resends int
+}
+
+var pendingDeaths map[string]*pendingDeath // Id of the dead node : its report.
+var recentAcks []uint64                    // Sequence numbers of the last death reports we got, oldest first.
+
+// LEADER: Report node's death to every peer, and note that we did, so it's
+// repeated until they acknowledge it. mutex must be held.
+func sendDeathReports(node *Node, event *CollisionEvent) {
+	pending := &pendingDeath{dead: *node, event: event, waiting: make(map[string][]uint64)}
+	for _, peer := range nodes {
+		if peer.Id != nodeId && !isOwnAddr(peer.Ip) {
+			sendDeathReport(pending, peer, "Node "+node.Id+" is dead, reporting sorrowful death")
+		}
+	}
+	if len(pending.waiting) > 0 {
+		pendingDeaths[node.Id] = pending
+	}
+}
+
+// LEADER: Send pending's report to peer, noting the sequence number it was
+// sent with. mutex must be held.
+func sendDeathReport(pending *pendingDeath, peer *Node, logMsg string) {
+	message := &Message{IsDeathReport: true, Node: pending.dead, Collision: pending.event}
+	sendPacketToPeer(peer, message, logMsg)
+	pending.waiting[peer.Id] = append(pending.waiting[peer.Id], message.Seq)
+}
+
+// LEADER: Note that the peer with the given id got the death reports with the
+// sequence numbers in acks. mutex must be held.
+func ackDeathReports(from string, acks []uint64) {
+	for dead, pending := range pendingDeaths {
+		if !containsSeq(acks, pending.waiting[from]) {
+			continue
+		}
+		delete(pending.waiting, from)
+		if len(pending.waiting) == 0 {
+			debugLog("Every peer knows", dead, "is dead")
+			delete(pendingDeaths, dead)
+		}
+	}
+}
+
+// Whether any of seqs is in acks.
+func containsSeq(acks []uint64, seqs []uint64) bool {
+	for _, seq := range seqs {
+		for _, ack := range acks {
+			if ack == seq {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Note that we got a death report with the given sequence number, so our
+// next interval updates acknowledge it. mutex must be held.
+func noteDeathReport(seq uint64) {
+	if seq == 0 {
+		// From a node that doesn't number its messages.
+		return
+	}
+	recentAcks = append(recentAcks, seq)
+	if len(recentAcks) > maxAcks {
+		recentAcks = recentAcks[len(recentAcks)-maxAcks:]
+	}
+}
+
+// LEADER: Repeat death reports to the peers that haven't acknowledged them,
+// until the game is over.
+func resendDeathReports() {
+	game := gameNumber
+	for isPlayingGame(game) {
+		time.Sleep(deathResendRate)
+		mutex.Lock()
+		for dead, pending := range pendingDeaths {
+			if !isLeader() {
+				// Whoever leads now reports deaths.
+				delete(pendingDeaths, dead)
+				continue
+			}
+			if pending.resends >= maxDeathResends {
+				localLog("Giving up on acknowledgements of", dead, "dying from",
+					len(pending.waiting), "peers")
+				delete(pendingDeaths, dead)
+				continue
+			}
+			pending.resends++
+			for id := range pending.waiting {
+				peer := getNode(id)
+				if peer == nil {
+					// Dropped as failed, so it won't acknowledge.
+					delete(pending.waiting, id)
+					continue
+				}
+				sendDeathReport(pending, peer, "repeating death report of "+dead)
+			}
+		}
+		mutex.Unlock()
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import "testing"
+
+func TestRepeatedDeathReportCountedOnce(t *testing.T) {
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 1, Y: 1}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 1, Y: 5}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 1, Y: 8}, Direction: DIRECTION_RIGHT},
+	)
+	// We're p2, following p1, which reports p3 dead.
+	nodeId = nodes[1].Id
+	myNode = nodes[1]
+	recentAcks = nil
+
+	dead := *nodes[2]
+	dead.IsAlive = false
+	// The report, a duplicate of its packet, then the leader repeating it.
+	for _, seq := range []uint64{5, 5, 6} {
+		deliverFrom(t, nodes[0], &Message{IsDeathReport: true,
+			Node: dead, SeqEpoch: 1, Seq: seq})
+	}
+
+	if aliveNodes != 2 {
+		t.Errorf("%d nodes alive after p3's death was reported three times, want 2", aliveNodes)
+	}
+	if nodes[2].IsAlive {
+		t.Errorf("p3 still alive")
+	}
+	if len(recentAcks) != 2 || recentAcks[0] != 5 || recentAcks[1] != 6 {
+		t.Errorf("acknowledging %v, want both reports, [5 6]", recentAcks)
+	}
+}
+
+func TestDeathReportPendingUntilAcked(t *testing.T) {
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 1, Y: 1}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 1, Y: 5}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 1, Y: 8}, Direction: DIRECTION_RIGHT},
+	)
+	nodes[1].Ip = "127.0.0.1:19872"
+	nodes[2].Ip = "127.0.0.1:19873"
+
+	// We lead and report p3 dead.
+	sendDeathReports(nodes[2], nil)
+	pending := pendingDeaths["p3"]
+	if pending == nil || len(pending.waiting) != 2 {
+		t.Fatalf("pending report %+v, want one waiting on p2 and p3", pending)
+	}
+	ackDeathReports("p2", pending.waiting["p2"])
+	if _, ok := pending.waiting["p2"]; ok || pendingDeaths["p3"] == nil {
+		t.Errorf("after p2's ack, waiting on %v, want just p3", pending.waiting)
+	}
+	ackDeathReports("p3", pending.waiting["p3"])
+	if pendingDeaths["p3"] != nil {
+		t.Errorf("still pending after every peer acked")
+	}
+}
+
+func TestDeathReportAckedByHeartbeat(t *testing.T) {
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 1, Y: 1}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 1, Y: 5}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 1, Y: 8}, Direction: DIRECTION_RIGHT},
+	)
+	p2, p3 := nodes[1], nodes[2]
+	givePeerAddr(p2)
+	givePeerAddr(p3)
+
+	// We lead and report p3 dead. p2's next interval update lists the
+	// report, p3's doesn't.
+	sendDeathReports(p3, nil)
+	pending := pendingDeaths["p3"]
+	if pending == nil || len(pending.waiting) != 2 {
+		t.Fatalf("pending report %+v, want one waiting on p2 and p3", pending)
+	}
+	deliverFrom(t, p2, &Message{Node: *p2, Acks: pending.waiting["p2"]})
+	deliverFrom(t, p3, &Message{Node: *p3, Acks: []uint64{pending.waiting["p3"][0] + 100}})
+	if _, ok := pending.waiting["p2"]; ok {
+		t.Errorf("still waiting on p2 after its update listed the report")
+	}
+	if _, ok := pending.waiting["p3"]; !ok || pendingDeaths["p3"] == nil {
+		t.Errorf("stopped waiting on p3, whose update didn't list the report")
+	}
+}
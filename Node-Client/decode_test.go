@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestDecodeMessageIgnoresUnknownFields(t *testing.T) {
+	message, err := decodeMessage([]byte(
+		`{"IsLeader":true,"Tick":7,"NewerField":{"x":[1,2]},"Node":{"Id":"p2","Hat":"red"}}`))
+	if err != nil {
+		t.Fatalf("message with unknown fields: %v", err)
+	}
+	if !message.IsLeader || message.Tick != 7 || message.Node.Id != "p2" {
+		t.Errorf("decoded as %+v, want the leader p2 on tick 7", message)
+	}
+
+	for _, data := range []string{
+		`{"IsLeader":true`,
+		`{"Tick":"seven"}`,
+		`{"Tick":7} {"Tick":8}`,
+		`not json`,
+	} {
+		if _, err := decodeMessage([]byte(data)); err == nil {
+			t.Errorf("decoded %s without an error", data)
+		}
+	}
+}
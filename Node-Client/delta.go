@@ -0,0 +1,81 @@
+package main
+
+// This file implements sending the leader's board as deltas. Rather than the
+// whole board, most game state broadcasts carry only the cells that changed
+// since the previous one. Every keyframeInterval-th broadcast carries the
+// whole board, so followers that missed a delta catch up. Followers keep a copy
+// of the leader's board built from these and paint just the changed cells onto
+// their own, rather than repainting every node's history each time.
+
+// Game state broadcasts between ones carrying the whole board.
+const keyframeInterval int = 5
+
+// #LEADER specific.
+var sentBoard [BOARD_SIZE][BOARD_SIZE]string // Board as of our last broadcast.
+var broadcastCount int                       // Game state broadcasts we've sent.
+
+// Follower specific.
+var leaderBoard [BOARD_SIZE][BOARD_SIZE]string // Leader's board as of its last broadcast.
+var haveLeaderBoard bool                       // Whether leaderBoard is known at all.
+
+// LEADER: Add our board to a game state message, whole or as the changes since
+// our last broadcast. mutex must be held.
+func addBoardToMessage(message *Message) {
+	message.BoardHash = hashBoard(&board)
+	if broadcastCount%keyframeInterval == 0 {
+		message.Board = string(BoardCodec{}.Marshal(&board))
+	} else {
+		message.DeltaBase = hashBoard(&sentBoard)
+		message.BoardDelta = string(BoardCodec{}.MarshalDelta(&sentBoard, &board))
+	}
+	sentBoard = board
+	broadcastCount++
+}
+
+// Update our copy of the leader's board from a game state message. Returns the
+// positions a delta changed, and false if the message had the whole board or a
+// delta we can't apply, in which case our board needs a full repaint. mutex
+// must be held.
+func applyLeaderBoard(message *Message) ([]Pos, bool) {
+	if message.Board != "" {
+		b, err := BoardCodec{}.Unmarshal([]byte(message.Board))
+		if err != nil {
+			localLog("ERROR: can't decode leader's board:", err)
+			haveLeaderBoard = false
+			return nil, false
+		}
+		leaderBoard = *b
+		haveLeaderBoard = true
+		return nil, false
+	}
+	if message.DeltaBase == 0 {
+		return nil, false
+	}
+	if !haveLeaderBoard || hashBoard(&leaderBoard) != message.DeltaBase {
+		// We missed a broadcast, so wait for the next keyframe.
+		debugLog("Can't apply board delta without its base, waiting for a keyframe")
+		haveLeaderBoard = false
+		return nil, false
+	}
+	changed, err := BoardCodec{}.ApplyDelta(&leaderBoard, []byte(message.BoardDelta))
+	if err != nil {
+		localLog("ERROR: can't decode leader's board delta:", err)
+		haveLeaderBoard = false
+		return nil, false
+	}
+	return changed, true
+}
+
+// Paint the cells of the leader's board at changed onto ours, and move nodes'
+// heads to where the leader has them. mutex must be held.
+func paintLeaderChanges(changed []Pos) {
+	for _, pos := range changed {
+		setCell(&board, pos, cellAt(&leaderBoard, pos))
+	}
+	for id, history := range gameHistory {
+		if n := getNode(id); n != nil && len(history) > 0 {
+			n.CurrLoc.X = history[0].X
+			n.CurrLoc.Y = history[0].Y
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"testing"
+)
+
+// A frame of a four player game: the leader's board before and after a tick,
+// with each node's history as of after it. Nodes run along every other row.
+func setUpFollowerFrame() (prev, next [BOARD_SIZE][BOARD_SIZE]string) {
+	fileLogger = log.New(ioutil.Discard, "", 0)
+	log.SetOutput(ioutil.Discard)
+	nodes = nil
+	gameHistory = make(map[string][]*Pos)
+	nodeHistory = make(map[string][]*Pos)
+	for i := 0; i < 4; i++ {
+		id := "p" + strconv.Itoa(i+1)
+		y := 2*i + 1
+		head := leaderHistoryLength
+		nodes = append(nodes, &Node{Id: id, CurrLoc: &Pos{X: head - 1, Y: y}, IsAlive: true})
+		for x := 0; x < head; x++ {
+			prev[y][x] = "t" + id[1:]
+		}
+		prev[y][head-1] = id
+		next = prev
+		next[y][head-1] = "t" + id[1:]
+		next[y][head] = id
+		for x := head; x > 0; x-- {
+			gameHistory[id] = append(gameHistory[id], &Pos{X: x, Y: y})
+			nodeHistory[id] = append(nodeHistory[id], &Pos{X: x, Y: y})
+		}
+	}
+	return prev, next
+}
+
+// Run a benchmark with stdout discarded, as UpdateBoard prints to it.
+func withoutStdout(b *testing.B, bench func()) {
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = devNull
+	defer func() {
+		os.Stdout = stdout
+		devNull.Close()
+	}()
+	b.ResetTimer()
+	bench()
+}
+
+// A follower's work per frame when the leader sends its whole board.
+func BenchmarkFollowerFullRepaint(b *testing.B) {
+	prev, next := setUpFollowerFrame()
+	message := &Message{Board: string(BoardCodec{}.Marshal(&next))}
+	withoutStdout(b, func() {
+		for i := 0; i < b.N; i++ {
+			board, leaderBoard = prev, prev
+			mutex.Lock()
+			applyLeaderBoard(message)
+			mutex.Unlock()
+			UpdateBoard()
+		}
+	})
+}
+
+// A follower's work per frame when the leader sends the changes to its board.
+func BenchmarkFollowerDelta(b *testing.B) {
+	prev, next := setUpFollowerFrame()
+	message := &Message{DeltaBase: hashBoard(&prev),
+		BoardDelta: string(BoardCodec{}.MarshalDelta(&prev, &next))}
+	withoutStdout(b, func() {
+		for i := 0; i < b.N; i++ {
+			board, leaderBoard = prev, prev
+			haveLeaderBoard = true
+			mutex.Lock()
+			changed, isDelta := applyLeaderBoard(message)
+			if !isDelta {
+				b.Fatal("delta wasn't applied")
+			}
+			paintLeaderChanges(changed)
+			mutex.Unlock()
+		}
+	})
+	if board != next {
+		b.Errorf("painted board doesn't match the leader's")
+	}
+}
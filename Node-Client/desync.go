@@ -0,0 +1,53 @@
+package main
+
+// This file implements detecting when a follower's board has drifted from the
+// leader's. The leader includes a hash of its board in each game state
+// message, along with the board or the changes to it (see delta.go), and
+// followers log the cells that differ whenever the hash doesn't match their
+// own.
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+)
+
+// Hash the contents of the board.
+func hashBoard(b *[BOARD_SIZE][BOARD_SIZE]string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(BoardCodec{}.String(b)))
+	return h.Sum64()
+}
+
+// List the cells that differ between two boards, as "(x,y) ours/theirs".
+func diffBoards(ours, theirs *[BOARD_SIZE][BOARD_SIZE]string) []string {
+	diffs := make([]string, 0)
+	for y := 0; y < BOARD_SIZE; y++ {
+		for x := 0; x < BOARD_SIZE; x++ {
+			if ours[y][x] != theirs[y][x] {
+				diffs = append(diffs, fmt.Sprintf("(%d,%d) %q/%q",
+					x, y, ours[y][x], theirs[y][x]))
+			}
+		}
+	}
+	return diffs
+}
+
+// Compare our board against the leader's as of a message from it, logging the
+// differences if they don't match. Only boards from the same tick are
+// compared, since otherwise they're expected to differ. Call after
+// applyLeaderBoard. mutex must be held.
+func checkBoardSync(message *Message) {
+	if message.BoardHash == 0 || message.Tick != tickCount {
+		return
+	}
+	ourHash := hashBoard(&board)
+	if ourHash == message.BoardHash {
+		return
+	}
+	localLog("WARNING: board desync at tick", tickCount, "ours:", ourHash,
+		"leader's:", message.BoardHash)
+	if haveLeaderBoard && hashBoard(&leaderBoard) == message.BoardHash {
+		debugLog("Board diff (ours/leader's):", strings.Join(diffBoards(&board, &leaderBoard), " "))
+	}
+}
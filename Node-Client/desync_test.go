@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+// A follower whose board differs from the leader's by one cell logs exactly
+// that cell in the board diff.
+func TestBoardDiffReportsChangedCell(t *testing.T) {
+	prev, _ := setUpFollowerFrame()
+	var logged bytes.Buffer
+	fileLogger = log.New(&logged, "", 0)
+	debugLogging = true
+	defer func() { debugLogging = false }()
+	board, leaderBoard = prev, prev
+	haveLeaderBoard = true
+	board[4][6] = "t1"
+	tickCount = 7
+	checkBoardSync(&Message{Tick: 7, BoardHash: hashBoard(&leaderBoard)})
+
+	if diffs := diffBoards(&board, &leaderBoard); len(diffs) != 1 || diffs[0] != `(6,4) "t1"/""` {
+		t.Fatalf("diff is %q, want just the changed cell", diffs)
+	}
+	var diffLine string
+	for _, line := range strings.Split(logged.String(), "\n") {
+		if strings.Contains(line, "Board diff") {
+			diffLine = line
+		}
+	}
+	if !strings.HasSuffix(diffLine, `(6,4) "t1"/""]`) {
+		t.Fatalf("logged diff %q, want just (6,4)", diffLine)
+	}
+	if !strings.Contains(logged.String(), "board desync at tick 7") {
+		t.Errorf("desync not logged: %q", logged.String())
+	}
+}
+
+// Boards from different ticks aren't compared.
+func TestBoardSyncSkipsOtherTicks(t *testing.T) {
+	prev, next := setUpFollowerFrame()
+	var logged bytes.Buffer
+	fileLogger = log.New(&logged, "", 0)
+	board, leaderBoard = prev, next
+	haveLeaderBoard = true
+	tickCount = 7
+	checkBoardSync(&Message{Tick: 8, BoardHash: hashBoard(&leaderBoard)})
+	if logged.Len() != 0 {
+		t.Fatalf("logged %q for a board from another tick", logged.String())
+	}
+}
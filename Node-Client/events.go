@@ -0,0 +1,92 @@
+package main
+
+// This file implements /events, a Server-Sent Events stream of what happens in
+// the game, for dashboards and scripts that would rather read plain HTTP than
+// speak socket.io. Each event is sent as
+//
+//	event: <kind>
+//	data: <JSON object>
+//
+// where kind is one of the EVENT_* constants.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// Kinds of events sent on the stream.
+const (
+	EVENT_DEATH            string = "death"           // {"id"}
+	EVENT_KILL             string = "kill"            // {"victim", "killer", "cause"}, see kill.go
+	EVENT_DIRECTION_CHANGE string = "directionChange" // {"id", "direction"}
+	EVENT_LEADER_CHANGE    string = "leaderChange"    // {"id"}
+	EVENT_GAME_OVER        string = "gameOver"        // {"winner", "reason"}
+)
+
+// Events buffered per subscriber. A subscriber that falls this far behind
+// misses events rather than holding up the game.
+const eventBufferSize int = 64
+
+type gameEvent struct {
+	Kind string
+	Data map[string]string
+}
+
+var eventLock sync.Mutex
+var eventSubscribers = make(map[chan gameEvent]bool)
+
+// Send an event to everyone streaming /events.
+func publishEvent(kind string, data map[string]string) {
+	eventLock.Lock()
+	defer eventLock.Unlock()
+	for subscriber := range eventSubscribers {
+		select {
+		case subscriber <- gameEvent{Kind: kind, Data: data}:
+		default:
+			debugLog("Dropping", kind, "event for a slow subscriber")
+		}
+	}
+}
+
+// Streams game events to the client until it disconnects.
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming isn't supported", http.StatusInternalServerError)
+		return
+	}
+
+	events := make(chan gameEvent, eventBufferSize)
+	eventLock.Lock()
+	eventSubscribers[events] = true
+	eventLock.Unlock()
+	defer func() {
+		eventLock.Lock()
+		delete(eventSubscribers, events)
+		eventLock.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-events:
+			data, err := json.Marshal(event.Data)
+			if err != nil {
+				localLog("ERROR: failed to encode", event.Kind, "event:", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Kind, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
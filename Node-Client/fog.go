@@ -0,0 +1,76 @@
+package main
+
+// This file implements fog of war. With a fog radius, players only see the
+// cells within that many cells of their head, across and down, until they die
+// or the game ends, when the whole board is revealed. Every node still
+// simulates the whole board, so only what it shows is fogged. The leader's game
+// state broadcasts are fogged too: rather than one board, or the changes to it,
+// for everyone, it sends each follower the whole board as that follower sees
+// it.
+
+// Marker of a cell hidden by fog.
+const FOG_CELL string = "~~"
+
+var fogRadius int // Cells from their head players see, 0 for the whole board.
+
+// Whether pos is too far from head to see.
+func isFogged(pos Pos, head *Pos) bool {
+	return intAbs(pos.X-head.X) > fogRadius || intAbs(pos.Y-head.Y) > fogRadius
+}
+
+// Whether n's view of the board is fogged. mutex must be held.
+func seesFog(n *Node) bool {
+	return fogRadius > 0 && isPlaying() && n != nil && n.IsAlive && n.CurrLoc != nil
+}
+
+// A copy of b as n sees it. mutex must be held.
+func fogBoard(b *[BOARD_SIZE][BOARD_SIZE]string, n *Node) *[BOARD_SIZE][BOARD_SIZE]string {
+	fogged := *b
+	if !seesFog(n) {
+		return &fogged
+	}
+	for y := 0; y < BOARD_SIZE; y++ {
+		for x := 0; x < BOARD_SIZE; x++ {
+			if isFogged(Pos{X: x, Y: y}, n.CurrLoc) {
+				fogged[y][x] = FOG_CELL
+			}
+		}
+	}
+	return &fogged
+}
+
+// LEADER: Send each follower message with our board as it sees it, in place of
+// addBoardToMessage and sendPacketsToPeers. mutex must be held.
+func sendFoggedGameState(logMsg string, message *Message) {
+	message.BoardHash = hashBoard(&board)
+	for _, peer := range nodes {
+		if peer.Id == nodeId || isOwnAddr(peer.Ip) {
+			continue
+		}
+		peerMessage := *message
+		peerMessage.Board = string(BoardCodec{}.Marshal(fogBoard(&board, peer)))
+		sendPacketToPeer(peer, &peerMessage, logMsg)
+	}
+}
+
+// Log the board the leader sent in message, as fogged for us. Call after
+// applyLeaderBoard. mutex must be held.
+func logFoggedBoard(message *Message) {
+	if fogRadius == 0 || message.Board == "" || !haveLeaderBoard {
+		return
+	}
+	localLog("Leader's board as we see it at tick", message.Tick)
+	printBoard(boardOutput, &leaderBoard)
+}
+
+// Copy the cells the leader's fogged board shows onto ours, keeping our own
+// where it's fogged. mutex must be held.
+func adoptVisibleCells() {
+	for y := 0; y < BOARD_SIZE; y++ {
+		for x := 0; x < BOARD_SIZE; x++ {
+			if leaderBoard[y][x] != FOG_CELL {
+				board[y][x] = leaderBoard[y][x]
+			}
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+// This file implements what the UI and spectators need to follow a player
+// around the board. Whole boards and the start of the game list every player
+// still in it, with where its head is, which way it's heading and whether it's
+// alive, and GET /player?id=p2 returns just one of them, e.g. for a spectator
+// following p2 between boards.
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// A player as sent to the UI.
+type playerDTO struct {
+	Id        string `json:"id"`
+	X         int    `json:"x"` // Where its head is, in the same coordinates as cells.
+	Y         int    `json:"y"`
+	Direction string `json:"direction"`
+	Alive     bool   `json:"alive"`
+}
+
+// node as sent to the UI. mutex must be held.
+func playerToDTO(node *Node) playerDTO {
+	player := playerDTO{Id: node.Id, Direction: node.Direction, Alive: node.IsAlive}
+	if node.CurrLoc != nil {
+		player.X = node.CurrLoc.X + renderedOffset()
+		player.Y = node.CurrLoc.Y + renderedOffset()
+	}
+	return player
+}
+
+// Every player still in the game as sent to the UI. mutex must be held.
+func playersToDTO() []playerDTO {
+	players := make([]playerDTO, 0, len(nodes))
+	for _, node := range nodes {
+		players = append(players, playerToDTO(node))
+	}
+	return players
+}
+
+// Serves the player whose id is given with ?id= as JSON.
+func handlePlayer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "only GET is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "id is required, e.g. ?id=p1", http.StatusBadRequest)
+		return
+	}
+
+	mutex.Lock()
+	node := getNode(id)
+	var player playerDTO
+	if node != nil {
+		player = playerToDTO(node)
+	}
+	mutex.Unlock()
+	if node == nil {
+		http.Error(w, "no player "+id+" in the game", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&player); err != nil {
+		localLog("ERROR: failed to write player", id, ":", err)
+	}
+}
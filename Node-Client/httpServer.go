@@ -3,9 +3,9 @@ package main
 // This file implements the HTTP server portion of the GUI layer.
 
 import (
+	"encoding/json"
 	"github.com/googollee/go-socket.io"
 	"github.com/pkg/browser"
-	"log"
 	"net"
 	"net/http"
 )
@@ -13,6 +13,26 @@ import (
 // Note: This variable should be treated as private to httpServer.go.
 var _gSO socketio.Socket
 
+// Boards pushed to the UI between whole ones when sending changes.
+const uiKeyframeInterval int = 10
+
+var uiDeltas bool                          // Whether the UI is sent changed cells rather than whole boards.
+var uiBoard [BOARD_SIZE][BOARD_SIZE]string // Board as last pushed to the UI.
+var uiFrames int                           // Boards pushed to the UI this game.
+
+// The cells that differ between from and to, as they are in to.
+func boardChanges(from, to *[BOARD_SIZE][BOARD_SIZE]string) []cellDTO {
+	changes := make([]cellDTO, 0)
+	for y := 0; y < BOARD_SIZE; y++ {
+		for x := 0; x < BOARD_SIZE; x++ {
+			if from[y][x] != to[y][x] {
+				changes = append(changes, cellToDTO(x, y, to[y][x]))
+			}
+		}
+	}
+	return changes
+}
+
 // Starts the UI game screen.
 func startGameUI() {
 	if _gSO == nil {
@@ -23,15 +43,27 @@ func startGameUI() {
 	_gSO.On("playerMove", func(playerMove map[string]string) {
 		direction, ok := playerMove["direction"]
 		if !ok {
-			log.Fatal("Received playerMove without direction")
+			localLog("ERROR: Received playerMove without direction")
 			return
 		}
 
-		notifyPeersDirChanged(direction)
+		if err := queueDirectionInput(direction); err != nil {
+			localLog("ERROR: playerMove:", err)
+		}
 	})
 
 	// Start the game.
-	_gSO.Emit("startGame", nodeId, nodeAddr, myNode.Direction)
+	uiFrames = 0
+	mutex.Lock()
+	players := playersToDTO()
+	mutex.Unlock()
+	_gSO.Emit("startGame", nodeId, nodeAddr, myNode.Direction, allowDiagonal,
+		myNode.Lives, displayName(nodeId), playerColours(),
+		reversalRule == REVERSAL_LETHAL, players)
+	if score := seriesScore(); score != "" {
+		_gSO.Emit("seriesScore", score)
+	}
+	reportReady()
 }
 
 func pushGameStateToJS(state [BOARD_SIZE][BOARD_SIZE]string) {
@@ -40,7 +72,13 @@ func pushGameStateToJS(state [BOARD_SIZE][BOARD_SIZE]string) {
 		return
 	}
 
-	_gSO.Emit("gameStateUpdate", state)
+	if uiDeltas && uiFrames%uiKeyframeInterval != 0 {
+		_gSO.Emit("gameStateDelta", borderChanges(boardChanges(&uiBoard, &state)))
+	} else {
+		_gSO.Emit("gameStateUpdate", toDTO(&state))
+	}
+	uiBoard = state
+	uiFrames++
 }
 
 func notifyPlayerDeathToJS() {
@@ -52,6 +90,24 @@ func notifyPlayerDeathToJS() {
 	_gSO.Emit("playerDead")
 }
 
+func notifyKillToJS(event *CollisionEvent) {
+	if _gSO == nil {
+		localLog("socketio is NIL !!!")
+		return
+	}
+
+	_gSO.Emit("kill", event)
+}
+
+func notifyPlayerRespawnToJS(livesLeft int) {
+	if _gSO == nil {
+		localLog("socketio is NIL !!!")
+		return
+	}
+
+	_gSO.Emit("playerRespawn", livesLeft)
+}
+
 func notifyPlayerVictoryToJS() {
 	if _gSO == nil {
 		localLog("socketio is NIL !!!")
@@ -61,18 +117,108 @@ func notifyPlayerVictoryToJS() {
 	_gSO.Emit("playerVictory")
 }
 
+func notifyGameOverToJS(reason string) {
+	if _gSO == nil {
+		localLog("socketio is NIL !!!")
+		return
+	}
+
+	_gSO.Emit("gameOver", reason)
+}
+
+func notifyChatToJS(from string, text string) {
+	if _gSO == nil {
+		localLog("socketio is NIL !!!")
+		return
+	}
+
+	_gSO.Emit("chat", from, text)
+}
+
+func notifyJoinRejectedToJS(status string) {
+	if _gSO == nil {
+		localLog("socketio is NIL !!!")
+		return
+	}
+
+	_gSO.Emit("joinRejected", status)
+}
+
+// Body of a POST to /direction.
+type directionRequest struct {
+	Direction string `json:"direction"`
+}
+
+// Changes this node's direction the same way a playerMove from the UI does.
+// This allows controlling a node without a browser, e.g. for testing.
+func handleDirection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req directionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "malformed body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := queueDirectionInput(req.Direction); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Body of a POST to /chat.
+type chatRequest struct {
+	Text string `json:"text"`
+}
+
+// Sends a chat line to the players waiting with us the same way the lobby's
+// chat box does.
+func handleChat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req chatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "malformed body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := sendChat(req.Text); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // Starts the HTTP server.
-func httpServe() {
-	defer waitGroup.Done()
+func httpServe() error {
 	server, err := socketio.NewServer(nil)
 	if err != nil {
 		localLog("ERROR: Fatal socketio.NewServer() error:", err)
-		log.Fatal(err)
+		return err
 	}
 	server.On("connection", func(so socketio.Socket) {
 		localLog("on connection")
 		_gSO = so
-		go msRpcDial()
+		so.On("sendChat", func(text string) {
+			if err := sendChat(text); err != nil {
+				localLog("ERROR: sendChat:", err)
+				return
+			}
+			notifyChatToJS("you", text)
+		})
+		go func() {
+			// Without the matchmaking server there's no game to play, but
+			// the UI reconnecting tries again.
+			if err := msRpcDial(); err != nil {
+				localLog("ERROR: failed to join matchmaking server:", err)
+				notifyJoinRejectedToJS(JOIN_UNREACHABLE)
+			}
+		}()
 	})
 	server.On("error", func(so socketio.Socket, err error) {
 		localLog("ERROR:", err)
@@ -81,16 +227,25 @@ func httpServe() {
 		localLog("on disconnect")
 	})
 
-	http.Handle("/socket.io/", server)
-	http.Handle("/", http.FileServer(http.Dir("./asset")))
+	mux := http.NewServeMux()
+	mux.Handle("/socket.io/", server)
+	mux.HandleFunc("/direction", handleDirection)
+	mux.HandleFunc("/chat", handleChat)
+	mux.HandleFunc("/player", handlePlayer)   // in follow.go
+	mux.HandleFunc("/events", handleEvents)   // in events.go
+	mux.HandleFunc("/metrics", handleMetrics) // in metrics.go
+	if pprofEnabled {
+		registerPprof(mux) // in pprof.go
+	}
+	mux.Handle("/", http.FileServer(http.Dir("./asset")))
 	localLog("Serving at ", httpServerAddr, "...")
 
 	listener, err := net.Listen("tcp", httpServerAddr)
 	if err != nil {
 		localLog("httpserver listener error ", err)
-	} else {
-		localLog("httpserver listener success")
-		browser.OpenURL("http://" + httpServerAddr)
-		http.Serve(listener, nil)
+		return err
 	}
+	localLog("httpserver listener success")
+	browser.OpenURL("http://" + httpServerAddr)
+	return http.Serve(listener, mux)
 }
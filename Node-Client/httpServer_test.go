@@ -0,0 +1,83 @@
+package main
+
+import (
+	"github.com/googollee/go-socket.io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func postDirection(body string) int {
+	req := httptest.NewRequest(http.MethodPost, "/direction", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handleDirection(w, req)
+	return w.Code
+}
+
+func TestPostDirection(t *testing.T) {
+	startStepTest(startingPosition{Pos: &Pos{X: 1, Y: 5}, Direction: DIRECTION_RIGHT})
+
+	if code := postDirection(`{"direction":"U"}`); code != http.StatusNoContent {
+		t.Errorf("valid direction got %d, want %d", code, http.StatusNoContent)
+	}
+	stepGame()
+	if myNode.Direction != DIRECTION_UP {
+		t.Errorf("heading %s after posting U, want %s", myNode.Direction, DIRECTION_UP)
+	}
+
+	for _, body := range []string{`{"direction":"X"}`, `{"direction":"D"}`, `not json`} {
+		if code := postDirection(body); code != http.StatusBadRequest {
+			t.Errorf("%s got %d, want %d", body, code, http.StatusBadRequest)
+		}
+	}
+	stepGame()
+	if myNode.Direction != DIRECTION_UP {
+		t.Errorf("heading %s after invalid posts, want still %s", myNode.Direction, DIRECTION_UP)
+	}
+}
+
+// A socket.io connection that keeps what's emitted on it.
+type recordingSocket struct {
+	socketio.Socket
+	events []string
+	args   [][]interface{}
+}
+
+func (s *recordingSocket) Emit(event string, args ...interface{}) error {
+	s.events = append(s.events, event)
+	s.args = append(s.args, args)
+	return nil
+}
+
+func TestPushGameStateSendsChanges(t *testing.T) {
+	startStepTest(startingPosition{Pos: &Pos{X: 1, Y: 1}, Direction: DIRECTION_RIGHT})
+	socket := &recordingSocket{}
+	_gSO = socket
+	uiDeltas = true
+	uiFrames = 0
+	defer func() {
+		_gSO = nil
+		uiDeltas = false
+	}()
+
+	for i := 0; i < 2; i++ {
+		if i > 0 {
+			stepGame()
+		}
+		mutex.Lock()
+		pushGameStateToJS(board)
+		mutex.Unlock()
+	}
+	if len(socket.events) != 2 || socket.events[0] != "gameStateUpdate" || socket.events[1] != "gameStateDelta" {
+		t.Fatalf("pushed %v, want a whole board and then its changes", socket.events)
+	}
+	changes := socket.args[1][0].([]cellDTO)
+	want := []cellDTO{
+		{X: 1, Y: 1, Type: CELL_TRAIL, Player: "p1"},
+		{X: 2, Y: 1, Type: CELL_HEAD, Player: "p1"},
+	}
+	if len(changes) != len(want) || changes[0] != want[0] || changes[1] != want[1] {
+		t.Errorf("moving one cell pushed %+v, want %+v", changes, want)
+	}
+}
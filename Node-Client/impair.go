@@ -0,0 +1,61 @@
+package main
+
+// This file implements simulating a bad network, for testing how the game
+// copes with one. With the -sim-* flags, packets we send to peers are dropped
+// with probability simLoss, and the rest are delayed by simLatency plus up to
+// simJitter, so packets sent close together may arrive out of order. Which
+// packets are dropped and how long each is delayed come from a generator
+// seeded with simSeed, so the same seed impairs the same packets.
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var simLoss float64          // Probability each packet sent is dropped.
+var simLatency time.Duration // Delay added to every packet sent.
+var simJitter time.Duration  // Most extra delay added at random to each packet sent.
+var simSeed int64            // Seed for which packets are dropped and delayed.
+
+// Wraps a transport, impairing the packets sent through it.
+type impairedTransport struct {
+	Transport
+	lock sync.Mutex // For rand, since packets are sent concurrently.
+	rand *rand.Rand
+}
+
+// Wrap t to impair the packets sent through it as the -sim-* flags say, or
+// return it as is if they don't.
+func impairTransport(t Transport) Transport {
+	if simLoss <= 0 && simLatency <= 0 && simJitter <= 0 {
+		return t
+	}
+	localLog("Simulating a bad network:", simLoss, "loss,", simLatency,
+		"latency,", simJitter, "jitter, seed", simSeed)
+	return &impairedTransport{Transport: t, rand: rand.New(rand.NewSource(simSeed))}
+}
+
+func (t *impairedTransport) Send(addr string, data []byte) error {
+	t.lock.Lock()
+	lost := t.rand.Float64() < simLoss
+	delay := simLatency
+	if simJitter > 0 {
+		delay += time.Duration(t.rand.Int63n(int64(simJitter) + 1))
+	}
+	t.lock.Unlock()
+
+	if lost {
+		debugLog("Simulating losing a packet to", addr)
+		return nil
+	}
+	if delay <= 0 {
+		return t.Transport.Send(addr, data)
+	}
+	time.AfterFunc(delay, func() {
+		if err := t.Transport.Send(addr, data); err != nil {
+			localLog("ERROR: failed to send delayed packet to", addr, ":", err)
+		}
+	})
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+// This file implements buffering direction input from the UI (or HTTP) until
+// the game loop is ready for it, so input is applied at tick boundaries rather
+// than whenever it happens to arrive. With turnCooldownTicks set, turns are
+// also held back until that many ticks have passed since the last one. While
+// the game is paused only the latest input is kept, so the first tick after
+// resuming goes where the player last asked, not through every key they
+// pressed in between.
+
+import (
+	"errors"
+	"sync"
+)
+
+// Most inputs buffered at once. Turns beyond this are dropped since the player
+// is mashing keys faster than the game moves.
+const maxQueuedInputs int = 3
+
+var inputLock sync.Mutex
+var queuedInputs []string // Directions waiting to be applied, oldest first.
+
+var turnCooldownTicks int // Ticks after turning before we can turn again, 0 for none.
+var nextTurnTick int      // First tick our next turn may be applied on.
+
+// Queue a direction change to be applied on an upcoming tick. Returns an error
+// if the direction isn't one the player could turn to after the inputs already
+// queued.
+func queueDirectionInput(direction string) error {
+	inputLock.Lock()
+	defer inputLock.Unlock()
+
+	mutex.Lock()
+	if myNode == nil {
+		mutex.Unlock()
+		return errors.New("game has not started")
+	}
+	lastDirection := myNode.Direction
+	paused := lifecycle == GAME_PAUSED
+	mutex.Unlock()
+	if paused {
+		// This replaces anything queued, so it's a turn from where we're going.
+		queuedInputs = nil
+	}
+	if len(queuedInputs) > 0 {
+		lastDirection = queuedInputs[len(queuedInputs)-1]
+	}
+
+	if err := checkTurn(lastDirection, direction); err != nil {
+		return err
+	}
+	if direction == lastDirection {
+		return nil
+	}
+	if len(queuedInputs) >= maxQueuedInputs {
+		localLog("Input queue full, dropping direction", direction)
+		return nil
+	}
+	queuedInputs = append(queuedInputs, direction)
+	return nil
+}
+
+// Apply the oldest queued direction change, if any and we're not cooling down
+// from the last one. Called once per tick before moving, without mutex held.
+func applyQueuedInput() {
+	inputLock.Lock()
+	mutex.Lock()
+	tick := tickCount
+	mutex.Unlock()
+	if len(queuedInputs) == 0 || tick < nextTurnTick {
+		inputLock.Unlock()
+		return
+	}
+	direction := queuedInputs[0]
+	queuedInputs = queuedInputs[1:]
+	nextTurnTick = tick + turnCooldownTicks
+	inputLock.Unlock()
+
+	if err := notifyPeersDirChanged(direction); err != nil {
+		localLog("ERROR: failed to apply queued input:", err)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"testing"
+)
+
+// Set up a running game with just us, heading right, and nothing queued.
+func startInputTest() {
+	fileLogger = log.New(ioutil.Discard, "", 0)
+	log.SetOutput(ioutil.Discard)
+	nodeId = "p1"
+	myNode = &Node{Id: nodeId, Direction: DIRECTION_RIGHT, IsAlive: true}
+	nodes = nil
+	lifecycle = GAME_RUNNING
+	tickCount = 0
+	queuedInputs = nil
+	turnCooldownTicks = 0
+	nextTurnTick = 0
+}
+
+func TestQueuedInputsApplyInOrder(t *testing.T) {
+	startInputTest()
+	for _, direction := range []string{DIRECTION_UP, DIRECTION_LEFT} {
+		if err := queueDirectionInput(direction); err != nil {
+			t.Fatalf("queueing %s: %v", direction, err)
+		}
+	}
+	for _, want := range []string{DIRECTION_UP, DIRECTION_LEFT} {
+		applyQueuedInput()
+		if myNode.Direction != want {
+			t.Errorf("heading %s, want %s", myNode.Direction, want)
+		}
+		tickCount++
+	}
+}
+
+func TestInputDuringPauseAppliesOnResume(t *testing.T) {
+	startInputTest()
+	lifecycle = GAME_PAUSED
+	for _, direction := range []string{DIRECTION_UP, DIRECTION_DOWN} {
+		if err := queueDirectionInput(direction); err != nil {
+			t.Fatalf("queueing %s: %v", direction, err)
+		}
+	}
+	stepGame()
+	if myNode.Direction != DIRECTION_RIGHT {
+		t.Fatalf("turned to %s while paused", myNode.Direction)
+	}
+
+	lifecycle = GAME_RUNNING
+	applyQueuedInput()
+	if myNode.Direction != DIRECTION_DOWN {
+		t.Errorf("first tick after resume heading %s, want %s",
+			myNode.Direction, DIRECTION_DOWN)
+	}
+	if len(queuedInputs) != 0 {
+		t.Errorf("still queued after resume: %v", queuedInputs)
+	}
+}
+
+func TestTurnCooldownHoldsSecondTurn(t *testing.T) {
+	startInputTest()
+	turnCooldownTicks = 3
+	for _, direction := range []string{DIRECTION_UP, DIRECTION_LEFT} {
+		if err := queueDirectionInput(direction); err != nil {
+			t.Fatalf("queueing %s: %v", direction, err)
+		}
+	}
+
+	applyQueuedInput()
+	if myNode.Direction != DIRECTION_UP {
+		t.Fatalf("heading %s on tick 0, want %s", myNode.Direction, DIRECTION_UP)
+	}
+	for tickCount = 1; tickCount < 3; tickCount++ {
+		applyQueuedInput()
+		if myNode.Direction != DIRECTION_UP {
+			t.Errorf("turned %s on tick %d, inside the cooldown", myNode.Direction, tickCount)
+		}
+	}
+	applyQueuedInput()
+	if myNode.Direction != DIRECTION_LEFT {
+		t.Errorf("heading %s once the cooldown ended, want %s", myNode.Direction, DIRECTION_LEFT)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+// This file implements kicking peers that keep sending packets the leader has
+// to reject, e.g. malformed, without a location or off the board, or turning
+// in ways the rules don't allow. Such a peer is broken or cheating. Once the
+// leader has rejected kickAfter of a peer's packets within kickWindow, it
+// declares the peer dead, as it would a crash, and drops it from the game like
+// a failed node, so the game goes on without it. Only packets that passed the
+// HMAC check count: anyone can send one that fails it from a peer's address,
+// and so get the peer kicked.
+
+import "time"
+
+var kickAfter int                     // Rejected packets within kickWindow before the leader kicks a peer, 0 for never.
+var kickWindow time.Duration          // How long a rejected packet counts towards a kick.
+var rejections map[string][]time.Time // Id : when the leader rejected its packets, oldest first.
+
+// For testing, how many packets without a location we send the leader once the
+// game is running, one a tick, as a broken peer would; 0 for none.
+var simBadPackets int
+
+// The node sending from addr, or nil if it's none of ours. mutex must be held.
+func nodeAtAddr(addr string) *Node {
+	for _, n := range nodes {
+		if n.Ip == addr {
+			return n
+		}
+		if resolved, ok := peerAddrs[n.Ip]; ok && resolved.String() == addr {
+			return n
+		}
+	}
+	return nil
+}
+
+// Note that we rejected a packet from addr, kicking whoever sent it once they
+// reach kickAfter. Only the leader kicks. mutex must be held.
+func noteRejection(addr string) {
+	if kickAfter <= 0 || !isLeader() || !isPlaying() {
+		return
+	}
+	peer := nodeAtAddr(addr)
+	if peer == nil || peer.Id == nodeId {
+		return
+	}
+
+	now := time.Now()
+	recent := rejections[peer.Id]
+	for len(recent) > 0 && now.Sub(recent[0]) > kickWindow {
+		recent = recent[1:]
+	}
+	recent = append(recent, now)
+	if len(recent) < kickAfter {
+		rejections[peer.Id] = recent
+		return
+	}
+	delete(rejections, peer.Id)
+	kickNode(peer)
+}
+
+// Like noteRejection, for when mutex isn't held.
+func rejectPacketFrom(addr string) {
+	mutex.Lock()
+	noteRejection(addr)
+	mutex.Unlock()
+}
+
+// LEADER: Declare peer dead and drop it from the game, telling everyone.
+// mutex must be held.
+func kickNode(peer *Node) {
+	localLog("KICKING NODE", peer.Id, "for", kickAfter, "rejected packets within", kickWindow)
+	if peer.IsAlive {
+		peer.IsAlive = false
+		aliveNodes = aliveNodes - 1
+		setCell(&board, *peer.CurrLoc, getPlayerState(peer.Id))
+		reportASorrowfulDeathToPeers(peer, causedDeath(peer, CAUSE_KICKED))
+	}
+	// Sent with our interval updates, so peers stop listening to it too.
+	failedNodes = append(failedNodes, peer.Id)
+	removeNodeFromList(peer.Id)
+	checkForWinner()
+}
+
+// Send the leader simBadPackets packets it has to reject, one a tick, while
+// we're playing the game given by its gameNumber.
+func simulateBadPackets(game int) {
+	for sent := 0; sent < simBadPackets; sent++ {
+		time.Sleep(tickRate)
+		mutex.Lock()
+		if !isPlayingGame(game) || isLeader() {
+			mutex.Unlock()
+			return
+		}
+		sendPacketToPeer(nodes[0], &Message{}, "packet without a location")
+		mutex.Unlock()
+	}
+}
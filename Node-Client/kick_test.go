@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestOnlyAuthenticatedRejectionsKick(t *testing.T) {
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 1, Y: 1}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 1, Y: 5}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 1, Y: 8}, Direction: DIRECTION_RIGHT},
+	)
+	// We lead, and p2 sends us packets we have to reject.
+	p2 := nodes[1]
+	roomSecret = []byte("room secret")
+	rejections = make(map[string][]time.Time)
+	kickAfter = 3
+	kickWindow = time.Minute
+	defer func() {
+		roomSecret = nil
+		kickAfter = 0
+	}()
+
+	// Anyone could send these from p2's address.
+	for i := 0; i < 2*kickAfter; i++ {
+		deliverPacketFrom(t, p2, bytes.Repeat([]byte("x"), 64))
+	}
+	if !p2.IsAlive || len(rejections["p2"]) != 0 {
+		t.Fatalf("p2 alive %v with rejections %v after unauthenticated packets, want alive with none",
+			p2.IsAlive, rejections["p2"])
+	}
+
+	// Only p2 could have sent these.
+	for i := 0; i < kickAfter; i++ {
+		deliverFrom(t, p2, &Message{})
+	}
+	if p2.IsAlive || getNode("p2") != nil {
+		t.Errorf("p2 still in the game after %d signed packets without a location", kickAfter)
+	}
+}
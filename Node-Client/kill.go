@@ -0,0 +1,74 @@
+package main
+
+// This file implements reporting what killed each player. When the leader's
+// simulation kills a node, it works out who or what did it and sends that
+// along with the death report, as a CollisionEvent. Every node, the leader
+// included, passes it on to the front end for the kill feed and to /events, as
+// a "kill" event.
+
+import "strings"
+
+// What killed a node.
+const (
+	CAUSE_WALL     string = "wall"     // Ran off the board or into a wall.
+	CAUSE_TRAIL    string = "trail"    // Ran into a trail, maybe its own.
+	CAUSE_HEAD     string = "head"     // Ran into another player.
+	CAUSE_MINE     string = "mine"     // Ran into a mine.
+	CAUSE_REVERSAL string = "reversal" // Reversed into its own neck.
+	CAUSE_SHRINK   string = "shrink"   // Was caught by the board closing in.
+	CAUSE_AFK      string = "afk"      // Stopped playing.
+	CAUSE_KICKED   string = "kicked"   // Kicked by the leader for sending bad packets.
+)
+
+// A death the leader detected, as sent to peers and the front end.
+type CollisionEvent struct {
+	Victim string // id of the node that died.
+	Killer string // id of the node whose trail or head it hit, "" if none.
+	Cause  string // one of the CAUSE_* constants.
+	Pos    Pos    // where the victim died.
+}
+
+// Work out what killed victim at pos when it moved to newPos, given what it
+// collided with and whether it reversed. mutex must be held.
+func collisionEvent(victim string, pos Pos, newPos Pos, hit collision, reversed bool) *CollisionEvent {
+	event := &CollisionEvent{Victim: victim, Pos: pos}
+	if reversed {
+		event.Cause = CAUSE_REVERSAL
+		event.Killer = victim
+		return event
+	}
+	if hit == COLLISION_WALL {
+		event.Cause = CAUSE_WALL
+		return event
+	}
+	cell := cellAt(&board, newPos)
+	if cell == "" {
+		// Squeezed through a corner, so blame one side of it.
+		cell = cellAt(&board, Pos{X: pos.X, Y: newPos.Y})
+	}
+	switch {
+	case cell == MINE_CELL:
+		event.Cause = CAUSE_MINE
+	case strings.HasPrefix(cell, "t"):
+		event.Cause = CAUSE_TRAIL
+		event.Killer = "p" + cell[1:]
+	case strings.HasPrefix(cell, "p") || strings.HasPrefix(cell, "d"):
+		event.Cause = CAUSE_HEAD
+		event.Killer = "p" + cell[1:]
+	default:
+		event.Cause = CAUSE_TRAIL
+	}
+	return event
+}
+
+// A death with nobody to blame, e.g. from the board closing in.
+func causedDeath(node *Node, cause string) *CollisionEvent {
+	return &CollisionEvent{Victim: node.Id, Cause: cause, Pos: *node.CurrLoc}
+}
+
+// Pass a death the leader detected on to the front end and /events.
+func announceKill(event *CollisionEvent) {
+	publishEvent(EVENT_KILL, map[string]string{"victim": event.Victim,
+		"killer": event.Killer, "cause": event.Cause})
+	notifyKillToJS(event)
+}
@@ -0,0 +1,83 @@
+package main
+
+// This file implements the game's lifecycle, the states a node goes through
+// from waiting for a game to the game being over:
+//
+//	lobby -> starting -> running <-> paused
+//	            |           |          |
+//	            +---------> finished <-+
+//
+// Every change goes through transition, which rejects any not drawn above and
+// logs the rest. A failed start goes back to the lobby, and a finished game
+// may be followed by another one starting.
+
+import "fmt"
+
+type lifecycleState int
+
+const (
+	GAME_LOBBY    lifecycleState = iota // Waiting for the ms server to start a game.
+	GAME_STARTING                       // Given the players, waiting for them to be ready.
+	GAME_RUNNING                        // Ticking.
+	GAME_PAUSED                         // In session, but not ticking.
+	GAME_FINISHED                       // Over, with a winner or not.
+)
+
+func (s lifecycleState) String() string {
+	switch s {
+	case GAME_LOBBY:
+		return "lobby"
+	case GAME_STARTING:
+		return "starting"
+	case GAME_RUNNING:
+		return "running"
+	case GAME_PAUSED:
+		return "paused"
+	case GAME_FINISHED:
+		return "finished"
+	}
+	return fmt.Sprintf("lifecycleState(%d)", int(s))
+}
+
+// State : states it may change to.
+var legalTransitions = map[lifecycleState][]lifecycleState{
+	GAME_LOBBY:    {GAME_STARTING},
+	GAME_STARTING: {GAME_LOBBY, GAME_RUNNING, GAME_FINISHED},
+	GAME_RUNNING:  {GAME_PAUSED, GAME_FINISHED},
+	GAME_PAUSED:   {GAME_RUNNING, GAME_FINISHED},
+	GAME_FINISHED: {GAME_STARTING},
+}
+
+var lifecycle lifecycleState = GAME_LOBBY
+
+// Games started so far. A game's goroutines keep the one they were started
+// for, so they can tell when a later game has replaced it.
+var gameNumber int
+
+// Change the game's state to to, logging it. Returns an error, changing
+// nothing, if the game can't go from its current state to to.
+func transition(to lifecycleState) error {
+	for _, legal := range legalTransitions[lifecycle] {
+		if legal == to {
+			localLog("Game", lifecycle, "->", to)
+			lifecycle = to
+			return nil
+		}
+	}
+	err := fmt.Errorf("game can't go from %v to %v", lifecycle, to)
+	localLog("ERROR:", err)
+	return err
+}
+
+// Whether a game is in session, i.e. has started and isn't over. The game's
+// goroutines run until it isn't.
+func isPlaying() bool {
+	return lifecycle == GAME_STARTING || lifecycle == GAME_RUNNING ||
+		lifecycle == GAME_PAUSED
+}
+
+// Whether game, the gameNumber of the game a goroutine was started for, is the
+// one in session.
+func isPlayingGame(game int) bool {
+	return game == gameNumber && isPlaying()
+}
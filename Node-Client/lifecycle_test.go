@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestTransitions(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer func() { lifecycle = GAME_LOBBY }()
+	states := []lifecycleState{GAME_LOBBY, GAME_STARTING, GAME_RUNNING,
+		GAME_PAUSED, GAME_FINISHED}
+	legal := map[[2]lifecycleState]bool{
+		{GAME_LOBBY, GAME_STARTING}:    true,
+		{GAME_STARTING, GAME_LOBBY}:    true,
+		{GAME_STARTING, GAME_RUNNING}:  true,
+		{GAME_STARTING, GAME_FINISHED}: true,
+		{GAME_RUNNING, GAME_PAUSED}:    true,
+		{GAME_RUNNING, GAME_FINISHED}:  true,
+		{GAME_PAUSED, GAME_RUNNING}:    true,
+		{GAME_PAUSED, GAME_FINISHED}:   true,
+		{GAME_FINISHED, GAME_STARTING}: true,
+	}
+	for _, from := range states {
+		for _, to := range states {
+			var logged bytes.Buffer
+			fileLogger = log.New(&logged, "", 0)
+			lifecycle = from
+			err := transition(to)
+			change := from.String() + " -> " + to.String()
+			if legal[[2]lifecycleState{from, to}] {
+				if err != nil || lifecycle != to {
+					t.Errorf("%s: %v, now %s", change, err, lifecycle)
+				}
+				if !strings.Contains(logged.String(), "Game "+change) {
+					t.Errorf("%s not logged: %q", change, logged.String())
+				}
+			} else {
+				if err == nil || lifecycle != from {
+					t.Errorf("%s allowed, now %s", change, lifecycle)
+				}
+				if strings.Contains(logged.String(), "Game "+change) {
+					t.Errorf("rejected %s logged as made", change)
+				}
+			}
+		}
+	}
+}
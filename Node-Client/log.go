@@ -4,6 +4,7 @@ package main
 
 import (
 	"github.com/arcaneiceman/GoVector/govec"
+	"io"
 	"log"
 	"os"
 	"strings"
@@ -16,6 +17,10 @@ type Msg struct {
 
 var Logger *govec.GoLog
 var fileLogger *log.Logger
+var debugLogging bool // Whether debugLog does anything.
+
+// Where printBoard writes the board as the game is played.
+var boardOutput io.Writer = localLogWriter{}
 
 func initLogging() {
 	// Windows doesn't accept colons in paths, so we filter them out here.
@@ -42,3 +47,20 @@ func localLog(v ...interface{}) {
 	log.Println(v)
 	fileLogger.Println(time.Now().Format("2006-01-02 15:04:05.000"), v)
 }
+
+// Log only when debug logging is on, for detail too noisy for regular runs.
+func debugLog(v ...interface{}) {
+	if debugLogging {
+		localLog(append([]interface{}{"DEBUG:"}, v...)...)
+	}
+}
+
+// Logs each line written to it with localLog.
+type localLogWriter struct{}
+
+func (localLogWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimSuffix(string(p), "\n"), "\n") {
+		localLog(line)
+	}
+	return len(p), nil
+}
@@ -0,0 +1,112 @@
+package main
+
+// This file implements counters of packets from peers that were dropped or
+// arrived out of order, served in plain text at /metrics, e.g.
+//
+//	packets_malformed_total 0
+//
+// Each message carries a sequence number, increasing with every message the
+// sender sends, which is how duplicates and reordering are spotted: we keep
+// the highest one seen from each sender and which of the seqWindowSize below
+// it we've seen too. Sequence numbers start over when the sender restarts, see
+// seqepoch.go.
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// Counted with sync/atomic, since packets are processed concurrently.
+var (
+	packetsMalformed  int64 // Couldn't be decoded.
+	packetsRejected   int64 // Decoded, or not, but failed validation.
+	packetsOversized  int64 // Over maxPacketSize, so truncated or cut off.
+	packetsDuplicate  int64 // Had a sequence number we'd already seen.
+	packetsOutOfOrder int64 // Had a sequence number lower than one we'd seen.
+)
+
+// How far below the highest sequence number from a sender we remember which
+// ones we've seen. Anything older is dropped, as it may be a duplicate.
+const seqWindowSize uint64 = 64
+
+// Sequence numbers seen from a sender.
+type seqWindow struct {
+	highest uint64
+	seen    uint64 // Bit i is set if we've seen highest-1-i.
+}
+
+var seqLock sync.Mutex
+var sentSeq uint64                         // Sequence number of the last message we sent.
+var seenSeqs = make(map[string]*seqWindow) // Sender's address : sequence numbers seen.
+
+func countPacket(counter *int64) {
+	atomic.AddInt64(counter, 1)
+}
+
+// Epoch and sequence number for the next message we send.
+func nextSeq() (int64, uint64) {
+	seqLock.Lock()
+	defer seqLock.Unlock()
+	sentSeq++
+	return seqEpoch, sentSeq
+}
+
+// Check the epoch and sequence number of a message from the given address,
+// counting it if it's a duplicate or out of order. Messages are keyed by
+// address rather than Node, since e.g. death reports carry the dead node
+// rather than the sender. Returns false for a duplicate, a message too old to
+// tell whether it is one, or a message from before the sender restarted, all
+// of which should be dropped.
+func checkSeq(from string, epoch int64, seq uint64) bool {
+	if seq == 0 {
+		// From a peer that doesn't number its messages.
+		return true
+	}
+	seqLock.Lock()
+	defer seqLock.Unlock()
+	if !checkEpoch(from, epoch) {
+		countPacket(&packetsOutOfOrder)
+		return false
+	}
+	window, ok := seenSeqs[from]
+	if !ok {
+		window = &seqWindow{}
+		seenSeqs[from] = window
+	}
+	switch {
+	case seq > window.highest:
+		// Shifts of 64 or more clear seen, as nothing in it is in the window.
+		shift := seq - window.highest
+		window.seen = window.seen<<shift | 1<<(shift-1)
+		window.highest = seq
+	case seq == window.highest:
+		countPacket(&packetsDuplicate)
+		return false
+	case window.highest-seq > seqWindowSize:
+		countPacket(&packetsOutOfOrder)
+		return false
+	default:
+		bit := uint64(1) << (window.highest - seq - 1)
+		if window.seen&bit != 0 {
+			countPacket(&packetsDuplicate)
+			return false
+		}
+		window.seen |= bit
+		// Still worth processing; UDP doesn't promise order.
+		countPacket(&packetsOutOfOrder)
+	}
+	return true
+}
+
+// Serves the packet counters, then the per-peer ones.
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintln(w, "packets_malformed_total", atomic.LoadInt64(&packetsMalformed))
+	fmt.Fprintln(w, "packets_rejected_total", atomic.LoadInt64(&packetsRejected))
+	fmt.Fprintln(w, "packets_oversized_total", atomic.LoadInt64(&packetsOversized))
+	fmt.Fprintln(w, "packets_duplicate_total", atomic.LoadInt64(&packetsDuplicate))
+	fmt.Fprintln(w, "packets_out_of_order_total", atomic.LoadInt64(&packetsOutOfOrder))
+	writeTrafficMetrics(w)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+const testPeer = "127.0.0.1:9996"
+
+func resetSeqs() {
+	seenSeqs = make(map[string]*seqWindow)
+	lastEpoch = make(map[string]int64)
+}
+
+func TestCheckSeqDropsEveryDuplicate(t *testing.T) {
+	resetSeqs()
+	for seq := uint64(1); seq <= 10; seq++ {
+		if !checkSeq(testPeer, 1, seq) {
+			t.Fatalf("dropped first sight of %d", seq)
+		}
+	}
+	before := atomic.LoadInt64(&packetsDuplicate)
+	for _, seq := range []uint64{10, 9, 3, 1} {
+		if checkSeq(testPeer, 1, seq) {
+			t.Errorf("accepted duplicate %d", seq)
+		}
+	}
+	if got := atomic.LoadInt64(&packetsDuplicate) - before; got != 4 {
+		t.Errorf("counted %d duplicates, want 4", got)
+	}
+}
+
+func TestCheckSeqOutOfOrder(t *testing.T) {
+	resetSeqs()
+	checkSeq(testPeer, 1, 5)
+	before := atomic.LoadInt64(&packetsOutOfOrder)
+	if !checkSeq(testPeer, 1, 3) {
+		t.Errorf("dropped 3 arriving after 5")
+	}
+	if checkSeq(testPeer, 1, 3) {
+		t.Errorf("accepted 3 twice")
+	}
+	if got := atomic.LoadInt64(&packetsOutOfOrder) - before; got != 1 {
+		t.Errorf("counted %d out of order, want 1", got)
+	}
+
+	// Too old to tell whether we've seen it.
+	checkSeq(testPeer, 1, 5+seqWindowSize+1)
+	if checkSeq(testPeer, 1, 4) {
+		t.Errorf("accepted 4 from outside the window")
+	}
+
+	// A new epoch starts over.
+	if !checkSeq(testPeer, 2, 1) {
+		t.Errorf("dropped the first message of a new epoch")
+	}
+}
+
+func TestMalformedPacketIsCounted(t *testing.T) {
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 1, Y: 1}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 8, Y: 8}, Direction: DIRECTION_LEFT},
+	)
+	before := atomic.LoadInt64(&packetsMalformed)
+	deliverPacketFrom(t, nodes[1], []byte("this is not json"))
+	if got := atomic.LoadInt64(&packetsMalformed) - before; got != 1 {
+		t.Errorf("counted %d malformed packets, want 1", got)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+// This file implements mines, neutral hazards the leader scatters over the
+// board as the game goes on. Every mineIntervalTicks, the leader turns a random
+// empty cell into a mine, which kills whoever drives into it like a trail
+// does, and tells everyone where its mines are. Where mines go is drawn from
+// the game's secret, so the same game places the same mines.
+
+import (
+	"hash/fnv"
+	"math/rand"
+)
+
+// Marker of a mine cell on the board.
+const MINE_CELL string = "**"
+
+var mineIntervalTicks int // Ticks between the leader placing a mine, 0 for never.
+var mines []Pos           // Where mines are on the board, in the order placed.
+var mineRand *rand.Rand   // Picks where the leader places mines.
+
+// Reset mines for a new game, seeding where they go from the game's secret.
+func resetMines() {
+	mineRand = rand.New(rand.NewSource(secretSeed()))
+	mines = make([]Pos, 0)
+}
+
+// A seed drawn from the game's secret, so every node of the game gets the same
+// one.
+func secretSeed() int64 {
+	hash := fnv.New64a()
+	hash.Write(roomSecret)
+	return int64(hash.Sum64())
+}
+
+// Place mines at the given positions if they aren't already. mutex must be
+// held.
+func addMines(positions []Pos) {
+	for _, pos := range positions {
+		if !isOnBoard(pos.X, pos.Y) || cellAt(&board, pos) == MINE_CELL {
+			continue
+		}
+		setCell(&board, pos, MINE_CELL)
+		mines = append(mines, pos)
+	}
+}
+
+// Whether a node could drive into x, y on its next move, making a mine there
+// impossible to avoid. mutex must be held.
+func isNextToHead(x int, y int) bool {
+	for _, node := range nodes {
+		if node.IsAlive && intAbs(node.CurrLoc.X-x) <= 1 && intAbs(node.CurrLoc.Y-y) <= 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// LEADER: Place a mine at a random empty cell away from every node's head,
+// telling peers about it. mutex must be held.
+func placeMine() {
+	candidates := make([]Pos, 0)
+	for y := 0; y < BOARD_SIZE; y++ {
+		for x := 0; x < BOARD_SIZE; x++ {
+			if cellAt(&board, Pos{X: x, Y: y}) == "" && !isNextToHead(x, y) {
+				candidates = append(candidates, Pos{X: x, Y: y})
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		localLog("Nowhere to place a mine")
+		return
+	}
+	pos := candidates[mineRand.Intn(len(candidates))]
+	addMines([]Pos{pos})
+	localLog("Placed a mine at", pos)
+
+	msg := &Message{IsLeader: true, Mines: mines, Node: *myNode}
+	sendPacketsToPeers("Placed a mine", msg)
+}
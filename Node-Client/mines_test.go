@@ -0,0 +1,63 @@
+package main
+
+import "testing"
+
+func TestDrivingIntoMine(t *testing.T) {
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 1, Y: 1}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 1, Y: 5}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 1, Y: 8}, Direction: DIRECTION_RIGHT},
+	)
+	resetMines()
+	mineIntervalTicks = 1
+	defer func() { mineIntervalTicks = 0 }()
+
+	stepGame()
+	if len(mines) != 1 || cellAt(&board, mines[0]) != MINE_CELL {
+		t.Fatalf("mines %v after the interval, want one on the board", mines)
+	}
+	if isNextToHead(mines[0].X, mines[0].Y) {
+		t.Errorf("placed a mine at %v, next to a head", mines[0])
+	}
+
+	// Clear it, so only the mine placed next is in anyone's way.
+	setCell(&board, mines[0], "")
+	resetMines()
+	mineIntervalTicks = 0
+	addMines([]Pos{{X: 4, Y: 1}})
+	stepGame()
+	if !nodes[0].IsAlive {
+		t.Fatalf("p1 died before reaching the mine")
+	}
+	stepGame()
+	if nodes[0].IsAlive {
+		t.Errorf("p1 drove into the mine at {4 1} and survived")
+	}
+	if !nodes[1].IsAlive || !nodes[2].IsAlive {
+		t.Errorf("p2 alive %v, p3 alive %v, want both", nodes[1].IsAlive, nodes[2].IsAlive)
+	}
+}
+
+func TestFollowerAddsLeaderMines(t *testing.T) {
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 1, Y: 1}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 8, Y: 8}, Direction: DIRECTION_LEFT},
+	)
+	// We're p2, following p1.
+	nodeId = nodes[1].Id
+	myNode = nodes[1]
+	resetMines()
+	addMines([]Pos{{X: 4, Y: 4}})
+
+	placed := []Pos{{X: 4, Y: 4}, {X: 6, Y: 2}}
+	deliverFrom(t, nodes[0], &Message{IsLeader: true, Mines: placed, Node: *nodes[0]})
+
+	if len(mines) != len(placed) {
+		t.Errorf("mines %v, want %v", mines, placed)
+	}
+	for _, pos := range placed {
+		if cellAt(&board, pos) != MINE_CELL {
+			t.Errorf("cell %v is %q, want the leader's mine", pos, cellAt(&board, pos))
+		}
+	}
+}
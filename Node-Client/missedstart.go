@@ -0,0 +1,84 @@
+package main
+
+// This file implements catching a game start we missed. The ms server starts a
+// game by calling each player's StartGame, but if that call is lost, e.g. to a
+// network blip, we'd sit in the lobby while our peers play without us. So
+// while we're waiting, we ask the ms server with GetGameArgs every
+// startPollRate whether it started our game, and start it ourselves from the
+// args it returns if it did. Peers wait a few seconds for everyone to be
+// ready, which is longer than startPollRate.
+
+import "time"
+
+// How often we ask the ms server whether our game started while waiting.
+const startPollRate = 2 * time.Second
+
+// Statuses GetGameArgs replies with.
+const (
+	GAME_ARGS_STARTED string = "started" // The reply has the args of our game.
+	GAME_ARGS_WAITING string = "waiting" // We're still waiting in a room.
+	GAME_ARGS_UNKNOWN string = "unknown" // The ms server doesn't know our token.
+)
+
+type GameArgsReply struct {
+	Val  string
+	Args GameArgs
+	Log  []byte
+}
+
+var simMissStart bool // For testing, ignore the first StartGame call.
+var pollingStart bool // Whether pollForStart is running. mutex must be held.
+
+// Start polling for our game to start, unless we already are.
+func startPollingForStart() {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if pollingStart {
+		return
+	}
+	pollingStart = true
+	go pollForStart()
+}
+
+// Ask the ms server whether our game started every startPollRate while we're
+// in the lobby, starting it if it did.
+func pollForStart() {
+	defer func() {
+		mutex.Lock()
+		pollingStart = false
+		mutex.Unlock()
+	}()
+	for {
+		time.Sleep(startPollRate)
+		if lifecycle != GAME_LOBBY {
+			return
+		}
+		reply := &GameArgsReply{}
+		log := logSend("Rpc Call Context.GetGameArgs to " + msServerAddr)
+		err := msService.Call("Context.GetGameArgs",
+			&NodeJoin{Ip: nodeAddr, Token: msToken, Log: log}, reply)
+		if err != nil {
+			// The connection is gone, e.g. as the UI is reconnecting, which
+			// polls again once it has rejoined.
+			localLog("ERROR: failed to ask for our game's args:", err)
+			return
+		}
+		switch reply.Val {
+		case GAME_ARGS_WAITING:
+			continue
+		case GAME_ARGS_STARTED:
+			if lifecycle != GAME_LOBBY {
+				// StartGame got here first.
+				return
+			}
+			localLog("Missed our game starting, starting it from the ms server's args")
+			if err := new(NodeService).StartGame(&reply.Args, &ValReply{}); err != nil {
+				localLog("ERROR: failed to start missed game:", err)
+			}
+			return
+		default:
+			localLog("ms server doesn't know us anymore:", reply.Val)
+			return
+		}
+	}
+}
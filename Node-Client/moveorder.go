@@ -0,0 +1,49 @@
+package main
+
+// This file implements the order nodes move in each tick. By default they move
+// in the order the matchmaking server listed them, so whatever still depends on
+// that order favours the players listed first. So that no player is always
+// first, MOVE_ORDER_ROTATE starts each tick one player further down the list,
+// and MOVE_ORDER_RANDOM shuffles the list each tick. Both only depend on the
+// tick and the game's secret, so every node, and a replay after a rollback,
+// moves nodes in the same order.
+
+import (
+	"math/rand"
+	"strings"
+)
+
+// Orders nodes can move in each tick.
+const (
+	MOVE_ORDER_FIXED  string = "fixed"  // The order the matchmaking server listed them in.
+	MOVE_ORDER_ROTATE string = "rotate" // Tick n starts n players down that list, wrapping around.
+	MOVE_ORDER_RANDOM string = "random" // Shuffled each tick, seeded by moveOrderSeed and the tick.
+)
+
+var moveOrder string = MOVE_ORDER_FIXED
+var moveOrderSeed int64 // Drawn from the game's secret, for MOVE_ORDER_RANDOM.
+
+// The nodes in the order they move on tick. mutex must be held.
+func nodesInMoveOrder(tick int) []*Node {
+	if moveOrder == MOVE_ORDER_FIXED || len(nodes) == 0 {
+		return nodes
+	}
+	ordered := make([]*Node, len(nodes))
+	if moveOrder == MOVE_ORDER_RANDOM {
+		shuffle := rand.New(rand.NewSource(moveOrderSeed + int64(tick)))
+		for i, j := range shuffle.Perm(len(nodes)) {
+			ordered[i] = nodes[j]
+		}
+	} else {
+		for i := range nodes {
+			ordered[i] = nodes[(i+tick)%len(nodes)]
+		}
+	}
+
+	ids := make([]string, len(ordered))
+	for i, node := range ordered {
+		ids[i] = node.Id
+	}
+	debugLog("Tick", tick, "move order:", strings.Join(ids, " "))
+	return ordered
+}
@@ -4,38 +4,167 @@ package main
 // side.
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"io/ioutil"
 	"net"
 	"net/rpc"
 	"strconv"
+	"sync"
+	"time"
 )
 
 type NodeService int
 
 type ValReply struct {
-	Val string
+	Val   string
+	Ip    string // For Join, the ip peers will be given for us.
+	Token string // For Join, lets us take our place back with ReJoinQueue.
+}
+
+// Overrides where a node starts and which way it faces.
+type StartOverride struct {
+	X         int
+	Y         int
+	Direction string // "" to keep the default direction.
 }
 
 type GameArgs struct {
-	NodeList []*Node
+	NodeList        []*Node
+	MaxGameDuration time.Duration
+	AllowDiagonal   bool
+	SpawnProtection int
+	Lives           int
+	Secret          []byte
+	StartOverrides  map[string]StartOverride
+	CleanStart      int
+	BounceWalls     bool
+	ResultAddr      string
+	ShrinkInterval  int
+	TrailStride     int
+	AfkTicks        int
+	TrailLength     int
+	MineInterval    int
+	AreaTiebreak    bool
+	TurnCooldown    int
+	RollbackTicks   int
+	Reversal        string
+	MoveOrder       string
+	Assist          bool
+	FogRadius       int // 0 unless players only see around their heads.
+	KickAfter       int
+	KickWindow      time.Duration
+	StartDelays     map[string]int
+	PracticeTicks   int // 0 unless we're playing alone.
+	BestOf          int // 0 unless the game is part of a series.
+	SeriesWins      map[string]int
+	Token           string // Our token from Join, so we know the ms server sent it.
+	Log             []byte
+}
+
+// How a player finished a game.
+type PlayerResult struct {
+	Id      string
+	Ip      string
+	Name    string
+	IsAlive bool
+	Lives   int
+	Area    int // Distinct cells the player covered.
+}
+
+// Outcome of a game, reported to the ms server by the leader.
+type GameResult struct {
+	Winner   string
+	Reason   string
+	Players  []PlayerResult
+	Duration time.Duration
+	Ticks    int
+	Secret   []byte
 	Log      []byte
 }
 
 type NodeJoin struct {
-	RpcIp string
-	Ip    string
-	Log   []byte
+	RpcIp    string
+	Ip       string
+	Player   string
+	Name     string
+	Token    string // For ReJoinQueue, the token Join gave us.
+	Practice bool   // Whether to play alone if nobody else turns up.
+	Log      []byte
 }
 
+// Snapshot of the live game state, returned by GetState.
+type GameState struct {
+	Nodes      []Node
+	IsLeader   bool
+	AliveNodes int
+	Traffic    map[string]PeerTraffic // Peer address : traffic with it.
+}
+
+// Join status the matchmaking server replies with when we're waiting for a
+// game. Anything else means the join was rejected.
+const JOIN_QUEUED string = "queued"
+
+// ReJoinQueue status meaning our game started while we were reconnecting, so
+// we get its args with GetGameArgs rather than joining again.
+const JOIN_REJECTED_IN_PROGRESS string = "rejected_in_progress"
+
+// Status the UI is told we weren't joined with when the matchmaking server
+// can't be reached. Never sent by the server itself.
+const JOIN_UNREACHABLE string = "unreachable"
+
 var nodeRpcAddr string
 var msServerAddr string // Matchmaking server IP.
 var msService *rpc.Client
+var advertisedAddr string   // Ip the ms server gives peers for us.
+var resultAddr string       // Where the leader reports the game's result.
+var playerName string       // Name we're rated under by the ms server.
+var displayNameFlag string  // Name shown to other players.
+var msTLSConfig *tls.Config // For reaching the ms server over TLS, nil for plaintext.
+var msToken string          // Token from our last Join, "" until we've joined.
+
+// Held while we're joining, as the ms server may call StartGame before Join's
+// reply gives us msToken to check it against.
+var msTokenLock sync.Mutex
 
 // This RPC function is triggered when a game is ready to begin.
 func (nc *NodeService) StartGame(args *GameArgs, response *ValReply) error {
-	nodes = args.NodeList
 	logReceive("Rpc Called Start Game to "+msServerAddr, args.Log)
+	msTokenLock.Lock()
+	token := msToken
+	msTokenLock.Unlock()
+	if token == "" || args.Token != token {
+		// Anyone can reach our rpc server, but only the ms server knows our
+		// token.
+		localLog("Rejected StartGame without our token")
+		return errors.New("StartGame: wrong token")
+	}
+	if simMissStart {
+		simMissStart = false
+		localLog("Simulating missing the ms server's StartGame")
+		return nil
+	}
+	mutex.Lock()
+	err := startGameFromArgs(args)
+	mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	startGameUI() // in httpServer.go, transition to game screen on the client.
+	notifyGameStartToSpectators()
+	return nil
+}
+
+// Take on the args of a game from the ms server and start it. The last game's
+// goroutines may still be reading what they replace, so mutex must be held.
+func startGameFromArgs(args *GameArgs) error {
+	if err := transition(GAME_STARTING); err != nil {
+		return err
+	}
+	nodes = args.NodeList
 	if len(nodes) > MAX_PLAYERS {
+		transition(GAME_LOBBY)
 		return errors.New("MS Server returned a node list with more than the " +
 			"max number of supported players")
 	}
@@ -43,19 +172,66 @@ func (nc *NodeService) StartGame(args *GameArgs, response *ValReply) error {
 	localLog("Starting game with nodes: " + printNodes())
 	findMyNode()
 
+	allowDiagonal = args.AllowDiagonal
+	spawnProtectionTicks = args.SpawnProtection
+	startDelays = args.StartDelays
+	startingLives = intMax(1, args.Lives)
+	roomSecret = args.Secret
+	startOverrides = args.StartOverrides
+	cleanStartCells = args.CleanStart
+	bounceWalls = args.BounceWalls
+	resultAddr = args.ResultAddr
+	shrinkIntervalTicks = args.ShrinkInterval
+	trailStride = args.TrailStride
+	afkTicks = args.AfkTicks
+	trailLength = args.TrailLength
+	mineIntervalTicks = args.MineInterval
+	areaTiebreak = args.AreaTiebreak
+	turnCooldownTicks = args.TurnCooldown
+	rollbackTicks = args.RollbackTicks
+	practiceTicks = args.PracticeTicks
+	bestOf = args.BestOf
+	seriesWins = args.SeriesWins
+	if score := seriesScore(); score != "" {
+		localLog(score)
+	}
+	kickAfter = args.KickAfter
+	steeringAssist = args.Assist
+	fogRadius = args.FogRadius
+	kickWindow = args.KickWindow
+	reversalRule = args.Reversal
+	if reversalRule == "" {
+		// From a matchmaking server that predates the rule.
+		reversalRule = REVERSAL_IGNORE
+	}
+	moveOrder = args.MoveOrder
+	if moveOrder == "" {
+		// From a matchmaking server that predates choosing the order.
+		moveOrder = MOVE_ORDER_FIXED
+	}
+	maxGameDuration = args.MaxGameDuration
+	if maxGameDuration <= 0 {
+		maxGameDuration = defaultMaxGameDuration
+	}
+
 	if msService == nil {
+		transition(GAME_LOBBY)
 		return errors.New("msService somehow still not setup")
 	}
 	msService.Close()
 
-	startGame()   // in node.go, call when rpc is working
-	startGameUI() // in httpServer.go, transition to game screen on the client.
+	// in node.go, call when rpc is working
+	if err := startGame(); err != nil {
+		localLog("ERROR: failed to start game:", err)
+		transition(GAME_LOBBY)
+		return err
+	}
 	return nil
 }
 
 func findMyNode() {
 	for i, node := range nodes {
-		if node.Ip == nodeAddr {
+		if node.Ip == advertisedAddr {
 			myNode = node
 			nodeId = node.Id
 			nodeIndex = strconv.Itoa(i + 1)
@@ -75,37 +251,223 @@ func printNodes() string {
 // This RPC function serves as a way for the Matchmaking service to send text to this node.
 func (nc *NodeService) Message(args *GameArgs, response *ValReply) error {
 	logReceive("Rpc Called Message", args.Log)
+	if isMsDropped() {
+		return errMsDropped
+	}
 	localLog("Received message:" + response.Val)
 	return nil
 }
 
-func msRpcServe() {
-	defer waitGroup.Done()
+// This RPC function lets tooling inspect the players and their positions.
+// args is unused.
+func (nc *NodeService) GetState(args *int, response *GameState) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	response.Nodes = make([]Node, 0, len(nodes))
+	for _, n := range nodes {
+		node := *n
+		if n.CurrLoc != nil {
+			// Copy the position so the caller doesn't share it with the game.
+			loc := *n.CurrLoc
+			node.CurrLoc = &loc
+		}
+		response.Nodes = append(response.Nodes, node)
+	}
+	response.IsLeader = isLeader()
+	response.AliveNodes = aliveNodes
+	response.Traffic = trafficSnapshot()
+	return nil
+}
 
+func msRpcServe() error {
 	localAddr, err := net.ResolveTCPAddr("tcp", nodeRpcAddr)
-	checkErr(err, 78)
+	if err != nil {
+		return err
+	}
 
 	nodeService := new(NodeService)
-	rpc.Register(nodeService)
+	if err = rpc.Register(nodeService); err != nil {
+		return err
+	}
 	nodeListener, err := net.Listen("tcp", localAddr.String())
-	checkErr(err, 83)
+	if err != nil {
+		return err
+	}
+	msDropLock.Lock()
+	rpcListener = nodeListener
+	msDropLock.Unlock()
 
+	// Besides the ms server, tooling may connect to call GetState, so keep
+	// accepting connections.
 	localLog("Listening for ms server at ", localAddr.String())
-	conn, err := nodeListener.Accept()
-	checkErr(err, 87)
-	go rpc.ServeConn(conn)
+	for {
+		msDropLock.Lock()
+		nodeListener = rpcListener
+		msDropLock.Unlock()
+		conn, err := nodeListener.Accept()
+		if err != nil {
+			if isMsDropped() {
+				// Closed by simulateMsDrop, which listens again later.
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			localLog("ERROR: failed to accept rpc connection:", err)
+			continue
+		}
+		go rpc.ServeConn(conn)
+	}
+}
+
+// LEADER: Snapshot the outcome of the game that just ended. mutex must be held.
+func newGameResult(winner string, reason string) *GameResult {
+	players := make([]PlayerResult, 0, len(nodes))
+	for _, n := range nodes {
+		players = append(players, PlayerResult{Id: n.Id, Ip: n.Ip, Name: n.Name,
+			IsAlive: n.IsAlive, Lives: n.Lives, Area: areaOf(n)})
+	}
+	return &GameResult{
+		Winner:   winner,
+		Reason:   reason,
+		Players:  players,
+		Duration: time.Since(gameStartTime),
+		Ticks:    tickCount,
+		Secret:   roomSecret,
+	}
+}
+
+// LEADER: Report the outcome of the game to the ms server that started it, at
+// resultAddr. It's passed in rather than read, as the next game of a series
+// may replace it meanwhile.
+func reportResult(resultAddr string, result *GameResult) {
+	if resultAddr == "" {
+		return
+	}
+	client, err := dialMS(resultAddr)
+	if err != nil {
+		localLog("ERROR: can't reach ms server to report result:", err)
+		return
+	}
+	defer client.Close()
+
+	result.Log = logSend("Rpc Call Context.ReportResult to " + resultAddr)
+	var reply ValReply
+	if err := client.Call("Context.ReportResult", result, &reply); err != nil {
+		localLog("ERROR: failed to report result:", err)
+		return
+	}
+	localLog("Reported game result, winner:", result.Winner)
+}
+
+// Connect to the ms server's rpc service at addr, over TLS if configured.
+func dialMS(addr string) (*rpc.Client, error) {
+	if msTLSConfig == nil {
+		return rpc.Dial("tcp", addr)
+	}
+	conn, err := tls.Dial("tcp", addr, msTLSConfig)
+	if err != nil {
+		return nil, err
+	}
+	return rpc.NewClient(conn), nil
+}
+
+// Build the TLS config for reaching the ms server, trusting the CAs in
+// caFile, and presenting the certificate and key in certFile and keyFile if
+// the server asks for one. Returns nil if caFile is unset, for plaintext.
+func newMSTLSConfig(caFile string, certFile string, keyFile string) (*tls.Config, error) {
+	if caFile == "" {
+		if certFile != "" || keyFile != "" {
+			return nil, errors.New("-ms-tls-cert and -ms-tls-key need -ms-tls-ca")
+		}
+		return nil, nil
+	}
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("no certificates found in " + caFile)
+	}
+	// The ms server's certificate is for the host we were given, not
+	// necessarily the address it's resolved to or reports results at.
+	host, _, err := net.SplitHostPort(msServerAddr)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{RootCAs: pool, ServerName: host}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
 }
 
-func msRpcDial() {
-	remoteAddr, e := net.ResolveTCPAddr("tcp", msServerAddr)
-	checkErr(e, 93)
+func msRpcDial() error {
+	remoteAddr, err := net.ResolveTCPAddr("tcp", msServerAddr)
+	if err != nil {
+		return err
+	}
 
-	msService, e = rpc.Dial("tcp", remoteAddr.String())
-	checkErr(e, 96)
+	if msService != nil {
+		// We're reconnecting, e.g. after the UI reloaded.
+		msService.Close()
+	}
+	msService, err = dialMS(remoteAddr.String())
+	if err != nil {
+		return err
+	}
 
 	var reply *ValReply = &ValReply{Val: ""}
-	log := logSend("Rpc Call Context.Join to " + msServerAddr)
-	err := msService.Call("Context.Join",
-		&NodeJoin{RpcIp: nodeRpcAddr, Ip: nodeAddr, Log: log}, reply)
-	checkErr(err, 101)
+	if msToken != "" {
+		// Take our place in the queue back rather than joining it again.
+		log := logSend("Rpc Call Context.ReJoinQueue to " + msServerAddr)
+		err = msService.Call("Context.ReJoinQueue",
+			&NodeJoin{RpcIp: nodeRpcAddr, Ip: nodeAddr, Token: msToken, Log: log}, reply)
+		if err != nil {
+			return err
+		}
+		localLog("Rejoin status:", reply.Val)
+		if reply.Val == JOIN_REJECTED_IN_PROGRESS {
+			startPollingForStart() // in missedstart.go, which starts it for us.
+			return nil
+		}
+	}
+	if reply.Val != JOIN_QUEUED {
+		msTokenLock.Lock()
+		log := logSend("Rpc Call Context.Join to " + msServerAddr)
+		err = msService.Call("Context.Join",
+			&NodeJoin{RpcIp: nodeRpcAddr, Ip: nodeAddr, Player: playerName,
+				Name: displayNameFlag, Practice: practiceAlone, Log: log}, reply)
+		if err == nil {
+			msToken = reply.Token
+		}
+		msTokenLock.Unlock()
+		if err != nil {
+			return err
+		}
+		localLog("Join status:", reply.Val)
+	}
+
+	advertisedAddr = nodeAddr
+	if reply.Ip != "" && reply.Ip != nodeAddr {
+		// We left out our host, so the ms server filled in the one it sees.
+		localLog("Peers will reach us at", reply.Ip)
+		advertisedAddr = reply.Ip
+	}
+	if reply.Val != JOIN_QUEUED {
+		// No game is coming, so let the player know instead of waiting.
+		notifyJoinRejectedToJS(reply.Val)
+		return nil
+	}
+	startPollingForStart() // in missedstart.go, in case StartGame never comes.
+	if simMsDrop > 0 {
+		// Just the once.
+		go simulateMsDrop(simMsDrop)
+		simMsDrop = 0
+	}
+	return nil
 }
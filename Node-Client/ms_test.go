@@ -0,0 +1,53 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetStateMidGame(t *testing.T) {
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 1, Y: 1}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 8, Y: 8}, Direction: DIRECTION_LEFT},
+	)
+	stepGame()
+	stepGame()
+
+	var state GameState
+	if err := new(NodeService).GetState(nil, &state); err != nil {
+		t.Fatal(err)
+	}
+	if state.IsLeader != isLeader() || state.AliveNodes != aliveNodes {
+		t.Errorf("leader %v with %d alive, want %v with %d",
+			state.IsLeader, state.AliveNodes, isLeader(), aliveNodes)
+	}
+	if len(state.Nodes) != len(nodes) {
+		t.Fatalf("got %d nodes, want %d", len(state.Nodes), len(nodes))
+	}
+	for i, n := range state.Nodes {
+		if !reflect.DeepEqual(n, *nodes[i]) {
+			t.Errorf("got node %+v, want %+v", n, *nodes[i])
+		}
+	}
+
+	// Positions are copies, so the caller can't move nodes.
+	state.Nodes[0].CurrLoc.X = 5
+	if nodes[0].CurrLoc.X != 3 {
+		t.Errorf("changing the returned position moved p1 to %v", *nodes[0].CurrLoc)
+	}
+}
+
+func TestStartGameNeedsOurToken(t *testing.T) {
+	lifecycle = GAME_LOBBY
+	defer func() { msToken = "" }()
+	for _, token := range []string{"", "ours"} {
+		msToken = token
+		err := new(NodeService).StartGame(&GameArgs{Token: "forged"}, &ValReply{})
+		if err == nil {
+			t.Errorf("started a game with a forged token while ours was %q", token)
+		}
+		if lifecycle != GAME_LOBBY {
+			t.Errorf("forged StartGame moved us to %s", lifecycle)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+// This file implements -sim-ms-drop, for testing the ms server's reconnect
+// grace. Once we've joined, we stop answering the ms server for a while, as
+// if our network had dropped out: our rpc server stops accepting connections
+// and fails calls on the ones it has. Then we take our place back with
+// ReJoinQueue, as we would when the UI reconnects.
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+var simMsDrop time.Duration // For testing, how long to stop answering the ms server after joining.
+
+var msDropLock sync.Mutex
+var rpcListener net.Listener // Accepts the ms server's connections. msDropLock must be held.
+var msDropped bool           // Whether we're pretending to have lost the ms server. msDropLock must be held.
+
+var errMsDropped = errors.New("simulating having lost the ms server")
+
+// Whether we're pretending to have lost the ms server.
+func isMsDropped() bool {
+	msDropLock.Lock()
+	defer msDropLock.Unlock()
+	return msDropped
+}
+
+// Stop answering the ms server for drop, then rejoin our room.
+func simulateMsDrop(drop time.Duration) {
+	localLog("Simulating losing the ms server for", drop)
+	msDropLock.Lock()
+	msDropped = true
+	addr := rpcListener.Addr().String()
+	rpcListener.Close()
+	msDropLock.Unlock()
+
+	time.Sleep(drop)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		localLog("ERROR: can't listen for the ms server again:", err)
+		return
+	}
+	msDropLock.Lock()
+	rpcListener = listener
+	msDropped = false
+	msDropLock.Unlock()
+	localLog("Reconnecting to the ms server")
+	if err := msRpcDial(); err != nil {
+		localLog("ERROR: failed to rejoin the ms server:", err)
+	}
+}
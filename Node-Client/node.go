@@ -4,11 +4,18 @@ package main
 // game state logic.
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"net"
 	"os"
+	"os/signal"
+	"runtime/debug"
 	"strconv"
 	"sync"
 	"time"
@@ -26,6 +33,9 @@ type Node struct {
 	CurrLoc   *Pos
 	Direction string
 	IsAlive   bool
+	Lives     int    // Crashes left before the node is out of the game.
+	Name      string // Display name, "" if the player didn't give one.
+	Colour    string // Hex colour the node is drawn in, "" for the UI's default.
 }
 
 // Message to be passed among nodes.
@@ -33,9 +43,33 @@ type Message struct {
 	IsLeader          bool                // is this from the leader.
 	IsDirectionChange bool                // is this a direction change update.
 	IsDeathReport     bool                // is this a death report.
+	IsRespawn         bool                // is this a node losing a life and respawning.
+	IsGameOver        bool                // is this the leader ending the game.
+	IsReady           bool                // is this a node reporting it's ready to play.
+	IsReadyReply      bool                // is this ready report answering a peer's, so it isn't answered itself.
+	IsCoordinator     bool                // is this the leader leaving and handing off to Successor.
+	IsCatchUp         bool                // is this the leader sending just us its Board to adopt, see catchup.go.
+	Successor         string              // id of the new leader in a coordinator message.
+	Winner            string              // id of the winner if the game is over, "" for a draw.
 	FailedNodes       []string            // id of disconnected nodes.
 	Node              Node                // interval update struct node or dead node.
-	GameHistory       map[string]([]*Pos) // history of at most 5 ticks
+	Collision         *CollisionEvent     // what killed the node in a death report from the leader.
+	GameHistory       map[string]([]*Pos) // history of at most leaderHistoryLength ticks
+	Tick              int                 // sender's tick count when sent; followers adopt the leader's.
+	BoardHash         uint64              // hash of the leader's board.
+	Board             string              // leader's whole board, encoded by BoardCodec, if not a delta.
+	BoardDelta        string              // cells of the leader's board changed since DeltaBase.
+	DeltaBase         uint64              // hash of the board BoardDelta applies to, 0 if not a delta.
+	ShrunkRings       int                 // rings of the board the leader has turned into walls.
+	Mines             []Pos               // where the leader has placed mines.
+	Term              int                 // sender's leaderTerm, so stale leaders can be told apart.
+	Seq               uint64              // sender's sequence number for the message, see metrics.go.
+	SeqEpoch          int64               // when the sender started numbering from 1, see seqepoch.go.
+	SentAt            int64               // sender's clock when sent, in UnixNano.
+	EchoSentAt        int64               // SentAt of the last message the sender got from the recipient.
+	EchoReceivedAt    int64               // sender's clock when it got that message.
+	StartedAt         int64               // leader's clock when the game started, in UnixNano; see clock.go.
+	Acks              []uint64            // seqs of the last death reports the sender got, see deathreport.go.
 	Log               []byte
 }
 
@@ -46,30 +80,77 @@ const (
 	DIRECTION_DOWN       string        = "D"
 	DIRECTION_LEFT       string        = "L"
 	DIRECTION_RIGHT      string        = "R"
+	DIRECTION_UP_LEFT    string        = "UL" // Diagonals are only valid when allowDiagonal is set.
+	DIRECTION_UP_RIGHT   string        = "UR"
+	DIRECTION_DOWN_LEFT  string        = "DL"
+	DIRECTION_DOWN_RIGHT string        = "DR"
 	MAX_PLAYERS          int           = 6
 	AXIS_X               int           = 0
 	AXIS_Y               int           = 1
 	intervalUpdateRate   time.Duration = 1000 * time.Millisecond
 	tickRate             time.Duration = 500 * time.Millisecond
+	slowTickThreshold    time.Duration = tickRate / 2 // Ticks slower than this get logged.
 	enforceGameStateRate time.Duration = 2000 * time.Millisecond
+
+	// Histories are rebuilt from the board every tick, so these bound their
+	// size (and the size of game state broadcasts) no matter how long the game.
+	leaderHistoryLength int = 7 // Positions per node in gameHistory.
+	nodeHistoryLength   int = 5 // Positions per node in nodeHistory.
+
+	defaultMaxGameDuration time.Duration = 10 * time.Minute
+)
+
+// What a node runs into when it moves.
+type collision int
+
+const (
+	COLLISION_NONE  collision = iota // Nothing, the move is fine.
+	COLLISION_WALL                   // The edge of the board.
+	COLLISION_TRAIL                  // A trail or another node.
 )
 
 // Game variables.
-var isPlaying bool        // Is the game in session.
-var imAlive bool          // Am I alive.
 var nodeId string         // Name of client.
 var nodeIndex string      // Player number (1 - 6).
 var nodeAddr string       // IP of client.
 var httpServerAddr string // HTTP Server IP.
+var transportName string  // Kind of transport used between peers.
+var transport Transport   // Sends and receives packets from peers, set with setTransport.
 var nodes []*Node         // All nodes in the game.
 var myNode *Node          // My node.
 
-var nodeHistory map[string][]*Pos // Id to list of 5 recent local locations of each player
+var peerAddrs map[string]*net.UDPAddr       // Ip of each node : its resolved address.
+var startOverrides map[string]StartOverride // Id : where it starts instead of its spawn.
+
+var nodeHistory map[string][]*Pos // Id to list of nodeHistoryLength recent local locations of each player
 var aliveNodes int                // Number of alive nodes.
 
+var allowDiagonal bool            // Whether diagonal directions are allowed.
+var spawnProtectionTicks int      // Collisions are survived for this many ticks.
+var startDelays map[string]int    // Id : ticks the node stays put before it starts moving.
+var startingLives int             // Lives each node starts with.
+var tickCount int                 // Number of ticks played so far.
+var gameStartTime time.Time       // When the game started, by the leader's clock once we've heard it.
+var winnerId string               // Id of the winner once the game is over.
+var maxGameDuration time.Duration // Game is ended as a draw once it runs this long.
+var cleanStartCells int           // No trail is left this close to a node's spawn.
+var spawnPositions map[string]Pos // Id : where the node last spawned.
+var bounceWalls bool              // Whether walls turn nodes rather than kill them.
+var predictPeers bool             // Whether late direction changes are corrected for.
+var shrinkIntervalTicks int       // Ticks between the board closing in, 0 for never.
+var shrunkRings int               // Outer rings of the board that are now walls.
+var trailStride int               // Nodes only leave a trail every this many ticks.
+var trailLength int               // Most trail cells a node has at once, 0 for no limit.
+var trailCells map[string][]Pos   // Id : cells of the node's trail, oldest first.
+
+// How often the leader broadcasts the full game state. Heartbeats go out every
+// intervalUpdateRate regardless, so this only sets how quickly followers are
+// corrected.
+var leaderBroadcastRate time.Duration
+
 // #LEADER specific.
 var failedNodes []string          // id of failed nodes found.
-var gameHistory map[string][]*Pos // Last five moves of every node in the game. Written ONLY by the leader.
+var gameHistory map[string][]*Pos // Last leaderHistoryLength moves of every node in the game. Written ONLY by the leader.
 
 // Sync variables.
 var waitGroup sync.WaitGroup // For internal processes.
@@ -81,30 +162,112 @@ var initialPositions map[string]*Pos    // Initial positions for all players.
 var lastCheckin map[string]time.Time
 
 func main() {
-	if len(os.Args) != 5 {
-		log.Println("usage: NodeClient [nodeAddr] [nodeRpcAddr] [msServerAddr] [httpServerAddr]")
-		log.Println("[nodeAddr] the udp ip:port node is listening to")
+	flag.StringVar(&transportName, "transport", TRANSPORT_UDP,
+		"transport used between peers, "+TRANSPORT_UDP+" or "+TRANSPORT_TCP)
+	recordPath := flag.String("record", "",
+		"file to record a replay of the game to, if any")
+	flag.BoolVar(&debugLogging, "debug", false, "log extra detail for debugging")
+	flag.BoolVar(&pprofEnabled, "pprof", false,
+		"serve Go's runtime profiles on the HTTP server at /debug/pprof/, for profiling the node")
+	flag.StringVar(&playerName, "player", "",
+		"name to be rated under by the matchmaking server; unrated if unset")
+	flag.StringVar(&displayNameFlag, "name", "",
+		"name shown to other players; defaults to the player's slot, e.g. p1")
+	flag.BoolVar(&practiceAlone, "practice", false,
+		"play alone against the clock if nobody else joins in time")
+	flag.BoolVar(&predictPeers, "predict", false,
+		"correct for lag in peers' direction changes instead of applying them late")
+	flag.IntVar(&udpReadBuffer, "udp-read-buffer", defaultUDPBufferSize,
+		"bytes to ask for the udp socket's receive buffer")
+	flag.IntVar(&udpWriteBuffer, "udp-write-buffer", defaultUDPBufferSize,
+		"bytes to ask for the udp socket's send buffer")
+	flag.DurationVar(&leaderBroadcastRate, "leader-broadcast-rate", enforceGameStateRate,
+		"how often to broadcast the full game state while leading")
+	logBoard := flag.Bool("log-board", true, "log the board every tick")
+	flag.BoolVar(&boardBorder, "board-border", false,
+		"draw a border around the board when logging it and in the UI")
+	flag.BoolVar(&uiDeltas, "ui-deltas", false,
+		"send the UI only the cells that changed each tick, with the whole board every so often")
+	flag.StringVar(&spectateAddr, "spectate", "",
+		"ip:port to host spectators at; only the leader sends them the game")
+	msTLSCA := flag.String("ms-tls-ca", "",
+		"PEM CA certificates to verify the matchmaking server with; reach it over TLS if set")
+	msTLSCert := flag.String("ms-tls-cert", "",
+		"PEM certificate to present to the matchmaking server, if it asks for one")
+	msTLSKey := flag.String("ms-tls-key", "",
+		"PEM private key for -ms-tls-cert")
+	flag.Float64Var(&simLoss, "sim-loss", 0,
+		"for testing, the probability each packet sent to a peer is dropped")
+	flag.DurationVar(&simLatency, "sim-latency", 0,
+		"for testing, delay added to every packet sent to a peer")
+	flag.DurationVar(&simJitter, "sim-jitter", 0,
+		"for testing, most extra delay added at random to each packet sent to a peer, reordering them")
+	flag.Int64Var(&simSeed, "sim-seed", 1,
+		"for testing, seed for which packets -sim-loss and -sim-jitter affect")
+	flag.BoolVar(&simMissStart, "sim-miss-start", false,
+		"for testing, ignore the matchmaking server starting the game, as if the call were lost")
+	flag.DurationVar(&simMsDrop, "sim-ms-drop", 0,
+		"for testing, stop answering the matchmaking server this long after joining, then rejoin")
+	flag.DurationVar(&simSeqReset, "sim-seq-reset", 0,
+		"for testing, start numbering messages over this long into a game, as if the node had restarted")
+	flag.IntVar(&simBadPackets, "sim-bad-packets", 0,
+		"for testing, send the leader this many packets without a location once the game runs, one a tick")
+	flag.Parse()
+	if flag.NArg() != 4 || leaderBroadcastRate <= 0 || simLoss < 0 || simLoss > 1 ||
+		(transportName != TRANSPORT_UDP && transportName != TRANSPORT_TCP) {
+		log.Println("usage: NodeClient [flags] [nodeAddr] [nodeRpcAddr] [msServerAddr] [httpServerAddr]")
+		log.Println("[nodeAddr] the udp (or tcp) ip:port node is listening to")
 		log.Println("[nodeRpcAddr] the rpc ip:port node is hosting for ms server")
 		log.Println("[msServerAddr] the rpc ip:port of matchmaking server node is connecting to")
 		log.Println("[httpServerAddr] the ip:port the http server is binded to ")
+		log.Println("[flags]")
+		flag.PrintDefaults()
 		os.Exit(1)
 	}
 
-	nodeAddr, nodeRpcAddr, msServerAddr = os.Args[1], os.Args[2], os.Args[3]
+	nodeAddr, nodeRpcAddr, msServerAddr = flag.Arg(0), flag.Arg(1), flag.Arg(2)
 
-	httpServerTcpAddr, err := net.ResolveTCPAddr("tcp", os.Args[4])
+	httpServerTcpAddr, err := net.ResolveTCPAddr("tcp", flag.Arg(3))
 	checkErr(err, 96)
 	httpServerAddr = httpServerTcpAddr.String()
 
 	log.Println(nodeAddr, nodeRpcAddr, msServerAddr, httpServerAddr)
 	initLogging()
+	if !*logBoard {
+		boardOutput = ioutil.Discard
+	}
+	if *recordPath != "" {
+		checkErr(startRecording(*recordPath), 131)
+	}
+	msTLSConfig, err = newMSTLSConfig(*msTLSCA, *msTLSCert, *msTLSKey)
+	checkErr(err, 134)
+	if err := preflight(); err != nil {
+		localLog("ERROR: preflight failed:", err)
+		os.Exit(1)
+	}
+
+	go handleInterrupt()
 
 	waitGroup.Add(2) // Add internal process.
-	go httpServe()
-	go msRpcServe()
+	go runProcess("httpServe", httpServe)
+	go runProcess("msRpcServe", msRpcServe)
+	if spectateAddr != "" {
+		waitGroup.Add(1)
+		go runProcess("spectateServe", spectateServe)
+	}
 	waitGroup.Wait() // Wait until processes are done.
 }
 
+// Runs a long-lived internal process. Errors bubbling up to here can't be
+// recovered from, so the program exits.
+func runProcess(name string, process func() error) {
+	defer waitGroup.Done()
+	if err := process(); err != nil {
+		localLog("ERROR:", name, "failed:", err)
+		os.Exit(1)
+	}
+}
+
 // Initialize variables.
 func init() {
 	initialDirections = map[string]string{
@@ -126,11 +289,15 @@ func init() {
 	}
 
 	for player, pos := range initialPositions {
-		board[pos.Y][pos.X] = player
+		setCell(&board, *pos, player)
 	}
 
 	nodeHistory = make(map[string][]*Pos)
 	nodes = make([]*Node, 0)
+	spawnPositions = make(map[string]Pos)
+	lastInputTick = make(map[string]int)
+	trailCells = make(map[string][]Pos)
+	visitedCells = make(map[string][]Pos)
 
 	mutex = &sync.Mutex{}
 
@@ -153,41 +320,323 @@ func intMin(a int, b int) int {
 	return b
 }
 
-func startGame() {
+func intAbs(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+func startGame() error {
+	if len(nodes) == 0 {
+		return errors.New("can't start a game with no nodes")
+	}
+	if myNode == nil {
+		return fmt.Errorf("%s isn't in the game's node list", advertisedAddr)
+	}
+
+	// Check every peer address and bind the peer port first so a bad address
+	// fails the setup cleanly rather than mid-game.
+	err := resolvePeerAddrs()
+	if err != nil {
+		return err
+	}
+	starts, err := startingPositions()
+	if err != nil {
+		return err
+	}
+	if transport != nil {
+		// Our last game's, which still has the peer port.
+		transport.Close()
+	}
+	next, err := newTransport(transportName, nodeAddr)
+	if err != nil {
+		return err
+	}
+	setTransport(impairTransport(next))
+
+	// Only present players should be on the board, and possibly not where
+	// init() put them. Nothing is left of any game we played before.
+	board = [BOARD_SIZE][BOARD_SIZE]string{}
+	nodeHistory = make(map[string][]*Pos)
+	gameHistory = make(map[string][]*Pos)
+	failedNodes = make([]string, 0)
+	winnerId = ""
+
 	// Find myself and init variables.
 	for _, node := range nodes {
-		node.CurrLoc = initialPositions[node.Id]
-		node.Direction = initialDirections[node.Id]
+		node.CurrLoc = starts[node.Id].Pos
+		node.Direction = starts[node.Id].Direction
 		node.IsAlive = true
+		node.Lives = startingLives
+		spawnPositions[node.Id] = *node.CurrLoc
+		lastInputTick[node.Id] = startDelays[node.Id] // Not AFK while held at the start.
+		trailCells[node.Id] = nil
+		visitedCells[node.Id] = nil
 		lastCheckin[node.Id] = time.Now()
-	}
-
-	// Remove the node IDs of non-present players from the board.
-	for i := len(nodes) + 1; i <= MAX_PLAYERS; i++ {
-		pos, ok := initialPositions[fmt.Sprintf("p%d", i)]
-		if !ok {
-			continue
-		}
-
-		board[pos.Y][pos.X] = ""
+		setCell(&board, *node.CurrLoc, node.Id)
 	}
 
 	localLog("nodeId:", nodeId)
 	localLog("----INITIAL STATE----")
-	printBoard()
+	printBoard(boardOutput, &board)
 	localLog("----INITIAL STATE----")
 
 	// ================================================= //
 
-	imAlive = true
-	isPlaying = true
 	aliveNodes = len(nodes)
+	gameStartTime = time.Now()
+	tickCount = 0
+	shrunkRings = 0
+	leaderTerm = 0
+	broadcastCount = 0
+	haveLeaderBoard = false
+	readyNodes = make(map[string]bool)
+	nextTurnTick = 0
+	latestPositions = make(map[string]positionStamp)
+	snapshots = nil
+	reversedNodes = make(map[string]bool)
+	pendingDeaths = make(map[string]*pendingDeath)
+	recentAcks = nil
+	rejections = make(map[string][]time.Time)
+	resetMines()
+	moveOrderSeed = secretSeed()
+	gameNumber++
+
+	peers := transport
+	go runGameLoop("listenPackets", func() { listenPackets(peers) })
+	go runGameLoop("intervalUpdate", intervalUpdate)
+	go runGameLoop("tickGame", tickGame)
+	go runGameLoop("handleNodeFailure", handleNodeFailure)
+	go runGameLoop("enforceGameState", enforceGameState)
+	go runGameLoop("enforceMaxGameDuration", enforceMaxGameDuration)
+	go runGameLoop("resendDeathReports", resendDeathReports)
+	if simSeqReset > 0 {
+		go simulateSeqReset(gameNumber)
+	}
+	if simBadPackets > 0 {
+		go simulateBadPackets(gameNumber)
+	}
+	return nil
+}
+
+// Where a node starts and which way it faces.
+type startingPosition struct {
+	Pos       *Pos
+	Direction string
+}
+
+// Work out where each node starts, applying the overrides from the ms server
+// over the default spawns. A node that would leave the board on its first
+// tick is turned to face inwards. Returns an error if a node would start off
+// the board, facing an invalid direction, on top of another node, or on or
+// facing a wall.
+func startingPositions() (map[string]startingPosition, error) {
+	starts := make(map[string]startingPosition)
+	taken := make(map[Pos]string) // Position : id of the node starting there
+	for _, node := range nodes {
+		pos, ok := initialPositions[node.Id]
+		if !ok {
+			return nil, fmt.Errorf("node %s has no spawn", node.Id)
+		}
+		loc := *pos
+		direction := initialDirections[node.Id]
+		if override, ok := startOverrides[node.Id]; ok {
+			loc = Pos{X: override.X, Y: override.Y}
+			if override.Direction != "" {
+				direction = override.Direction
+			}
+		}
+
+		if !isOnBoard(loc.X, loc.Y) {
+			return nil, fmt.Errorf("node %s would start off the board at %v", node.Id, loc)
+		}
+		if !isValidDirection(direction) {
+			return nil, fmt.Errorf("node %s would start facing invalid direction %q",
+				node.Id, direction)
+		}
+		if x, y := nextPosition(loc.X, loc.Y, direction); !isOnBoard(x, y) {
+			inward := inwardDirection(loc)
+			localLog("Node", node.Id, "would start facing off the board at", loc,
+				"so facing", inward, "instead of", direction)
+			direction = inward
+		}
+		if other, ok := taken[loc]; ok {
+			return nil, fmt.Errorf("nodes %s and %s would both start at %v",
+				other, node.Id, loc)
+		}
+		if err := checkSpawnClear(loc, direction); err != nil {
+			return nil, fmt.Errorf("node %s can't start at %v: %v", node.Id, loc, err)
+		}
+		taken[loc] = node.Id
+		starts[node.Id] = startingPosition{Pos: &loc, Direction: direction}
+	}
+	return starts, nil
+}
 
-	go listenUDPPacket()
-	go intervalUpdate()
-	go tickGame()
-	go handleNodeFailure()
-	go enforceGameState()
+// The straight direction with the most room ahead of pos before the edge of
+// the board, preferring right, left, down then up on ties so every node picks
+// the same.
+func inwardDirection(pos Pos) string {
+	room := map[string]int{
+		DIRECTION_RIGHT: BOARD_SIZE - 1 - pos.X,
+		DIRECTION_LEFT:  pos.X,
+		DIRECTION_DOWN:  BOARD_SIZE - 1 - pos.Y,
+		DIRECTION_UP:    pos.Y,
+	}
+	best := DIRECTION_RIGHT
+	for _, direction := range []string{DIRECTION_LEFT, DIRECTION_DOWN, DIRECTION_UP} {
+		if room[direction] > room[best] {
+			best = direction
+		}
+	}
+	return best
+}
+
+// Resolve the address of every node in the game, caching them for sending.
+func resolvePeerAddrs() error {
+	addrs := make(map[string]*net.UDPAddr)
+	for _, node := range nodes {
+		addr, err := net.ResolveUDPAddr("udp", node.Ip)
+		if err != nil {
+			return fmt.Errorf("node %s has a bad address %q: %v", node.Id, node.Ip, err)
+		}
+		addrs[node.Ip] = addr
+	}
+	peerAddrs = addrs
+	return nil
+}
+
+// Whether addr, a peer's Ip or where a packet came from, is our own peer
+// address. Sending to it would have us process our own updates as a peer's,
+// e.g. if two ids were given the same address.
+func isOwnAddr(addr string) bool {
+	if myNode == nil {
+		return false
+	}
+	if addr == myNode.Ip || addr == nodeAddr {
+		return true
+	}
+	own, ok := peerAddrs[myNode.Ip]
+	if !ok {
+		return false
+	}
+	other, ok := peerAddrs[addr]
+	if !ok {
+		var err error
+		if other, err = net.ResolveUDPAddr("udp", addr); err != nil {
+			return false
+		}
+	}
+	if other.Port != own.Port {
+		return false
+	}
+	if own.IP == nil || own.IP.IsUnspecified() {
+		// We listen on every interface, so only loopback is surely us.
+		return other.IP == nil || other.IP.IsUnspecified() || other.IP.IsLoopback()
+	}
+	return own.IP.Equal(other.IP)
+}
+
+// LEADER: End the game as a draw once it has run for maxGameDuration.
+// Every node waits out the duration since leadership may change mid-game.
+func enforceMaxGameDuration() {
+	game := gameNumber
+	for isPlayingGame(game) {
+		// gameStartTime moves to the leader's as followers hear it, so a
+		// follower taking over ends the game when the leader would have.
+		mutex.Lock()
+		due := isLeader() && time.Since(gameStartTime) >= maxGameDuration
+		if due {
+			localLog("Max game duration", maxGameDuration, "reached, ending game")
+			finishGame(timeUpWinner(), "time's up")
+		}
+		mutex.Unlock()
+		if due {
+			return
+		}
+		time.Sleep(intervalUpdateRate)
+	}
+}
+
+// LEADER: The winner of a game that ran out of time: with areaTiebreak, the
+// live player who covered the most area, otherwise nobody. mutex must be held.
+func timeUpWinner() string {
+	if !areaTiebreak {
+		return ""
+	}
+	alive := make([]*Node, 0)
+	for _, node := range nodes {
+		if node.IsAlive {
+			alive = append(alive, node)
+		}
+	}
+	winner := mostArea(alive)
+	if winner != "" {
+		localLog("Time's up,", winner, "wins by covering the most area:", areaOf(getNode(winner)))
+	}
+	return winner
+}
+
+// LEADER: End the game for everyone. winner is the id of the last player
+// standing, or "" if nobody won, in which case reason says why the game ended.
+func finishGame(winner string, reason string) {
+	if !isPlaying() {
+		return
+	}
+	endGame(winner, reason)
+	msg := &Message{IsLeader: true, IsGameOver: true, Winner: winner, Node: *myNode}
+	sendPacketsToPeers("Game over, winner: "+winner, msg)
+	go reportResult(resultAddr, newGameResult(winner, reason))
+}
+
+// LEADER: End the game once at most one player is left alive.
+func checkForWinner() {
+	if isPractice() {
+		// Alone from the start, so surviving isn't enough.
+		checkPracticeOver()
+		return
+	}
+	if aliveNodes > 1 {
+		return
+	}
+	winner := ""
+	for _, n := range nodes {
+		if n.IsAlive {
+			winner = n.Id
+		}
+	}
+	// With nobody left, the last players died on the same tick.
+	finishGame(winner, "it's a draw")
+}
+
+// Stop the game and tell the UI the result. winner is the id of the last
+// player standing, or "" if nobody won, in which case reason says why. Only
+// the first call of a game does anything, so the UI hears the result once
+// however many death reports or repeats of the leader's game over arrive.
+// Followers only call it with the leader's result, or when cut off from the
+// game. mutex must be held.
+func endGame(winner string, reason string) {
+	if !isPlaying() {
+		return
+	}
+	transition(GAME_FINISHED)
+	winnerId = winner
+	publishEvent(EVENT_GAME_OVER, map[string]string{"winner": winner, "reason": reason})
+	if winner == nodeId {
+		localLog("I WIN")
+		notifyPlayerVictoryToJS()
+	} else if winner != "" {
+		localLog("Someone else won:", winner)
+		notifyGameOverToJS(displayName(winner) + " won")
+	} else {
+		localLog("GAME OVER:", reason)
+		notifyGameOverToJS(reason)
+	}
+	if winner != "" {
+		reason = displayName(winner) + " won"
+	}
+	notifyGameOverToSpectators(reason)
 }
 
 // Update the board based on leader's history
@@ -196,10 +645,15 @@ func UpdateBoard() {
 	fmt.Println("Updating Board")
 	localLog("Received gameHistory from Leader")
 
-	// Clear everything on the board except our head
-	for _, v := range nodeHistory {
+	// Clear everything on the board except our head. Only nodes the leader
+	// sent history for are cleared, so nodes whose history the leader has
+	// reaped keep their final trail.
+	for id, v := range nodeHistory {
+		if _, ok := gameHistory[id]; !ok {
+			continue
+		}
 		for _, e := range v {
-			board[e.Y][e.X] = ""
+			setCell(&board, *e, "")
 		}
 	}
 	// Color board based on Leader's hitory
@@ -217,80 +671,304 @@ func UpdateBoard() {
 		for i, pos := range gameHistory[id] {
 			if i == 0 {
 				// Check if History's head is the same as our head
-				board[pos.Y][pos.X] = getPlayerState(id)
 				peerNode := getNode(id)
+				if peerNode == nil {
+					// The node has left the game, so leave its final head.
+					setCell(&board, *pos, "d"+playerIndex)
+					continue
+				}
+				setCell(&board, *pos, getPlayerState(id))
 				peerNode.CurrLoc.X = pos.X
 				peerNode.CurrLoc.Y = pos.Y
 			} else {
-				board[pos.Y][pos.X] = "t" + playerIndex
+				setCell(&board, *pos, "t"+playerIndex)
 			}
 		}
 	}
 	mutex.Unlock()
 }
 
-// Each tick of the game
+// Each tick of the game, once every player is ready.
 func tickGame() {
+	mutex.Lock()
+	game := gameNumber
+	mutex.Unlock()
+	waitForPlayers()
+	// The game may have ended while we waited, e.g. if we were cut off.
+	mutex.Lock()
+	transition(GAME_RUNNING)
+	mutex.Unlock()
+	// Keep rendering once the game is over, until another one starts.
 	for {
-		if isPlaying {
-			mutex.Lock()
-			for _, node := range nodes {
-				playerIndex := string(node.Id[len(node.Id)-1])
-				direction := node.Direction
-				x := node.CurrLoc.X
-				y := node.CurrLoc.Y
-				new_x := node.CurrLoc.X
-				new_y := node.CurrLoc.Y
-
-				// only predict for live nodes
-				if isPlaying && node.IsAlive {
-					// Path prediction
-					board[y][x] = "t" + playerIndex // Change position to be a trail.
-					switch direction {
-					case DIRECTION_UP:
-						new_y = intMax(0, y-1)
-					case DIRECTION_DOWN:
-						new_y = intMin(BOARD_SIZE-1, y+1)
-					case DIRECTION_LEFT:
-						new_x = intMax(0, x-1)
-					case DIRECTION_RIGHT:
-						new_x = intMin(BOARD_SIZE-1, x+1)
-					}
-
-					if nodeHasCollided(x, y, new_x, new_y) {
-						localLog("NODE " + node.Id + " IS DEAD")
-						if isLeader() && node.Id == nodeId && node.IsAlive {
-							node.IsAlive = false
-							aliveNodes = aliveNodes - 1
-							localLog("IM LEADER AND IM DEAD REPORTING TO FRONT END")
-							notifyPlayerDeathToJS()
-							reportASorrowfulDeathToPeers(node)
-						} else if isLeader() {
-							// we tell peers who the dead node is.
-							node.IsAlive = false
-							aliveNodes = aliveNodes - 1
-							localLog("Leader sending death report ", node.Id)
-							reportASorrowfulDeathToPeers(node)
-						}
-						// We don't update the position to a new value
-						board[y][x] = getPlayerState(node.Id)
-						if haveIWon() {
-							localLog("Leader won")
-							break
-						}
-					} else {
-						// Update player's new position.
-						board[new_y][new_x] = getPlayerState(node.Id)
-						node.CurrLoc.X = new_x
-						node.CurrLoc.Y = new_y
-					}
+		mutex.Lock()
+		replaced := game != gameNumber
+		mutex.Unlock()
+		if replaced {
+			return
+		}
+		tickStart := time.Now()
+		stepGame()
+		renderGame()
+		finishTick(tickStart)
+	}
+}
+
+// Sleep out the rest of a tick that started at tickStart. Only what's left is
+// slept so slow ticks don't make this node fall behind its peers.
+func finishTick(tickStart time.Time) {
+	elapsed := time.Since(tickStart)
+	if elapsed > slowTickThreshold {
+		localLog("WARNING: slow tick took", elapsed, "of", tickRate)
+	}
+	time.Sleep(tickRate - elapsed)
+}
+
+// Advance the game exactly one tick, applying the next buffered turn first.
+// Does nothing unless the game is running. Takes no time of its own, so tickGame
+// paces it, and it can be stepped by hand to play out a game tick by tick.
+func stepGame() {
+	if lifecycle != GAME_RUNNING {
+		return
+	}
+	applyQueuedInput()
+	advanceTick()
+}
+
+// Move every node one step and settle collisions.
+func advanceTick() {
+	mutex.Lock()
+	// Deferred so a panic here can't leave mutex held.
+	defer mutex.Unlock()
+	takeSnapshot()
+	deaths := 0
+	for _, node := range nodesInMoveOrder(tickCount) {
+		direction := node.Direction
+		x := node.CurrLoc.X
+		y := node.CurrLoc.Y
+		new_x := node.CurrLoc.X
+		new_y := node.CurrLoc.Y
+
+		// only predict for live nodes that have started moving
+		if isPlaying() && node.IsAlive && !isStartDelayed(node.Id) {
+			// Path prediction
+			layTrail(node.Id, Pos{X: x, Y: y}, tickCount) // Change position to be a trail.
+			new_x, new_y = nextPosition(x, y, direction)
+			collision := nodeHasCollided(x, y, new_x, new_y)
+			reversed := takeReversal(node)
+			if reversed {
+				// Straight back into its own neck.
+				collision = COLLISION_TRAIL
+			}
+			if collision == COLLISION_WALL && bounceWalls {
+				if bounced := bounceDirection(x, y, direction); bounced != "" {
+					localLog("NODE " + node.Id + " BOUNCED OFF A WALL")
+					node.Direction = bounced
+					new_x, new_y = nextPosition(x, y, bounced)
+					collision = nodeHasCollided(x, y, new_x, new_y)
 				}
 			}
-			mutex.Unlock()
+			if collision != COLLISION_NONE && !reversed && dodgeCollision(node, x, y) {
+				new_x, new_y = nextPosition(x, y, node.Direction)
+				collision = COLLISION_NONE
+			}
+
+			if collision != COLLISION_NONE && !isSpawnProtected() {
+				if isLeader() && node.Lives > 1 && respawnNode(node) {
+					continue
+				}
+				localLog("NODE " + node.Id + " IS DEAD")
+				event := collisionEvent(node.Id, Pos{X: x, Y: y},
+					Pos{X: new_x, Y: new_y}, collision, reversed)
+				if isLeader() && node.Id == nodeId && node.IsAlive {
+					node.IsAlive = false
+					aliveNodes = aliveNodes - 1
+					deaths++
+					localLog("IM LEADER AND IM DEAD REPORTING TO FRONT END")
+					notifyPlayerDeathToJS()
+					reportASorrowfulDeathToPeers(node, event)
+				} else if isLeader() {
+					// we tell peers who the dead node is.
+					node.IsAlive = false
+					aliveNodes = aliveNodes - 1
+					deaths++
+					localLog("Leader sending death report ", node.Id)
+					reportASorrowfulDeathToPeers(node, event)
+				}
+				// We don't update the position to a new value
+				setCell(&board, Pos{X: x, Y: y}, getPlayerState(node.Id))
+			} else if collision != COLLISION_NONE {
+				// Protected, so wait rather than move into whatever it hit.
+				setCell(&board, Pos{X: x, Y: y}, getPlayerState(node.Id))
+			} else {
+				// Update player's new position.
+				setCell(&board, Pos{X: new_x, Y: new_y}, getPlayerState(node.Id))
+				node.CurrLoc.X = new_x
+				node.CurrLoc.Y = new_y
+			}
 		}
-		renderGame()
-		time.Sleep(tickRate)
 	}
+
+	tickCount++
+
+	if isLeader() && shrinkIntervalTicks > 0 && tickCount%shrinkIntervalTicks == 0 {
+		deaths += shrinkBoard()
+	}
+	if isLeader() && afkTicks > 0 {
+		deaths += eliminateAFKNodes()
+	}
+	if isLeader() && mineIntervalTicks > 0 && tickCount%mineIntervalTicks == 0 {
+		placeMine()
+	}
+
+	// Only check for a winner once everyone has moved, so players
+	// dying on the same tick are treated the same regardless of order.
+	if isLeader() && isPractice() {
+		checkPracticeOver()
+	} else if deaths > 0 && isLeader() {
+		checkForWinner()
+	}
+	recordFrame()
+}
+
+// LEADER: Take a life from a crashed node and move it to an open cell, telling
+// peers about it. Returns false if there's nowhere to respawn. mutex must be
+// held.
+func respawnNode(node *Node) bool {
+	pos := findOpenCell()
+	if pos == nil {
+		localLog("Nowhere to respawn node", node.Id)
+		return false
+	}
+
+	node.Lives--
+	localLog("NODE "+node.Id+" LOST A LIFE,", node.Lives, "left, respawning at", *pos)
+	node.CurrLoc = pos
+	spawnPositions[node.Id] = *pos
+	setCell(&board, *pos, getPlayerState(node.Id))
+	if node.Id == nodeId {
+		notifyPlayerRespawnToJS(node.Lives)
+	}
+
+	msg := &Message{IsLeader: true, IsRespawn: true, Node: *node}
+	sendPacketsToPeers("Node "+node.Id+" lost a life, respawning", msg)
+	return true
+}
+
+// Find the empty cell furthest from anything on the board, which is at least
+// one cell away from walls and other cells. Returns nil if there's none.
+func findOpenCell() *Pos {
+	var best *Pos
+	bestDistance := 0
+	for y := 1; y < BOARD_SIZE-1; y++ {
+		for x := 1; x < BOARD_SIZE-1; x++ {
+			distance := distanceToNearestOccupied(x, y)
+			if distance > 1 && distance > bestDistance {
+				best = &Pos{X: x, Y: y}
+				bestDistance = distance
+			}
+		}
+	}
+	return best
+}
+
+// Return the chessboard distance from x, y to the nearest non-empty cell, or
+// 2 * BOARD_SIZE if the board is empty.
+func distanceToNearestOccupied(x int, y int) int {
+	nearest := 2 * BOARD_SIZE
+	for oy := range board {
+		for ox, cell := range board[oy] {
+			if cell == "" {
+				continue
+			}
+			distance := intMax(intAbs(ox-x), intAbs(oy-y))
+			nearest = intMin(nearest, distance)
+		}
+	}
+	return nearest
+}
+
+// Return the position one step away from x, y in the given direction. This may
+// be off the board.
+func nextPosition(x int, y int, direction string) (int, int) {
+	switch direction {
+	case DIRECTION_UP, DIRECTION_UP_LEFT, DIRECTION_UP_RIGHT:
+		y--
+	case DIRECTION_DOWN, DIRECTION_DOWN_LEFT, DIRECTION_DOWN_RIGHT:
+		y++
+	}
+	switch direction {
+	case DIRECTION_LEFT, DIRECTION_UP_LEFT, DIRECTION_DOWN_LEFT:
+		x--
+	case DIRECTION_RIGHT, DIRECTION_UP_RIGHT, DIRECTION_DOWN_RIGHT:
+		x++
+	}
+	return x, y
+}
+
+// Whether direction moves along both axes at once.
+func isDiagonal(direction string) bool {
+	switch direction {
+	case DIRECTION_UP_LEFT, DIRECTION_UP_RIGHT, DIRECTION_DOWN_LEFT, DIRECTION_DOWN_RIGHT:
+		return true
+	}
+	return false
+}
+
+// Whether direction is one a player may currently choose.
+func isValidDirection(direction string) bool {
+	switch direction {
+	case DIRECTION_UP, DIRECTION_DOWN, DIRECTION_LEFT, DIRECTION_RIGHT:
+		return true
+	}
+	return allowDiagonal && isDiagonal(direction)
+}
+
+// Return the direction facing the other way, i.e. a reversal.
+func opposite(direction string) string {
+	switch direction {
+	case DIRECTION_UP:
+		return DIRECTION_DOWN
+	case DIRECTION_DOWN:
+		return DIRECTION_UP
+	case DIRECTION_LEFT:
+		return DIRECTION_RIGHT
+	case DIRECTION_RIGHT:
+		return DIRECTION_LEFT
+	case DIRECTION_UP_LEFT:
+		return DIRECTION_DOWN_RIGHT
+	case DIRECTION_UP_RIGHT:
+		return DIRECTION_DOWN_LEFT
+	case DIRECTION_DOWN_LEFT:
+		return DIRECTION_UP_RIGHT
+	case DIRECTION_DOWN_RIGHT:
+		return DIRECTION_UP_LEFT
+	}
+	return ""
+}
+
+// Who sent the newest update to a node's position we've applied, and its
+// epoch and sequence number.
+type positionStamp struct {
+	from  string
+	epoch int64
+	seq   uint64
+}
+
+var latestPositions map[string]positionStamp // Id : newest update to its position.
+
+// Whether an update to the position of the node with the given id, from the
+// given address with sequence number seq, is older than one we've already
+// applied from there. UDP may reorder packets, and applying a stale update
+// would move the node back. Updates from a different sender, a new epoch of
+// the same one or without a sequence number can't be ordered, so are taken as
+// new. mutex must be held.
+func isStalePosition(id string, from string, epoch int64, seq uint64) bool {
+	latest, ok := latestPositions[id]
+	if ok && seq != 0 && latest.from == from && latest.epoch == epoch && seq < latest.seq {
+		return true
+	}
+	latestPositions[id] = positionStamp{from: from, epoch: epoch, seq: seq}
+	return false
 }
 
 // Change Position of a node by creating a trail from its previous location.
@@ -303,7 +981,12 @@ func updateLocationOfNode(fromCurrent *Node, to *Node) {
 		return
 	}
 
-	if currentDir == DIRECTION_UP || currentDir == DIRECTION_DOWN {
+	if isDiagonal(currentDir) {
+		// Follow the diagonal as far as it goes, then straighten out.
+		matchPositionDiagonally(fromCurrent, to)
+		matchPositionInAxis(AXIS_X, true, fromCurrent, to)
+		matchPositionInAxis(AXIS_Y, true, fromCurrent, to)
+	} else if currentDir == DIRECTION_UP || currentDir == DIRECTION_DOWN {
 		matchPositionInAxis(AXIS_Y, false, fromCurrent, to)
 		matchPositionInAxis(AXIS_X, true, fromCurrent, to)
 	} else {
@@ -314,6 +997,29 @@ func updateLocationOfNode(fromCurrent *Node, to *Node) {
 	fromCurrent.Direction = newDir
 }
 
+// Apply a peer's direction change that arrived late. We've been moving the
+// peer in its old direction since it turned, so move it back to where it
+// turned, then forward in its new direction for the ticks that have passed
+// since. Moves stop short of collisions, which are left to the next tick.
+// mutex must be held.
+func reconcileDirectionChange(node *Node, message *Message) {
+	updateLocationOfNode(node, &message.Node)
+	lag := tickCount - message.Tick
+	for ; lag > 0; lag-- {
+		x, y := nextPosition(node.CurrLoc.X, node.CurrLoc.Y, node.Direction)
+		if nodeHasCollided(node.CurrLoc.X, node.CurrLoc.Y, x, y) != COLLISION_NONE {
+			break
+		}
+		layTrail(node.Id, *node.CurrLoc, tickCount-lag)
+		node.CurrLoc.X = x
+		node.CurrLoc.Y = y
+		setCell(&board, Pos{X: x, Y: y}, getPlayerState(node.Id))
+	}
+	if lag > 0 {
+		debugLog("Stopped reconciling", node.Id, "with", lag, "ticks left")
+	}
+}
+
 // Match position of current node to the new position in the
 // given axis direction and whether to draw or delete trail.
 // Axis is one of:
@@ -326,9 +1032,15 @@ func matchPositionInAxis(axis int, draw bool, from *Node, to *Node) {
 	toX := to.CurrLoc.X
 	toY := to.CurrLoc.Y
 
-	nodeTrail := ""
-	if draw {
-		nodeTrail = "t" + nodeName[len(nodeName)-1:]
+	// The node left each cell as many ticks ago as it's steps away from
+	// where it is now.
+	leaveCell := func(x int, y int) {
+		if !draw {
+			setCell(&board, Pos{X: x, Y: y}, "")
+			return
+		}
+		steps := intMax(intAbs(toX-x), intAbs(toY-y))
+		layTrail(nodeName, Pos{X: x, Y: y}, tickCount-steps)
 	}
 
 	nodePlayer := getPlayerState(from.Id)
@@ -340,10 +1052,10 @@ func matchPositionInAxis(axis int, draw bool, from *Node, to *Node) {
 			increment = 1
 		}
 		for i != toX {
-			board[fromY][i] = nodeTrail
+			leaveCell(i, fromY)
 			i = increment + i
 		}
-		board[fromY][i] = nodePlayer
+		setCell(&board, Pos{X: i, Y: fromY}, nodePlayer)
 		from.CurrLoc.X = toX
 	} else { // Match Y axis.
 		i := fromY
@@ -352,42 +1064,160 @@ func matchPositionInAxis(axis int, draw bool, from *Node, to *Node) {
 			increment = 1
 		}
 		for i != toY {
-			board[fromY][i] = nodeTrail
+			leaveCell(fromX, i)
 			i = increment + i
 		}
-		board[i][fromX] = nodePlayer
+		setCell(&board, Pos{X: fromX, Y: i}, nodePlayer)
 		from.CurrLoc.Y = toY
 	}
 }
 
-// Check if a node has collided into a trail, wall, or another node.
-func nodeHasCollided(oldX int, oldY int, newX int, newY int) bool {
+// Move the current node diagonally toward the new position, drawing a trail,
+// until it lines up with the new position on either axis.
+func matchPositionDiagonally(from *Node, to *Node) {
+	x := from.CurrLoc.X
+	y := from.CurrLoc.Y
+	incrementX := -1
+	if to.CurrLoc.X > x {
+		incrementX = 1
+	}
+	incrementY := -1
+	if to.CurrLoc.Y > y {
+		incrementY = 1
+	}
+
+	for x != to.CurrLoc.X && y != to.CurrLoc.Y {
+		steps := intMax(intAbs(to.CurrLoc.X-x), intAbs(to.CurrLoc.Y-y))
+		layTrail(from.Id, Pos{X: x, Y: y}, tickCount-steps)
+		x += incrementX
+		y += incrementY
+	}
+	setCell(&board, Pos{X: x, Y: y}, getPlayerState(from.Id))
+	from.CurrLoc.X = x
+	from.CurrLoc.Y = y
+}
+
+// Check if a node has collided into a wall, or a trail or another node.
+func nodeHasCollided(oldX int, oldY int, newX int, newY int) collision {
 	// Wall boundaries.
-	if newX < 0 || newY < 0 || newX > BOARD_SIZE || newY > BOARD_SIZE {
-		return true
+	if newX < 0 || newY < 0 || newX >= BOARD_SIZE || newY >= BOARD_SIZE {
+		return COLLISION_WALL
 	}
-	// Collision with another player or trail.
-	if board[newY][newX] != "" {
-		return true
+	if cellAt(&board, Pos{X: newX, Y: newY}) == WALL_CELL {
+		return COLLISION_WALL
 	}
-	return false
+	// Collision with another player, a trail or a mine.
+	if cellAt(&board, Pos{X: newX, Y: newY}) != "" {
+		return COLLISION_TRAIL
+	}
+	// A diagonal move can't squeeze between the cells either side of the
+	// corner it cuts, e.g. through another diagonal trail.
+	if oldX != newX && oldY != newY &&
+		cellAt(&board, Pos{X: oldX, Y: newY}) != "" &&
+		cellAt(&board, Pos{X: newX, Y: oldY}) != "" {
+		return COLLISION_TRAIL
+	}
+	return COLLISION_NONE
+}
+
+// Pick a direction for a node at x, y heading into a wall to turn to instead,
+// preferring one leading to an empty cell. Returns "" if every way is a wall.
+func bounceDirection(x int, y int, direction string) string {
+	fallback := ""
+	for _, d := range []string{DIRECTION_UP, DIRECTION_RIGHT, DIRECTION_DOWN,
+		DIRECTION_LEFT, DIRECTION_UP_LEFT, DIRECTION_UP_RIGHT,
+		DIRECTION_DOWN_RIGHT, DIRECTION_DOWN_LEFT} {
+		if d == direction || d == opposite(direction) || !isValidDirection(d) {
+			continue
+		}
+		newX, newY := nextPosition(x, y, d)
+		switch nodeHasCollided(x, y, newX, newY) {
+		case COLLISION_NONE:
+			return d
+		case COLLISION_TRAIL:
+			if fallback == "" {
+				fallback = d
+			}
+		}
+	}
+	return fallback
+}
+
+// What the node with the given id leaves behind at x, y when it moves off on
+// the given tick: a trail, or nothing if the cell is within cleanStartCells of
+// where it spawned or the tick falls in a gap.
+func trailAt(id string, x int, y int, tick int) string {
+	if spawn, ok := spawnPositions[id]; ok &&
+		intMax(intAbs(x-spawn.X), intAbs(y-spawn.Y)) < cleanStartCells {
+		return ""
+	}
+	if trailStride > 1 && tick%trailStride != 0 {
+		return ""
+	}
+	return "t" + id[len(id)-1:]
+}
+
+// Leave what the node with the given id leaves behind at pos when it moves off
+// on the given tick. With a trailLength, the node's oldest trail cell is
+// cleared once it has more than that. mutex must be held.
+func layTrail(id string, pos Pos, tick int) {
+	trail := trailAt(id, pos.X, pos.Y, tick)
+	setCell(&board, pos, trail)
+	visitedCells[id] = append(visitedCells[id], pos)
+	if trail == "" || trailLength <= 0 {
+		return
+	}
+	trailCells[id] = append(trailCells[id], pos)
+	for len(trailCells[id]) > trailLength {
+		tail := trailCells[id][0]
+		trailCells[id] = trailCells[id][1:]
+		// The cell may have been overwritten since, e.g. by a wall.
+		if cellAt(&board, tail) == trail {
+			setCell(&board, tail, "")
+		}
+	}
+}
+
+// Take the tick count from a message from the leader, so that every node
+// agrees on what tick it is whatever their clocks. Messages without a tick
+// are ignored. mutex must be held.
+func adoptLeaderTick(message *Message) {
+	if message.Tick <= 0 || message.Tick == tickCount {
+		return
+	}
+	debugLog("Adopting leader's tick", message.Tick, "over ours,", tickCount)
+	tickCount = message.Tick
+}
+
+// Whether players still survive collisions because the game just started.
+func isSpawnProtected() bool {
+	return tickCount < spawnProtectionTicks
+}
+
+// Whether the node with the given id is still waiting out its start delay.
+func isStartDelayed(id string) bool {
+	return tickCount < startDelays[id]
 }
 
 // Renders the game.
 func renderGame() {
 	mutex.Lock()
 	if isLeader() {
-		go collectLast7Moves()
+		// Built here rather than in the background so every tick's history
+		// holds the positions of that tick, and nothing but them.
+		collectLast7Moves()
 	} else {
 		// Only non-leader nodes have to do this
 		go cacheLocation()
 	}
-	printBoard()
-	pushGameStateToJS(board)
+	printBoard(boardOutput, &board)
+	pushGameStateToJS(*fogBoard(&board, myNode))
+	pushGameStateToSpectators(board)
 	mutex.Unlock()
 }
 
-// NON-LEADER: Build a history of last 5 moves for node on the board.
+// NON-LEADER: Build a history of the last nodeHistoryLength moves for node on
+// the board.
 func cacheLocation() {
 	mutex.Lock()
 	// Collect the state of nodes on the board as the 'TRUE' state.
@@ -402,7 +1232,7 @@ func cacheLocation() {
 		xPos := node.CurrLoc.X
 		yPos := node.CurrLoc.Y
 		trail := "t" + string(node.Id[len(node.Id)-1])
-		for i < 5 {
+		for i < nodeHistoryLength {
 			p := findTrail(xPos, yPos, trail, nodeHistory[node.Id])
 			if p != nil {
 				nodeHistory[node.Id] = append(nodeHistory[node.Id], p)
@@ -422,21 +1252,25 @@ func cacheLocation() {
 	mutex.Unlock()
 }
 
-// LEADER: Build a history of last 7 moves for node on the board.
+// LEADER: Build a history of the last leaderHistoryLength moves for node on the
+// board. The history is rebuilt from scratch, our own node's included, so a
+// move is only ever in it once. mutex must be held.
 func collectLast7Moves() {
 	// Collect the state of nodes on the board as the 'TRUE' state.
 	for _, node := range nodes {
 		// Clear the list.
 		gameHistory[node.Id] = make([]*Pos, 0)
 
-		// Put in current location.
-		gameHistory[node.Id] = append(gameHistory[node.Id], node.CurrLoc)
+		// Put in current location. Copied, since the node keeps moving after
+		// the history is sent.
+		loc := *node.CurrLoc
+		gameHistory[node.Id] = append(gameHistory[node.Id], &loc)
 
 		i := 1
 		xPos := node.CurrLoc.X
 		yPos := node.CurrLoc.Y
 		trail := "t" + string(node.Id[len(node.Id)-1])
-		for i < 7 {
+		for i < leaderHistoryLength {
 			p := findTrail(xPos, yPos, trail, gameHistory[node.Id])
 			if p != nil {
 				gameHistory[node.Id] = append(gameHistory[node.Id], p)
@@ -455,20 +1289,27 @@ func collectLast7Moves() {
 	}
 }
 
-// Find the next unvisited trail around the x, y position on the board.
-// Return nil if trail cannot be found.
+// Find the next unvisited trail around the x, y position on the board, looking
+// past the empty cells a gapped trail leaves. Return nil if trail cannot be
+// found.
 func findTrail(x int, y int, trail string, visited []*Pos) *Pos {
-	if y > 0 && board[y-1][x] == trail && !contains(x, y-1, visited) {
-		return &Pos{X: x, Y: y - 1}
-	} else if y < BOARD_SIZE && board[y+1][x] == trail && !contains(x, y+1, visited) {
-		return &Pos{X: x, Y: y + 1}
-	} else if x > 0 && board[y][x-1] == trail && !contains(x-1, y, visited) {
-		return &Pos{X: x - 1, Y: y}
-	} else if x < BOARD_SIZE && board[y][x+1] == trail && !contains(x+1, y, visited) {
-		return &Pos{X: x + 1, Y: y}
-	} else {
-		return nil
+	reach := intMax(1, trailStride)
+	for _, step := range []Pos{{X: 0, Y: -1}, {X: 0, Y: 1}, {X: -1, Y: 0}, {X: 1, Y: 0}} {
+		for i := 1; i <= reach; i++ {
+			nx := x + step.X*i
+			ny := y + step.Y*i
+			if nx < 0 || ny < 0 || nx >= BOARD_SIZE || ny >= BOARD_SIZE {
+				break
+			}
+			if cellAt(&board, Pos{X: nx, Y: ny}) == trail && !contains(nx, ny, visited) {
+				return &Pos{X: nx, Y: ny}
+			}
+			if cellAt(&board, Pos{X: nx, Y: ny}) != "" {
+				break
+			}
+		}
 	}
+	return nil
 }
 
 // Check if x y is a position already in the list.
@@ -481,35 +1322,87 @@ func contains(x int, y int, list []*Pos) bool {
 	return false
 }
 
-// Continuously send game history of at most 5 previous ticks to all nodes
-// Do it even if game ends because the last standing node might not communicate to other peers
+// Continuously send game history of at most leaderHistoryLength previous ticks to all nodes
+// Do it even if game ends because the last standing node might not communicate to other peers,
+// until another game starts
 func enforceGameState() {
+	mutex.Lock()
+	game := gameNumber
+	mutex.Unlock()
 	for {
-		time.Sleep(enforceGameStateRate)
+		time.Sleep(leaderBroadcastRate)
+		mutex.Lock()
+		replaced := game != gameNumber
+		mutex.Unlock()
+		if replaced {
+			return
+		}
 		if isLeader() {
 			mutex.Lock()
-			message := &Message{IsLeader: true, GameHistory: gameHistory, Node: *myNode}
-			mutex.Unlock()
+			message := gameStateMessage()
 			logMsg := "Leader enforcing game state packet with game history"
-			sendPacketsToPeers(logMsg, message)
+			fogged := fogRadius > 0
+			if fogged {
+				sendFoggedGameState(logMsg, message)
+			} else {
+				addBoardToMessage(message)
+			}
+			mutex.Unlock()
+			if !fogged {
+				sendPacketsToPeers(logMsg, message)
+			}
 			localLog(logMsg, message)
+
+			mutex.Lock()
+			reapHistory()
+			mutex.Unlock()
+		}
+	}
+}
+
+// LEADER: Our game state broadcast, without the board. mutex must be held.
+func gameStateMessage() *Message {
+	// Keep telling everyone the game is over in case they missed it. The
+	// history is copied as the next tick rebuilds it while the message is
+	// being sent.
+	history := make(map[string][]*Pos, len(gameHistory))
+	for id, positions := range gameHistory {
+		history[id] = positions
+	}
+	return &Message{IsLeader: true, GameHistory: history, Node: *myNode,
+		IsGameOver: !isPlaying(), Winner: winnerId, Tick: tickCount,
+		ShrunkRings: shrunkRings, Mines: mines, StartedAt: gameStartTime.UnixNano()}
+}
+
+// LEADER: Drop the history of nodes that have been removed from the game.
+// Call this after a broadcast so followers have received the final state of
+// those nodes' trails once.
+func reapHistory() {
+	for id := range gameHistory {
+		if getNode(id) == nil {
+			localLog("Reaping history of removed node", id)
+			delete(gameHistory, id)
 		}
 	}
 }
 
 // Update peers with node's current location.
 func intervalUpdate() {
+	game := gameNumber
 	for {
-		if imAlive == false || isPlaying == false {
+		if !isPlayingGame(game) {
 			return
 		}
 		var message *Message
 		if isLeader() {
 			mutex.Lock()
-			message = &Message{IsLeader: true, FailedNodes: failedNodes, Node: *myNode}
+			message = &Message{IsLeader: true, FailedNodes: failedNodes, Node: *myNode,
+				Tick: tickCount, StartedAt: gameStartTime.UnixNano()}
 			mutex.Unlock()
 		} else {
-			message = &Message{Node: *myNode}
+			mutex.Lock()
+			message = &Message{Node: *myNode, Acks: append([]uint64(nil), recentAcks...)}
+			mutex.Unlock()
 		}
 		logMsg := "Interval update"
 		sendPacketsToPeers(logMsg, message)
@@ -519,56 +1412,205 @@ func intervalUpdate() {
 
 func sendPacketsToPeers(logMsg string, message *Message) {
 	for _, node := range nodes {
-		if node.Id != nodeId {
+		if node.Id != nodeId && !isOwnAddr(node.Ip) {
 			log := logSend("Sending: " + logMsg + " [to: " + node.Id + " at ip " + node.Ip + "]")
 			message.Log = log
+			message.Term = leaderTerm
+			stampMessage(message, node.Id)
 			nodeJson, err := json.Marshal(message)
-			checkErr(err, 548)
-			go sendUDPPacket(node.Ip, nodeJson)
+			if err != nil {
+				localLog("ERROR: can't marshal message for", node.Id, ":", err)
+				continue
+			}
+			queuePacket(node.Ip, signPacket(nodeJson))
 		}
 	}
 }
 
-// Send data to ip via UDP.
-func sendUDPPacket(ip string, data []byte) {
-	// a random port is picked since we can't listen and read at the same time
-	udpConn, err := net.Dial("udp", ip)
-	checkErr(err, 559)
-	defer udpConn.Close()
-
-	_, err = udpConn.Write(data)
-	checkErr(err, 563)
+// Decode a message from a peer. Fields Message doesn't have, e.g. ones added
+// by a newer version, are ignored; only JSON that's malformed or doesn't fit
+// Message is an error.
+func decodeMessage(buf []byte) (Message, error) {
+	var message Message
+	decoder := json.NewDecoder(bytes.NewReader(buf))
+	if err := decoder.Decode(&message); err != nil {
+		return message, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return message, errors.New("unexpected data after the message")
+	}
+	return message, nil
 }
 
-func processPacket(buf []byte, addr *net.UDPAddr, n int) {
-	var message Message
+func processPacket(packet []byte, addr net.Addr) {
+	receivedAt := time.Now()
+	recordReceived(addr.String(), len(packet), receivedAt)
+	// The game's secret and our address are replaced when the next starts.
+	mutex.Lock()
+	buf, err := verifyPacket(packet)
+	own := isOwnAddr(addr.String())
+	mutex.Unlock()
+	if err != nil {
+		// Not held against the peer at addr, as the address is easily forged.
+		localLog("Dropping unauthenticated packet from", addr.String(), ":", err)
+		countPacket(&packetsRejected)
+		return
+	}
+	if own {
+		localLog("Dropping packet from our own address", addr.String())
+		countPacket(&packetsRejected)
+		return
+	}
+
 	var node Node
-	err := json.Unmarshal(buf[0:n], &message)
-	checkErr(err, 570)
+	message, err := decodeMessage(buf)
+	if err != nil {
+		// A bad packet shouldn't take the game down with it.
+		localLog("Dropping malformed packet from", addr.String(), ":", err)
+		countPacket(&packetsMalformed)
+		rejectPacketFrom(addr.String())
+		return
+	}
 	node = message.Node
+	if node.CurrLoc == nil {
+		localLog("Dropping packet without a location from", addr.String())
+		countPacket(&packetsRejected)
+		rejectPacketFrom(addr.String())
+		return
+	}
+	if !isOnBoard(node.CurrLoc.X, node.CurrLoc.Y) {
+		localLog("Dropping packet with a location off the board from", addr.String())
+		countPacket(&packetsRejected)
+		rejectPacketFrom(addr.String())
+		return
+	}
+	if !checkSeq(addr.String(), message.SeqEpoch, message.Seq) {
+		localLog("Dropping duplicate or stale packet", message.Seq, "from", addr.String())
+		return
+	}
 
-	logReceive("Received packet from "+addr.String()+": "+string(buf[0:n]), message.Log)
+	logReceive("Received packet from "+addr.String()+": "+string(buf), message.Log)
 	localLog("Received: Id:", node.Id, "Ip:", node.Ip, "X:",
 		node.CurrLoc.X, "Y:", node.CurrLoc.Y, "Dir:", node.Direction)
-	lastCheckin[node.Id] = time.Now()
+	mutex.Lock()
+	// Not necessarily message.Node, e.g. that's the dead node in death reports.
+	senderId := node.Id
+	if sender := nodeAtAddr(addr.String()); sender != nil {
+		senderId = sender.Id
+	}
+	catchUpIfReturning(senderId, receivedAt)
+	lastCheckin[senderId] = receivedAt
+	mutex.Unlock()
+	recordMessageTimes(&message, senderId, receivedAt)
+
+	if message.IsReady {
+		mutex.Lock()
+		receivedReady(node.Id, message.IsReadyReply)
+		mutex.Unlock()
+		return
+	}
+
+	if len(message.Acks) > 0 {
+		// Piggybacked on an interval update, which is handled as usual.
+		mutex.Lock()
+		if isLeader() {
+			ackDeathReports(node.Id, message.Acks)
+		}
+		mutex.Unlock()
+	}
+
+	if message.IsLeader {
+		mutex.Lock()
+		current := checkLeaderTerm(&message)
+		mutex.Unlock()
+		if !current {
+			return
+		}
+	}
+
+	if message.IsLeader && message.IsCoordinator {
+		mutex.Lock()
+		acceptHandoff(&message)
+		mutex.Unlock()
+		return
+	}
 
 	if message.IsLeader {
 		// FailedNodes communication.
 		if message.FailedNodes != nil {
 			localLog("failedNodes are: ", message.FailedNodes)
+			mutex.Lock()
 			for _, n := range message.FailedNodes {
 				removeNodeFromList(n)
 			}
+			mutex.Unlock()
+		}
+
+		if message.ShrunkRings > shrunkRings {
+			mutex.Lock()
+			wallOffRings(message.ShrunkRings)
+			mutex.Unlock()
+		}
+		if len(message.Mines) > len(mines) {
+			mutex.Lock()
+			addMines(message.Mines)
+			mutex.Unlock()
 		}
 
 		// Check if message.History exist
 		if message.GameHistory != nil {
 			// Cache history info from the leader
 			gameHistory = message.GameHistory
-			UpdateBoard()
+			mutex.Lock()
+			changed, isDelta := applyLeaderBoard(&message)
+			logFoggedBoard(&message)
+			if message.IsCatchUp {
+				adoptLeaderBoard(&message)
+			} else if isDelta {
+				paintLeaderChanges(changed)
+			}
+			mutex.Unlock()
+			if !isDelta {
+				UpdateBoard()
+			}
+			mutex.Lock()
+			checkBoardSync(&message)
+			mutex.Unlock()
+		}
+
+		// Only after comparing boards, which is done at our own tick.
+		mutex.Lock()
+		adoptLeaderTick(&message)
+		adoptLeaderStartTime(&message)
+		mutex.Unlock()
+
+		if message.IsGameOver {
+			localLog("Leader ended the game, winner:", message.Winner)
+			mutex.Lock()
+			endGame(message.Winner, "it's a draw")
+			mutex.Unlock()
+			return
 		}
 	}
 
+	if message.IsLeader && message.IsRespawn {
+		localLog("Received respawn of", node.Id, "with", node.Lives, "lives left")
+		mutex.Lock()
+		if n := getNode(node.Id); n != nil {
+			// Leave a trail where it crashed and jump to where it respawned.
+			layTrail(n.Id, *n.CurrLoc, tickCount)
+			n.Lives = node.Lives
+			n.CurrLoc = node.CurrLoc
+			spawnPositions[n.Id] = *n.CurrLoc
+			setCell(&board, *n.CurrLoc, getPlayerState(n.Id))
+			if n.Id == nodeId {
+				notifyPlayerRespawnToJS(n.Lives)
+			}
+		}
+		mutex.Unlock()
+		return
+	}
+
 	if message.IsDeathReport {
 		localLog("Received death report ", node.Id)
 		mutex.Lock()
@@ -577,9 +1619,16 @@ func processPacket(buf []byte, addr *net.UDPAddr, n int) {
 			if n.Id == node.Id && n.IsAlive {
 				n.IsAlive = false
 				localLog("LEADER SENT: ", n.Id, " IS DEAD")
+				publishEvent(EVENT_DEATH, map[string]string{"id": n.Id})
 				aliveNodes = aliveNodes - 1
 				localLog("**** DEATH REPORT *** size is now ", strconv.Itoa(aliveNodes))
-				board[n.CurrLoc.Y][n.CurrLoc.X] = getPlayerState(n.Id)
+				if cellAt(&board, *n.CurrLoc) != WALL_CELL {
+					setCell(&board, *n.CurrLoc, getPlayerState(n.Id))
+				}
+
+				if message.Collision != nil {
+					announceKill(message.Collision)
+				}
 
 				// Check if its me.
 				if node.Id == nodeId {
@@ -588,91 +1637,119 @@ func processPacket(buf []byte, addr *net.UDPAddr, n int) {
 				}
 			}
 		}
-
-		if haveIWon() {
-			mutex.Unlock()
-			renderGame()
-			return
+		// The leader decides when the game is over and tells us. Usually it
+		// sent the report, but a node whose game crashed reports itself.
+		if isLeader() && isPlaying() {
+			checkForWinner()
 		}
+		// Even if we knew, the leader may not have heard that we did.
+		noteDeathReport(message.Seq)
 		mutex.Unlock()
 	}
 
+	mutex.Lock()
+	stale := isStalePosition(message.Node.Id, addr.String(), message.SeqEpoch, message.Seq)
+	mutex.Unlock()
+	if stale {
+		localLog("Ignoring stale update of", message.Node.Id, "from", addr.String())
+		return
+	}
+
 	// Received a direction change from a peer.
 	// Match the state of peer by predicting its path.
 	if message.IsDirectionChange {
 		mutex.Lock()
-		for _, n := range nodes {
-			if n.Id == message.Node.Id {
+		if n := getNode(message.Node.Id); n != nil {
+			if err := checkTurn(n.Direction, message.Node.Direction); err != nil {
+				// Applied the same as if the player were us.
+				localLog("Ignoring", n.Id, "turning:", err)
+				noteRejection(addr.String())
+				mutex.Unlock()
+				return
+			}
+			recordInput(n.Id)
+			publishEvent(EVENT_DIRECTION_CHANGE,
+				map[string]string{"id": n.Id, "direction": message.Node.Direction})
+			if message.Node.Direction == opposite(n.Direction) {
+				// Lethal, so there's nothing to reconcile.
+				turnNode(n, message.Node.Direction)
+			} else if rollbackDirectionChange(n, &message) {
+				// Replayed as if it had arrived on time.
+			} else if predictPeers {
+				reconcileDirectionChange(n, &message)
+			} else {
 				n.Direction = message.Node.Direction
 			}
 		}
 		mutex.Unlock()
 	}
 	mutex.Lock()
-	mNode := getNode(message.Node.Id)
-	updateLocationOfNode(mNode, &message.Node)
+	if mNode := getNode(message.Node.Id); mNode != nil {
+		updateLocationOfNode(mNode, &message.Node)
+	}
 	mutex.Unlock()
 }
 
-func listenUDPPacket() {
-	localAddr, err := net.ResolveUDPAddr("udp", nodeAddr)
-	checkErr(err, 642)
-	udpConn, err := net.ListenUDP("udp", localAddr)
-	checkErr(err, 644)
-	err = udpConn.SetReadBuffer(9000)
-	checkErr(err, 646)
-	defer udpConn.Close()
-
-	buf := make([]byte, 1024)
+// Receive packets from peers on transport, the game's, until it's closed, e.g.
+// as the next game replaces it with its own.
+func listenPackets(transport Transport) {
+	defer transport.Close()
 
 	for {
-		n, addr, err := udpConn.ReadFromUDP(buf)
-		checkErr(err, 653)
-		go processPacket(buf, addr, n)
+		buf, addr, err := transport.Receive()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		} else if err != nil {
+			localLog("ERROR: failed to read packet:", err)
+			continue
+		}
+		go processPacket(buf, addr)
 		time.Sleep(100 * time.Millisecond)
 	}
 }
 
-// LEADER: Tell nodes someone has died.
-func reportASorrowfulDeathToPeers(node *Node) {
-	msg := &Message{IsDeathReport: true, Node: *node}
-	logMsg := "Node " + node.Id + "is dead, reporting sorrowful death"
-	sendPacketsToPeers(logMsg, msg)
-}
-
-func haveIWon() bool {
-	// stop playing when someone has won
-	if myNode.IsAlive && aliveNodes == 1 {
-		localLog("I WIN")
-		notifyPlayerVictoryToJS()
-		isPlaying = false
-		return true
-	} else if aliveNodes == 1 {
-		localLog("Someone else won")
-		isPlaying = false
-	}
-	return false
+// LEADER: Tell nodes someone has died and what killed them, repeating it until
+// they acknowledge it. mutex must be held.
+func reportASorrowfulDeathToPeers(node *Node, event *CollisionEvent) {
+	publishEvent(EVENT_DEATH, map[string]string{"id": node.Id})
+	announceKill(event)
+	sendDeathReports(node, event)
 }
 
-func notifyPeersDirChanged(direction string) {
+// Change this node's direction and tell peers about it. Returns an error if
+// the direction isn't one the player can turn to.
+func notifyPeersDirChanged(direction string) error {
 	mutex.Lock()
+	defer mutex.Unlock()
+	if myNode == nil {
+		return errors.New("game has not started")
+	}
 	prevDirection := myNode.Direction
 
+	if err := checkTurn(prevDirection, direction); err != nil {
+		localLog("Ignoring direction change from", prevDirection, "to", direction)
+		return err
+	}
+
 	// check if the direction change for node with the id
 	if prevDirection != direction {
 		logMsg := "Direction for " + nodeId + " has changed from " +
 			prevDirection + " to " + direction
-		myNode.Direction = direction
+		turnNode(myNode, direction)
+		recordInput(nodeId)
+		publishEvent(EVENT_DIRECTION_CHANGE,
+			map[string]string{"id": nodeId, "direction": direction})
 
-		msg := &Message{IsDirectionChange: true, Node: *myNode}
+		msg := &Message{IsDirectionChange: true, Node: *myNode, Tick: tickCount}
 		localLog(logMsg, msg)
 		sendPacketsToPeers(logMsg, msg)
 	}
-	mutex.Unlock()
+	return nil
 }
 
+// Whether we lead the game, i.e. are first in the node list.
 func isLeader() bool {
-	return nodes[0].Id == nodeId
+	return len(nodes) > 0 && nodes[0].Id == nodeId
 }
 
 func hasExceededThreshold(nodeLastCheckin int64) bool {
@@ -684,39 +1761,172 @@ func hasExceededThreshold(nodeLastCheckin int64) bool {
 
 func handleNodeFailure() {
 	// check if the time it last checked in exceed CHECKIN_INTERVAL
+	game := gameNumber
 	for {
-		if isPlaying == false {
+		mutex.Lock()
+		playing := isPlayingGame(game)
+		if playing {
+			detectNodeFailures()
+		}
+		mutex.Unlock()
+		if !playing {
 			return
 		}
-		if isLeader() {
-			localLog("Im a leader: ", nodeId)
-			for _, node := range nodes {
-				if node.Id != nodeId {
-					if hasExceededThreshold(lastCheckin[node.Id].UnixNano()) {
-						localLog(node.Id, " HAS FAILED")
-						// --> leader should periodically send out active nodes in the system
-						// --> so here we just have to remove it from the nodes list.
-						failedNodes = append(failedNodes, node.Id)
-						localLog(len(failedNodes))
-						removeNodeFromList(node.Id)
-					}
+		time.Sleep(intervalUpdateRate)
+	}
+}
+
+// Drop the nodes that haven't checked in for too long, or just the leader if
+// we follow. mutex must be held.
+func detectNodeFailures() {
+	if isLeader() {
+		localLog("Im a leader: ", nodeId)
+		for _, node := range nodes {
+			if node.Id != nodeId {
+				if hasExceededThreshold(lastCheckin[node.Id].UnixNano()) {
+					localLog(node.Id, " HAS FAILED")
+					// --> leader should periodically send out active nodes in the system
+					// --> so here we just have to remove it from the nodes list.
+					failedNodes = append(failedNodes, node.Id)
+					localLog(len(failedNodes))
+					removeNodeFromList(node.Id)
 				}
 			}
-		} else {
-			localLog("Im a node: ", nodeId)
-			// Continually check if leader is alive.
-			leaderId := nodes[0].Id
-			if hasExceededThreshold(lastCheckin[leaderId].UnixNano()) {
-				localLog("LEADER ", leaderId, " HAS FAILED.")
-				removeNodeFromList(leaderId)
-			}
 		}
-		time.Sleep(intervalUpdateRate)
+	} else {
+		localLog("Im a node: ", nodeId)
+		// Continually check if leader is alive.
+		if len(nodes) == 0 {
+			return
+		}
+		leaderId := nodes[0].Id
+		if hasExceededThreshold(lastCheckin[leaderId].UnixNano()) {
+			localLog("LEADER ", leaderId, " HAS FAILED.")
+			removeNodeFromList(leaderId)
+		}
+	}
+}
+
+// Leave cleanly on SIGINT, handing off leadership if we're leading a game.
+func handleInterrupt() {
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	<-interrupts
+	localLog("Interrupted, leaving")
+	mutex.Lock()
+	if isPlaying() && len(nodes) > 1 && isLeader() {
+		handOffLeadership()
+	}
+	mutex.Unlock()
+	os.Exit(0)
+}
+
+// LEADER: Tell everyone we're leaving and who leads after us, so they don't
+// have to wait to detect our failure. The successor is whoever would lead
+// once we're removed from the node list. The message is sent directly rather
+// than queued since we're about to exit. mutex must be held.
+func handOffLeadership() {
+	successor := nodes[1].Id
+	localLog("Handing off leadership to", successor)
+	message := &Message{IsLeader: true, IsCoordinator: true, Successor: successor,
+		GameHistory: gameHistory, Node: *myNode}
+	sendPacketsToPeersNow("Leader handoff", message)
+}
+
+// Like sendPacketsToPeers, but to just peer. mutex must be held.
+func sendPacketToPeer(peer *Node, message *Message, logMsg string) {
+	message.Log = logSend("Sending: " + logMsg + " [to: " + peer.Id + " at ip " + peer.Ip + "]")
+	message.Term = leaderTerm
+	stampMessage(message, peer.Id)
+	nodeJson, err := json.Marshal(message)
+	if err != nil {
+		localLog("ERROR: can't marshal message for", peer.Id, ":", err)
+		return
+	}
+	queuePacket(peer.Ip, signPacket(nodeJson))
+}
+
+// Like sendPacketsToPeers, but sends directly rather than queueing, for when
+// we're about to exit.
+func sendPacketsToPeersNow(logMsg string, message *Message) {
+	for _, node := range nodes {
+		if node.Id == nodeId || isOwnAddr(node.Ip) {
+			continue
+		}
+		message.Log = logSend("Sending: " + logMsg + " [to: " + node.Id + " at ip " + node.Ip + "]")
+		message.Term = leaderTerm
+		stampMessage(message, node.Id)
+		nodeJson, err := json.Marshal(message)
+		if err != nil {
+			localLog("ERROR: can't marshal message for", node.Id, ":", err)
+			continue
+		}
+		data := signPacket(nodeJson)
+		if err := transport.Send(node.Ip, data); err != nil {
+			localLog("ERROR: failed to send to", node.Id, ":", err)
+			continue
+		}
+		recordSent(node.Ip, len(data))
+	}
+}
+
+// Runs a game loop, turning a panic into a clean exit rather than a node that
+// silently stops playing. Peers are told we're leaving first so they don't
+// have to detect it.
+func runGameLoop(name string, loop func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			localLog("ERROR:", name, "panicked:", r, "\n"+string(debug.Stack()))
+			leaveAfterPanic()
+			os.Exit(1)
+		}
+	}()
+	loop()
+}
+
+// Tell peers we're out of the game after a game loop panicked. mutex isn't
+// taken since the loop may have died holding it, and we're exiting anyways.
+func leaveAfterPanic() {
+	if !isPlaying() || myNode == nil {
+		return
+	}
+	if len(nodes) > 1 && isLeader() {
+		handOffLeadership()
+		return
+	}
+	dead := *myNode
+	dead.IsAlive = false
+	sendPacketsToPeersNow("Node "+nodeId+" crashed, reporting sorrowful death",
+		&Message{IsDeathReport: true, Node: dead})
+}
+
+// Take over from a leader that left cleanly. mutex must be held.
+func acceptHandoff(message *Message) {
+	leaderId := message.Node.Id
+	if len(nodes) == 0 || nodes[0].Id != leaderId {
+		localLog("Ignoring handoff from", leaderId, "which isn't the leader")
+		return
+	}
+	if n := getNode(leaderId); n != nil && n.IsAlive {
+		aliveNodes = aliveNodes - 1
+	}
+	removeNodeFromList(leaderId)
+	if len(nodes) == 0 || nodes[0].Id != message.Successor {
+		localLog("WARNING: leader named", message.Successor, "as successor but the node list disagrees")
+		return
+	}
+	localLog("Leader", leaderId, "left, new leader is", message.Successor)
+	gameHistory = message.GameHistory
+	// Give the new leader a full failure detection window.
+	lastCheckin[message.Successor] = time.Now()
+	if isLeader() && isPlaying() {
+		checkForWinner()
 	}
 }
 
-// LEADER: removes a dead node from the node list.
+// LEADER: removes a dead node from the node list. mutex must be held.
 func removeNodeFromList(id string) {
+	wasLeader := len(nodes) > 0 && nodes[0].Id == id
 	i := 0
 	for i < len(nodes) {
 		currentNode := nodes[i]
@@ -726,6 +1936,29 @@ func removeNodeFromList(id string) {
 			i++
 		}
 	}
+	if wasLeader && len(nodes) > 0 {
+		leaderTerm++
+		publishEvent(EVENT_LEADER_CHANGE, map[string]string{"id": nodes[0].Id})
+	}
+}
+
+// Id : colour of every node the matchmaking server gave one.
+func playerColours() map[string]string {
+	colours := make(map[string]string)
+	for _, node := range nodes {
+		if node.Colour != "" {
+			colours[node.Id] = node.Colour
+		}
+	}
+	return colours
+}
+
+// Name to show for the node with the given id, falling back to the id.
+func displayName(id string) string {
+	if n := getNode(id); n != nil && n.Name != "" {
+		return n.Name
+	}
+	return id
 }
 
 // Given a node id string, return "p_" or "d_" depending on whether the player is alive.
@@ -764,7 +1997,8 @@ func getNode(id string) *Node {
 	return nil
 }
 
-// Error checking. Exit program when error occurs.
+// Error checking. Exit program when error occurs. Only use this during
+// startup; anything running mid-game should return its errors instead.
 func checkErr(err error, lineNum int) {
 	if err != nil {
 		localLog("line ", lineNum, " error:", err)
@@ -772,27 +2006,25 @@ func checkErr(err error, lineNum int) {
 	}
 }
 
-// For debugging
-func printBoard() {
+// Write b to w as a grid with row and column numbers, for debugging.
+func printBoard(w io.Writer, b *[BOARD_SIZE][BOARD_SIZE]string) {
 	// TODO: Continous string concat is terrible, but this is OK for just
 	//       debugging for now. Get rid of it at some point in the future.
+	rows, first := renderedRows(b)
 	topLine := "  "
-	for i, _ := range board[0] {
-		topLine += fmt.Sprintf("%3d", i)
-	}
-	localLog(topLine, "")
-	for r, _ := range board {
-		// Ideally, we would introduce a localLog() variant that does Print()
-		// instead of Println(). However, Print() on log files seems to always
-		// introduce a new line, which is useless for what we're doing here.
+	for i, _ := range rows[0] {
+		topLine += fmt.Sprintf("%3d", first+i)
+	}
+	fmt.Fprintln(w, topLine)
+	for r, _ := range rows {
 		line := ""
-		for _, item := range board[r] {
+		for _, item := range rows[r] {
 			if item == "" {
 				line += "__ "
 			} else {
 				line += (item + " ")
 			}
 		}
-		localLog(fmt.Sprintf("%2d", r), line)
+		fmt.Fprintf(w, "%2d %s\n", first+r, line)
 	}
 }
@@ -0,0 +1,860 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Set up a running game that we lead, with a node for each of the given
+// positions and directions, indexed from p1. Every node is at our address, so
+// nothing is sent.
+func startStepTest(starts ...startingPosition) {
+	fileLogger = log.New(ioutil.Discard, "", 0)
+	log.SetOutput(ioutil.Discard)
+	// Packets to peers go nowhere, unless the test says otherwise.
+	setTransport(discardTransport{})
+	roomSecret = nil
+	board = [BOARD_SIZE][BOARD_SIZE]string{}
+	nodes = nil
+	for i, start := range starts {
+		id := "p" + string(rune('1'+i))
+		node := &Node{Id: id, Ip: "127.0.0.1:9999", CurrLoc: start.Pos,
+			Direction: start.Direction, IsAlive: true, Lives: 1}
+		nodes = append(nodes, node)
+		setCell(&board, *node.CurrLoc, id)
+	}
+	nodeId = nodes[0].Id
+	myNode = nodes[0]
+	aliveNodes = len(nodes)
+	lifecycle = GAME_RUNNING
+	tickCount = 0
+	queuedInputs = nil
+	visitedCells = make(map[string][]Pos)
+	lastInputTick = make(map[string]int)
+	reversedNodes = make(map[string]bool)
+	pendingDeaths = make(map[string]*pendingDeath)
+	spawnPositions = make(map[string]Pos)
+	startDelays = make(map[string]int)
+	latestPositions = make(map[string]positionStamp)
+}
+
+// Pass msg to processPacket as if peer had sent it, signed if the game has a
+// secret.
+func deliverFrom(t *testing.T, peer *Node, msg *Message) {
+	t.Helper()
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deliverPacketFrom(t, peer, signPacket(data))
+}
+
+// Pass packet to processPacket as if peer had sent it, from the address
+// givePeerAddr gives it.
+func deliverPacketFrom(t *testing.T, peer *Node, packet []byte) {
+	t.Helper()
+	givePeerAddr(peer)
+	addr, err := net.ResolveUDPAddr("udp", peer.Ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	processPacket(packet, addr)
+}
+
+// startStepTest puts every node at our address, so if peer is still there,
+// give it one of its own, 127.0.0.1:1980n for pn, forgetting what earlier
+// tests sent from it.
+func givePeerAddr(peer *Node) {
+	if peer.Ip != myNode.Ip {
+		return
+	}
+	peer.Ip = "127.0.0.1:1980" + peer.Id[1:]
+	seqLock.Lock()
+	delete(seenSeqs, peer.Ip)
+	delete(lastEpoch, peer.Ip)
+	seqLock.Unlock()
+}
+
+func TestStepGameCollision(t *testing.T) {
+	// p2 heads down across the row p1 heads right along, reaching it on the
+	// third tick, after p1 has passed. p3 is out of the way, so the game goes
+	// on once p2 is dead.
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 1, Y: 3}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 3, Y: 0}, Direction: DIRECTION_DOWN},
+		startingPosition{Pos: &Pos{X: 8, Y: 8}, Direction: DIRECTION_UP},
+	)
+	p1, p2 := nodes[0], nodes[1]
+
+	for tick := 1; tick <= 2; tick++ {
+		stepGame()
+		if !p2.IsAlive {
+			t.Fatalf("p2 died on tick %d", tick)
+		}
+	}
+	if *p1.CurrLoc != (Pos{X: 3, Y: 3}) || *p2.CurrLoc != (Pos{X: 3, Y: 2}) {
+		t.Fatalf("after 2 ticks p1 at %v, p2 at %v", *p1.CurrLoc, *p2.CurrLoc)
+	}
+
+	stepGame()
+	if !p1.IsAlive {
+		t.Errorf("p1 died")
+	}
+	if p2.IsAlive {
+		t.Errorf("p2 survived running into p1's trail")
+	}
+	if *p2.CurrLoc != (Pos{X: 3, Y: 2}) {
+		t.Errorf("dead p2 moved to %v", *p2.CurrLoc)
+	}
+	if cell := cellAt(&board, Pos{X: 3, Y: 2}); cell != "d2" {
+		t.Errorf("p2's cell is %q, want d2", cell)
+	}
+	if aliveNodes != 2 || tickCount != 3 || !isPlaying() {
+		t.Errorf("after the crash %d alive on tick %d, playing %v",
+			aliveNodes, tickCount, isPlaying())
+	}
+}
+
+func TestStepGameWhileNotRunning(t *testing.T) {
+	startStepTest(startingPosition{Pos: &Pos{X: 1, Y: 1}, Direction: DIRECTION_RIGHT})
+	lifecycle = GAME_PAUSED
+	stepGame()
+	if tickCount != 0 || *myNode.CurrLoc != (Pos{X: 1, Y: 1}) {
+		t.Errorf("stepped to tick %d, at %v, while paused", tickCount, *myNode.CurrLoc)
+	}
+}
+
+func TestStepGameDiagonal(t *testing.T) {
+	// p1 heads down and right across the board. p2 heads up into the cell p1
+	// crossed on the first tick.
+	allowDiagonal = true
+	defer func() { allowDiagonal = false }()
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 1, Y: 1}, Direction: DIRECTION_DOWN_RIGHT},
+		startingPosition{Pos: &Pos{X: 2, Y: 4}, Direction: DIRECTION_UP},
+		startingPosition{Pos: &Pos{X: 8, Y: 1}, Direction: DIRECTION_DOWN},
+	)
+	p1, p2 := nodes[0], nodes[1]
+
+	stepGame()
+	stepGame()
+	if !p1.IsAlive || *p1.CurrLoc != (Pos{X: 3, Y: 3}) {
+		t.Fatalf("p1 at %v, alive %v, want at {3 3}", *p1.CurrLoc, p1.IsAlive)
+	}
+	for _, pos := range []Pos{{X: 1, Y: 1}, {X: 2, Y: 2}} {
+		if cell := cellAt(&board, pos); cell != "t1" {
+			t.Errorf("cell %v is %q, want p1's trail", pos, cell)
+		}
+	}
+	// Only the cells p1 moved through, not the ones it cut the corner of.
+	for _, pos := range []Pos{{X: 2, Y: 1}, {X: 1, Y: 2}, {X: 3, Y: 2}} {
+		if cell := cellAt(&board, pos); cell != "" {
+			t.Errorf("cell %v is %q, want empty", pos, cell)
+		}
+	}
+
+	if p2.IsAlive {
+		t.Errorf("p2 survived running into p1's diagonal trail at {2 2}")
+	}
+	if *p2.CurrLoc != (Pos{X: 2, Y: 3}) {
+		t.Errorf("dead p2 moved to %v", *p2.CurrLoc)
+	}
+}
+
+func TestStepGameCrossingDiagonals(t *testing.T) {
+	// p1 and p2 head diagonally towards each other. On the second tick p2
+	// would cut between p1's trail at {2 2} and its head at {3 3}.
+	allowDiagonal = true
+	defer func() { allowDiagonal = false }()
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 1, Y: 1}, Direction: DIRECTION_DOWN_RIGHT},
+		startingPosition{Pos: &Pos{X: 4, Y: 1}, Direction: DIRECTION_DOWN_LEFT},
+		startingPosition{Pos: &Pos{X: 8, Y: 8}, Direction: DIRECTION_UP},
+	)
+	p1, p2 := nodes[0], nodes[1]
+
+	stepGame()
+	stepGame()
+	if !p1.IsAlive || *p1.CurrLoc != (Pos{X: 3, Y: 3}) {
+		t.Errorf("p1 at %v, alive %v, want at {3 3}", *p1.CurrLoc, p1.IsAlive)
+	}
+	if p2.IsAlive {
+		t.Errorf("p2 crossed p1's diagonal trail to %v", *p2.CurrLoc)
+	}
+	if *p2.CurrLoc != (Pos{X: 3, Y: 2}) {
+		t.Errorf("dead p2 moved to %v", *p2.CurrLoc)
+	}
+}
+
+func TestFinishTickCompensatesSlowRender(t *testing.T) {
+	fileLogger = log.New(ioutil.Discard, "", 0)
+	log.SetOutput(ioutil.Discard)
+	const slack = 50 * time.Millisecond
+	for _, render := range []time.Duration{0, tickRate / 2, tickRate * 3 / 4} {
+		tickStart := time.Now()
+		time.Sleep(render)
+		finishTick(tickStart)
+		if took := time.Since(tickStart); took < tickRate || took > tickRate+slack {
+			t.Errorf("tick with a %v render took %v, want %v", render, took, tickRate)
+		}
+	}
+
+	// Too slow to catch up, so don't sleep at all.
+	tickStart := time.Now().Add(-2 * tickRate)
+	start := time.Now()
+	finishTick(tickStart)
+	if slept := time.Since(start); slept > slack {
+		t.Errorf("slept %v after an overlong tick", slept)
+	}
+}
+
+func TestSimultaneousLastDeathsDraw(t *testing.T) {
+	// Both players run into the left wall on the first tick.
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 0, Y: 1}, Direction: DIRECTION_LEFT},
+		startingPosition{Pos: &Pos{X: 0, Y: 3}, Direction: DIRECTION_LEFT},
+	)
+	resultAddr = ""
+	events := make(chan gameEvent, eventBufferSize)
+	eventLock.Lock()
+	eventSubscribers[events] = true
+	eventLock.Unlock()
+	defer func() {
+		eventLock.Lock()
+		delete(eventSubscribers, events)
+		eventLock.Unlock()
+	}()
+
+	for i := 0; i < 3; i++ {
+		stepGame()
+	}
+	if aliveNodes != 0 || lifecycle != GAME_FINISHED || winnerId != "" {
+		t.Errorf("%d alive, game %v, winner %q; want a finished draw",
+			aliveNodes, lifecycle, winnerId)
+	}
+
+	gameOvers := 0
+	for len(events) > 0 {
+		event := <-events
+		if event.Kind != EVENT_GAME_OVER {
+			continue
+		}
+		gameOvers++
+		if event.Data["winner"] != "" || event.Data["reason"] != "it's a draw" {
+			t.Errorf("game over event %v, want a draw", event.Data)
+		}
+	}
+	if gameOvers != 1 {
+		t.Errorf("%d game over events, want 1", gameOvers)
+	}
+}
+
+func TestSpawnProtection(t *testing.T) {
+	// p1 faces the wall and p2 heads into p1's head, reaching it on the second
+	// of two protected ticks. The wall is still there on the third.
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 0, Y: 1}, Direction: DIRECTION_LEFT},
+		startingPosition{Pos: &Pos{X: 0, Y: 3}, Direction: DIRECTION_UP},
+		startingPosition{Pos: &Pos{X: 8, Y: 8}, Direction: DIRECTION_UP},
+	)
+	spawnProtectionTicks = 2
+	defer func() { spawnProtectionTicks = 0 }()
+	p1, p2 := nodes[0], nodes[1]
+
+	stepGame()
+	stepGame()
+	if !p1.IsAlive || !p2.IsAlive {
+		t.Fatalf("died while protected: p1 alive %v, p2 alive %v", p1.IsAlive, p2.IsAlive)
+	}
+	if *p1.CurrLoc != (Pos{X: 0, Y: 1}) {
+		t.Errorf("p1 at %v, want waiting against the wall at {0 1}", *p1.CurrLoc)
+	}
+	if *p2.CurrLoc != (Pos{X: 0, Y: 2}) {
+		t.Errorf("p2 at %v, want waiting next to p1's head at {0 2}", *p2.CurrLoc)
+	}
+	if cell := cellAt(&board, Pos{X: 0, Y: 1}); cell != getPlayerState(p1.Id) {
+		t.Errorf("p1's head cell is %q, want still p1's", cell)
+	}
+
+	stepGame()
+	if p1.IsAlive {
+		t.Errorf("p1 survived the wall after protection ran out")
+	}
+}
+
+func TestRemovedNodeHistoryReapedAfterBroadcast(t *testing.T) {
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 1, Y: 1}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 1, Y: 5}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 1, Y: 8}, Direction: DIRECTION_RIGHT},
+	)
+	gameHistory = make(map[string][]*Pos)
+	stepGame()
+	collectLast7Moves()
+
+	removeNodeFromList("p2")
+	if _, ok := gameStateMessage().GameHistory["p2"]; !ok {
+		t.Fatalf("p2's final history wasn't broadcast")
+	}
+	reapHistory()
+
+	stepGame()
+	collectLast7Moves()
+	history := gameStateMessage().GameHistory
+	if _, ok := history["p2"]; ok {
+		t.Errorf("p2's history is still broadcast after it was reaped")
+	}
+	for _, id := range []string{"p1", "p3"} {
+		if len(history[id]) != 3 {
+			t.Errorf("%s has history %v, want its head and two trail cells", id, history[id])
+		}
+	}
+}
+
+func TestStartGameRejectsBadAddress(t *testing.T) {
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 1, Y: 1}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 8, Y: 8}, Direction: DIRECTION_LEFT},
+	)
+	nodes[1].Ip = "localhost:notaport"
+	lifecycle = GAME_STARTING
+	game := gameNumber
+	setTransport(nil)
+
+	err := startGame()
+	if err == nil || !strings.Contains(err.Error(), "p2") {
+		t.Fatalf("started with a bad address for p2, error %v", err)
+	}
+	if gameNumber != game || transport != nil {
+		t.Errorf("game %d started with transport %v, want none", gameNumber, transport)
+	}
+}
+
+func TestFollowerGameOverFromLeader(t *testing.T) {
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 1, Y: 1}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 8, Y: 8}, Direction: DIRECTION_LEFT},
+	)
+	// We're p2, following p1.
+	nodeId = nodes[1].Id
+	myNode = nodes[1]
+	resultAddr = ""
+	events := make(chan gameEvent, eventBufferSize)
+	eventLock.Lock()
+	eventSubscribers[events] = true
+	eventLock.Unlock()
+	defer func() {
+		eventLock.Lock()
+		delete(eventSubscribers, events)
+		eventLock.Unlock()
+	}()
+
+	deliverFrom(t, nodes[0], &Message{IsLeader: true, IsGameOver: true,
+		Winner: "p1", Node: *nodes[0]})
+
+	if isPlayingGame(gameNumber) || winnerId != "p1" {
+		t.Errorf("game %v with winner %q, want over with p1 winning", lifecycle, winnerId)
+	}
+	stepGame()
+	if tickCount != 0 {
+		t.Errorf("ticked after the game was over")
+	}
+	select {
+	case event := <-events:
+		if event.Kind != EVENT_GAME_OVER || event.Data["winner"] != "p1" {
+			t.Errorf("got %s event %v, want game over won by p1", event.Kind, event.Data)
+		}
+	default:
+		t.Errorf("no game over event")
+	}
+}
+
+func TestLivesRespawnThenEliminate(t *testing.T) {
+	// p1 faces the wall with two lives. The others have plenty, so the game
+	// goes on however often they crash.
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 0, Y: 1}, Direction: DIRECTION_LEFT},
+		startingPosition{Pos: &Pos{X: 8, Y: 8}, Direction: DIRECTION_UP},
+		startingPosition{Pos: &Pos{X: 8, Y: 1}, Direction: DIRECTION_DOWN},
+	)
+	p1 := nodes[0]
+	p1.Lives = 2
+	nodes[1].Lives = 100
+	nodes[2].Lives = 100
+
+	stepGame()
+	if !p1.IsAlive || p1.Lives != 1 {
+		t.Fatalf("after the first crash p1 alive %v with %d lives, want alive with 1",
+			p1.IsAlive, p1.Lives)
+	}
+	if *p1.CurrLoc == (Pos{X: 0, Y: 1}) {
+		t.Errorf("p1 wasn't respawned")
+	}
+
+	for tick := 0; tick < BOARD_SIZE && p1.IsAlive; tick++ {
+		stepGame()
+	}
+	if p1.IsAlive {
+		t.Errorf("p1 survived its second crash")
+	}
+	if p1.Lives != 1 || aliveNodes != 2 {
+		t.Errorf("p1 eliminated with %d lives, %d alive, want 1 life and 2 alive",
+			p1.Lives, aliveNodes)
+	}
+}
+
+func TestStartOverridesHeadOn(t *testing.T) {
+	fileLogger = log.New(ioutil.Discard, "", 0)
+	log.SetOutput(ioutil.Discard)
+	board = [BOARD_SIZE][BOARD_SIZE]string{}
+	nodes = []*Node{{Id: "p1"}, {Id: "p2"}, {Id: "p3"}}
+	startOverrides = map[string]StartOverride{
+		"p1": {X: 2, Y: 5, Direction: DIRECTION_RIGHT},
+		"p2": {X: 5, Y: 5, Direction: DIRECTION_LEFT},
+	}
+	defer func() { startOverrides = nil }()
+	starts, err := startingPositions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *starts["p3"].Pos != *initialPositions["p3"] {
+		t.Errorf("p3 starts at %v, want its default %v", *starts["p3"].Pos, *initialPositions["p3"])
+	}
+
+	startStepTest(starts["p1"], starts["p2"], starts["p3"])
+	p1, p2 := nodes[0], nodes[1]
+	if *p1.CurrLoc != (Pos{X: 2, Y: 5}) || p2.Direction != DIRECTION_LEFT {
+		t.Fatalf("p1 at %v, p2 heading %s; overrides weren't applied", *p1.CurrLoc, p2.Direction)
+	}
+
+	stepGame()
+	if !p1.IsAlive || !p2.IsAlive {
+		t.Fatalf("crashed a tick early")
+	}
+	stepGame()
+	if p1.IsAlive || p2.IsAlive {
+		t.Errorf("after meeting head-on p1 alive %v, p2 alive %v, want both dead",
+			p1.IsAlive, p2.IsAlive)
+	}
+}
+
+func TestStartFacingOffBoardTurnsInward(t *testing.T) {
+	fileLogger = log.New(ioutil.Discard, "", 0)
+	log.SetOutput(ioutil.Discard)
+	board = [BOARD_SIZE][BOARD_SIZE]string{}
+	nodes = []*Node{{Id: "p1"}, {Id: "p2"}, {Id: "p3"}, {Id: "p4"}, {Id: "p5"}}
+	last := BOARD_SIZE - 1
+	startOverrides = map[string]StartOverride{
+		// As much room right as down, so right.
+		"p1": {X: 0, Y: 0, Direction: DIRECTION_LEFT},
+		"p2": {X: last, Y: 4, Direction: DIRECTION_RIGHT},
+		"p3": {X: 5, Y: last, Direction: DIRECTION_DOWN},
+		"p4": {X: 3, Y: 0, Direction: DIRECTION_UP},
+		// Already facing onto the board.
+		"p5": {X: 0, Y: 7, Direction: DIRECTION_UP},
+	}
+	defer func() { startOverrides = nil }()
+	starts, err := startingPositions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"p1": DIRECTION_RIGHT,
+		"p2": DIRECTION_LEFT,
+		"p3": DIRECTION_UP,
+		"p4": DIRECTION_DOWN,
+		"p5": DIRECTION_UP,
+	}
+	for id, direction := range want {
+		if starts[id].Direction != direction {
+			t.Errorf("%s starts at %v facing %s, want %s",
+				id, *starts[id].Pos, starts[id].Direction, direction)
+		}
+	}
+}
+
+func TestCleanStartCorridor(t *testing.T) {
+	// p1 runs right from its spawn, leaving no trail in the first three
+	// cells and a trail after that.
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 0, Y: 2}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 0, Y: 6}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 8, Y: 8}, Direction: DIRECTION_UP},
+	)
+	cleanStartCells = 3
+	defer func() { cleanStartCells = 0 }()
+	spawnPositions["p1"] = Pos{X: 0, Y: 2}
+
+	for tick := 0; tick < 5; tick++ {
+		stepGame()
+	}
+	if *nodes[0].CurrLoc != (Pos{X: 5, Y: 2}) {
+		t.Fatalf("p1 at %v, want {5 2}", *nodes[0].CurrLoc)
+	}
+	for x := 0; x < 5; x++ {
+		want := ""
+		if x >= cleanStartCells {
+			want = "t1"
+		}
+		if board[2][x] != want {
+			t.Errorf("cell (%d,2) is %q, want %q", x, board[2][x], want)
+		}
+	}
+	if board[6][1] != "t2" {
+		t.Errorf("p2, with no spawn recorded, left %q at (1,6), want a trail", board[6][1])
+	}
+}
+
+func TestBounceOffWalls(t *testing.T) {
+	// p1 starts heading into the left wall and p2 into a trail.
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 0, Y: 2}, Direction: DIRECTION_LEFT},
+		startingPosition{Pos: &Pos{X: 5, Y: 5}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 8, Y: 8}, Direction: DIRECTION_UP},
+	)
+	bounceWalls = true
+	defer func() { bounceWalls = false }()
+	board[5][6] = "t3"
+	p1, p2 := nodes[0], nodes[1]
+
+	stepGame()
+	if !p1.IsAlive {
+		t.Fatalf("p1 died on the wall in bounce mode")
+	}
+	if p1.Direction != DIRECTION_UP || *p1.CurrLoc != (Pos{X: 0, Y: 1}) {
+		t.Errorf("p1 heading %s at %v, want turned up to {0 1}", p1.Direction, *p1.CurrLoc)
+	}
+	if p2.IsAlive {
+		t.Errorf("p2 survived running into a trail in bounce mode")
+	}
+
+	stepGame()
+	stepGame()
+	if !p1.IsAlive || p1.Direction != DIRECTION_RIGHT || *p1.CurrLoc != (Pos{X: 1, Y: 0}) {
+		t.Errorf("p1 alive %v heading %s at %v, want turned right along the top to {1 0}",
+			p1.IsAlive, p1.Direction, *p1.CurrLoc)
+	}
+}
+
+// A transport that prints what it's asked to send, for a test process to
+// report to the one that started it.
+type printingTransport struct{}
+
+func (printingTransport) Send(addr string, data []byte) error {
+	fmt.Printf("SENT %s %s\n", addr, data)
+	return nil
+}
+
+func (printingTransport) Receive() ([]byte, net.Addr, error) {
+	select {}
+}
+
+func (printingTransport) Close() error {
+	return nil
+}
+
+func TestGameLoopPanicReportsDeath(t *testing.T) {
+	// The node exits after a panic, so it plays in a process of its own.
+	if os.Getenv("GOTRON_PANIC_TEST") == "1" {
+		startStepTest(
+			startingPosition{Pos: &Pos{X: 1, Y: 1}, Direction: DIRECTION_RIGHT},
+			startingPosition{Pos: &Pos{X: 1, Y: 5}, Direction: DIRECTION_RIGHT},
+			startingPosition{Pos: &Pos{X: 1, Y: 8}, Direction: DIRECTION_RIGHT},
+		)
+		for i, node := range nodes {
+			node.Ip = "127.0.0.1:1990" + strconv.Itoa(i+1)
+		}
+		nodeId = "p2"
+		myNode = nodes[1]
+		setTransport(printingTransport{})
+		runGameLoop("tickGame", func() { panic("injected") })
+		return
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestGameLoopPanicReportsDeath$")
+	cmd.Env = append(os.Environ(), "GOTRON_PANIC_TEST=1")
+	out, err := cmd.Output()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+		t.Fatalf("node exited with %v after a panic, want exit status 1", err)
+	}
+
+	reported := make(map[string]bool)
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) != 3 || fields[0] != "SENT" {
+			continue
+		}
+		var message Message
+		if err := json.Unmarshal([]byte(fields[2]), &message); err != nil {
+			t.Fatalf("sent %q: %v", fields[2], err)
+		}
+		if !message.IsDeathReport || message.Node.Id != "p2" || message.Node.IsAlive {
+			t.Errorf("sent %+v to %s, want p2's death report", message, fields[1])
+		}
+		reported[fields[1]] = true
+	}
+	for _, addr := range []string{"127.0.0.1:19901", "127.0.0.1:19903"} {
+		if !reported[addr] {
+			t.Errorf("death not reported to %s, only to %v", addr, reported)
+		}
+	}
+}
+
+func TestSuddenDeathShrink(t *testing.T) {
+	// p1 runs down the outer ring, while p2 and p3 stay inside it.
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 0, Y: 5}, Direction: DIRECTION_DOWN},
+		startingPosition{Pos: &Pos{X: 5, Y: 5}, Direction: DIRECTION_LEFT},
+		startingPosition{Pos: &Pos{X: 5, Y: 2}, Direction: DIRECTION_RIGHT},
+	)
+	shrinkIntervalTicks = 3
+	shrunkRings = 0
+	defer func() { shrinkIntervalTicks = 0 }()
+	p1, p2, p3 := nodes[0], nodes[1], nodes[2]
+
+	stepGame()
+	stepGame()
+	if shrunkRings != 0 || board[0][0] != "" || !p1.IsAlive {
+		t.Fatalf("board closed in before the interval: %d rings, p1 alive %v",
+			shrunkRings, p1.IsAlive)
+	}
+
+	stepGame()
+	if shrunkRings != 1 {
+		t.Fatalf("%d rings closed after the interval, want 1", shrunkRings)
+	}
+	for _, pos := range []Pos{{X: 0, Y: 0}, {X: 9, Y: 0}, {X: 0, Y: 9}, {X: 9, Y: 9}, {X: 4, Y: 0}, {X: 9, Y: 4}} {
+		if cellAt(&board, pos) != WALL_CELL {
+			t.Errorf("outer ring cell %v is %q, want a wall", pos, cellAt(&board, pos))
+		}
+	}
+	if p1.IsAlive {
+		t.Errorf("p1 survived standing on the outer ring at %v", *p1.CurrLoc)
+	}
+	if !p2.IsAlive || !p3.IsAlive {
+		t.Errorf("inside the ring, p2 alive %v, p3 alive %v", p2.IsAlive, p3.IsAlive)
+	}
+	if x, y := nextPosition(1, 1, DIRECTION_UP); nodeHasCollided(1, 1, x, y) != COLLISION_WALL {
+		t.Errorf("moving onto the closed ring isn't a wall collision")
+	}
+}
+
+func TestStartGameWithoutNodes(t *testing.T) {
+	fileLogger = log.New(ioutil.Discard, "", 0)
+	log.SetOutput(ioutil.Discard)
+	nodes = nil
+	myNode = nil
+	nodeId = "p1"
+	lifecycle = GAME_STARTING
+	game := gameNumber
+	if isLeader() {
+		t.Errorf("leading a game with no nodes")
+	}
+	err := startGame()
+	if err == nil || !strings.Contains(err.Error(), "no nodes") {
+		t.Fatalf("started with no nodes, error %v", err)
+	}
+	if gameNumber != game {
+		t.Errorf("game %d started, want %d still", gameNumber, game)
+	}
+}
+
+func TestStalePositionIgnored(t *testing.T) {
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 1, Y: 1}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 1, Y: 5}, Direction: DIRECTION_RIGHT},
+	)
+	p2 := nodes[1]
+	newer, older := *p2, *p2
+	newer.CurrLoc, newer.Direction = &Pos{X: 3, Y: 6}, DIRECTION_DOWN
+	older.CurrLoc, older.Direction = &Pos{X: 2, Y: 5}, DIRECTION_RIGHT
+
+	// p2's update from after it turned down overtakes the one from before.
+	deliverFrom(t, p2, &Message{Node: newer, SeqEpoch: 1, Seq: 2})
+	at := *p2.CurrLoc
+	deliverFrom(t, p2, &Message{Node: older, SeqEpoch: 1, Seq: 1})
+	if *p2.CurrLoc != at || p2.Direction != DIRECTION_DOWN {
+		t.Errorf("p2 at %v heading %s after a stale update, want still at %v heading %s",
+			*p2.CurrLoc, p2.Direction, at, DIRECTION_DOWN)
+	}
+
+	// A new epoch can't be ordered against the last, so is applied.
+	deliverFrom(t, p2, &Message{Node: older, SeqEpoch: 2, Seq: 1})
+	if p2.Direction != DIRECTION_RIGHT {
+		t.Errorf("p2 heading %s after an update from a new epoch, want %s",
+			p2.Direction, DIRECTION_RIGHT)
+	}
+}
+
+func TestFollowerAdoptsLeaderTick(t *testing.T) {
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 1, Y: 1}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 8, Y: 8}, Direction: DIRECTION_LEFT},
+	)
+	// We're p2, following p1.
+	nodeId = nodes[1].Id
+	myNode = nodes[1]
+	leader := nodes[0]
+
+	// Whether our clock ran fast or slow, one heartbeat puts us on the
+	// leader's tick.
+	for _, ticks := range []struct{ ours, leaders int }{{3, 7}, {9, 5}} {
+		tickCount = ticks.ours
+		deliverFrom(t, leader, &Message{IsLeader: true, Node: *leader, Tick: ticks.leaders})
+		if tickCount != ticks.leaders {
+			t.Errorf("on tick %d after the leader's heartbeat on %d, want %d",
+				tickCount, ticks.leaders, ticks.leaders)
+		}
+	}
+
+	// Heartbeats without a tick leave ours alone.
+	deliverFrom(t, leader, &Message{IsLeader: true, Node: *leader})
+	if tickCount != 5 {
+		t.Errorf("on tick %d after a heartbeat without one, want 5 still", tickCount)
+	}
+}
+
+func TestStartDelay(t *testing.T) {
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 1, Y: 1}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 1, Y: 5}, Direction: DIRECTION_RIGHT},
+	)
+	startDelays["p2"] = 3
+	p1, p2 := nodes[0], nodes[1]
+
+	for tick := 1; tick <= 3; tick++ {
+		stepGame()
+		if *p2.CurrLoc != (Pos{X: 1, Y: 5}) {
+			t.Fatalf("p2 moved to %v on tick %d of its 3 tick delay", *p2.CurrLoc, tick)
+		}
+	}
+	if *p1.CurrLoc != (Pos{X: 4, Y: 1}) {
+		t.Errorf("p1 at %v after 3 ticks, want {4 1} as it isn't delayed", *p1.CurrLoc)
+	}
+	if cell := cellAt(&board, Pos{X: 1, Y: 5}); cell != "p2" {
+		t.Errorf("waiting p2's cell is %q, want its head", cell)
+	}
+
+	stepGame()
+	if *p2.CurrLoc != (Pos{X: 2, Y: 5}) {
+		t.Errorf("p2 at %v once its delay ran out, want {2 5}", *p2.CurrLoc)
+	}
+}
+
+func TestLeaderHistoryGrowsEachTick(t *testing.T) {
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 0, Y: 1}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 0, Y: 5}, Direction: DIRECTION_RIGHT},
+	)
+	gameHistory = make(map[string][]*Pos)
+
+	for tick := 1; tick <= leaderHistoryLength+1; tick++ {
+		stepGame()
+		collectLast7Moves()
+		history := gameHistory["p1"]
+		if want := intMin(tick+1, leaderHistoryLength); len(history) != want {
+			t.Fatalf("tick %d: p1's history has %d positions, want %d", tick, len(history), want)
+		}
+		// From its head back along its trail.
+		for i, pos := range history {
+			if want := (Pos{X: tick - i, Y: 1}); *pos != want {
+				t.Errorf("tick %d: p1's history %d is %v, want %v", tick, i, *pos, want)
+			}
+		}
+	}
+}
+
+func TestTrailStride(t *testing.T) {
+	// p1 heads right along row 1, leaving a trail every other tick. p2 and
+	// p3 head up across its path just after it passes.
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 0, Y: 1}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 1, Y: 3}, Direction: DIRECTION_UP},
+		startingPosition{Pos: &Pos{X: 2, Y: 4}, Direction: DIRECTION_UP},
+		startingPosition{Pos: &Pos{X: 8, Y: 8}, Direction: DIRECTION_UP},
+	)
+	trailStride = 2
+	defer func() { trailStride = 0 }()
+	p2, p3 := nodes[1], nodes[2]
+
+	for i := 0; i < 3; i++ {
+		stepGame()
+	}
+	for _, x := range []int{0, 2} {
+		if cell := cellAt(&board, Pos{X: x, Y: 1}); cell != "t1" {
+			t.Errorf("cell {%d 1} is %q, want p1's trail", x, cell)
+		}
+	}
+	if !p2.IsAlive || *p2.CurrLoc != (Pos{X: 1, Y: 0}) {
+		t.Errorf("p2 at %v, alive %v, want through the gap at {1 1} to {1 0}",
+			*p2.CurrLoc, p2.IsAlive)
+	}
+	if p3.IsAlive {
+		t.Errorf("p3 survived running into p1's trail at {2 1}")
+	}
+}
+
+func TestTrailLength(t *testing.T) {
+	// p1 heads right along row 1 with a trail 2 cells long. p2 and p3 head
+	// up into its first two trail cells as it lays its third.
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 0, Y: 1}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 0, Y: 4}, Direction: DIRECTION_UP},
+		startingPosition{Pos: &Pos{X: 1, Y: 4}, Direction: DIRECTION_UP},
+		startingPosition{Pos: &Pos{X: 8, Y: 8}, Direction: DIRECTION_UP},
+	)
+	trailLength = 2
+	defer func() { trailLength = 0 }()
+	trailCells = make(map[string][]Pos)
+	p2, p3 := nodes[1], nodes[2]
+
+	for i := 0; i < 3; i++ {
+		stepGame()
+	}
+	if !p2.IsAlive || *p2.CurrLoc != (Pos{X: 0, Y: 1}) {
+		t.Errorf("p2 at %v, alive %v, want on p1's old tail at {0 1}", *p2.CurrLoc, p2.IsAlive)
+	}
+	if p3.IsAlive {
+		t.Errorf("p3 survived running into p1's trail at {1 1}")
+	}
+	if len(trailCells["p1"]) != 2 {
+		t.Errorf("p1 has trail %v, want 2 cells", trailCells["p1"])
+	}
+}
+
+func TestOwnPacketIgnored(t *testing.T) {
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 1, Y: 1}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 1, Y: 5}, Direction: DIRECTION_RIGHT},
+	)
+	// Our own packet to p2, echoed back to us.
+	p2 := nodes[1]
+	turn := *p2
+	turn.Direction = DIRECTION_DOWN
+	data, err := json.Marshal(&Message{IsDirectionChange: true, Node: turn})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, err := net.ResolveUDPAddr("udp", myNode.Ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := atomic.LoadInt64(&packetsRejected)
+	processPacket(data, addr)
+	if p2.Direction != DIRECTION_RIGHT {
+		t.Errorf("p2 heading %s after a packet from our own address", p2.Direction)
+	}
+	if got := atomic.LoadInt64(&packetsRejected) - before; got != 1 {
+		t.Errorf("counted %d rejected packets, want 1", got)
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+// This file implements profiling the node with -pprof, which serves Go's
+// runtime profiles on the node's HTTP server under /debug/pprof/, e.g.
+// `go tool pprof localhost:9997/debug/pprof/profile`. They give away a lot
+// about the node and cost time to take, so they're off by default. Importing
+// net/http/pprof also registers them on http.DefaultServeMux, which is why
+// the HTTP server has a mux of its own.
+
+import (
+	"net/http"
+	"net/http/pprof"
+)
+
+var pprofEnabled bool // Whether to serve profiles at /debug/pprof/.
+
+// Serve the profiles on mux.
+func registerPprof(mux *http.ServeMux) {
+	localLog("Serving profiles at /debug/pprof/")
+	mux.HandleFunc("/debug/pprof/", pprof.Index) // and the named profiles, e.g. heap
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+}
@@ -0,0 +1,34 @@
+package main
+
+// This file implements practice games. A player who joins with -practice and
+// finds nobody to play with before the ms server's countdown ends plays
+// alone. With nobody to outlast, they win by surviving practiceTicks ticks,
+// and the game is over if they crash first.
+
+import "strconv"
+
+var practiceAlone bool // Whether to play alone if nobody else turns up.
+var practiceTicks int  // Ticks to survive to win a practice game, 0 if not one.
+
+// Whether this game is a practice game.
+func isPractice() bool {
+	return practiceTicks > 0
+}
+
+// LEADER: End a practice game once the player has survived practiceTicks or
+// crashed. mutex must be held.
+func checkPracticeOver() {
+	if aliveNodes == 0 {
+		finishGame("", "you crashed after "+strconv.Itoa(tickCount)+" ticks")
+		return
+	}
+	if tickCount < practiceTicks {
+		return
+	}
+	for _, n := range nodes {
+		if n.IsAlive {
+			finishGame(n.Id, "")
+			return
+		}
+	}
+}
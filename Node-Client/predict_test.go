@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+// Play five ticks of a game we lead, in which p2 turns down on tick 2, with
+// the turn reaching us after the last. Returns where p2 ended up.
+func playWithLateTurn(t *testing.T) Pos {
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 1, Y: 1}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 1, Y: 3}, Direction: DIRECTION_RIGHT},
+	)
+	p2 := nodes[1]
+	var turnedAt Pos
+	for tick := 0; tick < 5; tick++ {
+		if tick == 2 {
+			turnedAt = *p2.CurrLoc
+		}
+		stepGame()
+	}
+	turn := *p2
+	turn.CurrLoc = &turnedAt
+	turn.Direction = DIRECTION_DOWN
+	deliverFrom(t, p2, &Message{IsDirectionChange: true, Tick: 2, Node: turn})
+	if p2.Direction != DIRECTION_DOWN {
+		t.Fatalf("p2 heading %s after turning, want %s", p2.Direction, DIRECTION_DOWN)
+	}
+	return *p2.CurrLoc
+}
+
+func TestPredictLateTurn(t *testing.T) {
+	if late := playWithLateTurn(t); late != (Pos{X: 6, Y: 3}) {
+		t.Errorf("p2 at %v with the late turn applied where it arrived, want {6 3}", late)
+	}
+
+	predictPeers = true
+	defer func() { predictPeers = false }()
+	// Back to {3 3} where it turned, then down for the three ticks since.
+	if predicted := playWithLateTurn(t); predicted != (Pos{X: 3, Y: 6}) {
+		t.Errorf("p2 at %v with the late turn reconciled, want {3 6}", predicted)
+	}
+	if cell := cellAt(&board, Pos{X: 5, Y: 3}); cell != "" {
+		t.Errorf("cell p2 was predicted to pass through is %q, want cleared", cell)
+	}
+}
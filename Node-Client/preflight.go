@@ -0,0 +1,56 @@
+package main
+
+// This file implements the checks a node runs on startup, before serving
+// anything, so a misconfigured node says everything that's wrong at once and
+// exits rather than failing piecemeal once a game is under way.
+
+import (
+	"errors"
+	"net"
+	"strings"
+)
+
+// Check that every address we'll listen on can be bound and that the ms
+// server is reachable, returning one error listing every problem found.
+func preflight() error {
+	problems := make([]string, 0)
+	check := func(what string, err error) {
+		if err != nil {
+			problems = append(problems, what+": "+err.Error())
+		}
+	}
+
+	check("can't bind peer address "+nodeAddr, checkBind(transportName, nodeAddr))
+	check("can't bind rpc address "+nodeRpcAddr, checkBind(TRANSPORT_TCP, nodeRpcAddr))
+	check("can't bind http address "+httpServerAddr, checkBind(TRANSPORT_TCP, httpServerAddr))
+	if spectateAddr != "" {
+		check("can't bind spectator address "+spectateAddr, checkBind(TRANSPORT_TCP, spectateAddr))
+	}
+	client, err := dialMS(msServerAddr)
+	if err == nil {
+		client.Close()
+	}
+	check("can't reach matchmaking server at "+msServerAddr, err)
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Check that addr can be listened on with the given network, "udp" or "tcp",
+// releasing it straight away.
+func checkBind(network string, addr string) error {
+	if network == TRANSPORT_UDP {
+		conn, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return listener.Close()
+}
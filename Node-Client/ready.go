@@ -0,0 +1,107 @@
+package main
+
+// This file implements the handshake that holds the first tick until every
+// player is ready. The ms server starts every node at once, but a node may not
+// have its UI up yet, in which case the first moves would happen before its
+// player could see them. Each node tells its peers once it's showing the game,
+// and nobody starts moving until they've heard from everyone or readyTimeout
+// passes, so a node that never comes up can't hold the game forever.
+
+import "time"
+
+const (
+	readyTimeout    time.Duration = 5 * time.Second
+	readyPollRate   time.Duration = 50 * time.Millisecond
+	readyResendRate time.Duration = tickRate // Ready reports may be lost, so they're repeated.
+)
+
+var readyNodes map[string]bool // Id : whether the node has reported it's ready.
+
+// Note that the node with the given id is ready. mutex must be held.
+func markReady(id string) {
+	if !readyNodes[id] {
+		localLog("Node", id, "is ready")
+	}
+	readyNodes[id] = true
+}
+
+// Ids of the nodes in the game that aren't ready yet. mutex must be held.
+func unreadyNodes() []string {
+	unready := make([]string, 0)
+	for _, node := range nodes {
+		if !readyNodes[node.Id] {
+			unready = append(unready, node.Id)
+		}
+	}
+	return unready
+}
+
+// Report that we're ready to play, once the UI is showing the game.
+func reportReady() {
+	mutex.Lock()
+	defer mutex.Unlock()
+	markReady(nodeId)
+	sendReady()
+}
+
+// Tell every peer we're ready. mutex must be held.
+func sendReady() {
+	for _, node := range nodes {
+		if node.Id == nodeId || isOwnAddr(node.Ip) {
+			continue
+		}
+		sendReadyTo(node, false)
+	}
+}
+
+// Tell node we're ready, in reply to its report if reply is set. mutex must be
+// held.
+func sendReadyTo(node *Node, reply bool) {
+	sendPacketToPeer(node, &Message{IsReady: true, IsReadyReply: reply, Node: *myNode}, "ready")
+}
+
+// Note that the node with the given id reported it's ready. Unless the report
+// answers ours, we answer it with our own: the node may have started after us,
+// e.g. having missed the ms server starting the game, and so our reports
+// before it was listening, and otherwise wouldn't hear from us until our next
+// resend, or never if we've stopped waiting. It stops reporting once it's
+// heard from everyone, and answers aren't answered, so this can't ping-pong.
+// mutex must be held.
+func receivedReady(id string, reply bool) {
+	node := getNode(id)
+	if node == nil {
+		return
+	}
+	markReady(id)
+	if !reply && readyNodes[nodeId] {
+		sendReadyTo(node, true)
+	}
+}
+
+// Block until every node in the game is ready or readyTimeout passes,
+// repeating our own ready report meanwhile in case peers missed it.
+func waitForPlayers() {
+	deadline := time.Now().Add(readyTimeout)
+	lastSent := time.Now()
+	for {
+		mutex.Lock()
+		unready := unreadyNodes()
+		imReady := readyNodes[nodeId]
+		mutex.Unlock()
+		if len(unready) == 0 {
+			localLog("Every node is ready, starting")
+			return
+		}
+		if time.Now().After(deadline) {
+			localLog("WARNING: starting without waiting for", unready, "to be ready")
+			return
+		}
+		if imReady && time.Since(lastSent) >= readyResendRate {
+			mutex.Lock()
+			sendReady()
+			mutex.Unlock()
+			lastSent = time.Now()
+		}
+		time.Sleep(readyPollRate)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+)
+
+// Our position and the tick count, taking mutex.
+func tickState() (Pos, int) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return *myNode.CurrLoc, tickCount
+}
+
+func TestFirstTickWaitsForReady(t *testing.T) {
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 1, Y: 1}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 1, Y: 5}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 1, Y: 8}, Direction: DIRECTION_RIGHT},
+	)
+	gameHistory = make(map[string][]*Pos)
+	lifecycle = GAME_STARTING
+	readyNodes = make(map[string]bool)
+	markReady("p1")
+
+	done := make(chan struct{})
+	go func() {
+		tickGame()
+		close(done)
+	}()
+	defer func() {
+		mutex.Lock()
+		gameNumber++
+		mutex.Unlock()
+		<-done
+	}()
+
+	for _, id := range []string{"p2", "p3"} {
+		time.Sleep(4 * readyPollRate)
+		if pos, ticks := tickState(); ticks != 0 || pos != (Pos{X: 1, Y: 1}) {
+			t.Fatalf("moved to %v after %d ticks before %s was ready", pos, ticks, id)
+		}
+		mutex.Lock()
+		receivedReady(id, false)
+		mutex.Unlock()
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if pos, ticks := tickState(); ticks > 0 {
+			if pos == (Pos{X: 1, Y: 1}) {
+				t.Errorf("still at %v after %d ticks", pos, ticks)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no tick a second after everyone was ready")
+		}
+		time.Sleep(readyPollRate)
+	}
+}
+
+// Passes on what's sent, instead of sending it.
+type capturingTransport struct {
+	sent chan []byte
+}
+
+func (t capturingTransport) Send(addr string, data []byte) error {
+	t.sent <- data
+	return nil
+}
+
+func (capturingTransport) Receive() ([]byte, net.Addr, error) {
+	select {}
+}
+
+func (capturingTransport) Close() error {
+	return nil
+}
+
+func TestReadyReportAnsweredWhileWaiting(t *testing.T) {
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 1, Y: 1}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 1, Y: 5}, Direction: DIRECTION_RIGHT},
+	)
+	nodes[1].Ip = "127.0.0.1:19881"
+	capturing := capturingTransport{sent: make(chan []byte, 8)}
+	setTransport(capturing)
+	lifecycle = GAME_STARTING
+	readyNodes = make(map[string]bool)
+	markReady("p1")
+
+	// p2 came up after our reports went out, so it hears from us right away,
+	// rather than at our next resend.
+	mutex.Lock()
+	receivedReady("p2", false)
+	mutex.Unlock()
+	select {
+	case data := <-capturing.sent:
+		var message Message
+		if err := json.Unmarshal(data, &message); err != nil {
+			t.Fatal(err)
+		}
+		if !message.IsReady || !message.IsReadyReply || message.Node.Id != "p1" {
+			t.Errorf("answered with %+v, want p1's ready reply", message)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("p2's report went unanswered")
+	}
+
+	// Its answer to that isn't answered again.
+	mutex.Lock()
+	receivedReady("p2", true)
+	mutex.Unlock()
+	select {
+	case <-capturing.sent:
+		t.Errorf("answered p2's reply")
+	case <-time.After(4 * readyPollRate):
+	}
+}
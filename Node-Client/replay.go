@@ -0,0 +1,48 @@
+package main
+
+// This file implements recording a game to a replay file, which can be turned
+// into images with the tool in ../Replay.
+//
+// A replay is newline-delimited JSON with one ReplayFrame per tick.
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// The state of the board after a tick.
+type ReplayFrame struct {
+	Tick    int
+	Board   [BOARD_SIZE][BOARD_SIZE]string
+	Colours map[string]string // Id : colour of the players still in the game.
+}
+
+var replayFile *os.File
+var replayEncoder *json.Encoder // nil unless recording.
+
+// Start recording the game to the file at path, overwriting it.
+func startRecording(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	replayFile = f
+	replayEncoder = json.NewEncoder(f)
+	localLog("Recording replay to", path)
+	return nil
+}
+
+// Append the current board to the replay, if recording. mutex must be held.
+func recordFrame() {
+	if replayEncoder == nil {
+		return
+	}
+	err := replayEncoder.Encode(&ReplayFrame{Tick: tickCount, Board: board,
+		Colours: playerColours()})
+	if err != nil {
+		// The game is more important than the replay, so stop recording.
+		localLog("ERROR: failed to record replay, stopping:", err)
+		replayFile.Close()
+		replayEncoder = nil
+	}
+}
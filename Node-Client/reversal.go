@@ -0,0 +1,46 @@
+package main
+
+// This file implements the rule for reversals, i.e. turning to face the way a
+// player came. By default they're ignored. With REVERSAL_LETHAL they're
+// allowed, but the player runs into their own neck and dies on their next
+// move, whether or not their trail is actually there.
+
+import "fmt"
+
+// What happens when a player reverses.
+const (
+	REVERSAL_IGNORE string = "ignore" // The turn is discarded.
+	REVERSAL_LETHAL string = "lethal" // The player dies.
+)
+
+var reversalRule string = REVERSAL_IGNORE
+
+var reversedNodes = make(map[string]bool) // Id : whether it reversed since its last move.
+
+// Check that a player facing from can turn to direction. Returns an error if
+// direction isn't one they can turn to, or is a reversal that's ignored.
+func checkTurn(from string, direction string) error {
+	if !isValidDirection(direction) ||
+		(direction == opposite(from) && reversalRule != REVERSAL_LETHAL) {
+		return fmt.Errorf("can't change direction from %q to %q", from, direction)
+	}
+	return nil
+}
+
+// Turn node to direction, noting if it reversed so it dies on its next move.
+// mutex must be held.
+func turnNode(node *Node, direction string) {
+	if direction == opposite(node.Direction) {
+		localLog("NODE " + node.Id + " REVERSED INTO ITS OWN NECK")
+		reversedNodes[node.Id] = true
+	}
+	node.Direction = direction
+}
+
+// Whether node reversed since its last move, clearing the note as it's about
+// to move. mutex must be held.
+func takeReversal(node *Node) bool {
+	reversed := reversedNodes[node.Id]
+	delete(reversedNodes, node.Id)
+	return reversed
+}
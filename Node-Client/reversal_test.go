@@ -0,0 +1,47 @@
+package main
+
+import "testing"
+
+func TestReversalRule(t *testing.T) {
+	defer func() { reversalRule = REVERSAL_IGNORE }()
+	tests := []struct {
+		rule   string
+		lethal bool
+	}{
+		{REVERSAL_IGNORE, false},
+		{REVERSAL_LETHAL, true},
+	}
+	for _, test := range tests {
+		// We're p1 and reverse, as does our peer p2. p3 carries on.
+		startStepTest(
+			startingPosition{Pos: &Pos{X: 3, Y: 1}, Direction: DIRECTION_RIGHT},
+			startingPosition{Pos: &Pos{X: 3, Y: 5}, Direction: DIRECTION_RIGHT},
+			startingPosition{Pos: &Pos{X: 3, Y: 8}, Direction: DIRECTION_RIGHT},
+		)
+		turnCooldownTicks = 0
+		nextTurnTick = 0
+		reversalRule = test.rule
+		p1, p2, p3 := nodes[0], nodes[1], nodes[2]
+
+		if err := queueDirectionInput(DIRECTION_LEFT); (err == nil) != test.lethal {
+			t.Errorf("%s: queueing our reversal returned %v", test.rule, err)
+		}
+		turn := *p2
+		turn.Direction = DIRECTION_LEFT
+		deliverFrom(t, p2, &Message{IsDirectionChange: true, Node: turn})
+		stepGame()
+
+		for _, node := range []*Node{p1, p2} {
+			if node.IsAlive == test.lethal {
+				t.Errorf("%s: %s alive %v after reversing", test.rule, node.Id, node.IsAlive)
+			}
+			if !test.lethal && node.Direction != DIRECTION_RIGHT {
+				t.Errorf("%s: %s heading %s, want the reversal discarded",
+					test.rule, node.Id, node.Direction)
+			}
+		}
+		if !p3.IsAlive {
+			t.Errorf("%s: p3 died without reversing", test.rule)
+		}
+	}
+}
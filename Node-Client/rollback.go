@@ -0,0 +1,205 @@
+package main
+
+// This file implements rollback at the referee. The leader keeps snapshots of
+// the last rollbackTicks ticks, and when a peer's turn arrives late, it rolls
+// back to the tick the peer turned on and replays the ticks since with the
+// turn applied, so the result is the same as if the turn had arrived on time.
+//
+// Replays only move players. If anything else happened since the turn, e.g.
+// someone died or the board closed in, or a replayed move would collide, the
+// turn is applied late as usual instead.
+
+var rollbackTicks int // Ticks the leader can roll back to apply a late turn, 0 for none.
+
+// A node as it was at the start of a tick.
+type nodeSnapshot struct {
+	loc       Pos
+	direction string
+	isAlive   bool
+	lives     int
+}
+
+// The game as it was at the start of a tick, before anyone moved.
+type tickSnapshot struct {
+	tick         int
+	board        [BOARD_SIZE][BOARD_SIZE]string
+	nodes        map[string]nodeSnapshot
+	trailCells   map[string][]Pos
+	visitedCells map[string][]Pos
+	shrunkRings  int
+	mines        int
+}
+
+var snapshots []*tickSnapshot // Oldest first, one per tick.
+
+// Copy every slice in cells, so later appends don't change the copy.
+func copyCells(cells map[string][]Pos) map[string][]Pos {
+	copied := make(map[string][]Pos, len(cells))
+	for id, positions := range cells {
+		copied[id] = append([]Pos(nil), positions...)
+	}
+	return copied
+}
+
+// Snapshot the game as it is now, at the start of the given tick. mutex must
+// be held.
+func captureSnapshot(tick int) *tickSnapshot {
+	snapshot := &tickSnapshot{
+		tick:         tick,
+		board:        board,
+		nodes:        make(map[string]nodeSnapshot, len(nodes)),
+		trailCells:   copyCells(trailCells),
+		visitedCells: copyCells(visitedCells),
+		shrunkRings:  shrunkRings,
+		mines:        len(mines),
+	}
+	for _, node := range nodes {
+		snapshot.nodes[node.Id] = nodeSnapshot{loc: *node.CurrLoc,
+			direction: node.Direction, isAlive: node.IsAlive, lives: node.Lives}
+	}
+	return snapshot
+}
+
+// LEADER: Snapshot the start of this tick, dropping the oldest snapshot if
+// there are more than rollbackTicks. mutex must be held.
+func takeSnapshot() {
+	if rollbackTicks <= 0 || !isLeader() {
+		return
+	}
+	snapshots = append(snapshots, captureSnapshot(tickCount))
+	if len(snapshots) > rollbackTicks {
+		snapshots = snapshots[len(snapshots)-rollbackTicks:]
+	}
+}
+
+// The snapshot of the start of tick, or nil if we don't have one. mutex must
+// be held.
+func snapshotAt(tick int) *tickSnapshot {
+	if len(snapshots) == 0 {
+		return nil
+	}
+	i := tick - snapshots[0].tick
+	if i < 0 || i >= len(snapshots) {
+		return nil
+	}
+	return snapshots[i]
+}
+
+// Whether nothing but moves has happened since snapshot was taken, so
+// replaying moves from it reproduces the game. mutex must be held.
+func onlyMovesSince(snapshot *tickSnapshot) bool {
+	if snapshot.shrunkRings != shrunkRings || snapshot.mines != len(mines) ||
+		len(snapshot.nodes) != len(nodes) {
+		return false
+	}
+	for _, node := range nodes {
+		then, ok := snapshot.nodes[node.Id]
+		if !ok || then.isAlive != node.IsAlive || then.lives != node.Lives {
+			return false
+		}
+	}
+	return true
+}
+
+// Put the board, positions and trails back as they were in snapshot.
+// mutex must be held.
+func restoreSnapshot(snapshot *tickSnapshot) {
+	board = snapshot.board
+	trailCells = copyCells(snapshot.trailCells)
+	visitedCells = copyCells(snapshot.visitedCells)
+	for _, node := range nodes {
+		then := snapshot.nodes[node.Id]
+		loc := then.loc
+		node.CurrLoc = &loc
+		node.Direction = then.direction
+	}
+}
+
+// Move every live node one step, as advanceTick does. Returns false as soon as
+// a move would collide, as replaying can't settle collisions. mutex must be
+// held.
+func replayMoves(tick int) bool {
+	for _, node := range nodesInMoveOrder(tick) {
+		if !node.IsAlive || tick < startDelays[node.Id] {
+			continue
+		}
+		x, y := node.CurrLoc.X, node.CurrLoc.Y
+		newX, newY := nextPosition(x, y, node.Direction)
+		collision := nodeHasCollided(x, y, newX, newY)
+		if collision == COLLISION_WALL && bounceWalls {
+			if bounced := bounceDirection(x, y, node.Direction); bounced != "" {
+				node.Direction = bounced
+				newX, newY = nextPosition(x, y, bounced)
+				collision = nodeHasCollided(x, y, newX, newY)
+			}
+		}
+		if collision != COLLISION_NONE && dodgeCollision(node, x, y) {
+			newX, newY = nextPosition(x, y, node.Direction)
+			collision = COLLISION_NONE
+		}
+		if collision != COLLISION_NONE {
+			return false
+		}
+		layTrail(node.Id, Pos{X: x, Y: y}, tick)
+		node.CurrLoc.X = newX
+		node.CurrLoc.Y = newY
+		setCell(&board, *node.CurrLoc, getPlayerState(node.Id))
+	}
+	return true
+}
+
+// LEADER: Apply a turn by node that arrived late by rolling back to the tick
+// it was made on and replaying the ticks since. Returns false, changing
+// nothing, if that's not possible, e.g. because the tick is too long ago.
+// mutex must be held.
+func rollbackDirectionChange(node *Node, message *Message) bool {
+	if rollbackTicks <= 0 || !isLeader() || message.Tick >= tickCount ||
+		message.Tick < spawnProtectionTicks {
+		return false
+	}
+	from := snapshotAt(message.Tick)
+	if from == nil || !onlyMovesSince(from) {
+		return false
+	}
+	localLog("Rolling back", tickCount-from.tick, "ticks for a late turn by", node.Id)
+
+	// Turns made since the last snapshot are only in the current directions.
+	directions := make(map[string]string, len(nodes))
+	for _, n := range nodes {
+		directions[n.Id] = n.Direction
+	}
+	// To put back if the replay fails.
+	now := captureSnapshot(tickCount)
+	kept := append([]*tickSnapshot(nil), snapshots...)
+
+	// The late turn holds until node's next turn, which we already have.
+	turnedFrom := from.nodes[node.Id].direction
+	turnedAgain := false
+	restoreSnapshot(from)
+	for tick := from.tick; tick < tickCount; tick++ {
+		snapshot := snapshotAt(tick)
+		for _, n := range nodes {
+			n.Direction = snapshot.nodes[n.Id].direction
+		}
+		turnedAgain = turnedAgain || node.Direction != turnedFrom
+		if !turnedAgain {
+			node.Direction = message.Node.Direction
+		}
+		// Later rollbacks should start from the corrected game.
+		snapshots[tick-snapshots[0].tick] = captureSnapshot(tick)
+		if !replayMoves(tick) {
+			localLog("Not rolling back for", node.Id, "as tick", tick, "would collide")
+			restoreSnapshot(now)
+			snapshots = kept
+			return false
+		}
+	}
+
+	for _, n := range nodes {
+		n.Direction = directions[n.Id]
+	}
+	if !turnedAgain && directions[node.Id] == turnedFrom {
+		node.Direction = message.Node.Direction
+	}
+	return true
+}
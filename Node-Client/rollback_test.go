@@ -0,0 +1,136 @@
+package main
+
+import "testing"
+
+// Play six ticks of a game we lead, in which p2 turns down on tick 2, with
+// the turn reaching us on tick arrival. Returns the board and where everyone
+// ended up.
+func playWithTurnArriving(t *testing.T, arrival int) ([BOARD_SIZE][BOARD_SIZE]string, map[string]Pos) {
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 1, Y: 1}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 1, Y: 3}, Direction: DIRECTION_RIGHT},
+	)
+	trailCells = make(map[string][]Pos)
+	snapshots = nil
+
+	var turnedAt Pos
+	for tick := 0; tick < 6; tick++ {
+		if tick == 2 {
+			turnedAt = *nodes[1].CurrLoc
+		}
+		if tick == arrival {
+			turn := *nodes[1]
+			turn.CurrLoc = &turnedAt
+			turn.Direction = DIRECTION_DOWN
+			deliverFrom(t, nodes[1], &Message{IsDirectionChange: true, Tick: 2, Node: turn})
+		}
+		stepGame()
+	}
+
+	positions := make(map[string]Pos)
+	for _, node := range nodes {
+		positions[node.Id] = *node.CurrLoc
+	}
+	return board, positions
+}
+
+func TestRollbackMatchesOnTimeTurn(t *testing.T) {
+	rollbackTicks = 8
+	defer func() { rollbackTicks = 0 }()
+
+	onTimeBoard, onTime := playWithTurnArriving(t, 2)
+	lateBoard, late := playWithTurnArriving(t, 5)
+	if onTime["p2"] != (Pos{X: 3, Y: 7}) {
+		t.Fatalf("p2 at %v with the turn on time, want {3 7}", onTime["p2"])
+	}
+	for id, pos := range onTime {
+		if late[id] != pos {
+			t.Errorf("%s at %v with the turn late, want %v as when on time", id, late[id], pos)
+		}
+	}
+	if lateBoard != onTimeBoard {
+		t.Errorf("board with the turn late:\n%s\nwant as when on time:\n%s",
+			BoardCodec{}.String(&lateBoard), BoardCodec{}.String(&onTimeBoard))
+	}
+}
+
+func TestRollbackRefusedOnCollision(t *testing.T) {
+	rollbackTicks = 8
+	defer func() { rollbackTicks = 0 }()
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 1, Y: 1}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 1, Y: 3}, Direction: DIRECTION_RIGHT},
+	)
+	trailCells = make(map[string][]Pos)
+	snapshots = nil
+	for tick := 0; tick < 5; tick++ {
+		stepGame()
+	}
+	before, at := board, *nodes[1].CurrLoc
+
+	// Turning up on tick 2 runs p2 into p1's trail at {3 1} on tick 3.
+	turn := *nodes[1]
+	turn.Direction = DIRECTION_UP
+	if rollbackDirectionChange(nodes[1], &Message{IsDirectionChange: true, Tick: 2, Node: turn}) {
+		t.Fatalf("rolled back a turn whose replay collides")
+	}
+	if board != before || *nodes[1].CurrLoc != at || nodes[1].Direction != DIRECTION_RIGHT {
+		t.Errorf("refused rollback left p2 at %v heading %s, board:\n%s",
+			*nodes[1].CurrLoc, nodes[1].Direction, BoardCodec{}.String(&board))
+	}
+	if then := snapshotAt(3).nodes["p2"]; then.direction != DIRECTION_RIGHT {
+		t.Errorf("refused rollback left tick 3's snapshot with p2 heading %s", then.direction)
+	}
+}
+
+// Play six ticks of a game we lead, in which p2 turns down on tick 2 and down
+// and right on tick 4, with the first turn reaching us on tick arrival and the
+// second on time. Returns the board and where p2 ended up.
+func playWithNewerTurn(t *testing.T, arrival int) ([BOARD_SIZE][BOARD_SIZE]string, Node) {
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 1, Y: 1}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 1, Y: 3}, Direction: DIRECTION_RIGHT},
+	)
+	trailCells = make(map[string][]Pos)
+	snapshots = nil
+	p2 := nodes[1]
+	for tick := 0; tick < 6; tick++ {
+		if tick == arrival && arrival == 2 {
+			p2.Direction = DIRECTION_DOWN
+		} else if tick == arrival {
+			turn := *p2
+			turn.Direction = DIRECTION_DOWN
+			if !rollbackDirectionChange(p2, &Message{IsDirectionChange: true, Tick: 2, Node: turn}) {
+				t.Fatalf("didn't roll back the turn on tick %d", tick)
+			}
+		}
+		if tick == 4 {
+			p2.Direction = DIRECTION_DOWN_RIGHT
+		}
+		stepGame()
+	}
+	return board, *p2
+}
+
+func TestRollbackKeepsNewerTurn(t *testing.T) {
+	rollbackTicks = 8
+	allowDiagonal = true
+	defer func() {
+		rollbackTicks = 0
+		allowDiagonal = false
+	}()
+
+	onTimeBoard, onTime := playWithNewerTurn(t, 2)
+	lateBoard, late := playWithNewerTurn(t, 5)
+	if *onTime.CurrLoc != (Pos{X: 5, Y: 7}) {
+		t.Fatalf("p2 at %v with the turn on time, want {5 7}", *onTime.CurrLoc)
+	}
+	if *late.CurrLoc != *onTime.CurrLoc || late.Direction != DIRECTION_DOWN_RIGHT {
+		t.Errorf("p2 at %v heading %s with the first turn late, want at %v heading %s",
+			*late.CurrLoc, late.Direction, *onTime.CurrLoc, DIRECTION_DOWN_RIGHT)
+	}
+	if lateBoard != onTimeBoard {
+		t.Errorf("board with the turn late:\n%s\nwant as when on time:\n%s",
+			BoardCodec{}.String(&lateBoard), BoardCodec{}.String(&onTimeBoard))
+	}
+}
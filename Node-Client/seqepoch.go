@@ -0,0 +1,59 @@
+package main
+
+// This file implements sequence epochs. A node that crashes and is started
+// again numbers its messages from 1 again, while its peers may still have the
+// higher sequence numbers of its last run, and would take its new messages for
+// duplicates or stale ones. So every message also carries the epoch its
+// sequence number is from, when the sender started numbering, which is later
+// for every restart. Peers start over with a sender's sequence numbers when
+// its epoch goes up, and drop messages from an epoch it has left behind.
+
+import "time"
+
+// When we started numbering our messages from 1, in UnixNano. seqLock must be
+// held.
+var seqEpoch int64 = time.Now().UnixNano()
+
+var lastEpoch = make(map[string]int64) // Sender's address : epoch of its seenSeqs.
+
+// For testing, how long into a game we start numbering our messages over, as
+// if we'd restarted; 0 for never.
+var simSeqReset time.Duration
+
+// Start numbering our messages from 1 again under a new epoch.
+func resetSeq() {
+	seqLock.Lock()
+	defer seqLock.Unlock()
+	seqEpoch = time.Now().UnixNano()
+	sentSeq = 0
+	localLog("Numbering our messages over from epoch", seqEpoch)
+}
+
+// Reset our sequence numbers simSeqReset into the game given by its
+// gameNumber, if we're still playing it.
+func simulateSeqReset(game int) {
+	time.Sleep(simSeqReset)
+	if isPlayingGame(game) {
+		resetSeq()
+	}
+}
+
+// Check the epoch of a message from the given address, starting its sequence
+// numbers over if it's a new one. Returns false if it's older than the epoch
+// we're at, so the message was sent before the sender restarted. seqLock must
+// be held.
+func checkEpoch(from string, epoch int64) bool {
+	last, ok := lastEpoch[from]
+	if epoch == last {
+		return true
+	}
+	if epoch < last {
+		return false
+	}
+	if ok {
+		localLog("Peer at", from, "started its sequence numbers over from epoch", epoch)
+	}
+	lastEpoch[from] = epoch
+	delete(seenSeqs, from)
+	return true
+}
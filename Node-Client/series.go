@@ -0,0 +1,27 @@
+package main
+
+// This file implements showing the score of a best-of-N series. The ms server
+// runs the series, starting each of its games with StartGame like any other
+// and passing along how many of them each player has won so far. Nodes just
+// play them one after another, and show the score when each starts.
+
+import (
+	"fmt"
+	"strings"
+)
+
+var bestOf int                // Games in the series this game is part of, 0 if not part of one.
+var seriesWins map[string]int // Id : games of the series won before this one.
+
+// The series' score before this game, e.g. "Best of 3: alice 1, bob 0", or ""
+// if this game isn't part of a series.
+func seriesScore() string {
+	if bestOf <= 1 {
+		return ""
+	}
+	scores := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		scores = append(scores, fmt.Sprintf("%s %d", displayName(node.Id), seriesWins[node.Id]))
+	}
+	return fmt.Sprintf("Best of %d: %s", bestOf, strings.Join(scores, ", "))
+}
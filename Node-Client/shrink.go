@@ -0,0 +1,88 @@
+package main
+
+// This file implements sudden death, where the board closes in over time to
+// force long games to end. Every shrinkIntervalTicks, the leader turns the
+// outermost ring of open board into walls, killing anyone standing on it, and
+// tells everyone how many rings are now walls.
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Marker of a wall cell on the board.
+const WALL_CELL string = "##"
+
+// Cells ahead of a spawn, in the direction it faces, that must be free of walls.
+const spawnClearance int = 2
+
+// Check that neither the cell at pos nor the spawnClearance cells ahead of it
+// facing direction are walls, so nobody starts on or straight into one. Cells
+// ahead that are off the board are left to the usual wall collision.
+func checkSpawnClear(pos Pos, direction string) error {
+	if cellAt(&board, pos) == WALL_CELL {
+		return errors.New("it's a wall")
+	}
+	x, y := pos.X, pos.Y
+	for i := 1; i <= spawnClearance; i++ {
+		x, y = nextPosition(x, y, direction)
+		if !isOnBoard(x, y) {
+			return nil
+		}
+		if cellAt(&board, Pos{X: x, Y: y}) == WALL_CELL {
+			return fmt.Errorf("there's a wall %d cells ahead at %v", i, Pos{X: x, Y: y})
+		}
+	}
+	return nil
+}
+
+// Which ring of the board x, y is in, 0 being the outermost.
+func ringOf(x int, y int) int {
+	return intMin(intMin(x, y), intMin(BOARD_SIZE-1-x, BOARD_SIZE-1-y))
+}
+
+// Turn the outer rings of the board into walls, up to and including ring
+// rings-1. mutex must be held.
+func wallOffRings(rings int) {
+	for y := 0; y < BOARD_SIZE; y++ {
+		for x := 0; x < BOARD_SIZE; x++ {
+			if ringOf(x, y) < rings {
+				setCell(&board, Pos{X: x, Y: y}, WALL_CELL)
+			}
+		}
+	}
+	shrunkRings = rings
+}
+
+// LEADER: Close in the board by another ring, unless only the middle is left.
+// Returns how many nodes died. mutex must be held.
+func shrinkBoard() int {
+	// Always leave the middle of the board open.
+	if shrunkRings >= BOARD_SIZE/2-1 {
+		return 0
+	}
+	wallOffRings(shrunkRings + 1)
+	localLog("Board closed in to", shrunkRings, "rings")
+
+	deaths := 0
+	for _, node := range nodes {
+		if !node.IsAlive || ringOf(node.CurrLoc.X, node.CurrLoc.Y) >= shrunkRings {
+			continue
+		}
+		if node.Lives > 1 && respawnNode(node) {
+			continue
+		}
+		localLog("NODE " + node.Id + " WAS CAUGHT BY THE WALLS")
+		node.IsAlive = false
+		aliveNodes = aliveNodes - 1
+		deaths++
+		if node.Id == nodeId {
+			notifyPlayerDeathToJS()
+		}
+		reportASorrowfulDeathToPeers(node, causedDeath(node, CAUSE_SHRINK))
+	}
+
+	msg := &Message{IsLeader: true, ShrunkRings: shrunkRings, Node: *myNode}
+	sendPacketsToPeers("Board closed in", msg)
+	return deaths
+}
@@ -0,0 +1,32 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+// This file reads socket options on platforms with getsockopt.
+
+import (
+	"net"
+	"syscall"
+)
+
+// Read the receive and send buffer sizes the OS actually gave conn.
+func socketBufferSizes(conn *net.UDPConn) (int, int, error) {
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return 0, 0, err
+	}
+	var readSize, writeSize int
+	var sockErr error
+	err = rawConn.Control(func(fd uintptr) {
+		readSize, sockErr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF)
+		if sockErr != nil {
+			return
+		}
+		writeSize, sockErr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_SNDBUF)
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return readSize, writeSize, sockErr
+}
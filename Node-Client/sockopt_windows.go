@@ -0,0 +1,13 @@
+package main
+
+// This file stands in for sockopt.go on Windows.
+
+import (
+	"errors"
+	"net"
+)
+
+// Reading socket options isn't supported on Windows.
+func socketBufferSizes(conn *net.UDPConn) (int, int, error) {
+	return 0, 0, errors.New("not supported on windows")
+}
@@ -0,0 +1,85 @@
+package main
+
+// This file implements the spectator hub, a second socket.io server that lets
+// any number of browsers watch a game without playing in it. Every node can
+// host one, but only the leader's board is authoritative, so only the leader
+// broadcasts to its spectators.
+
+import (
+	"github.com/googollee/go-socket.io"
+	"net"
+	"net/http"
+)
+
+// Room every spectator socket joins, so frames are broadcast to all of them.
+const SPECTATOR_ROOM string = "spectators"
+
+var spectateAddr string              // ip:port spectators connect to, "" for no hub.
+var spectatorServer *socketio.Server // nil unless hosting spectators.
+
+// Starts the spectator hub, serving the game's UI and a socket.io endpoint
+// that only ever sends.
+func spectateServe() error {
+	server, err := socketio.NewServer(nil)
+	if err != nil {
+		return err
+	}
+	server.On("connection", func(so socketio.Socket) {
+		localLog("Spectator connected:", so.Id())
+		so.Join(SPECTATOR_ROOM)
+		mutex.Lock()
+		defer mutex.Unlock()
+		if isPlaying() && isLeader() {
+			// Catch up with a game that started before they connected.
+			so.Emit("spectateGame", spectatorNames(), playerColours(), playersToDTO())
+		}
+	})
+	server.On("error", func(so socketio.Socket, err error) {
+		localLog("ERROR: spectator:", err)
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle("/socket.io/", server)
+	mux.HandleFunc("/player", handlePlayer) // in follow.go
+	mux.Handle("/", http.FileServer(http.Dir("./asset")))
+
+	listener, err := net.Listen("tcp", spectateAddr)
+	if err != nil {
+		return err
+	}
+	spectatorServer = server
+	localLog("Serving spectators at", spectateAddr)
+	return http.Serve(listener, mux)
+}
+
+// Send an event to every spectator, if we're the leader hosting any.
+func broadcastToSpectators(event string, args ...interface{}) {
+	if spectatorServer == nil || !isLeader() {
+		return
+	}
+	spectatorServer.BroadcastTo(SPECTATOR_ROOM, event, args...)
+}
+
+// Id : display name of every player, for spectators to tell them apart.
+func spectatorNames() map[string]string {
+	names := make(map[string]string)
+	for _, node := range nodes {
+		names[node.Id] = displayName(node.Id)
+	}
+	return names
+}
+
+func notifyGameStartToSpectators() {
+	mutex.Lock()
+	players := playersToDTO()
+	mutex.Unlock()
+	broadcastToSpectators("spectateGame", spectatorNames(), playerColours(), players)
+}
+
+func pushGameStateToSpectators(state [BOARD_SIZE][BOARD_SIZE]string) {
+	broadcastToSpectators("gameStateUpdate", toDTO(&state))
+}
+
+func notifyGameOverToSpectators(reason string) {
+	broadcastToSpectators("gameOver", reason)
+}
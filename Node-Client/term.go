@@ -0,0 +1,93 @@
+package main
+
+// This file implements leader terms, which settle who leads after a network
+// partition heals. While partitioned, each side drops the nodes it can't hear
+// from, so both can end up with a leader broadcasting authoritative state.
+//
+// Every node counts the leaders it has seen replaced in leaderTerm, and leader
+// messages carry the sender's term. Since each side of a partition replaces
+// leaders independently, the side that elected a leader more recently has the
+// higher term. Nodes follow whichever leader has the highest term, breaking
+// ties by lowest id, and drop messages from any other.
+
+import (
+	"encoding/json"
+	"time"
+)
+
+var leaderTerm int // Number of times we've seen the leader replaced this game.
+
+// Whether a leader with the given term and id outranks the one we follow.
+// mutex must be held.
+func outranksLeader(term int, id string) bool {
+	if term != leaderTerm {
+		return term > leaderTerm
+	}
+	return len(nodes) == 0 || id < nodes[0].Id
+}
+
+// Check the term of a message from a node claiming to lead, switching to
+// follow it if it outranks our leader. Returns false if the message is from a
+// stale leader and should be dropped. mutex must be held.
+func checkLeaderTerm(message *Message) bool {
+	sender := message.Node.Id
+	if len(nodes) > 0 && nodes[0].Id == sender {
+		// We may have missed the election that made it leader.
+		leaderTerm = intMax(leaderTerm, message.Term)
+		return true
+	}
+	if !outranksLeader(message.Term, sender) {
+		localLog("Ignoring", sender, "leading with term", message.Term, "as ours is", leaderTerm)
+		if isLeader() {
+			// It must have been cut off from us, so tell it who leads now.
+			correctStaleLeader(message.Node.Ip, sender)
+		}
+		return false
+	}
+	followLeader(message)
+	return true
+}
+
+// Follow the sender of message as leader, dropping the nodes ahead of it in
+// our list. Its side of the partition has already dropped them, possibly
+// including us, in which case the game is over for us. mutex must be held.
+func followLeader(message *Message) {
+	sender := message.Node.Id
+	localLog("Following", sender, "as leader with term", message.Term, "over term", leaderTerm)
+	if getNode(sender) == nil {
+		// We dropped it while partitioned.
+		leader := message.Node
+		nodes = append([]*Node{&leader}, nodes...)
+		if leader.IsAlive {
+			aliveNodes = aliveNodes + 1
+		}
+	}
+	for len(nodes) > 0 && nodes[0].Id != sender {
+		if nodes[0].IsAlive {
+			aliveNodes = aliveNodes - 1
+		}
+		removeNodeFromList(nodes[0].Id)
+	}
+	leaderTerm = message.Term
+	lastCheckin[sender] = time.Now()
+
+	if getNode(nodeId) == nil && isPlaying() {
+		localLog("Leader", sender, "no longer has us in the game")
+		endGame("", "this node was cut off from the game")
+	}
+}
+
+// LEADER: Send our heartbeat to a node that thinks it leads with an older
+// term, so it steps down. mutex must be held.
+func correctStaleLeader(ip string, id string) {
+	message := &Message{IsLeader: true, FailedNodes: failedNodes, Node: *myNode,
+		Term: leaderTerm}
+	message.Log = logSend("Sending: correcting stale leader [to: " + id + " at ip " + ip + "]")
+	stampMessage(message, id)
+	nodeJson, err := json.Marshal(message)
+	if err != nil {
+		localLog("ERROR: can't marshal message for", id, ":", err)
+		return
+	}
+	queuePacket(ip, signPacket(nodeJson))
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// Heartbeat from node leading with the given term, dropping failed.
+func leaderHeartbeat(node *Node, term int, failed ...string) *Message {
+	return &Message{IsLeader: true, Node: *node, Term: term, FailedNodes: failed}
+}
+
+func TestLeadersWithDifferentTermsConverge(t *testing.T) {
+	// A partition left p1 leading us, p3, with term 0, while the other side
+	// dropped p1 and elected p2 with term 1.
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 1, Y: 1}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 1, Y: 5}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 1, Y: 8}, Direction: DIRECTION_RIGHT},
+	)
+	nodeId = nodes[2].Id
+	myNode = nodes[2]
+	leaderTerm = 0
+	defer func() { leaderTerm = 0 }()
+	p1, p2 := nodes[0], nodes[1]
+
+	// The partition heals, and we hear from both leaders.
+	deliverFrom(t, p2, leaderHeartbeat(p2, 1, "p1"))
+	deliverFrom(t, p1, leaderHeartbeat(p1, 0))
+	if len(nodes) != 2 || nodes[0].Id != "p2" || leaderTerm != 1 {
+		t.Fatalf("following %s of %d nodes with term %d, want p2 of 2 with term 1",
+			nodes[0].Id, len(nodes), leaderTerm)
+	}
+
+	// p2 then hears from p1, which still thinks it leads, and tells it
+	// who does.
+	startStepTest(
+		startingPosition{Pos: &Pos{X: 1, Y: 5}, Direction: DIRECTION_RIGHT},
+		startingPosition{Pos: &Pos{X: 1, Y: 8}, Direction: DIRECTION_RIGHT},
+	)
+	nodes[0].Id, nodes[1].Id = "p2", "p3"
+	nodeId = "p2"
+	leaderTerm = 1
+	capturing := capturingTransport{sent: make(chan []byte, 8)}
+	setTransport(capturing)
+	deliverFrom(t, p1, leaderHeartbeat(p1, 0))
+	if !isLeader() || leaderTerm != 1 {
+		t.Errorf("p2 stepped down for a stale leader, term now %d", leaderTerm)
+	}
+	select {
+	case data := <-capturing.sent:
+		var message Message
+		if err := json.Unmarshal(data, &message); err != nil {
+			t.Fatal(err)
+		}
+		if !message.IsLeader || message.Term != 1 || message.Node.Id != "p2" {
+			t.Errorf("corrected p1 with %+v, want p2's heartbeat with term 1", message)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("p1 wasn't told about the newer leader")
+	}
+}
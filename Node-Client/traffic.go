@@ -0,0 +1,89 @@
+package main
+
+// This file implements per-peer traffic accounting, for telling which peer's
+// link is lossy or heavy. Peers are keyed by address, the same as the send
+// queues and sequence numbers, and their counters are returned by GetState
+// and served at /metrics, e.g.
+//
+//	peer_packets_sent_total{peer="127.0.0.1:8001"} 42
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Traffic exchanged with a peer since we started.
+type PeerTraffic struct {
+	BytesSent       int64
+	PacketsSent     int64
+	BytesReceived   int64
+	PacketsReceived int64
+	LastSeen        time.Time // When we last received a packet, zero if never.
+}
+
+var trafficLock sync.Mutex
+var peerTraffic = make(map[string]*PeerTraffic) // Peer address : traffic.
+
+// Returns the traffic for addr. trafficLock must be held.
+func trafficFor(addr string) *PeerTraffic {
+	traffic, ok := peerTraffic[addr]
+	if !ok {
+		traffic = &PeerTraffic{}
+		peerTraffic[addr] = traffic
+	}
+	return traffic
+}
+
+// Note that a packet of size bytes was sent to addr.
+func recordSent(addr string, size int) {
+	trafficLock.Lock()
+	defer trafficLock.Unlock()
+	traffic := trafficFor(addr)
+	traffic.BytesSent += int64(size)
+	traffic.PacketsSent++
+}
+
+// Note that a packet of size bytes was received from addr at the given time.
+func recordReceived(addr string, size int, at time.Time) {
+	trafficLock.Lock()
+	defer trafficLock.Unlock()
+	traffic := trafficFor(addr)
+	traffic.BytesReceived += int64(size)
+	traffic.PacketsReceived++
+	traffic.LastSeen = at
+}
+
+// Copy of the traffic with every peer we've exchanged packets with.
+func trafficSnapshot() map[string]PeerTraffic {
+	trafficLock.Lock()
+	defer trafficLock.Unlock()
+	snapshot := make(map[string]PeerTraffic, len(peerTraffic))
+	for addr, traffic := range peerTraffic {
+		snapshot[addr] = *traffic
+	}
+	return snapshot
+}
+
+// Writes the per-peer counters in the /metrics format, ordered by address.
+func writeTrafficMetrics(w io.Writer) {
+	snapshot := trafficSnapshot()
+	addrs := make([]string, 0, len(snapshot))
+	for addr := range snapshot {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	for _, addr := range addrs {
+		traffic := snapshot[addr]
+		label := fmt.Sprintf("{peer=%q}", addr)
+		fmt.Fprintln(w, "peer_bytes_sent_total"+label, traffic.BytesSent)
+		fmt.Fprintln(w, "peer_packets_sent_total"+label, traffic.PacketsSent)
+		fmt.Fprintln(w, "peer_bytes_received_total"+label, traffic.BytesReceived)
+		fmt.Fprintln(w, "peer_packets_received_total"+label, traffic.PacketsReceived)
+		if !traffic.LastSeen.IsZero() {
+			fmt.Fprintln(w, "peer_last_seen_seconds"+label, traffic.LastSeen.Unix())
+		}
+	}
+}
@@ -0,0 +1,365 @@
+package main
+
+// This file implements the transports used to send messages between peers.
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	TRANSPORT_UDP string = "udp"
+	TRANSPORT_TCP string = "tcp"
+
+	maxPacketSize int           = 2048                   // Largest message accepted from a peer.
+	sendTimeout   time.Duration = 500 * time.Millisecond // Longest a single send may block.
+	sendQueueSize int           = 16                     // Packets queued per peer before dropping.
+
+	defaultUDPBufferSize int = 256 * 1024
+)
+
+var udpReadBuffer int  // Bytes asked of the OS for the UDP socket's receive buffer.
+var udpWriteBuffer int // Bytes asked of the OS for the UDP socket's send buffer.
+
+// Moves packets between this node and its peers.
+type Transport interface {
+	// Send data to the peer listening at addr.
+	Send(addr string, data []byte) error
+	// Block until a packet arrives, returning it and who sent it.
+	Receive() ([]byte, net.Addr, error)
+	Close() error
+}
+
+// Create a transport of the given kind listening at addr.
+func newTransport(kind string, addr string) (Transport, error) {
+	switch kind {
+	case TRANSPORT_UDP:
+		return newUDPTransport(addr)
+	case TRANSPORT_TCP:
+		return newTCPTransport(addr)
+	}
+	return nil, fmt.Errorf("unknown transport %q", kind)
+}
+
+// Sends each packet as a datagram, from the same socket packets are received
+// on.
+type udpTransport struct {
+	conn *net.UDPConn
+}
+
+func newUDPTransport(addr string) (*udpTransport, error) {
+	localAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", localAddr)
+	if err != nil {
+		return nil, err
+	}
+	if err = conn.SetReadBuffer(udpReadBuffer); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err = conn.SetWriteBuffer(udpWriteBuffer); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// The OS may grant less than asked for, or more on Linux which doubles it.
+	if readSize, writeSize, err := socketBufferSizes(conn); err != nil {
+		localLog("Can't read udp buffer sizes:", err)
+	} else {
+		localLog("udp buffer sizes: read", readSize, "write", writeSize)
+	}
+	return &udpTransport{conn: conn}, nil
+}
+
+func (t *udpTransport) Send(addr string, data []byte) error {
+	resolved, ok := peerAddrs[addr]
+	if !ok {
+		var err error
+		resolved, err = net.ResolveUDPAddr("udp", addr)
+		if err != nil {
+			return err
+		}
+	}
+
+	t.conn.SetWriteDeadline(time.Now().Add(sendTimeout))
+	_, err := t.conn.WriteToUDP(data, resolved)
+	return err
+}
+
+func (t *udpTransport) Receive() ([]byte, net.Addr, error) {
+	// One byte spare to tell a packet over the limit, which the OS truncates,
+	// from one exactly at it.
+	buf := make([]byte, maxPacketSize+1)
+	n, addr, err := t.conn.ReadFromUDP(buf)
+	if err != nil {
+		return nil, nil, err
+	}
+	if n > maxPacketSize {
+		countPacket(&packetsOversized)
+		return nil, nil, fmt.Errorf("packet from %v is over the %d byte limit",
+			addr, maxPacketSize)
+	}
+	return buf[:n], addr, nil
+}
+
+func (t *udpTransport) Close() error {
+	return t.conn.Close()
+}
+
+// A packet read off one of the TCP connections.
+type tcpPacket struct {
+	data []byte
+	addr net.Addr
+}
+
+// An outgoing connection to a peer. The lock is held while dialing or writing
+// so a slow peer only holds up sends to itself.
+type tcpPeerConn struct {
+	lock sync.Mutex
+	conn net.Conn // nil until dialed.
+}
+
+// Sends packets over persistent TCP connections, for networks where UDP is
+// blocked. Since TCP is a stream, each packet is prefixed with its length.
+//
+// A dialed connection comes from an ephemeral port, not the one its peer
+// listens on, so the first frame on every connection is the address the dialer
+// listens at. Packets read off the connection are reported as from there, the
+// same address they would have come from over UDP.
+type tcpTransport struct {
+	addr     string // Address we listen at, sent to the peers we dial.
+	listener net.Listener
+	packets  chan tcpPacket
+
+	connsLock sync.Mutex
+	conns     map[string]*tcpPeerConn // Peer address : outgoing connection
+}
+
+func newTCPTransport(addr string) (*tcpTransport, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	t := &tcpTransport{
+		addr:     addr,
+		listener: listener,
+		packets:  make(chan tcpPacket, 64),
+		conns:    make(map[string]*tcpPeerConn),
+	}
+	go t.accept()
+	return t, nil
+}
+
+// Accept connections from peers and read packets off them until closed.
+func (t *tcpTransport) accept() {
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				close(t.packets)
+				return
+			}
+			localLog("ERROR: failed to accept tcp connection:", err)
+			continue
+		}
+		go t.readPackets(conn)
+	}
+}
+
+func (t *tcpTransport) readPackets(conn net.Conn) {
+	defer conn.Close()
+	from, err := readHandshake(conn)
+	if err != nil {
+		localLog("ERROR: dropping tcp connection from", conn.RemoteAddr(), ":", err)
+		return
+	}
+	for {
+		data, err := readFrame(conn)
+		if err != nil {
+			if err != io.EOF {
+				localLog("ERROR: dropping tcp connection from", from, ":", err)
+			}
+			return
+		}
+		t.packets <- tcpPacket{data: data, addr: from}
+	}
+}
+
+// Read the address the peer that dialed conn listens at, filling in the host
+// it dialed from if it listens on every interface.
+func readHandshake(conn net.Conn) (net.Addr, error) {
+	conn.SetReadDeadline(time.Now().Add(sendTimeout))
+	data, err := readFrame(conn)
+	if err != nil {
+		return nil, fmt.Errorf("no handshake: %v", err)
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	host, port, err := net.SplitHostPort(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("bad handshake: %v", err)
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host, _, _ = net.SplitHostPort(conn.RemoteAddr().String())
+	}
+	return net.ResolveTCPAddr("tcp", net.JoinHostPort(host, port))
+}
+
+func (t *tcpTransport) Send(addr string, data []byte) error {
+	t.connsLock.Lock()
+	peer, ok := t.conns[addr]
+	if !ok {
+		peer = &tcpPeerConn{}
+		t.conns[addr] = peer
+	}
+	t.connsLock.Unlock()
+
+	peer.lock.Lock()
+	defer peer.lock.Unlock()
+	if peer.conn == nil {
+		conn, err := net.DialTimeout("tcp", addr, sendTimeout)
+		if err != nil {
+			return err
+		}
+		conn.SetWriteDeadline(time.Now().Add(sendTimeout))
+		if err = writeFrame(conn, []byte(t.addr)); err != nil {
+			conn.Close()
+			return err
+		}
+		peer.conn = conn
+	}
+
+	peer.conn.SetWriteDeadline(time.Now().Add(sendTimeout))
+	err := writeFrame(peer.conn, data)
+	if err != nil {
+		// Redial on the next send.
+		peer.conn.Close()
+		peer.conn = nil
+	}
+	return err
+}
+
+func (t *tcpTransport) Receive() ([]byte, net.Addr, error) {
+	packet, ok := <-t.packets
+	if !ok {
+		return nil, nil, net.ErrClosed
+	}
+	return packet.data, packet.addr, nil
+}
+
+func (t *tcpTransport) Close() error {
+	t.connsLock.Lock()
+	for addr, peer := range t.conns {
+		peer.lock.Lock()
+		if peer.conn != nil {
+			peer.conn.Close()
+		}
+		peer.lock.Unlock()
+		delete(t.conns, addr)
+	}
+	t.connsLock.Unlock()
+	return t.listener.Close()
+}
+
+// Write data prefixed with its length.
+func writeFrame(w io.Writer, data []byte) error {
+	if len(data) > maxPacketSize {
+		return fmt.Errorf("packet of %d bytes is over the %d byte limit",
+			len(data), maxPacketSize)
+	}
+	frame := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[4:], data)
+	_, err := w.Write(frame)
+	return err
+}
+
+// Read a packet written by writeFrame.
+func readFrame(r io.Reader) ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if size > uint32(maxPacketSize) {
+		countPacket(&packetsOversized)
+		return nil, fmt.Errorf("packet of %d bytes is over the %d byte limit",
+			size, maxPacketSize)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Each peer gets a worker sending the packets queued for it in order, so a
+// slow or unreachable peer can't hold up sending to the others. The workers
+// read transport holding peerQueuesLock rather than mutex, so setTransport
+// takes both.
+var peerQueuesLock sync.Mutex
+var peerQueues = make(map[string]chan []byte) // Peer address : packets to send
+
+// Make t the transport peers are reached with. Whatever is still queued was
+// for the last one, so it's dropped. mutex must be held.
+func setTransport(t Transport) {
+	resetPeerQueues()
+	peerQueuesLock.Lock()
+	defer peerQueuesLock.Unlock()
+	transport = t
+}
+
+// Stop every peer's send worker, dropping the packets still queued. The next
+// packet queued for a peer starts it a new worker.
+func resetPeerQueues() {
+	peerQueuesLock.Lock()
+	defer peerQueuesLock.Unlock()
+	for addr, queue := range peerQueues {
+		close(queue)
+		delete(peerQueues, addr)
+	}
+}
+
+// Queue data to be sent to the peer at addr. If the peer has fallen too far
+// behind, the packet is dropped instead; newer updates will follow anyways.
+func queuePacket(addr string, data []byte) {
+	peerQueuesLock.Lock()
+	queue, ok := peerQueues[addr]
+	if !ok {
+		queue = make(chan []byte, sendQueueSize)
+		peerQueues[addr] = queue
+		go sendQueuedPackets(addr, queue)
+	}
+	// Still holding the lock, as resetPeerQueues may close the queue.
+	select {
+	case queue <- data:
+	default:
+		localLog("WARNING: send queue to", addr, "is full, dropping packet")
+	}
+	peerQueuesLock.Unlock()
+}
+
+func sendQueuedPackets(addr string, queue chan []byte) {
+	for data := range queue {
+		peerQueuesLock.Lock()
+		current := peerQueues[addr] == queue
+		transport := transport
+		peerQueuesLock.Unlock()
+		if !current {
+			// Reset, so the rest were queued for a transport that's gone.
+			return
+		}
+		if err := transport.Send(addr, data); err != nil {
+			localLog("ERROR: failed to send packet to", addr, ":", err)
+			continue
+		}
+		recordSent(addr, len(data))
+	}
+}
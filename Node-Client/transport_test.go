@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"net"
+	"testing"
+	"time"
+)
+
+// Send data from a to b over TCP, returning the address b reports it from.
+func sendOverTCP(t *testing.T, a, b *tcpTransport, data []byte) string {
+	if err := a.Send(b.addr, data); err != nil {
+		t.Fatalf("sending: %v", err)
+	}
+	got, from, err := b.Receive()
+	if err != nil {
+		t.Fatalf("receiving: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("received %q, want %q", got, data)
+	}
+	return from.String()
+}
+
+func TestTCPReportsListenAddress(t *testing.T) {
+	fileLogger = log.New(ioutil.Discard, "", 0)
+	log.SetOutput(ioutil.Discard)
+	tests := []struct {
+		listen string
+		want   string
+	}{
+		{"127.0.0.1:19801", "127.0.0.1:19801"},
+		// Listening on every interface, so the host is the one it dialed from.
+		{":19802", "127.0.0.1:19802"},
+	}
+
+	b, err := newTCPTransport("127.0.0.1:19800")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	for _, test := range tests {
+		a, err := newTCPTransport(test.listen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, data := range []string{"first", "second"} {
+			if from := sendOverTCP(t, a, b, []byte(data)); from != test.want {
+				t.Errorf("%s from %s reported from %s, want %s",
+					data, test.listen, from, test.want)
+			}
+		}
+		a.Close()
+	}
+}
+
+// A transport that drops whatever it's asked to send, for tests of nodes with
+// peers that aren't there.
+type discardTransport struct{}
+
+func (discardTransport) Send(addr string, data []byte) error {
+	return nil
+}
+
+func (discardTransport) Receive() ([]byte, net.Addr, error) {
+	select {}
+}
+
+func (discardTransport) Close() error {
+	return nil
+}
+
+// A transport whose sends to one address block until released, and whose other
+// sends are passed on to sent.
+type stallingTransport struct {
+	stalled string
+	release chan struct{}
+	sent    chan string
+}
+
+func (t *stallingTransport) Send(addr string, data []byte) error {
+	if addr == t.stalled {
+		<-t.release
+		return nil
+	}
+	t.sent <- addr
+	return nil
+}
+
+func (t *stallingTransport) Receive() ([]byte, net.Addr, error) {
+	select {}
+}
+
+func (t *stallingTransport) Close() error {
+	return nil
+}
+
+func TestStalledPeerDoesNotHoldUpOthers(t *testing.T) {
+	fileLogger = log.New(ioutil.Discard, "", 0)
+	log.SetOutput(ioutil.Discard)
+	stalling := &stallingTransport{stalled: "127.0.0.1:19811",
+		release: make(chan struct{}), sent: make(chan string, 8)}
+	setTransport(stalling)
+	defer resetPeerQueues()
+	defer close(stalling.release)
+
+	// More than the stalled peer's queue holds, so some are dropped rather
+	// than piling up.
+	for i := 0; i < sendQueueSize+4; i++ {
+		queuePacket(stalling.stalled, []byte("update"))
+	}
+	others := []string{"127.0.0.1:19812", "127.0.0.1:19813"}
+	for _, addr := range others {
+		queuePacket(addr, []byte("update"))
+	}
+
+	received := make(map[string]bool)
+	timeout := time.After(time.Second)
+	for len(received) < len(others) {
+		select {
+		case addr := <-stalling.sent:
+			received[addr] = true
+		case <-timeout:
+			t.Fatalf("only %v received while one peer was stalled", received)
+		}
+	}
+}
+
+func TestUDPBufferSizes(t *testing.T) {
+	fileLogger = log.New(ioutil.Discard, "", 0)
+	log.SetOutput(ioutil.Discard)
+	udpReadBuffer, udpWriteBuffer = 64*1024, 16*1024
+	defer func() { udpReadBuffer, udpWriteBuffer = 0, 0 }()
+
+	u, err := newUDPTransport("127.0.0.1:19810")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer u.Close()
+	readSize, writeSize, err := socketBufferSizes(u.conn)
+	if err != nil {
+		t.Skip(err)
+	}
+	// Linux doubles what's asked for, so only check each got at least that,
+	// and that they weren't swapped.
+	if readSize < udpReadBuffer || writeSize < udpWriteBuffer || readSize <= writeSize {
+		t.Errorf("asked for buffers of %d to read and %d to write, got %d and %d",
+			udpReadBuffer, udpWriteBuffer, readSize, writeSize)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+// This file implements exporting replays as images.
+
+import (
+	"errors"
+	"image"
+	"image/gif"
+	"image/png"
+	"io"
+)
+
+// How long each frame is shown in a GIF, in 100ths of a second. This matches
+// the tick rate of the game.
+const FRAME_DELAY int = 50
+
+// Write the last frame of a replay as a PNG.
+func exportPNG(frames []*Frame, w io.Writer) error {
+	if len(frames) == 0 {
+		return errors.New("replay has no frames")
+	}
+	return png.Encode(w, renderBoard(frames[len(frames)-1].Board))
+}
+
+// Write an animated GIF with one frame per tick of a replay.
+func exportGIF(frames []*Frame, w io.Writer) error {
+	if len(frames) == 0 {
+		return errors.New("replay has no frames")
+	}
+	anim := &gif.GIF{
+		Image: make([]*image.Paletted, 0, len(frames)),
+		Delay: make([]int, 0, len(frames)),
+	}
+	for _, frame := range frames {
+		anim.Image = append(anim.Image, renderBoard(frame.Board))
+		anim.Delay = append(anim.Delay, FRAME_DELAY)
+	}
+	return gif.EncodeAll(w, anim)
+}
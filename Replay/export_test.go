@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"image/color"
+	"image/gif"
+	"strings"
+	"testing"
+)
+
+// Three ticks of p1 moving right along the top row of a 3x3 board.
+const testReplay = `{"Tick":1,"Board":[["t1","p1",""],["","",""],["","",""]],"Colours":{"p1":"#00ff00"}}
+{"Tick":2,"Board":[["t1","t1","p1"],["","",""],["","",""]],"Colours":{"p1":"#00ff00"}}
+{"Tick":3,"Board":[["t1","t1","d1"],["","",""],["","",""]],"Colours":{"p1":"#00ff00"}}
+`
+
+func TestExportGIF(t *testing.T) {
+	frames, err := readReplay(strings.NewReader(testReplay))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaults := append([]color.RGBA(nil), playerColours...)
+	defer func() {
+		copy(playerColours, defaults)
+		buildPalette()
+	}()
+	if err := usePlayerColours(frames); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := exportGIF(frames, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	anim, err := gif.DecodeAll(&out)
+	if err != nil {
+		t.Fatalf("exported GIF doesn't decode: %v", err)
+	}
+	if len(anim.Image) != 3 {
+		t.Errorf("GIF has %d frames, want 3", len(anim.Image))
+	}
+	for i, delay := range anim.Delay {
+		if delay != FRAME_DELAY {
+			t.Errorf("frame %d shown for %d, want %d", i, delay, FRAME_DELAY)
+		}
+	}
+
+	// p1's head on the second frame is in its recorded colour.
+	head := anim.Image[1].At(2*CELL_SIZE+CELL_SIZE/2, CELL_SIZE/2)
+	if r, g, b, _ := head.RGBA(); r != 0 || g != 0xffff || b != 0 {
+		t.Errorf("p1's head is %v, want #00ff00", head)
+	}
+}
+
+func TestExportGIFWithoutFrames(t *testing.T) {
+	if err := exportGIF(nil, &bytes.Buffer{}); err == nil {
+		t.Errorf("exported a GIF of an empty replay")
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+// This file implements a tool for working with replays recorded by
+// Node-Client.
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+func usage() {
+	fmt.Println("usage: Replay [flags] [command] [replayFile] [outputFile]")
+	fmt.Println("[command] one of:")
+	fmt.Println("    png       draw the final board as a PNG")
+	fmt.Println("    gif       animate the whole game as a GIF")
+	fmt.Println("    validate  check the replay is consistent; takes no [outputFile]")
+	fmt.Println("[flags]")
+	flag.PrintDefaults()
+	os.Exit(1)
+}
+
+func main() {
+	flag.StringVar(&trailColouring, "trails", TRAILS_OWNER,
+		"how trails are drawn: "+TRAILS_OWNER+" in a muted shade of their player's colour, or "+
+			TRAILS_PLAIN+" all in the same gray")
+	flag.Parse()
+	args := flag.Args()
+	if trailColouring != TRAILS_OWNER && trailColouring != TRAILS_PLAIN {
+		usage()
+	}
+	if len(args) == 2 && args[0] == "validate" {
+		validate(args[1])
+		return
+	}
+	if len(args) != 3 {
+		usage()
+	}
+
+	var export func([]*Frame, io.Writer) error
+	switch args[0] {
+	case "png":
+		export = exportPNG
+	case "gif":
+		export = exportGIF
+	default:
+		usage()
+	}
+
+	frames, err := readReplayFile(args[1])
+	FatalError(err)
+	FatalError(usePlayerColours(frames))
+
+	out, err := os.Create(args[2])
+	FatalError(err)
+	defer out.Close()
+	FatalError(export(frames, out))
+	fmt.Println("Exported", len(frames), "frames to", args[2])
+}
+
+// Check the replay at path, exiting with an error if it's inconsistent.
+func validate(path string) {
+	frames, err := readReplayFile(path)
+	FatalError(err)
+	FatalError(validateReplay(frames))
+	fmt.Println("Replay is valid,", len(frames), "frames")
+}
+
+// The program should exit if this gives error
+func FatalError(e error) {
+	if e != nil {
+		fmt.Println(e)
+		os.Exit(-10)
+	}
+}
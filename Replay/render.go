@@ -0,0 +1,179 @@
+package main
+
+// This file implements drawing boards as images.
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+)
+
+// Width and height of a board cell in pixels.
+const CELL_SIZE int = 20
+
+// Colours of the players, in the same order as the UI (p1 to p6). Replays
+// that recorded the colours players were given override these.
+var playerColours = []color.RGBA{
+	{0xff, 0x00, 0x00, 0xff}, // red
+	{0x00, 0x80, 0x00, 0xff}, // green
+	{0x00, 0x00, 0xff, 0xff}, // blue
+	{0xff, 0xa5, 0x00, 0xff}, // orange
+	{0xa5, 0x2a, 0x2a, 0xff}, // brown
+	{0x00, 0x00, 0x00, 0xff}, // black
+}
+
+var backgroundColour = color.RGBA{0xff, 0xff, 0xff, 0xff}
+var wallColour = color.RGBA{0x80, 0x80, 0x80, 0xff}       // gray, like the UI
+var mineColour = color.RGBA{0x80, 0x00, 0x80, 0xff}       // purple, like the UI
+var plainTrailColour = color.RGBA{0xc0, 0xc0, 0xc0, 0xff} // light gray, for TRAILS_PLAIN
+
+// How trails are coloured.
+const (
+	TRAILS_OWNER string = "owner" // A muted shade of their player's colour.
+	TRAILS_PLAIN string = "plain" // The same for every player.
+)
+
+var trailColouring string = TRAILS_OWNER
+
+// Marker of a wall cell, from the board closing in.
+const WALL_CELL string = "##"
+
+// Marker of a mine cell.
+const MINE_CELL string = "**"
+
+// All colours a board can be drawn with. For each player there's a head
+// colour, a muted trail colour and a darker colour for their head once dead,
+// followed by the colours of walls, mines and plain trails.
+var palette color.Palette
+
+func init() {
+	buildPalette()
+}
+
+// Build the palette from the current player colours.
+func buildPalette() {
+	palette = color.Palette{backgroundColour}
+	for _, c := range playerColours {
+		palette = append(palette, c)
+	}
+	for _, c := range playerColours {
+		palette = append(palette, mute(c))
+	}
+	for _, c := range playerColours {
+		palette = append(palette, darken(c))
+	}
+	palette = append(palette, wallColour, mineColour, plainTrailColour)
+}
+
+// Draw players in the colours recorded in frames, if any. A player that left
+// the game is missing from later frames, so every frame is checked.
+func usePlayerColours(frames []*Frame) error {
+	for _, frame := range frames {
+		for id, hex := range frame.Colours {
+			if len(id) != 2 || id[1] < '1' || int(id[1]-'1') >= len(playerColours) {
+				continue
+			}
+			c, err := parseHexColour(hex)
+			if err != nil {
+				return fmt.Errorf("colour of %s: %v", id, err)
+			}
+			playerColours[id[1]-'1'] = c
+		}
+	}
+	buildPalette()
+	return nil
+}
+
+// Parse a colour written like "#ff0000".
+func parseHexColour(hex string) (color.RGBA, error) {
+	if len(hex) != 7 || hex[0] != '#' {
+		return color.RGBA{}, fmt.Errorf("%q isn't a #rrggbb colour", hex)
+	}
+	rgb, err := strconv.ParseUint(hex[1:], 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("%q isn't a #rrggbb colour", hex)
+	}
+	return color.RGBA{uint8(rgb >> 16), uint8(rgb >> 8), uint8(rgb), 0xff}, nil
+}
+
+// Blend a colour halfway with another.
+func blend(c color.RGBA, with color.RGBA) color.RGBA {
+	return color.RGBA{
+		uint8((int(c.R) + int(with.R)) / 2),
+		uint8((int(c.G) + int(with.G)) / 2),
+		uint8((int(c.B) + int(with.B)) / 2),
+		0xff,
+	}
+}
+
+// Blend a colour halfway with the background.
+func lighten(c color.RGBA) color.RGBA {
+	return blend(c, backgroundColour)
+}
+
+// Blend a colour halfway with black.
+func darken(c color.RGBA) color.RGBA {
+	return blend(c, color.RGBA{0x00, 0x00, 0x00, 0xff})
+}
+
+// Desaturate a colour halfway to the gray of the same brightness, then
+// lighten it, so trails are clearly their player's but fainter than heads.
+func mute(c color.RGBA) color.RGBA {
+	gray := uint8((299*int(c.R) + 587*int(c.G) + 114*int(c.B)) / 1000)
+	return lighten(blend(c, color.RGBA{gray, gray, gray, 0xff}))
+}
+
+// Return the palette index to draw a cell marker such as "p1", "t1", "d1", a
+// wall or a mine with.
+func cellColourIndex(cell string) uint8 {
+	players := uint8(len(playerColours))
+	if cell == WALL_CELL {
+		return 1 + 3*players
+	}
+	if cell == MINE_CELL {
+		return 2 + 3*players
+	}
+	if len(cell) != 2 || cell[1] < '1' || int(cell[1]-'1') >= len(playerColours) {
+		return 0
+	}
+	player := uint8(cell[1] - '1')
+	switch cell[0] {
+	case 't':
+		if trailColouring == TRAILS_PLAIN {
+			return 3 + 3*players
+		}
+		return 1 + players + player
+	case 'd':
+		return 1 + 2*players + player
+	}
+	return 1 + player
+}
+
+// Draw a board, one CELL_SIZE square per cell.
+func renderBoard(board [][]string) *image.Paletted {
+	height := len(board) * CELL_SIZE
+	width := 0
+	if len(board) > 0 {
+		width = len(board[0]) * CELL_SIZE
+	}
+	img := image.NewPaletted(image.Rect(0, 0, width, height), palette)
+
+	for y, row := range board {
+		for x, cell := range row {
+			index := cellColourIndex(cell)
+			for py := y * CELL_SIZE; py < (y+1)*CELL_SIZE; py++ {
+				for px := x * CELL_SIZE; px < (x+1)*CELL_SIZE; px++ {
+					img.SetColorIndex(px, py, index)
+				}
+			}
+			if len(cell) == 2 && cell[0] == 'd' {
+				// Cross out dead players like the UI does.
+				for i := 0; i < CELL_SIZE; i++ {
+					img.SetColorIndex(x*CELL_SIZE+i, y*CELL_SIZE+i, 0)
+				}
+			}
+		}
+	}
+	return img
+}
@@ -0,0 +1,43 @@
+package main
+
+// This file implements reading replays recorded by Node-Client.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// The state of the board after a tick, as recorded by Node-Client.
+type Frame struct {
+	Tick    int
+	Board   [][]string
+	Colours map[string]string // Id : hex colour, for players that were given one
+}
+
+// Read every frame of the replay at path.
+func readReplayFile(path string) ([]*Frame, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readReplay(f)
+}
+
+// Read every frame of a replay.
+func readReplay(r io.Reader) ([]*Frame, error) {
+	frames := make([]*Frame, 0)
+	decoder := json.NewDecoder(r)
+	for {
+		frame := new(Frame)
+		err := decoder.Decode(frame)
+		if err == io.EOF {
+			return frames, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("frame %d: %v", len(frames)+1, err)
+		}
+		frames = append(frames, frame)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+// This file implements checking a replay for consistency, to catch recorder
+// bugs and corrupt files before drawing them.
+
+import (
+	"fmt"
+)
+
+// Check that frames make up a consistent game: ticks only go forwards, every
+// board is the same square size, every cell is a known marker, each player has
+// at most one head, no player appears after the first frame, and no player
+// comes back to life after dying. Returns the first problem found.
+func validateReplay(frames []*Frame) error {
+	if len(frames) == 0 {
+		return fmt.Errorf("replay has no frames")
+	}
+	size := len(frames[0].Board)
+	players := make(map[byte]bool) // Player number : whether it's in the game.
+	dead := make(map[byte]int)     // Player number : tick it was first seen dead.
+	for i, frame := range frames {
+		if i > 0 && frame.Tick <= frames[i-1].Tick {
+			return fmt.Errorf("tick %d: follows tick %d", frame.Tick, frames[i-1].Tick)
+		}
+		if len(frame.Board) != size {
+			return fmt.Errorf("tick %d: board has %d rows, not %d", frame.Tick, len(frame.Board), size)
+		}
+		heads := make(map[byte]bool)
+		for y, row := range frame.Board {
+			if len(row) != size {
+				return fmt.Errorf("tick %d: row %d has %d cells, not %d", frame.Tick, y, len(row), size)
+			}
+			for x, cell := range row {
+				if cell == "" || cell == WALL_CELL || cell == MINE_CELL {
+					continue
+				}
+				if len(cell) != 2 || (cell[0] != 'p' && cell[0] != 't' && cell[0] != 'd') ||
+					cell[1] < '1' || int(cell[1]-'1') >= len(playerColours) {
+					return fmt.Errorf("tick %d: unknown cell %q at %d,%d", frame.Tick, cell, x, y)
+				}
+				player := cell[1]
+				if i == 0 {
+					players[player] = true
+				} else if !players[player] {
+					return fmt.Errorf("tick %d: player p%c appears at %d,%d after the game started",
+						frame.Tick, player, x, y)
+				}
+				if cell[0] == 't' {
+					continue
+				}
+				if heads[player] {
+					return fmt.Errorf("tick %d: player p%c has more than one head", frame.Tick, player)
+				}
+				heads[player] = true
+				if cell[0] == 'd' {
+					if _, ok := dead[player]; !ok {
+						dead[player] = frame.Tick
+					}
+				} else if diedAt, ok := dead[player]; ok {
+					return fmt.Errorf("tick %d: player p%c is alive at %d,%d after dying on tick %d",
+						frame.Tick, player, x, y, diedAt)
+				}
+			}
+		}
+	}
+	return nil
+}
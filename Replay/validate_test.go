@@ -0,0 +1,30 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateReplay(t *testing.T) {
+	frames, err := readReplay(strings.NewReader(testReplay))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validateReplay(frames); err != nil {
+		t.Errorf("consistent replay flagged: %v", err)
+	}
+}
+
+func TestValidateReplayResurrection(t *testing.T) {
+	// p1 crashes on tick 3, then is back on tick 4.
+	corrupt := testReplay +
+		`{"Tick":4,"Board":[["t1","t1","t1"],["","","p1"],["","",""]],"Colours":{"p1":"#00ff00"}}` + "\n"
+	frames, err := readReplay(strings.NewReader(corrupt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "tick 4: player p1 is alive at 2,1 after dying on tick 3"
+	if err := validateReplay(frames); err == nil || err.Error() != want {
+		t.Errorf("replay with a resurrection flagged with %v, want %q", err, want)
+	}
+}
@@ -18,7 +18,7 @@ class BuildStage(object):
             return subprocess.call(self._command_and_args)
 
 def main():
-    description = "Quickly builds both the MS and client binaries."
+    description = "Quickly builds the MS, client and replay binaries."
     parser = argparse.ArgumentParser(description=description)
     parser.add_argument("--use-go-build", dest="use_go_build",
                         action="store_true",
@@ -31,7 +31,8 @@ def main():
     stages = [
         BuildStage("MS Server",
                    common.MATCHMAKING_DIR,
-                   ["go", "build", "MS.go", "log.go"]),
+                   ["go", "build", "-o", "MS"]),
+        BuildStage("Replay", common.REPLAY_DIR, ["go", "build"]),
     ]
 
     if args.use_go_build:
@@ -3,6 +3,7 @@
 import contextlib
 import os
 import psutil
+import signal
 import subprocess
 import time
 import unittest
@@ -10,6 +11,7 @@ import unittest
 _HERE = os.path.dirname(os.path.abspath(__file__))
 NODE_CLIENT_DIR = os.path.join(os.path.dirname(_HERE), "Node-Client")
 MATCHMAKING_DIR = os.path.join(os.path.dirname(_HERE), "MatchMaking")
+REPLAY_DIR = os.path.join(os.path.dirname(_HERE), "Replay")
 
 @contextlib.contextmanager
 def use_cwd(new_cwd):
@@ -32,16 +34,32 @@ class CommonBinary(object):
             print ("Tried to kill process with PID '{}' but failed. Continuing "
                    "anyways.".format(self._process.pid))
 
+    def interrupt(self):
+        """Sends SIGINT, letting the process shut down cleanly."""
+        self._process.send_signal(signal.SIGINT)
+
+    def pause(self):
+        """Sends SIGSTOP, freezing the process as if its host had stalled."""
+        self._process.send_signal(signal.SIGSTOP)
+
+    def resume(self):
+        """Sends SIGCONT, resuming a process stopped by pause()."""
+        self._process.send_signal(signal.SIGCONT)
+
     def wait(self):
         self._process.wait()
 
+    def is_running(self):
+        return self._process.poll() is None
+
 class MatchMakingServer(CommonBinary):
     # The number of seconds the game start timer expires.
     GAME_START_TIMEOUT = 30
 
-    def __init__(self, port):
+    def __init__(self, port, flags=None):
         super(MatchMakingServer, self).__init__()
         self.port = port
+        self._flags = flags or []
         self.local_log_path = os.path.join(
             MATCHMAKING_DIR, "127.0.0.1{}-local.txt".format(port))
         self.govector_log_path = os.path.join(
@@ -64,22 +82,25 @@ class MatchMakingServer(CommonBinary):
         # We force the working directory to be |MATCHMAKING_DIR| so tests can
         # use a fixed path to log files.
         with use_cwd(MATCHMAKING_DIR), open(os.devnull, "w") as dev_null:
-            self._process = subprocess.Popen([self._bin_path,
-                                              "localhost:{}".format(self.port)],
+            self._process = subprocess.Popen([self._bin_path] + self._flags +
+                                             ["localhost:{}".format(self.port)],
                                              stdout=dev_null,
                                              stderr=dev_null)
 
 class Client(CommonBinary):
-    def __init__(self, node_port, node_rpc_port, ms_port, http_srv_port):
+    def __init__(self, node_port, node_rpc_port, ms_port, http_srv_port,
+                 node_host="localhost", flags=None):
         super(Client, self).__init__()
         self.node_port = node_port
+        self._flags = flags or []
+        self._node_host = node_host
         self._node_rpc_port = node_rpc_port
         self._ms_port = ms_port
-        self._http_srv_port = http_srv_port
+        self.http_srv_port = http_srv_port
         self.local_log_path = os.path.join(
-            NODE_CLIENT_DIR, "localhost{}-local.txt".format(node_port))
+            NODE_CLIENT_DIR, "{}{}-local.txt".format(node_host, node_port))
         self.govector_log_path = os.path.join(
-            NODE_CLIENT_DIR, "localhost{}-Log.txt".format(node_port))
+            NODE_CLIENT_DIR, "{}{}-Log.txt".format(node_host, node_port))
 
         possible_bin_paths = [
             os.path.join(NODE_CLIENT_DIR, ".vendor", "bin", "Node-Client"),
@@ -105,12 +126,11 @@ class Client(CommonBinary):
         # Our HTML assets are only loaded if we run the binary from the correct
         # cwd.
         with use_cwd(NODE_CLIENT_DIR), open(os.devnull, "w") as dev_null:
-            self._process = subprocess.Popen([
-                self._bin_path,
-                "localhost:{}".format(self.node_port),
+            self._process = subprocess.Popen([self._bin_path] + self._flags + [
+                "{}:{}".format(self._node_host, self.node_port),
                 "localhost:{}".format(self._node_rpc_port),
                 "localhost:{}".format(self._ms_port),
-                "localhost:{}".format(self._http_srv_port)
+                "localhost:{}".format(self.http_srv_port)
             ],
             stdout=dev_null,
             stderr=dev_null)
@@ -124,7 +144,7 @@ class TestCase(unittest.TestCase):
     def tearDown(self):
         kill_remaining_processes()
 
-def start_multiple_clients(ms_srv_port, client_count):
+def start_multiple_clients(ms_srv_port, client_count, flags=None):
     clients = []
     for client_num in range(client_count):
         node_port = 9999 - (client_num * 3)
@@ -133,7 +153,8 @@ def start_multiple_clients(ms_srv_port, client_count):
         clients.append(Client(node_port=node_port,
                               node_rpc_port=node_rpc_port,
                               ms_port=ms_srv_port,
-                              http_srv_port=http_srv_port))
+                              http_srv_port=http_srv_port,
+                              flags=flags))
         print ("Starting client w/ node port {}, RPC port {}, MS port {}, HTTP "
                "port {}".format(node_port, node_rpc_port, ms_srv_port,
                                 http_srv_port))
@@ -0,0 +1,52 @@
+#!/usr/bin/env python2
+
+import os
+import sys
+import time
+import unittest
+
+_HERE = os.path.dirname(os.path.abspath(__file__))
+sys.path.append(os.path.dirname(_HERE))
+
+import common
+
+# How long the matchmaking server waits for players before starting a game.
+SESSION_DELAY = 2
+
+# p1 starts a cell from the left wall heading for it, so once it's there it has
+# the wall ahead, its own trail behind and p2, who never moves, below it. Only
+# the cell above is free.
+START_OVERRIDES = "p1:1,1:L;p2:0,2:R"
+
+def log_contains(path, text):
+    with open(path) as log_file:
+        return any(text in line for line in log_file)
+
+class AssistTest(common.TestCase):
+    def test_boxed_in_node_dodges(self):
+        """p1 is boxed in on three sides with -assist. Rather than die against
+        the wall, it should turn up into the open cell on every node, and
+        still be alive.
+        """
+        ms_srv = common.MatchMakingServer(
+            2222, flags=["-session-delay={}s".format(SESSION_DELAY),
+                         "-assist",
+                         "-start-overrides={}".format(START_OVERRIDES),
+                         "-start-delays=p2:1000"])
+        ms_srv.start()
+        time.sleep(2)
+
+        clients = common.start_multiple_clients(ms_srv.port, 2)
+        # Wait for the game to start and p1 to reach the wall.
+        common.sleep(SESSION_DELAY + 8)
+
+        for client in clients:
+            self.assertTrue(log_contains(client.local_log_path,
+                                         "NODE p1 DODGED L TO U"),
+                            "p1 should have dodged up")
+            self.assertFalse(log_contains(client.local_log_path,
+                                          "NODE p1 IS DEAD"),
+                             "p1 shouldn't have died")
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,68 @@
+#!/usr/bin/env python2
+
+import os
+import sys
+import time
+import unittest
+
+_HERE = os.path.dirname(os.path.abspath(__file__))
+sys.path.append(os.path.dirname(_HERE))
+
+import common
+
+# Should match the constants in node.go and border.go.
+BOARD_SIZE = 10
+BORDER_CELL = "=="
+
+def logged_boards(log_path):
+    """Returns the boards in a node's local log, each a list of rows of
+    cells, without the row and column numbers.
+    """
+    boards = []
+    rows = None
+    with open(log_path) as log_file:
+        for line in log_file:
+            # Lines look like "<date> <time> [<logged text>]".
+            text = line.split(" ", 2)[-1].strip().lstrip("[").rstrip("]")
+            fields = text.split()
+            if fields and fields[0] == "-1" and len(fields) > 1 and \
+                    fields[1] == "0":
+                # Column numbers, starting a board.
+                rows = []
+                boards.append(rows)
+            elif rows is not None and fields and \
+                    fields[0].lstrip("-").isdigit() and \
+                    len(rows) < BOARD_SIZE + 2:
+                rows.append(fields[1:])
+    return [board for board in boards if len(board) == BOARD_SIZE + 2]
+
+class BoardBorderTest(common.TestCase):
+    def test_board_border(self):
+        """c1 and c2 play a game with -board-border. The boards c1 logs should
+        be BOARD_SIZE+2 square, with border cells all around the edge.
+        """
+        ms_srv = common.MatchMakingServer(2222)
+        ms_srv.start()
+        time.sleep(2)
+
+        clients = common.start_multiple_clients(ms_srv.port, 2,
+                                                flags=["-board-border"])
+        common.sleep(common.MatchMakingServer.GAME_START_TIMEOUT * 1.1)
+
+        boards = logged_boards(clients[0].local_log_path)
+        self.assertTrue(boards, "c1 should have logged a bordered board")
+        board = boards[-1]
+        for row in board:
+            self.assertEqual(len(row), BOARD_SIZE + 2,
+                             "Every row should be BOARD_SIZE+2 cells")
+        for i in range(BOARD_SIZE + 2):
+            for cell in [board[0][i], board[-1][i], board[i][0], board[i][-1]]:
+                self.assertEqual(cell, BORDER_CELL,
+                                 "The edge should be all border cells")
+        for row in board[1:-1]:
+            for cell in row[1:-1]:
+                self.assertNotEqual(cell, BORDER_CELL,
+                                    "Only the edge should be border cells")
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,56 @@
+#!/usr/bin/env python2
+
+import httplib
+import json
+import os
+import sys
+import time
+import unittest
+
+_HERE = os.path.dirname(os.path.abspath(__file__))
+sys.path.append(os.path.dirname(_HERE))
+
+import common
+
+# How long the matchmaking server waits for players before starting a game.
+SESSION_DELAY = 2
+
+# How long to wait for an event before failing.
+EVENT_TIMEOUT = 20
+
+class EventsTest(common.TestCase):
+    def test_death_event(self):
+        """c1 and c2 play a game nobody steers, so someone dies when they reach
+        a wall. Someone watching c1's event stream should see the death.
+        """
+        ms_srv = common.MatchMakingServer(
+            2222, flags=["-session-delay={}s".format(SESSION_DELAY)])
+        ms_srv.start()
+        time.sleep(2)
+
+        clients = common.start_multiple_clients(ms_srv.port, 2)
+        conn = httplib.HTTPConnection(
+            "localhost", clients[0].http_srv_port, timeout=EVENT_TIMEOUT)
+        conn.request("GET", "/events")
+        # Read lines off the connection itself, since reading the chunked
+        # response waits for a full buffer. The chunk sizes come through as
+        # lines of their own, which are skipped like any other line.
+        stream = conn.getresponse().fp
+
+        kind = None
+        death = None
+        deadline = time.time() + EVENT_TIMEOUT
+        while death is None and time.time() < deadline:
+            line = stream.readline().strip()
+            if line.startswith("event: "):
+                kind = line[len("event: "):]
+            elif line.startswith("data: ") and kind == "death":
+                death = json.loads(line[len("data: "):])
+        conn.close()
+
+        self.assertIsNotNone(death, "c1 should have streamed a death event")
+        self.assertIn(death["id"], ["p1", "p2"],
+                      "The death should be one of the players'")
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,96 @@
+#!/usr/bin/env python2
+
+import os
+import sys
+import time
+import unittest
+
+_HERE = os.path.dirname(os.path.abspath(__file__))
+sys.path.append(os.path.dirname(_HERE))
+
+import common
+
+# Should match the constants in node.go and fog.go.
+BOARD_SIZE = 10
+FOG_CELL = "~~"
+
+# How long the matchmaking server waits for players before starting a game.
+SESSION_DELAY = 2
+
+FOG_RADIUS = 2
+
+def logged_text(line):
+    # Lines look like "<date> <time> [<logged text>]".
+    return line.split(" ", 2)[-1].strip().lstrip("[").rstrip("]")
+
+def received_boards(log_path):
+    """Returns the fogged boards the leader sent a node, as logged by it, each
+    a list of rows of cells without the row and column numbers.
+    """
+    boards = []
+    rows = None
+    with open(log_path) as log_file:
+        for line in log_file:
+            text = logged_text(line)
+            if "Leader's board as we see it" in text:
+                rows = []
+                boards.append(rows)
+                continue
+            fields = text.split()
+            if rows is None or not fields or not fields[0].isdigit():
+                continue
+            if fields[0] == "0" and len(fields) == BOARD_SIZE:
+                # Column numbers.
+                continue
+            if len(rows) < BOARD_SIZE:
+                rows.append(fields[1:])
+    return [board for board in boards if len(board) == BOARD_SIZE]
+
+def find_cell(board, cell):
+    for y, row in enumerate(board):
+        for x, code in enumerate(row):
+            if code == cell:
+                return x, y
+    return None
+
+class FogTest(common.TestCase):
+    def test_fogged_board(self):
+        """c1 leads a game with c2 with -fog-radius. The boards c2 gets from
+        c1 should show the cells within FOG_RADIUS of c2's head, and only
+        those.
+        """
+        # Players survive running into walls, so the game outlasts the test.
+        ms_srv = common.MatchMakingServer(
+            2222, flags=["-session-delay={}s".format(SESSION_DELAY),
+                         "-spawn-protection=1000",
+                         "-fog-radius={}".format(FOG_RADIUS)])
+        ms_srv.start()
+        time.sleep(2)
+
+        clients = common.start_multiple_clients(ms_srv.port, 2)
+        common.sleep(SESSION_DELAY + 8)
+
+        boards = received_boards(clients[1].local_log_path)
+        self.assertTrue(boards, "c2 should have logged a board from c1")
+        checked = 0
+        for board in boards:
+            head = find_cell(board, "p2")
+            if head is None:
+                continue
+            checked += 1
+            for y, row in enumerate(board):
+                self.assertEqual(len(row), BOARD_SIZE,
+                                 "Every row should be BOARD_SIZE cells")
+                for x, cell in enumerate(row):
+                    far = abs(x - head[0]) > FOG_RADIUS or \
+                        abs(y - head[1]) > FOG_RADIUS
+                    if far:
+                        self.assertEqual(cell, FOG_CELL,
+                                         "({},{}) should be fogged".format(x, y))
+                    else:
+                        self.assertNotEqual(cell, FOG_CELL,
+                                            "({},{}) should be seen".format(x, y))
+        self.assertTrue(checked, "c2's head should be on a board it got")
+
+if __name__ == "__main__":
+    unittest.main()
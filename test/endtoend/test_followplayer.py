@@ -0,0 +1,55 @@
+#!/usr/bin/env python2
+
+import json
+import os
+import sys
+import time
+import unittest
+import urllib2
+
+_HERE = os.path.dirname(os.path.abspath(__file__))
+sys.path.append(os.path.dirname(_HERE))
+
+import common
+
+# How long the matchmaking server waits for players before starting a game.
+SESSION_DELAY = 2
+
+# Where p2 starts, and stays for the whole test.
+P2_X, P2_Y = 6, 4
+
+def get_player(client, player_id):
+    return json.loads(urllib2.urlopen(
+        "http://localhost:{}/player?id={}".format(client.http_srv_port,
+                                                 player_id)).read())
+
+class FollowPlayerTest(common.TestCase):
+    def test_player_endpoint(self):
+        """p2 starts at a known cell and stays put. Both nodes' /player
+        should return that position for p2, and a 404 for a player who isn't
+        in the game.
+        """
+        ms_srv = common.MatchMakingServer(
+            2222, flags=["-session-delay={}s".format(SESSION_DELAY),
+                         "-start-overrides=p2:{},{}:U".format(P2_X, P2_Y),
+                         "-start-delays=p2:1000"])
+        ms_srv.start()
+        time.sleep(2)
+
+        clients = common.start_multiple_clients(ms_srv.port, 2)
+        # Wait for the game to start and run for a few ticks.
+        common.sleep(SESSION_DELAY + 6)
+
+        for client in clients:
+            player = get_player(client, "p2")
+            self.assertEqual(player["id"], "p2")
+            self.assertEqual((player["x"], player["y"]), (P2_X, P2_Y),
+                             "p2 should be where it started")
+            self.assertEqual(player["direction"], "U")
+
+        with self.assertRaises(urllib2.HTTPError) as context:
+            get_player(clients[0], "p6")
+        self.assertEqual(context.exception.code, 404)
+
+if __name__ == "__main__":
+    unittest.main()
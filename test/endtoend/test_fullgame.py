@@ -0,0 +1,53 @@
+#!/usr/bin/env python2
+
+import os
+import sys
+import time
+import unittest
+
+_HERE = os.path.dirname(os.path.abspath(__file__))
+sys.path.append(os.path.dirname(_HERE))
+
+import common
+
+# How long the matchmaking server waits for players before starting a game.
+SESSION_DELAY = 2
+
+class FullGameTest(common.TestCase):
+    def test_full_game(self):
+        """Four players join, get matched into one game, and play it out
+        without anyone steering. Everyone runs into a wall, so the leader
+        should report a finished game with all four players to the
+        matchmaking server.
+        """
+        ms_srv = common.MatchMakingServer(
+            2222, flags=["-session-delay={}s".format(SESSION_DELAY)])
+        ms_srv.start()
+        time.sleep(2)
+
+        clients = common.start_multiple_clients(ms_srv.port, 4)
+
+        # Wait for the game to start, then for players to reach the walls.
+        common.sleep(SESSION_DELAY + 10)
+
+        for client in clients:
+            self.assertTrue(client.is_running(),
+                            "Clients should still be running after the game")
+
+        game_over_found = False
+        players_found = set()
+        with open(ms_srv.local_log_path) as log_file:
+            for line in log_file:
+                if "Game over after" in line:
+                    game_over_found = True
+                for player in ["p1", "p2", "p3", "p4"]:
+                    if "Result: {}".format(player) in line:
+                        players_found.add(player)
+
+        self.assertTrue(game_over_found,
+                        "MS server should have received the game's result")
+        self.assertEqual(players_found, set(["p1", "p2", "p3", "p4"]),
+                         "The result should include every player")
+
+if __name__ == "__main__":
+    unittest.main()
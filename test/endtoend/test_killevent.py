@@ -0,0 +1,72 @@
+#!/usr/bin/env python2
+
+import httplib
+import json
+import os
+import sys
+import time
+import unittest
+
+_HERE = os.path.dirname(os.path.abspath(__file__))
+sys.path.append(os.path.dirname(_HERE))
+
+import common
+
+# How long the matchmaking server waits for players before starting a game.
+SESSION_DELAY = 2
+
+# How long to wait for the game to end before failing.
+GAME_TIMEOUT = 30
+
+CAUSES = ["wall", "trail", "head", "mine", "reversal", "shrink", "afk"]
+
+class KillEventTest(common.TestCase):
+    def test_one_kill_event_per_death(self):
+        """c1 and c2 play a game nobody steers until it's over. Someone
+        watching c2's event stream, which hears of deaths from the leader,
+        should see exactly one kill event for each death, saying what did it.
+        """
+        ms_srv = common.MatchMakingServer(
+            2222, flags=["-session-delay={}s".format(SESSION_DELAY)])
+        ms_srv.start()
+        time.sleep(2)
+
+        clients = common.start_multiple_clients(ms_srv.port, 2)
+        conn = httplib.HTTPConnection(
+            "localhost", clients[1].http_srv_port, timeout=GAME_TIMEOUT)
+        conn.request("GET", "/events")
+        # Read lines off the connection itself, since reading the chunked
+        # response waits for a full buffer. The chunk sizes come through as
+        # lines of their own, which are skipped like any other line.
+        stream = conn.getresponse().fp
+
+        kind = None
+        deaths = []
+        kills = []
+        deadline = time.time() + GAME_TIMEOUT
+        while time.time() < deadline:
+            line = stream.readline().strip()
+            if line.startswith("event: "):
+                kind = line[len("event: "):]
+            elif line.startswith("data: "):
+                data = json.loads(line[len("data: "):])
+                if kind == "death":
+                    deaths.append(data["id"])
+                elif kind == "kill":
+                    kills.append(data)
+                elif kind == "gameOver":
+                    break
+        conn.close()
+
+        self.assertTrue(deaths, "c2 should have streamed a death")
+        self.assertEqual(sorted(deaths), sorted(k["victim"] for k in kills),
+                         "Every death should have exactly one kill event")
+        for kill in kills:
+            self.assertIn(kill["cause"], CAUSES,
+                          "The kill event should say what killed " + kill["victim"])
+            if kill["cause"] == "wall":
+                self.assertEqual(kill["killer"], "",
+                                 "Nobody should be blamed for a wall")
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,54 @@
+#!/usr/bin/env python2
+
+import os
+import sys
+import time
+import unittest
+
+_HERE = os.path.dirname(os.path.abspath(__file__))
+sys.path.append(os.path.dirname(_HERE))
+
+import common
+
+# How long the matchmaking server waits for players before starting a game.
+SESSION_DELAY = 2
+
+MAX_GAME_DURATION = 6
+
+class MaxGameDurationTest(common.TestCase):
+    def test_game_ends_at_cap(self):
+        """Two players who survive running into walls, so never die, play with
+        a short -max-game-duration. The leader should end the game as a draw
+        when it's up, with both players still alive.
+        """
+        ms_srv = common.MatchMakingServer(
+            2222, flags=["-session-delay={}s".format(SESSION_DELAY),
+                         "-spawn-protection=1000",
+                         "-max-game-duration={}s".format(MAX_GAME_DURATION)])
+        ms_srv.start()
+        time.sleep(2)
+
+        clients = common.start_multiple_clients(ms_srv.port, 2)
+        common.sleep(SESSION_DELAY + MAX_GAME_DURATION + 6)
+
+        with open(clients[0].local_log_path) as log_file:
+            self.assertIn("Max game duration", log_file.read(),
+                          "The leader should end the game when time's up")
+
+        game_over = None
+        alive = 0
+        with open(ms_srv.local_log_path) as log_file:
+            for line in log_file:
+                if "Game over after" in line:
+                    game_over = line
+                if "Result:" in line and "alive: true" in line:
+                    alive += 1
+        self.assertIsNotNone(game_over,
+                             "MS server should have received the game's result")
+        self.assertIn("time's up", game_over,
+                      "The game should have ended for running out of time")
+        self.assertIn("winner:  reason", game_over, "The game should be a draw")
+        self.assertEqual(alive, 2, "Both players should have survived")
+
+if __name__ == "__main__":
+    unittest.main()
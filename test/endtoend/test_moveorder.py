@@ -0,0 +1,67 @@
+#!/usr/bin/env python2
+
+import os
+import re
+import sys
+import time
+import unittest
+
+_HERE = os.path.dirname(os.path.abspath(__file__))
+sys.path.append(os.path.dirname(_HERE))
+
+import common
+
+# How long the matchmaking server waits for players before starting a game.
+SESSION_DELAY = 2
+
+# Matches what nodesInMoveOrder logs with -debug.
+MOVE_ORDER_RE = re.compile(r"DEBUG: Tick (\d+) move order: ([p\d ]+)")
+
+def logged_move_orders(log_path):
+    """Returns tick : ids of the players in the order they moved, from a node's
+    local log.
+    """
+    orders = {}
+    with open(log_path) as log_file:
+        for line in log_file:
+            match = MOVE_ORDER_RE.search(line)
+            if match:
+                orders[int(match.group(1))] = match.group(2).split()
+    return orders
+
+class MoveOrderTest(common.TestCase):
+    def test_move_order_rotates(self):
+        """c1 and c2 play a game with -move-order=rotate. Each tick, the
+        player who moved first last tick should move last, on both nodes.
+        """
+        ms_srv = common.MatchMakingServer(
+            2222, flags=["-session-delay={}s".format(SESSION_DELAY),
+                         "-move-order=rotate"])
+        ms_srv.start()
+        time.sleep(2)
+
+        clients = common.start_multiple_clients(ms_srv.port, 2,
+                                                flags=["-debug"])
+        # Wait for the game to start and play a few ticks.
+        common.sleep(SESSION_DELAY + 10)
+
+        orders = [logged_move_orders(client.local_log_path)
+                  for client in clients]
+        for client_orders in orders:
+            self.assertTrue(len(client_orders) >= 2,
+                            "Each node should have logged a few ticks")
+            for tick, order in client_orders.items():
+                self.assertEqual(sorted(order), ["p1", "p2"],
+                                 "Every player should move once a tick")
+                if tick + 1 in client_orders:
+                    self.assertEqual(client_orders[tick + 1],
+                                     order[1:] + order[:1],
+                                     "The order should rotate each tick")
+
+        for tick in set(orders[0]) & set(orders[1]):
+            self.assertEqual(orders[0][tick], orders[1][tick],
+                             "Both nodes should move players in the same "
+                             "order on the same tick")
+
+if __name__ == "__main__":
+    unittest.main()
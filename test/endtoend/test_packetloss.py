@@ -0,0 +1,52 @@
+#!/usr/bin/env python2
+
+import os
+import sys
+import time
+import unittest
+
+_HERE = os.path.dirname(os.path.abspath(__file__))
+sys.path.append(os.path.dirname(_HERE))
+
+import common
+
+# How long the matchmaking server waits for players before starting a game.
+SESSION_DELAY = 2
+
+# Lines a node logs when the game ends for it, whoever won.
+GAME_OVER_LINES = ["I WIN", "Someone else won:", "GAME OVER:"]
+
+class PacketLossTest(common.TestCase):
+    def test_game_completes_with_packet_loss(self):
+        """Two players play a game nobody steers while each drops a fifth of
+        the packets it sends and delays the rest. They should still both see
+        the game end, and the leader should report its result.
+        """
+        ms_srv = common.MatchMakingServer(
+            2222, flags=["-session-delay={}s".format(SESSION_DELAY)])
+        ms_srv.start()
+        time.sleep(2)
+
+        clients = common.start_multiple_clients(
+            ms_srv.port, 2,
+            flags=["-sim-loss=0.2", "-sim-latency=20ms", "-sim-jitter=30ms"])
+
+        # Wait for the game to start, then for players to reach the walls.
+        common.sleep(SESSION_DELAY + 10)
+
+        for client in clients:
+            self.assertTrue(client.is_running(),
+                            "Clients should still be running after the game")
+            with open(client.local_log_path) as log_file:
+                game_over = any(marker in line for line in log_file
+                                for marker in GAME_OVER_LINES)
+            self.assertTrue(game_over,
+                            "Every client should see the game end")
+
+        with open(ms_srv.local_log_path) as log_file:
+            result_found = any("Game over after" in line for line in log_file)
+        self.assertTrue(result_found,
+                        "MS server should have received the game's result")
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,49 @@
+#!/usr/bin/env python2
+
+import os
+import sys
+import time
+import unittest
+import urllib2
+
+_HERE = os.path.dirname(os.path.abspath(__file__))
+sys.path.append(os.path.dirname(_HERE))
+
+import common
+
+def get_status(port, path):
+    """Returns the HTTP status of a GET of path on localhost:port."""
+    try:
+        return urllib2.urlopen("http://localhost:{}{}".format(port, path)).getcode()
+    except urllib2.HTTPError as e:
+        return e.code
+
+class PprofTest(common.TestCase):
+    def test_pprof_only_with_flag(self):
+        """c1 is run with -pprof and c2 without. c1 should serve the
+        /debug/pprof/ index and c2 should 404.
+        """
+        ms_srv = common.MatchMakingServer(2222)
+        ms_srv.start()
+        time.sleep(2)
+
+        client1 = common.Client(node_port=9999, node_rpc_port=9998,
+                                ms_port=ms_srv.port, http_srv_port=9997,
+                                flags=["-pprof"])
+        client1.start()
+        time.sleep(0.5)
+        client2 = common.Client(node_port=9996, node_rpc_port=9995,
+                                ms_port=ms_srv.port, http_srv_port=9994)
+        client2.start()
+        common.sleep(3)
+
+        self.assertEqual(get_status(client1.http_srv_port, "/debug/pprof/"), 200,
+                         "c1 should serve the profile index")
+        self.assertEqual(get_status(client1.http_srv_port,
+                                    "/debug/pprof/heap?debug=1"), 200,
+                         "c1 should serve named profiles")
+        self.assertEqual(get_status(client2.http_srv_port, "/debug/pprof/"), 404,
+                         "c2 shouldn't serve profiles")
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,62 @@
+#!/usr/bin/env python2
+
+import os
+import sys
+import time
+import unittest
+import urllib2
+
+_HERE = os.path.dirname(os.path.abspath(__file__))
+sys.path.append(os.path.dirname(_HERE))
+
+import common
+
+# How long the matchmaking server waits for players before starting a game.
+SESSION_DELAY = 2
+
+def peers_heard_from(client):
+    """Returns the addresses the client counted packets received from."""
+    metrics = urllib2.urlopen(
+        "http://localhost:{}/metrics".format(client.http_srv_port)).read()
+    peers = set()
+    for line in metrics.splitlines():
+        name, value = line.split()
+        if name.startswith("peer_packets_received_total{") and int(value) > 0:
+            peers.add(name.rstrip("}").split("=", 1)[1].strip('"'))
+    return peers
+
+class TCPTransportTest(common.TestCase):
+    def test_game_over_tcp(self):
+        """Two players play a game out with -transport=tcp. The leader should
+        report the result, and each should have heard from the other at the
+        port it listens on rather than the one it dialed from.
+        """
+        ms_srv = common.MatchMakingServer(
+            2222, flags=["-session-delay={}s".format(SESSION_DELAY)])
+        ms_srv.start()
+        time.sleep(2)
+
+        clients = common.start_multiple_clients(ms_srv.port, 2,
+                                                flags=["-transport=tcp"])
+        common.sleep(SESSION_DELAY + 10)
+
+        for client in clients:
+            self.assertTrue(client.is_running(),
+                            "Clients should still be running after the game")
+
+        players_found = set()
+        with open(ms_srv.local_log_path) as log_file:
+            for line in log_file:
+                for player in ["p1", "p2"]:
+                    if "Result: {}".format(player) in line:
+                        players_found.add(player)
+        self.assertEqual(players_found, set(["p1", "p2"]),
+                         "MS server should have received the game's result")
+
+        for client, other in [(clients[0], clients[1]), (clients[1], clients[0])]:
+            ports = [peer.rsplit(":", 1)[1] for peer in peers_heard_from(client)]
+            self.assertEqual(ports, [str(other.node_port)],
+                             "Packets should be from the peer's listening port")
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,55 @@
+#!/usr/bin/env python2
+
+import os
+import sys
+import time
+import unittest
+
+_HERE = os.path.dirname(os.path.abspath(__file__))
+sys.path.append(os.path.dirname(_HERE))
+
+import common
+
+# How long the matchmaking server waits for players before starting a game.
+SESSION_DELAY = 2
+
+# What endGame logs for each way a game can end for a node.
+RESULT_LINES = ["I WIN", "Someone else won:", "GAME OVER:"]
+
+def count_lines(path, text):
+    with open(path) as log_file:
+        return sum(1 for line in log_file if text in line)
+
+class VictoryOnceTest(common.TestCase):
+    def test_result_shown_once(self):
+        """Three players play out a game nobody steers, so several death
+        reports reach every node before the last player is left. Each node
+        should end the game and tell its UI the result exactly once, even
+        though the leader keeps repeating that the game is over, and at most
+        one of them should have won.
+        """
+        ms_srv = common.MatchMakingServer(
+            2222, flags=["-session-delay={}s".format(SESSION_DELAY)])
+        ms_srv.start()
+        time.sleep(2)
+
+        clients = common.start_multiple_clients(ms_srv.port, 3)
+
+        # Wait for the game to start, for players to reach the walls and for
+        # the leader to repeat the game over a few times.
+        common.sleep(SESSION_DELAY + 15)
+
+        wins = 0
+        for client in clients:
+            results = sum(count_lines(client.local_log_path, text)
+                          for text in RESULT_LINES)
+            self.assertEqual(results, 1,
+                             "Each node should show the result exactly once")
+            self.assertEqual(count_lines(client.local_log_path,
+                                         "-> finished"), 1,
+                             "Each node should finish the game exactly once")
+            wins += count_lines(client.local_log_path, "I WIN")
+        self.assertLessEqual(wins, 1, "At most one player can win")
+
+if __name__ == "__main__":
+    unittest.main()
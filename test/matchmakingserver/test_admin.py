@@ -0,0 +1,54 @@
+#!/usr/bin/env python2
+
+import json
+import os
+import sys
+import time
+import unittest
+import urllib2
+
+_HERE = os.path.dirname(os.path.abspath(__file__))
+sys.path.append(os.path.dirname(_HERE))
+
+import common
+
+ADMIN_PORT = 8000
+
+# Long enough that the room is still counting down when we look.
+SESSION_DELAY = 60
+
+def admin_get(path):
+    return urllib2.urlopen(
+        "http://localhost:{}{}".format(ADMIN_PORT, path)).read()
+
+class AdminTest(common.TestCase):
+    def test_admin_status(self):
+        """Two clients wait for a game on a server serving its admin page.
+        /status should report them waiting in one room that's still counting
+        down, like the Status RPC, and the page itself should be served.
+        """
+        ms_srv = common.MatchMakingServer(
+            2222, flags=["-admin=localhost:{}".format(ADMIN_PORT),
+                         "-session-delay={}s".format(SESSION_DELAY)])
+        ms_srv.start()
+        time.sleep(2)
+
+        common.start_multiple_clients(ms_srv.port, 2)
+        time.sleep(2)
+
+        status = json.loads(admin_get("/status"))
+        self.assertEqual(status["Waiting"], 2, "Both clients should be waiting")
+        self.assertEqual(status["Rooms"], {"0": 2},
+                         "Both clients should be in the one room")
+        self.assertEqual(len(status["Queued"]["0"]), 2,
+                         "Both clients should be listed in the room")
+        starts_in = status["StartsIn"]["0"] / 1e9
+        self.assertTrue(0 < starts_in < SESSION_DELAY,
+                        "The room should be counting down")
+        self.assertEqual(status["Playing"], 0, "No game should be playing")
+        self.assertEqual(status["GamesStarted"], 0, "No game should have started")
+
+        self.assertIn("<html>", admin_get("/"), "The admin page should be served")
+
+if __name__ == "__main__":
+    unittest.main()
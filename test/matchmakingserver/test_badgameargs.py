@@ -0,0 +1,47 @@
+#!/usr/bin/env python2
+
+import os
+import sys
+import time
+import unittest
+
+_HERE = os.path.dirname(os.path.abspath(__file__))
+sys.path.append(os.path.dirname(_HERE))
+
+import common
+
+# How long the matchmaking server waits for players before starting a game.
+SESSION_DELAY = 2
+
+def log_contains(path, text):
+    with open(path) as log_file:
+        return any(text in line for line in log_file)
+
+class BadGameArgsTest(common.TestCase):
+    def test_bad_game_args_not_sent(self):
+        """The server is told to start p1 off the board, so the args of c1
+        and c2's game are bad. It should refuse to start the game rather than
+        call either client's StartGame.
+        """
+        ms_srv = common.MatchMakingServer(
+            2222, flags=["-session-delay={}s".format(SESSION_DELAY),
+                         "-start-overrides=p1:12,0"])
+        ms_srv.start()
+        time.sleep(2)
+
+        clients = common.start_multiple_clients(ms_srv.port, 2)
+        common.sleep(SESSION_DELAY + 5)
+
+        self.assertTrue(log_contains(ms_srv.local_log_path,
+                                     "not starting a game with bad args"),
+                        "The server should have rejected the game's args")
+        self.assertFalse(log_contains(ms_srv.govector_log_path,
+                                      "Rpc Call NodeService.StartGame"),
+                         "The server shouldn't have started anyone's game")
+        for client in clients:
+            self.assertFalse(log_contains(client.local_log_path,
+                                          "Game starting -> running"),
+                             "No client should be playing")
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,106 @@
+#!/usr/bin/env python2
+
+import json
+import os
+import shutil
+import sys
+import tempfile
+import time
+import unittest
+import urllib2
+
+_HERE = os.path.dirname(os.path.abspath(__file__))
+sys.path.append(os.path.dirname(_HERE))
+
+import common
+
+# Long enough that no game starts, or room merges, while the test runs.
+SESSION_DELAY = 60
+
+# ann and ben are in the same 200 point bucket, cat is far from them.
+RATINGS = {"ann": 1500, "ben": 1500, "cat": 2500}
+
+CHAT_TEXT = "anyone up for a game?"
+
+def start_client(ms_srv_port, client_num, player):
+    client = common.Client(node_port=9999 - (client_num * 3),
+                           node_rpc_port=9998 - (client_num * 3),
+                           ms_port=ms_srv_port,
+                           http_srv_port=9997 - (client_num * 3),
+                           flags=["-player=" + player])
+    client.start()
+    time.sleep(0.5)
+    return client
+
+def post_chat(client, text):
+    request = urllib2.Request(
+        "http://localhost:{}/chat".format(client.http_srv_port),
+        json.dumps({"text": text}))
+    return urllib2.urlopen(request).getcode()
+
+def log_contains(path, text):
+    with open(path) as log_file:
+        return any(text in line for line in log_file)
+
+class ChatTest(common.TestCase):
+    def setUp(self):
+        super(ChatTest, self).setUp()
+        self._ratings_dir = tempfile.mkdtemp()
+        self._ratings = os.path.join(self._ratings_dir, "ratings.json")
+        with open(self._ratings, "w") as ratings_file:
+            json.dump(RATINGS, ratings_file)
+
+    def tearDown(self):
+        super(ChatTest, self).tearDown()
+        shutil.rmtree(self._ratings_dir)
+
+    def test_chat_stays_in_room(self):
+        """ann and ben wait in one room and cat in another. A line ann chats
+        should reach ben, but not cat, and not be echoed back to ann.
+        """
+        ms_srv = common.MatchMakingServer(
+            2222, flags=["-ratings=" + self._ratings,
+                         "-bucket-width=200",
+                         "-session-delay={}s".format(SESSION_DELAY)])
+        ms_srv.start()
+        time.sleep(2)
+
+        ann = start_client(ms_srv.port, 0, "ann")
+        ben = start_client(ms_srv.port, 1, "ben")
+        cat = start_client(ms_srv.port, 2, "cat")
+        # Wait for everyone to join.
+        common.sleep(5)
+
+        self.assertEqual(post_chat(ann, CHAT_TEXT), 204,
+                         "The MS server should have taken ann's line")
+        common.sleep(2)
+
+        received = "Chat from ann: " + CHAT_TEXT
+        self.assertTrue(log_contains(ben.local_log_path, received),
+                        "ben is in ann's room, so should get the line")
+        self.assertFalse(log_contains(cat.local_log_path, received),
+                         "cat is in another room, so shouldn't get the line")
+        self.assertFalse(log_contains(ann.local_log_path, received),
+                         "ann's own line shouldn't be sent back to them")
+        self.assertFalse(log_contains(ms_srv.local_log_path, "Rejected chat"),
+                         "ann's token should have found their room")
+
+    def test_chat_too_fast(self):
+        """A second line sent right after the first is turned away."""
+        ms_srv = common.MatchMakingServer(
+            2222, flags=["-session-delay={}s".format(SESSION_DELAY),
+                         "-chat-interval=10s"])
+        ms_srv.start()
+        time.sleep(2)
+
+        ann = start_client(ms_srv.port, 0, "ann")
+        start_client(ms_srv.port, 1, "ben")
+        common.sleep(5)
+
+        self.assertEqual(post_chat(ann, CHAT_TEXT), 204)
+        with self.assertRaises(urllib2.HTTPError) as context:
+            post_chat(ann, CHAT_TEXT)
+        self.assertEqual(context.exception.code, 400)
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,46 @@
+#!/usr/bin/env python2
+
+import os
+import sys
+import time
+import unittest
+
+_HERE = os.path.dirname(os.path.abspath(__file__))
+sys.path.append(os.path.dirname(_HERE))
+
+import common
+
+class GameResultTest(common.TestCase):
+    def test_game_result(self):
+        """c1 and c2 play a game nobody steers, so it ends quickly once they
+        run into walls. The leader should report the result to the matchmaking
+        server with both players in it.
+        """
+        ms_srv = common.MatchMakingServer(2222)
+        ms_srv.start()
+        time.sleep(2)
+
+        _ = common.start_multiple_clients(ms_srv.port, 2)
+
+        # Wait for the game to start, then for players to reach the walls.
+        common.sleep(common.MatchMakingServer.GAME_START_TIMEOUT + 10)
+
+        game_over_found = False
+        p1_found = False
+        p2_found = False
+        with open(ms_srv.local_log_path) as log_file:
+            for line in log_file:
+                if "Game over after" in line:
+                    game_over_found = True
+                elif "Result: p1" in line:
+                    p1_found = True
+                elif "Result: p2" in line:
+                    p2_found = True
+
+        self.assertTrue(game_over_found,
+                        "MS server should have received the game's result")
+        self.assertTrue(p1_found, "The result should include p1")
+        self.assertTrue(p2_found, "The result should include p2")
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,77 @@
+#!/usr/bin/env python2
+
+import json
+import os
+import shutil
+import sys
+import tempfile
+import time
+import unittest
+import urllib2
+
+_HERE = os.path.dirname(os.path.abspath(__file__))
+sys.path.append(os.path.dirname(_HERE))
+
+import common
+
+ADMIN_PORT = 8000
+
+# How long the matchmaking server waits for players before starting a game.
+SESSION_DELAY = 2
+
+def admin_get(path):
+    return urllib2.urlopen(
+        "http://localhost:{}{}".format(ADMIN_PORT, path)).read()
+
+class MatchHistoryTest(common.TestCase):
+    def setUp(self):
+        super(MatchHistoryTest, self).setUp()
+        self._history_dir = tempfile.mkdtemp()
+        self._history = os.path.join(self._history_dir, "history.jsonl")
+
+    def tearDown(self):
+        super(MatchHistoryTest, self).tearDown()
+        shutil.rmtree(self._history_dir)
+
+    def test_match_history(self):
+        """The history file already holds a game from before a restart. c1
+        and c2 then play a game nobody steers, so it ends quickly once they
+        run into walls. /matches should list both games, oldest first, and
+        the file should have gained the new one.
+        """
+        earlier = {"Winner": "p1", "WinnerName": "earlier", "Ticks": 42,
+                   "Players": [{"Id": "p1", "Name": "earlier"}]}
+        with open(self._history, "w") as history_file:
+            history_file.write(json.dumps(earlier) + "\n")
+
+        ms_srv = common.MatchMakingServer(
+            2222, flags=["-admin=localhost:{}".format(ADMIN_PORT),
+                         "-history=" + self._history,
+                         "-session-delay={}s".format(SESSION_DELAY)])
+        ms_srv.start()
+        time.sleep(2)
+
+        common.start_multiple_clients(ms_srv.port, 2)
+
+        # Wait for the game to start, then for players to reach the walls.
+        common.sleep(SESSION_DELAY + 20)
+
+        matches = json.loads(admin_get("/matches"))["Matches"]
+        self.assertEqual(len(matches), 2, "Both games should be listed")
+        self.assertEqual(matches[0]["WinnerName"], "earlier",
+                         "The game from before the restart should be first")
+        self.assertEqual(sorted(p["Id"] for p in matches[1]["Players"]),
+                         ["p1", "p2"], "The game played should be second")
+
+        latest = json.loads(admin_get("/matches?n=1"))["Matches"]
+        self.assertEqual(len(latest), 1, "n=1 should list one game")
+        self.assertEqual(latest[0]["Players"], matches[1]["Players"],
+                         "n=1 should list the game played")
+
+        with open(self._history) as history_file:
+            lines = [line for line in history_file if line.strip()]
+        self.assertEqual(len(lines), 2,
+                         "The game played should have been appended to the file")
+
+if __name__ == "__main__":
+    unittest.main()
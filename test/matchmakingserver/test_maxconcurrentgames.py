@@ -0,0 +1,81 @@
+#!/usr/bin/env python2
+
+import os
+import sys
+import time
+import unittest
+
+_HERE = os.path.dirname(os.path.abspath(__file__))
+sys.path.append(os.path.dirname(_HERE))
+
+import common
+
+# How long the matchmaking server waits for players before starting a game.
+SESSION_DELAY = 2
+
+def start_client(index, ms_srv_port):
+    """Starts a client on ports clear of those start_multiple_clients uses."""
+    base_port = 9900 - (index * 3)
+    client = common.Client(node_port=base_port,
+                           node_rpc_port=base_port - 1,
+                           ms_port=ms_srv_port,
+                           http_srv_port=base_port - 2)
+    client.start()
+    time.sleep(0.5)
+    return client
+
+class MaxConcurrentGamesTest(common.TestCase):
+    def test_max_concurrent_games(self):
+        """With one game allowed at a time, c1 and c2 start a game. c3 and c4
+        join while it's being played and should be turned away as the server
+        is busy. Once the game's result is in, c5 and c6 should get a game of
+        their own.
+        """
+        ms_srv = common.MatchMakingServer(
+            2222, flags=["-max-concurrent-games=1",
+                         "-session-delay={}s".format(SESSION_DELAY)])
+        ms_srv.start()
+        time.sleep(2)
+
+        _ = common.start_multiple_clients(ms_srv.port, 2)
+        common.sleep(SESSION_DELAY + 2)
+
+        c3 = start_client(0, ms_srv.port)
+        c4 = start_client(1, ms_srv.port)
+
+        # Wait for players to reach the walls and the result to come in.
+        common.sleep(10)
+
+        _ = start_client(2, ms_srv.port)
+        _ = start_client(3, ms_srv.port)
+        common.sleep(SESSION_DELAY + 2)
+
+        busy_count = 0
+        starts_before_result = 0
+        starts_after_result = 0
+        result_found = False
+        with open(ms_srv.local_log_path) as log_file:
+            for line in log_file:
+                if "server_busy" in line:
+                    busy_count += 1
+                elif "Game over after" in line:
+                    result_found = True
+                elif "Starting Game" in line and result_found:
+                    starts_after_result += 1
+                elif "Starting Game" in line:
+                    starts_before_result += 1
+
+        self.assertEqual(busy_count, 2,
+                         "c3 and c4 should be turned away while c1 and c2 play")
+        self.assertTrue(result_found,
+                        "MS server should have received the first game's result")
+        self.assertEqual(starts_before_result, 1,
+                         "Only one game should start before the result is in")
+        self.assertEqual(starts_after_result, 1,
+                         "c5 and c6 should start a game once the first is over")
+
+        c3.kill()
+        c4.kill()
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,64 @@
+#!/usr/bin/env python2
+
+import os
+import sys
+import time
+import unittest
+import urllib2
+
+_HERE = os.path.dirname(os.path.abspath(__file__))
+sys.path.append(os.path.dirname(_HERE))
+
+import common
+
+ADMIN_PORT = 8000
+
+# How long the matchmaking server waits for players before starting a game.
+SESSION_DELAY = 2
+
+def get_metrics():
+    """Returns the name, with labels, of each of the server's metrics : its
+    value.
+    """
+    text = urllib2.urlopen(
+        "http://localhost:{}/metrics".format(ADMIN_PORT)).read()
+    metrics = {}
+    for line in text.splitlines():
+        name, value = line.rsplit(" ", 1)
+        metrics[name] = float(value)
+    return metrics
+
+class MetricsTest(common.TestCase):
+    def test_metrics_reflect_results(self):
+        """c1 and c2 play a best-of-3 series p1 wins 2-0, as p2 starts heading
+        for the edge of the board, so the server gets two results of short
+        games. /metrics should count two wins, and both games in the duration
+        histogram.
+        """
+        ms_srv = common.MatchMakingServer(
+            2222, flags=["-admin=localhost:{}".format(ADMIN_PORT),
+                         "-session-delay={}s".format(SESSION_DELAY),
+                         "-best-of=3", "-start-overrides=p2:1,5:L"])
+        ms_srv.start()
+        time.sleep(2)
+
+        metrics = get_metrics()
+        self.assertEqual(metrics['game_duration_seconds_count'], 0,
+                         "No game should have finished yet")
+
+        common.start_multiple_clients(ms_srv.port, 2)
+        # Wait for both games and the break between them.
+        common.sleep(SESSION_DELAY + 25)
+
+        metrics = get_metrics()
+        self.assertEqual(metrics['games_total{outcome="win"}'], 2)
+        self.assertEqual(metrics['games_total{outcome="draw"}'], 0)
+        self.assertEqual(metrics['games_total{outcome="abandoned"}'], 0)
+        self.assertEqual(metrics['game_duration_seconds_count'], 2)
+        self.assertEqual(metrics['game_duration_seconds_bucket{le="60"}'], 2,
+                         "Both games should have taken under a minute")
+        self.assertEqual(metrics['game_duration_seconds_bucket{le="+Inf"}'], 2)
+        self.assertGreater(metrics['game_duration_seconds_sum'], 0)
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,58 @@
+#!/usr/bin/env python2
+
+import os
+import sys
+import time
+import unittest
+
+_HERE = os.path.dirname(os.path.abspath(__file__))
+sys.path.append(os.path.dirname(_HERE))
+
+import common
+
+# How long the matchmaking server waits for players before starting a game.
+SESSION_DELAY = 2
+
+def log_contains(path, text):
+    with open(path) as log_file:
+        return any(text in line for line in log_file)
+
+class MissedStartTest(common.TestCase):
+    def test_missed_start_is_pulled(self):
+        """c2 ignores the server's StartGame call, as if it were lost. It
+        should ask the server for its game's args while waiting, start the
+        game from them and play it with c1.
+        """
+        ms_srv = common.MatchMakingServer(
+            2222, flags=["-session-delay={}s".format(SESSION_DELAY)])
+        ms_srv.start()
+        time.sleep(2)
+
+        client1 = common.Client(node_port=9999, node_rpc_port=9998,
+                                ms_port=ms_srv.port, http_srv_port=9997)
+        client1.start()
+        time.sleep(0.5)
+        client2 = common.Client(node_port=9996, node_rpc_port=9995,
+                                ms_port=ms_srv.port, http_srv_port=9994,
+                                flags=["-sim-miss-start"])
+        client2.start()
+
+        # Wait for the game to start and c2 to have polled for it.
+        common.sleep(SESSION_DELAY + 8)
+
+        self.assertTrue(log_contains(client2.local_log_path,
+                                     "Simulating missing the ms server's StartGame"),
+                        "c2 should have ignored the StartGame call")
+        self.assertTrue(log_contains(ms_srv.local_log_path,
+                                     "Sending game args to"),
+                        "The server should have sent c2 its game's args")
+        self.assertTrue(log_contains(client2.local_log_path,
+                                     "Missed our game starting"),
+                        "c2 should have started the game it missed")
+        for client in (client1, client2):
+            self.assertTrue(log_contains(client.local_log_path,
+                                         "Game starting -> running"),
+                            "Both clients should be playing")
+
+if __name__ == "__main__":
+    unittest.main()
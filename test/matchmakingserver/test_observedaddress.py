@@ -0,0 +1,45 @@
+#!/usr/bin/env python2
+
+import os
+import sys
+import time
+import unittest
+
+_HERE = os.path.dirname(os.path.abspath(__file__))
+sys.path.append(os.path.dirname(_HERE))
+
+import common
+
+class ObservedAddressTest(common.TestCase):
+    def test_observed_address(self):
+        """c1 connects to the matchmaking server without saying which host it's
+        on. The matchmaking server should fill in the host it sees c1
+        connecting from.
+        """
+        ms_srv = common.MatchMakingServer(2222)
+        ms_srv.start()
+        time.sleep(2)
+
+        client = common.Client(node_port=9999, node_rpc_port=9998,
+                               ms_port=ms_srv.port, http_srv_port=9997,
+                               node_host="")
+        client.start()
+
+        # Wait for a while to make sure MS server logs that the client is
+        # connected.
+        time.sleep(5)
+
+        observed_address_found = False
+        with open(ms_srv.local_log_path) as log_file:
+            for line in log_file:
+                if "New node:" not in line:
+                    continue
+                if "127.0.0.1:9999" in line or "[::1]:9999" in line:
+                    observed_address_found = True
+
+        self.assertTrue(observed_address_found,
+                        ("MS server should have stored the address the client "
+                         "connected from"))
+
+if __name__ == "__main__":
+    unittest.main()
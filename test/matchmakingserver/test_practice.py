@@ -0,0 +1,90 @@
+#!/usr/bin/env python2
+
+import httplib
+import json
+import os
+import sys
+import time
+import unittest
+
+_HERE = os.path.dirname(os.path.abspath(__file__))
+sys.path.append(os.path.dirname(_HERE))
+
+import common
+
+# How long the matchmaking server waits for players before starting a game.
+SESSION_DELAY = 2
+
+# Few enough that p1 survives them heading for the wall nobody steers it away
+# from.
+PRACTICE_TICKS = 3
+
+# How long to wait for the game to end before failing.
+GAME_TIMEOUT = 30
+
+class PracticeTest(common.TestCase):
+    def test_practice_alone(self):
+        """c1 joins asking to practice, and nobody else does. Once the
+        countdown ends, c1 should play alone and win by surviving
+        PRACTICE_TICKS ticks.
+        """
+        ms_srv = common.MatchMakingServer(
+            2222, flags=["-session-delay={}s".format(SESSION_DELAY),
+                         "-practice-ticks={}".format(PRACTICE_TICKS)])
+        ms_srv.start()
+        time.sleep(2)
+
+        clients = common.start_multiple_clients(ms_srv.port, 1,
+                                                flags=["-practice"])
+        conn = httplib.HTTPConnection(
+            "localhost", clients[0].http_srv_port, timeout=GAME_TIMEOUT)
+        conn.request("GET", "/events")
+        # Read lines off the connection itself, since reading the chunked
+        # response waits for a full buffer. The chunk sizes come through as
+        # lines of their own, which are skipped like any other line.
+        stream = conn.getresponse().fp
+
+        kind = None
+        game_over = None
+        deadline = time.time() + GAME_TIMEOUT
+        while game_over is None and time.time() < deadline:
+            line = stream.readline().strip()
+            if line.startswith("event: "):
+                kind = line[len("event: "):]
+            elif line.startswith("data: ") and kind == "gameOver":
+                game_over = json.loads(line[len("data: "):])
+        conn.close()
+
+        self.assertIsNotNone(game_over, "c1's practice game should have ended")
+        self.assertEqual(game_over["winner"], "p1",
+                         "c1 should have won by surviving")
+
+        practice_found = False
+        with open(ms_srv.local_log_path) as log_file:
+            for line in log_file:
+                if "Starting practice game" in line:
+                    practice_found = True
+        self.assertTrue(practice_found,
+                        "MS server should have started a practice game")
+
+    def test_no_practice_without_asking(self):
+        """c1 joins without asking to practice, and nobody else does. No game
+        should start.
+        """
+        ms_srv = common.MatchMakingServer(
+            2222, flags=["-session-delay={}s".format(SESSION_DELAY)])
+        ms_srv.start()
+        time.sleep(2)
+
+        common.start_multiple_clients(ms_srv.port, 1)
+        common.sleep(SESSION_DELAY + 5)
+
+        with open(ms_srv.local_log_path) as log_file:
+            for line in log_file:
+                self.assertNotIn("Starting practice game", line,
+                                 "c1 didn't ask to practice")
+                self.assertNotIn("Starting Game", line,
+                                 "c1 can't play a game alone")
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,85 @@
+#!/usr/bin/env python2
+
+import os
+import sys
+import time
+import unittest
+
+_HERE = os.path.dirname(os.path.abspath(__file__))
+sys.path.append(os.path.dirname(_HERE))
+
+import common
+
+# How long the matchmaking server waits for players before starting a game.
+# Long enough for c2 to drop out and come back first.
+SESSION_DELAY = 8
+
+# How long c2 stops answering the matchmaking server for.
+DROP = 3
+
+def log_contains(path, text):
+    with open(path) as log_file:
+        return any(text in line for line in log_file)
+
+def start_clients(ms_srv, drop):
+    client1 = common.Client(node_port=9999, node_rpc_port=9998,
+                            ms_port=ms_srv.port, http_srv_port=9997)
+    client1.start()
+    time.sleep(0.5)
+    client2 = common.Client(node_port=9996, node_rpc_port=9995,
+                            ms_port=ms_srv.port, http_srv_port=9994,
+                            flags=["-sim-ms-drop={}s".format(drop)])
+    client2.start()
+    return client1, client2
+
+class ReconnectGraceTest(common.TestCase):
+    def test_rejoin_within_grace(self):
+        """c2 drops out for DROP seconds while waiting with c1, less than
+        the reconnect grace. It should take its place back with its token
+        and play the game with c1.
+        """
+        ms_srv = common.MatchMakingServer(
+            2222, flags=["-session-delay={}s".format(SESSION_DELAY),
+                         "-reconnect-grace={}s".format(DROP * 3)])
+        ms_srv.start()
+        time.sleep(2)
+
+        client1, client2 = start_clients(ms_srv, DROP)
+        common.sleep(SESSION_DELAY + 4)
+
+        self.assertTrue(log_contains(ms_srv.local_log_path,
+                                     "Waiting for localhost:9995 to reconnect"),
+                        "The server should have noticed c2 drop out")
+        self.assertFalse(log_contains(ms_srv.local_log_path, "Rejected rejoin"),
+                         "c2 shouldn't have been dropped from its room")
+        self.assertTrue(log_contains(ms_srv.local_log_path, "Rejoined node"),
+                        "c2 should have taken its place back")
+        self.assertTrue(log_contains(client2.local_log_path,
+                                     "Rejoin status: queued"),
+                        "c2 should have been told it's back in its room")
+        for client in (client1, client2):
+            self.assertTrue(log_contains(client.local_log_path,
+                                         "Game starting -> running"),
+                            "Both clients should be playing")
+
+    def test_rejoin_after_grace(self):
+        """c2 drops out for a few times the reconnect grace. Its place should
+        be gone when it comes back, so it joins afresh.
+        """
+        ms_srv = common.MatchMakingServer(
+            2222, flags=["-session-delay={}s".format(SESSION_DELAY),
+                         "-reconnect-grace=1s"])
+        ms_srv.start()
+        time.sleep(2)
+
+        client1, client2 = start_clients(ms_srv, DROP * 2)
+        common.sleep(DROP * 2 + 3)
+
+        self.assertTrue(log_contains(ms_srv.local_log_path, "Rejected rejoin"),
+                        "c2 should have been dropped from its room")
+        self.assertTrue(log_contains(client2.local_log_path,
+                                     "Rejoin status: unknown_token"),
+                        "c2's token should no longer be known")
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,56 @@
+#!/usr/bin/env python2
+
+import os
+import sys
+import time
+import unittest
+
+_HERE = os.path.dirname(os.path.abspath(__file__))
+sys.path.append(os.path.dirname(_HERE))
+
+import common
+
+# How long the matchmaking server waits for players before starting a game.
+SESSION_DELAY = 2
+
+def count_lines(path, text):
+    with open(path) as log_file:
+        return sum(1 for line in log_file if text in line)
+
+class SeriesTest(common.TestCase):
+    def test_best_of_three_ends_two_nil(self):
+        """c1 and c2 play a best-of-3 series. p2 starts next to the edge of the
+        board heading for it, so p1 wins every game. Once p1 has won 2, the
+        series should be over, with p1 its champion, and no third game should
+        start.
+        """
+        ms_srv = common.MatchMakingServer(
+            2222, flags=["-session-delay={}s".format(SESSION_DELAY),
+                         "-best-of=3", "-start-overrides=p2:1,5:L"])
+        ms_srv.start()
+        time.sleep(2)
+
+        clients = common.start_multiple_clients(ms_srv.port, 2)
+        leader = clients[0]
+
+        # Wait for two games and the breaks after them, which is long enough
+        # for a third game to start if the series wrongly went on.
+        common.sleep(SESSION_DELAY + 30)
+
+        self.assertEqual(count_lines(ms_srv.local_log_path, "Game over after"),
+                         2, "The server should have had two results")
+        self.assertEqual(count_lines(ms_srv.local_log_path,
+                                     "Series over after 2 games, champion: p1"),
+                         1, "p1 should have won the series 2-0")
+        for client in clients:
+            self.assertEqual(count_lines(client.local_log_path,
+                                         "Starting game with nodes"), 2,
+                             "Each node should have played exactly two games")
+        self.assertEqual(count_lines(leader.local_log_path, "I WIN"), 2,
+                         "p1 should have won both games")
+        self.assertEqual(count_lines(leader.local_log_path,
+                                     "Best of 3: p1 1, p2 0"), 1,
+                         "The second game should start with p1 a game up")
+
+if __name__ == "__main__":
+    unittest.main()
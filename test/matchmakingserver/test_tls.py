@@ -0,0 +1,85 @@
+#!/usr/bin/env python2
+
+import os
+import shutil
+import subprocess
+import sys
+import tempfile
+import time
+import unittest
+
+_HERE = os.path.dirname(os.path.abspath(__file__))
+sys.path.append(os.path.dirname(_HERE))
+
+import common
+
+def make_self_signed_cert(directory):
+    """Writes a self-signed certificate for localhost and its key to
+    |directory|, returning their paths.
+    """
+    cert_path = os.path.join(directory, "cert.pem")
+    key_path = os.path.join(directory, "key.pem")
+    with open(os.devnull, "w") as dev_null:
+        subprocess.check_call([
+            "openssl", "req", "-x509", "-newkey", "rsa:2048", "-nodes",
+            "-keyout", key_path, "-out", cert_path, "-days", "1",
+            "-subj", "/CN=localhost",
+            "-addext", "subjectAltName=DNS:localhost",
+        ], stdout=dev_null, stderr=dev_null)
+    return cert_path, key_path
+
+def count_joins(ms_srv):
+    joins = 0
+    with open(ms_srv.local_log_path) as log_file:
+        for line in log_file:
+            if "New node:" in line:
+                joins += 1
+    return joins
+
+class TLSTest(common.TestCase):
+    def setUp(self):
+        super(TLSTest, self).setUp()
+        self._cert_dir = tempfile.mkdtemp()
+        self._cert, self._key = make_self_signed_cert(self._cert_dir)
+
+    def tearDown(self):
+        super(TLSTest, self).tearDown()
+        shutil.rmtree(self._cert_dir)
+
+    def test_tls_join(self):
+        """The MS server serves over TLS. c1 reaches it over TLS and joins."""
+        ms_srv = common.MatchMakingServer(
+            2222, flags=["-tls-cert=" + self._cert, "-tls-key=" + self._key])
+        ms_srv.start()
+        time.sleep(2)
+
+        clients = common.start_multiple_clients(
+            ms_srv.port, 1, flags=["-ms-tls-ca=" + self._cert])
+        time.sleep(5)
+
+        self.assertTrue(clients[0].is_running(), "c1 should have joined")
+        self.assertEqual(count_joins(ms_srv), 1,
+                         "c1 should have joined over TLS")
+
+    def test_plaintext_refused(self):
+        """The MS server serves over TLS. c1 doesn't use TLS, so it can't join.
+        It keeps running so its UI can try again.
+        """
+        ms_srv = common.MatchMakingServer(
+            2222, flags=["-tls-cert=" + self._cert, "-tls-key=" + self._key])
+        ms_srv.start()
+        time.sleep(2)
+
+        clients = common.start_multiple_clients(ms_srv.port, 1)
+        time.sleep(5)
+
+        self.assertTrue(clients[0].is_running(),
+                        "c1 should still be running after failing to join")
+        with open(clients[0].local_log_path) as log_file:
+            self.assertIn("failed to join matchmaking server", log_file.read(),
+                          "c1 should have failed to join")
+        self.assertEqual(count_joins(ms_srv), 0,
+                         "Nobody should have joined without TLS")
+
+if __name__ == "__main__":
+    unittest.main()
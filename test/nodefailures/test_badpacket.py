@@ -0,0 +1,54 @@
+#!/usr/bin/env python2
+
+import os
+import socket
+import sys
+import unittest
+import urllib2
+
+_HERE = os.path.dirname(os.path.abspath(__file__))
+sys.path.append(os.path.dirname(_HERE))
+
+import common
+
+class BadPacketTest(common.TestCase):
+    def test_bad_packet(self):
+        """Two clients start a game. A malformed, unauthenticated packet is
+        sent to client 1, which should log, count and drop it rather than
+        exiting.
+        """
+        ms_srv = common.MatchMakingServer(2222)
+        ms_srv.start()
+        common.sleep(2)
+
+        clients = common.start_multiple_clients(ms_srv.port, 2)
+
+        # Wait for the game to start so the client is listening for packets.
+        common.sleep(common.MatchMakingServer.GAME_START_TIMEOUT * 1.1)
+
+        client1 = clients[0]
+        sock = socket.socket(socket.AF_INET, socket.SOCK_DGRAM)
+        sock.sendto("this is not json", ("localhost", client1.node_port))
+        sock.close()
+        common.sleep(2)
+
+        self.assertTrue(client1.is_running(),
+                        "Client should survive receiving a malformed packet")
+
+        found_drop_msg = False
+        with open(client1.local_log_path) as log_file:
+            for line in log_file:
+                if "Dropping unauthenticated packet" in line:
+                    found_drop_msg = True
+                    break
+        self.assertTrue(found_drop_msg,
+                        "Client should log that it dropped the bad packet")
+
+        metrics = urllib2.urlopen(
+            "http://localhost:{}/metrics".format(client1.http_srv_port)).read()
+        counters = dict(line.split() for line in metrics.splitlines())
+        self.assertGreaterEqual(int(counters["packets_rejected_total"]), 1,
+                                "Client should count the bad packet")
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,59 @@
+#!/usr/bin/env python2
+
+import os
+import sys
+import time
+import unittest
+
+_HERE = os.path.dirname(os.path.abspath(__file__))
+sys.path.append(os.path.dirname(_HERE))
+
+import common
+
+# How long the matchmaking server waits for players before starting a game.
+SESSION_DELAY = 2
+
+# Longer than the leader's catchUpAfter, shorter than it takes to decide a
+# node has failed.
+PAUSE = 4
+
+def log_contains(path, text):
+    with open(path) as log_file:
+        return any(text in line for line in log_file)
+
+class CatchUpTest(common.TestCase):
+    def test_catch_up_after_stall(self):
+        """c1 leads a game with c2 and c3. c2 stalls for PAUSE seconds, then
+        carries on. The leader should send c2, and only c2, its board, which
+        c2 should adopt.
+        """
+        # Players survive running into walls, so the game outlasts the test.
+        ms_srv = common.MatchMakingServer(
+            2222, flags=["-session-delay={}s".format(SESSION_DELAY),
+                         "-spawn-protection=1000"])
+        ms_srv.start()
+        time.sleep(2)
+
+        clients = common.start_multiple_clients(ms_srv.port, 3)
+        leader, client2, client3 = clients
+        # Wait for the game to start.
+        common.sleep(SESSION_DELAY + 5)
+
+        client2.pause()
+        common.sleep(PAUSE)
+        client2.resume()
+        common.sleep(3)
+
+        self.assertTrue(log_contains(leader.local_log_path, "catching it up"),
+                        "The leader should have caught up c2")
+        self.assertFalse(log_contains(leader.local_log_path, "p2  HAS FAILED"),
+                         "c2 shouldn't have been dropped as failed")
+        self.assertTrue(log_contains(client2.local_log_path,
+                                     "Caught up with the leader's board"),
+                        "c2 should have adopted the leader's board")
+        self.assertFalse(log_contains(client3.local_log_path,
+                                      "Caught up with the leader's board"),
+                         "Only c2 should have been sent the leader's board")
+
+if __name__ == "__main__":
+    unittest.main()
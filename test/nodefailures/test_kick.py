@@ -0,0 +1,103 @@
+#!/usr/bin/env python2
+
+import os
+import socket
+import sys
+import time
+import unittest
+
+_HERE = os.path.dirname(os.path.abspath(__file__))
+sys.path.append(os.path.dirname(_HERE))
+
+import common
+
+# How long the matchmaking server waits for players before starting a game.
+SESSION_DELAY = 2
+
+# Rejected packets before the leader kicks a peer.
+KICK_AFTER = 5
+
+def log_contains(path, text):
+    with open(path) as log_file:
+        return any(text in line for line in log_file)
+
+def log_count(path, text):
+    with open(path) as log_file:
+        return sum(1 for line in log_file if text in line)
+
+def start_clients(ms_srv, bad_packets):
+    """Starts c1, c2 and c3, c2 sending the leader bad_packets packets it has
+    to reject once the game runs.
+    """
+    clients = []
+    for i in range(3):
+        flags = []
+        if i == 1:
+            flags = ["-sim-bad-packets={}".format(bad_packets)]
+        clients.append(common.Client(node_port=9999 - 3 * i,
+                                     node_rpc_port=9998 - 3 * i,
+                                     ms_port=ms_srv.port,
+                                     http_srv_port=9997 - 3 * i,
+                                     flags=flags))
+        clients[-1].start()
+        time.sleep(0.5)
+    return clients
+
+class KickTest(common.TestCase):
+    def start_ms(self):
+        # Players survive running into walls, so the game outlasts the test.
+        ms_srv = common.MatchMakingServer(
+            2222, flags=["-session-delay={}s".format(SESSION_DELAY),
+                         "-kick-after={}".format(KICK_AFTER),
+                         "-spawn-protection=1000"])
+        ms_srv.start()
+        time.sleep(2)
+        return ms_srv
+
+    def test_kick_after_bad_packets(self):
+        """c1 leads a game with c2 and c3, and c2 sends it KICK_AFTER packets
+        without a location. c1 should kick c2 once it has rejected them all,
+        and tell c3 that c2 is dead.
+        """
+        ms_srv = self.start_ms()
+        leader, client2, client3 = start_clients(ms_srv, KICK_AFTER)
+        # Wait for the game to start and c2 to send its packets.
+        common.sleep(SESSION_DELAY + 7)
+
+        self.assertTrue(log_contains(leader.local_log_path, "KICKING NODE p2"),
+                        "The leader should have kicked c2")
+        self.assertTrue(log_contains(client3.local_log_path,
+                                     "LEADER SENT:  p2  IS DEAD"),
+                        "c3 should have heard that c2 is dead")
+
+    def test_no_kick_for_forged_packets(self):
+        """c2 sends c1, the leader, one packet short of being kicked, then is
+        replaced by something sending unauthenticated packets from its
+        address. Those could come from anyone, so c1 shouldn't hold them
+        against c2.
+        """
+        ms_srv = self.start_ms()
+        leader, client2, client3 = start_clients(ms_srv, KICK_AFTER - 1)
+        # Wait for the game to start and c2 to send its packets.
+        common.sleep(SESSION_DELAY + 7)
+        self.assertEqual(log_count(leader.local_log_path,
+                                   "Dropping packet without a location"),
+                         KICK_AFTER - 1,
+                         "The leader should have rejected c2's packets")
+
+        client2.kill()
+        sock = socket.socket(socket.AF_INET, socket.SOCK_DGRAM)
+        sock.bind(("localhost", client2.node_port))
+        for _ in range(KICK_AFTER):
+            sock.sendto("not signed", ("localhost", leader.node_port))
+        sock.close()
+        common.sleep(1)
+
+        self.assertTrue(log_contains(leader.local_log_path,
+                                     "Dropping unauthenticated packet"),
+                        "The leader should have dropped the forged packets")
+        self.assertFalse(log_contains(leader.local_log_path, "KICKING NODE"),
+                         "c2 shouldn't be kicked for packets anyone could send")
+
+if __name__ == "__main__":
+    unittest.main()
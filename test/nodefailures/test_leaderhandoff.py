@@ -0,0 +1,71 @@
+#!/usr/bin/env python2
+
+import os
+import sys
+import unittest
+
+_HERE = os.path.dirname(os.path.abspath(__file__))
+sys.path.append(os.path.dirname(_HERE))
+
+import common
+
+# How long the matchmaking server waits for players before starting a game.
+SESSION_DELAY = 4
+
+class LeaderHandoffTest(common.TestCase):
+    def test_leader_handoff(self):
+        """A leader client (1) is started followed by two normal clients (2, 3).
+        The leader leaves cleanly. 2 should be named the successor and take over
+        right away, without waiting to detect the leader's failure.
+        """
+        # Players survive running into walls, so the game outlasts the test.
+        ms_srv = common.MatchMakingServer(
+            2222, flags=["-session-delay={}s".format(SESSION_DELAY),
+                         "-spawn-protection=1000"])
+        ms_srv.start()
+        common.sleep(2)
+
+        clients = common.start_multiple_clients(ms_srv.port, 3)
+
+        # Wait for the game to start.
+        common.sleep(SESSION_DELAY + 1)
+
+        leader = clients[0]
+        leader.interrupt()
+
+        # Less than the failure detection threshold, so only a handoff could
+        # have made 2 the leader by now.
+        common.sleep(3)
+
+        client2 = clients[1]
+        with open(client2.local_log_path) as log_file:
+            found_handoff_msg = False
+            found_leader_msg = False
+            for line in log_file:
+                if "new leader is p2" in line:
+                    found_handoff_msg = True
+                elif found_handoff_msg and common.line_indicates_leader(line):
+                    found_leader_msg = True
+            self.assertTrue(found_handoff_msg,
+                            "Client 2 should have accepted the handoff")
+            self.assertTrue(found_leader_msg,
+                            "Client 2 should become the leader")
+
+        client3 = clients[2]
+        with open(client3.local_log_path) as log_file:
+            found_handoff_msg = False
+            found_leader_msg = False
+            for line in log_file:
+                if "new leader is p2" in line:
+                    found_handoff_msg = True
+                elif common.line_indicates_leader(line):
+                    found_leader_msg = True
+            self.assertTrue(found_handoff_msg,
+                            "Client 3 should have accepted the handoff")
+            self.assertFalse(found_leader_msg,
+                             "Client 3 should stay as a normal node")
+
+if __name__ == "__main__":
+    print "Warning: this test case is fragile and requires precise timing."
+    print "It may fail even if the implementation being tested is working."
+    unittest.main()
@@ -9,21 +9,26 @@ sys.path.append(os.path.dirname(_HERE))
 
 import common
 
+# How long the matchmaking server waits for players before starting a game.
+SESSION_DELAY = 4
+
 class LeaderThenClientFailureTest(common.TestCase):
     def test_leader_then_client_failure(self):
         """A leader client (1) is started followed by three normal clients
         (2, 3, 4).The leader client fails followed by 2 failing. 3 should become
         the new leader, and 4 should stay as a client.
         """
-        ms_srv = common.MatchMakingServer(2222)
+        # Players survive running into walls, so the game outlasts the test.
+        ms_srv = common.MatchMakingServer(
+            2222, flags=["-session-delay={}s".format(SESSION_DELAY),
+                         "-spawn-protection=1000"])
         ms_srv.start()
         common.sleep(2)
 
         clients = common.start_multiple_clients(ms_srv.port, 4)
 
-        # XXX: This sleep is rather fragile because we need to resume after
-        #      the MS has started the game, but before the game has ended.
-        common.sleep(common.MatchMakingServer.GAME_START_TIMEOUT * 0.825)
+        # Wait for the game to start.
+        common.sleep(SESSION_DELAY - 1)
 
         # Kill leader and client 2.
         common.sleep(2)
@@ -32,8 +37,10 @@ class LeaderThenClientFailureTest(common.TestCase):
         client2 = clients[1]
         client2.kill()
 
-        # Wait for leader re-election to occur.
-        common.sleep(8)
+        # Wait for leader re-election to occur: the 7s failure threshold, up to
+        # a second for the next check to notice, and a second for the new
+        # leader's next check to log it.
+        common.sleep(10)
 
         client3 = clients[2]
         with open(client3.local_log_path) as log_file:
@@ -0,0 +1,63 @@
+#!/usr/bin/env python2
+
+import os
+import sys
+import unittest
+import urllib2
+
+_HERE = os.path.dirname(os.path.abspath(__file__))
+sys.path.append(os.path.dirname(_HERE))
+
+import common
+
+def peer_counters(client):
+    """Returns {peer address: {counter name: value}} from the client's
+    /metrics.
+    """
+    metrics = urllib2.urlopen(
+        "http://localhost:{}/metrics".format(client.http_srv_port)).read()
+    peers = {}
+    for line in metrics.splitlines():
+        name, value = line.split()
+        if not name.startswith("peer_"):
+            continue
+        name, label = name.rstrip("}").split("{")
+        peer = label.split("=", 1)[1].strip('"')
+        peers.setdefault(peer, {})[name] = int(value)
+    return peers
+
+class PeerTrafficTest(common.TestCase):
+    def test_peer_traffic(self):
+        """Two clients play a game for a few seconds. Each should count the
+        packets and bytes it exchanged with the other, and when it last heard
+        from it.
+        """
+        ms_srv = common.MatchMakingServer(2222)
+        ms_srv.start()
+        common.sleep(2)
+
+        clients = common.start_multiple_clients(ms_srv.port, 2)
+        common.sleep(common.MatchMakingServer.GAME_START_TIMEOUT * 1.1)
+
+        for client in clients:
+            # The peer may be counted under more than one address, e.g. if it
+            # sends from a different one than it advertised, so add them up.
+            counters = {}
+            for peer in peer_counters(client).values():
+                for name, value in peer.items():
+                    counters[name] = counters.get(name, 0) + value
+            for name in ["peer_packets_sent_total",
+                         "peer_packets_received_total"]:
+                self.assertGreaterEqual(counters.get(name, 0), 1,
+                                        name + " should count the traffic")
+            self.assertGreater(counters["peer_bytes_sent_total"],
+                               counters["peer_packets_sent_total"],
+                               "Every packet sent should be counted in bytes")
+            self.assertGreater(counters["peer_bytes_received_total"],
+                               counters["peer_packets_received_total"],
+                               "Every packet received should be counted in bytes")
+            self.assertIn("peer_last_seen_seconds", counters,
+                          "Client should note when it last heard from its peer")
+
+if __name__ == "__main__":
+    unittest.main()
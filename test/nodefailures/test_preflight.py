@@ -0,0 +1,43 @@
+#!/usr/bin/env python2
+
+import os
+import socket
+import sys
+import unittest
+
+_HERE = os.path.dirname(os.path.abspath(__file__))
+sys.path.append(os.path.dirname(_HERE))
+
+import common
+
+class PreflightTest(common.TestCase):
+    def test_unbindable_peer_port(self):
+        """c1's peer port is already taken when it starts. It should report
+        that in its preflight check and exit before joining a game.
+        """
+        ms_srv = common.MatchMakingServer(2222)
+        ms_srv.start()
+        common.sleep(2)
+
+        taken = socket.socket(socket.AF_INET, socket.SOCK_DGRAM)
+        taken.bind(("localhost", 9999))
+        try:
+            clients = common.start_multiple_clients(ms_srv.port, 1)
+            common.sleep(3)
+            self.assertFalse(clients[0].is_running(),
+                             "Client should exit when it can't bind its port")
+        finally:
+            taken.close()
+
+        found_preflight_msg = False
+        with open(clients[0].local_log_path) as log_file:
+            for line in log_file:
+                if ("preflight failed" in line and
+                        "can't bind peer address" in line):
+                    found_preflight_msg = True
+                    break
+        self.assertTrue(found_preflight_msg,
+                        "Client should report the port in its preflight check")
+
+if __name__ == "__main__":
+    unittest.main()
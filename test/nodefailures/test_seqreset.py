@@ -0,0 +1,74 @@
+#!/usr/bin/env python2
+
+import os
+import sys
+import time
+import unittest
+import urllib2
+
+_HERE = os.path.dirname(os.path.abspath(__file__))
+sys.path.append(os.path.dirname(_HERE))
+
+import common
+
+# How long the matchmaking server waits for players before starting a game.
+SESSION_DELAY = 2
+
+# How long into the game c2 numbers its messages over.
+SEQ_RESET = 4
+
+def lines_after(path, text):
+    """Returns the lines of a log after the first containing text, or None
+    if none does.
+    """
+    with open(path) as log_file:
+        lines = log_file.readlines()
+    for i, line in enumerate(lines):
+        if text in line:
+            return lines[i + 1:]
+    return None
+
+class SeqResetTest(common.TestCase):
+    def test_reset_sequence_accepted(self):
+        """c2 starts numbering its messages from 1 again partway into a game
+        with c1, as if it had restarted. c1 should start over with c2's
+        sequence numbers rather than drop its messages as duplicates, and
+        carry on applying them.
+        """
+        # Players survive running into walls, so the game outlasts the test.
+        ms_srv = common.MatchMakingServer(
+            2222, flags=["-session-delay={}s".format(SESSION_DELAY),
+                         "-spawn-protection=1000"])
+        ms_srv.start()
+        time.sleep(2)
+
+        client1 = common.Client(node_port=9999, node_rpc_port=9998,
+                                ms_port=ms_srv.port, http_srv_port=9997)
+        client1.start()
+        time.sleep(0.5)
+        client2 = common.Client(node_port=9996, node_rpc_port=9995,
+                                ms_port=ms_srv.port, http_srv_port=9994,
+                                flags=["-sim-seq-reset={}s".format(SEQ_RESET)])
+        client2.start()
+
+        # Wait for the game to start, c2 to reset and c1 to hear from it.
+        common.sleep(SESSION_DELAY + SEQ_RESET + 6)
+
+        after = lines_after(client1.local_log_path,
+                            "started its sequence numbers over")
+        self.assertIsNotNone(after, "c1 should have seen c2's new epoch")
+        self.assertTrue(any("Received: Id: p2" in line for line in after),
+                        "c1 should have taken c2's messages after the reset")
+        self.assertFalse(any("Dropping duplicate or stale packet" in line
+                             for line in after),
+                         "c1 shouldn't have dropped c2's new messages")
+
+        metrics = urllib2.urlopen(
+            "http://localhost:{}/metrics".format(client1.http_srv_port)).read()
+        counters = dict(line.split()[:2] for line in metrics.splitlines()
+                        if not line.startswith("#"))
+        self.assertEqual(int(counters["packets_duplicate_total"]), 0,
+                         "None of c2's messages should look like duplicates")
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,102 @@
+#!/usr/bin/env python2
+
+import json
+import os
+import shutil
+import struct
+import subprocess
+import sys
+import tempfile
+import unittest
+import zlib
+
+_HERE = os.path.dirname(os.path.abspath(__file__))
+sys.path.append(os.path.dirname(_HERE))
+
+import common
+
+REPLAY_BIN = os.path.join(common.REPLAY_DIR, "Replay")
+
+# Width and height of a board cell in pixels, as Replay draws them.
+CELL_SIZE = 20
+
+# Two players, each with a head at the end of a trail.
+BOARD = [["t1", "t1", "p1"],
+         ["t2", "t2", "p2"]]
+
+def read_png(path):
+    """Returns the rows of pixels of a paletted PNG as (r, g, b) tuples."""
+    with open(path, "rb") as png_file:
+        data = png_file.read()
+    palette = []
+    compressed = ""
+    pos = 8 # Past the signature.
+    while pos < len(data):
+        length, kind = struct.unpack(">I4s", data[pos:pos + 8])
+        body = data[pos + 8:pos + 8 + length]
+        if kind == "IHDR":
+            width, height, depth, colour_type = struct.unpack(">IIBB", body[:10])
+        elif kind == "PLTE":
+            palette = [struct.unpack("BBB", body[i:i + 3])
+                       for i in range(0, length, 3)]
+        elif kind == "IDAT":
+            compressed += body
+        pos += 12 + length # Length, kind, body and CRC.
+    assert depth == 8 and colour_type == 3, "Expected an 8 bit paletted PNG"
+
+    raw = zlib.decompress(compressed)
+    rows = []
+    for y in range(height):
+        row = raw[y * (width + 1):(y + 1) * (width + 1)]
+        # Paletted images aren't filtered.
+        assert row[0] == "\x00", "Expected unfiltered rows"
+        rows.append([palette[ord(index)] for index in row[1:]])
+    return rows
+
+def cell_colour(pixels, x, y):
+    return pixels[y * CELL_SIZE + CELL_SIZE / 2][x * CELL_SIZE + CELL_SIZE / 2]
+
+class TrailColoursTest(unittest.TestCase):
+    def setUp(self):
+        self.dir = tempfile.mkdtemp()
+        self.replay_path = os.path.join(self.dir, "replay.jsonl")
+        with open(self.replay_path, "w") as replay_file:
+            json.dump({"Tick": 1, "Board": BOARD,
+                       "Colours": {"p1": "#ff0000", "p2": "#0000ff"}},
+                      replay_file)
+            replay_file.write("\n")
+
+    def tearDown(self):
+        shutil.rmtree(self.dir)
+
+    def export_png(self, flags=None):
+        png_path = os.path.join(self.dir, "board.png")
+        subprocess.check_call([REPLAY_BIN] + (flags or []) +
+                              ["png", self.replay_path, png_path])
+        return read_png(png_path)
+
+    def test_trails_coloured_by_owner(self):
+        """Each player's trail should be drawn in its own colour, fainter than
+        their head but not the background.
+        """
+        pixels = self.export_png()
+        trail1, head1 = cell_colour(pixels, 0, 0), cell_colour(pixels, 2, 0)
+        trail2, head2 = cell_colour(pixels, 0, 1), cell_colour(pixels, 2, 1)
+
+        self.assertEqual(head1, (0xff, 0, 0), "p1's head should be its colour")
+        self.assertEqual(head2, (0, 0, 0xff), "p2's head should be its colour")
+        self.assertNotEqual(trail1, trail2,
+                            "The players' trails should differ in colour")
+        for trail, head in ((trail1, head1), (trail2, head2)):
+            self.assertNotEqual(trail, head)
+            self.assertNotEqual(trail, (0xff, 0xff, 0xff))
+        self.assertEqual(cell_colour(pixels, 1, 0), trail1,
+                         "A trail should be one colour throughout")
+
+    def test_plain_trails(self):
+        """With -trails=plain, both trails should be the same colour."""
+        pixels = self.export_png(["-trails=plain"])
+        self.assertEqual(cell_colour(pixels, 0, 0), cell_colour(pixels, 0, 1))
+
+if __name__ == "__main__":
+    unittest.main()